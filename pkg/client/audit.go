@@ -0,0 +1,81 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// AuditEntry is a change of a movie, favourite or user. Changes has the
+// fields that changed with their values before and after it.
+type AuditEntry struct {
+	ID        uint                   `json:"ID"`
+	CreatedAt time.Time              `json:"CreatedAt"`
+	ActorID   *uint                  `json:"ActorID"`
+	RequestID string                 `json:"RequestID"`
+	IP        string                 `json:"IP"`
+	Action    string                 `json:"Action"`
+	Entity    string                 `json:"Entity"`
+	EntityID  uint                   `json:"EntityID"`
+	Changes   map[string]AuditChange `json:"Changes"`
+}
+
+type AuditChange struct {
+	Before json.RawMessage `json:"before"`
+	After  json.RawMessage `json:"after"`
+}
+
+// AuditFilter selects the entries of the audit log. Zero fields do not filter.
+type AuditFilter struct {
+	Entity   string
+	EntityID int
+	ActorID  int
+	From     time.Time
+	To       time.Time
+}
+
+func (f AuditFilter) query() url.Values {
+	query := url.Values{}
+	if f.Entity != "" {
+		query.Set("entity", f.Entity)
+	}
+	if f.EntityID > 0 {
+		query.Set("entity_id", strconv.Itoa(f.EntityID))
+	}
+	if f.ActorID > 0 {
+		query.Set("actor", strconv.Itoa(f.ActorID))
+	}
+	if !f.From.IsZero() {
+		query.Set("from", f.From.Format(time.RFC3339))
+	}
+	if !f.To.IsZero() {
+		query.Set("to", f.To.Format(time.RFC3339))
+	}
+
+	return query
+}
+
+// AuditLog returns one page (starting at 1) of the audit log, newest first,
+// and the total number of matching entries. Only admins can read it.
+func (c *Client) AuditLog(ctx context.Context, filter AuditFilter, page, pageSize int) ([]AuditEntry, int, error) {
+	req, err := jsonRequest(http.MethodGet, "/admin/audit", nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	req.query = filter.query()
+	req.query.Set("page", strconv.Itoa(page))
+	req.query.Set("page_size", strconv.Itoa(pageSize))
+
+	var entries []AuditEntry
+	res, err := c.do(ctx, req, &entries)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	total, _ := strconv.Atoi(res.Header.Get("X-Total-Count"))
+
+	return entries, total, nil
+}
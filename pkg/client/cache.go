@@ -0,0 +1,37 @@
+package client
+
+import (
+	"context"
+	"net/http"
+)
+
+// CacheStats are the counters of a cache of the API since it started
+type CacheStats struct {
+	Hits      uint64  `json:"Hits"`
+	Misses    uint64  `json:"Misses"`
+	Evictions uint64  `json:"Evictions"`
+	Size      int     `json:"Size"`
+	HitRate   float64 `json:"HitRate"`
+}
+
+// Caches are the counters of the caches of the instance that answered
+type Caches struct {
+	Users    CacheStats `json:"Users"`
+	Sessions CacheStats `json:"Sessions"`
+	Movies   CacheStats `json:"Movies"`
+}
+
+// CacheStats returns the counters of the caches (admins only)
+func (c *Client) CacheStats(ctx context.Context) (*Caches, error) {
+	req, err := jsonRequest(http.MethodGet, "/admin/cache", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var caches Caches
+	if _, err := c.do(ctx, req, &caches); err != nil {
+		return nil, err
+	}
+
+	return &caches, nil
+}
@@ -0,0 +1,297 @@
+// Package client is a Go client for the films API.
+//
+// A Client logs in with the given credentials on the first call that needs
+// authentication, refreshes the access token before it expires and logs in
+// again (retrying the call once) if the API rejects it:
+//
+//	c := client.New("http://localhost:4000", client.WithCredentials("bob", "Secret.password1"))
+//	movies, err := c.Movies(ctx, client.MovieFilter{Genre: "Crime"})
+//
+// Errors returned by the API are mapped to the sentinel errors of the models
+// package, so they can be checked with errors.Is:
+//
+//	_, err := c.Movie(ctx, 42)
+//	if errors.Is(err, models.ErrNoRecord) { ... }
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Tokens are refreshed when they are about to expire in less than this
+const refreshMargin = 5 * time.Minute
+
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+
+	name     string
+	password string
+
+	// Accept-Language of the requests
+	language string
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+type Option func(*Client)
+
+// WithHTTPClient sets the HTTP client used for requests (http.DefaultClient by default)
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithCredentials sets the name and password used to log in automatically
+func WithCredentials(name, password string) Option {
+	return func(c *Client) {
+		c.name = name
+		c.password = password
+	}
+}
+
+// WithToken sets an access token obtained elsewhere. Without credentials the
+// client can refresh it but cannot log in again once it has expired.
+func WithToken(token string) Option {
+	return func(c *Client) {
+		c.setToken(token)
+	}
+}
+
+// WithLanguage sets the preferred languages of the error messages, in
+// Accept-Language format ("es" or "es-ES,en;q=0.5")
+func WithLanguage(language string) Option {
+	return func(c *Client) {
+		c.language = language
+	}
+}
+
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: http.DefaultClient,
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+// Token returns the current access token, empty if the client has not logged in yet
+func (c *Client) Token() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.token
+}
+
+func (c *Client) credentials() (string, string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.name, c.password
+}
+
+// request describes a call to the API. Bodies are kept as bytes so the request
+// can be sent again after logging in.
+type request struct {
+	method      string
+	path        string
+	query       url.Values
+	body        []byte
+	stream      io.Reader
+	contentType string
+
+	// auth requests get a valid token (logging in if needed) and are retried
+	// once if it is rejected. Other requests only send token, if set.
+	auth  bool
+	token string
+}
+
+func jsonRequest(method, path string, body interface{}) (request, error) {
+	req := request{method: method, path: path, auth: true}
+
+	if body != nil {
+		content, err := json.Marshal(body)
+		if err != nil {
+			return req, err
+		}
+
+		req.body = content
+		req.contentType = "application/json"
+	}
+
+	return req, nil
+}
+
+// do sends the request and decodes the JSON response into out (if not nil)
+func (c *Client) do(ctx context.Context, req request, out interface{}) (*http.Response, error) {
+	res, err := c.send(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if out != nil {
+		if err := json.NewDecoder(res.Body).Decode(out); err != nil {
+			return res, err
+		}
+	}
+
+	return res, nil
+}
+
+// send returns the response of a successful request. The caller must close its body.
+func (c *Client) send(ctx context.Context, req request) (*http.Response, error) {
+	res, err := c.sendOnce(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Token rejected: log in again and retry once (streams cannot be sent twice)
+	name, password := c.credentials()
+	if res.StatusCode == http.StatusUnauthorized && req.auth && req.stream == nil && name != "" {
+		res.Body.Close()
+
+		if err := c.Login(ctx, name, password); err != nil {
+			return nil, err
+		}
+
+		res, err = c.sendOnce(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if res.StatusCode >= 400 {
+		defer res.Body.Close()
+		return nil, newError(res)
+	}
+
+	return res, nil
+}
+
+func (c *Client) sendOnce(ctx context.Context, req request) (*http.Response, error) {
+	token := req.token
+	if req.auth {
+		var err error
+		if token, err = c.validToken(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	endpoint := c.baseURL + req.path
+	if len(req.query) > 0 {
+		endpoint += "?" + req.query.Encode()
+	}
+
+	var body io.Reader = req.stream
+	if req.body != nil {
+		body = bytes.NewReader(req.body)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, req.method, endpoint, body)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.contentType != "" {
+		httpReq.Header.Set("Content-Type", req.contentType)
+	}
+	httpReq.Header.Set("Accept", "application/json")
+	if c.language != "" {
+		httpReq.Header.Set("Accept-Language", c.language)
+	}
+	if token != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	return c.httpClient.Do(httpReq)
+}
+
+// validToken returns a token that is not about to expire, logging in or
+// refreshing the current one if needed
+func (c *Client) validToken(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	token, expires := c.token, c.expires
+	name, password := c.name, c.password
+	c.mu.Unlock()
+
+	switch {
+	case token == "" && name != "":
+		if err := c.Login(ctx, name, password); err != nil {
+			return "", err
+		}
+	case token != "" && !expires.IsZero() && time.Until(expires) < refreshMargin:
+		if err := c.RefreshToken(ctx); err != nil {
+			if name == "" {
+				return "", err
+			}
+
+			// The token could not be refreshed (expired, user logged out...)
+			if err := c.Login(ctx, name, password); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	return c.Token(), nil
+}
+
+// saveToken stores the bearer token sent by the API in the Authorization header
+func (c *Client) saveToken(res *http.Response) error {
+	token, found := strings.CutPrefix(res.Header.Get("Authorization"), "Bearer ")
+	if !found || token == "" {
+		return errors.New("client: response has no bearer token")
+	}
+
+	c.setToken(token)
+
+	return nil
+}
+
+func (c *Client) setToken(token string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.token = token
+	c.expires = tokenExpiry(token)
+}
+
+// tokenExpiry reads the exp claim of a JWT without verifying it. The zero time
+// is returned if the token has no expiration or cannot be read.
+func tokenExpiry(token string) time.Time {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return time.Time{}
+	}
+
+	var claims struct {
+		Exp int64 `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Exp == 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(claims.Exp, 0)
+}
@@ -0,0 +1,80 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"films-api.rdelgado.es/src/internals/models"
+)
+
+// Error is returned when the API answers with an error status. It wraps the
+// sentinel error of the models package matching the status, if any.
+type Error struct {
+	StatusCode int
+	Message    string
+
+	// Errors of each field when the request did not pass validation (status 422)
+	Fields map[string]string
+
+	err error
+}
+
+func (e *Error) Error() string {
+	if len(e.Fields) > 0 {
+		return fmt.Sprintf("films api: %d %s: %v", e.StatusCode, e.Message, e.Fields)
+	}
+
+	return fmt.Sprintf("films api: %d %s", e.StatusCode, e.Message)
+}
+
+func (e *Error) Unwrap() error {
+	return e.err
+}
+
+// sentinels maps the status codes used by the API handlers to the errors that cause them
+var sentinels = map[int]error{
+	http.StatusNotFound:     models.ErrNoRecord,
+	http.StatusConflict:     models.ErrDuplicatedEntry,
+	http.StatusUnauthorized: models.ErrInvalidCredentials,
+	http.StatusForbidden:    models.ErrNotAuthorized,
+
+	http.StatusTooManyRequests: models.ErrMFALocked,
+}
+
+func newError(res *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(res.Body, 64*1024))
+
+	e := &Error{
+		StatusCode: res.StatusCode,
+		Message:    strings.TrimSpace(string(body)),
+		err:        sentinels[res.StatusCode],
+	}
+
+	// Validation errors are sent as a JSON object with the error of each field
+	if res.StatusCode == http.StatusUnprocessableEntity {
+		var fields map[string]string
+		if err := json.Unmarshal(body, &fields); err == nil {
+			e.Fields = fields
+			e.Message = http.StatusText(res.StatusCode)
+		}
+	}
+
+	if e.Message == "" {
+		e.Message = http.StatusText(res.StatusCode)
+	}
+
+	return e
+}
+
+// SecondFactorError is returned by Login for the users with two-factor
+// authentication. The token is sent with a code to LoginMFA.
+type SecondFactorError struct {
+	MFAToken string
+}
+
+func (e *SecondFactorError) Error() string {
+	return "films api: a code of the second factor is required"
+}
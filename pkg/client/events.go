@@ -0,0 +1,141 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EventStreamReset is the type of the event sent first when the stream could
+// not resume after LastEventID, so some events may have been missed
+const EventStreamReset = "stream.reset"
+
+// Event is a change of the catalogue or the favourites. Data is the changed
+// resource, or its ID if it was deleted.
+type Event struct {
+	ID          string          `json:"id"`
+	Type        string          `json:"type"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UserID      uint            `json:"user_id"`
+	Aggregate   string          `json:"aggregate"`
+	AggregateID uint            `json:"aggregate_id"`
+	Data        json.RawMessage `json:"data"`
+}
+
+// EventFilter selects the events of a stream. Zero fields do not filter.
+type EventFilter struct {
+	Types   []string
+	MovieID int
+
+	// ID of the last event received, to resume a stream
+	LastEventID string
+}
+
+// EventStream reads the events of GET /events:
+//
+//	stream, err := c.Events(ctx, client.EventFilter{Types: []string{"movie.created"}})
+//	defer stream.Close()
+//	for stream.Next() {
+//		fmt.Println(stream.Event().Type)
+//	}
+//
+// Next returns false when the server ends the stream (it does so with slow
+// clients). Reconnect with the ID of the last event to get the missed ones.
+type EventStream struct {
+	body    io.ReadCloser
+	scanner *bufio.Scanner
+	event   Event
+	err     error
+}
+
+// Events opens the event stream. The caller must close it.
+func (c *Client) Events(ctx context.Context, filter EventFilter) (*EventStream, error) {
+	req, err := jsonRequest(http.MethodGet, "/events", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.query = url.Values{}
+	if len(filter.Types) > 0 {
+		req.query.Set("types", strings.Join(filter.Types, ","))
+	}
+	if filter.MovieID > 0 {
+		req.query.Set("movie", strconv.Itoa(filter.MovieID))
+	}
+	if filter.LastEventID != "" {
+		req.query.Set("last_event_id", filter.LastEventID)
+	}
+
+	res, err := c.send(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	return &EventStream{body: res.Body, scanner: bufio.NewScanner(res.Body)}, nil
+}
+
+// Next waits for the next event. Heartbeats are skipped.
+func (s *EventStream) Next() bool {
+	var id, name string
+	var data []string
+
+	for s.scanner.Scan() {
+		line := s.scanner.Text()
+
+		if line == "" {
+			if name == "" && len(data) == 0 {
+				continue
+			}
+
+			s.event = Event{}
+			if len(data) > 0 {
+				if err := json.Unmarshal([]byte(strings.Join(data, "\n")), &s.event); err != nil {
+					s.err = err
+					return false
+				}
+			}
+			if name != "" {
+				s.event.Type = name
+			}
+			if id != "" {
+				s.event.ID = id
+			}
+
+			return true
+		}
+
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+
+		switch field {
+		case "id":
+			id = value
+		case "event":
+			name = value
+		case "data":
+			data = append(data, value)
+		}
+	}
+
+	s.err = s.scanner.Err()
+	return false
+}
+
+func (s *EventStream) Event() Event {
+	return s.event
+}
+
+// Err returns the error that stopped the stream, nil if the server ended it
+func (s *EventStream) Err() error {
+	return s.err
+}
+
+func (s *EventStream) Close() error {
+	return s.body.Close()
+}
@@ -0,0 +1,53 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"films-api.rdelgado.es/src/internals/models"
+)
+
+// Favourites returns the user's favourite movies. An empty list is returned
+// if the user has no favourites.
+func (c *Client) Favourites(ctx context.Context) ([]Favourite, error) {
+	req, err := jsonRequest(http.MethodGet, "/favourites", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var favourites []Favourite
+	_, err = c.do(ctx, req, &favourites)
+
+	// The API answers not found when the list is empty
+	if errors.Is(err, models.ErrNoRecord) {
+		return []Favourite{}, nil
+	}
+
+	return favourites, err
+}
+
+// AddFavourite adds a movie to the user's favourites and returns the ID of the favourite
+func (c *Client) AddFavourite(ctx context.Context, movieId int) (int, error) {
+	req, err := jsonRequest(http.MethodPost, "/favourite", map[string]int{"movie_id": movieId})
+	if err != nil {
+		return 0, err
+	}
+
+	var id int
+	_, err = c.do(ctx, req, &id)
+
+	return id, err
+}
+
+// RemoveFavourite removes a favourite given its ID (not the ID of the movie)
+func (c *Client) RemoveFavourite(ctx context.Context, favouriteId int) error {
+	req, err := jsonRequest(http.MethodDelete, "/favourites/"+strconv.Itoa(favouriteId), nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.do(ctx, req, nil)
+	return err
+}
@@ -0,0 +1,65 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+)
+
+// Image is a poster or backdrop of a movie. URLs are paths of the API, to be
+// joined with its base URL.
+type Image struct {
+	URL         string            `json:"URL"`
+	ContentType string            `json:"ContentType"`
+	Width       int               `json:"Width"`
+	Height      int               `json:"Height"`
+	Thumbnails  map[string]string `json:"Thumbnails,omitempty"`
+}
+
+// UploadPoster replaces the poster of a movie with a JPEG, PNG or WebP image.
+// Only the user who created the movie can change it.
+func (c *Client) UploadPoster(ctx context.Context, movieId int, filename string, src io.Reader) (*Image, error) {
+	return c.uploadImage(ctx, movieId, "poster", filename, src)
+}
+
+// UploadBackdrop replaces the backdrop of a movie with a JPEG, PNG or WebP
+// image. Only the user who created the movie can change it.
+func (c *Client) UploadBackdrop(ctx context.Context, movieId int, filename string, src io.Reader) (*Image, error) {
+	return c.uploadImage(ctx, movieId, "backdrop", filename, src)
+}
+
+func (c *Client) uploadImage(ctx context.Context, movieId int, kind, filename string, src io.Reader) (*Image, error) {
+
+	// The form is kept in memory so the request can be sent again after logging in
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+
+	part, err := form.CreateFormFile("image", filename)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(part, src); err != nil {
+		return nil, err
+	}
+	if err := form.Close(); err != nil {
+		return nil, err
+	}
+
+	req := request{
+		method:      http.MethodPost,
+		path:        "/movie/" + strconv.Itoa(movieId) + "/" + kind,
+		body:        body.Bytes(),
+		contentType: form.FormDataContentType(),
+		auth:        true,
+	}
+
+	var image Image
+	if _, err := c.do(ctx, req, &image); err != nil {
+		return nil, err
+	}
+
+	return &image, nil
+}
@@ -0,0 +1,74 @@
+package client
+
+import "context"
+
+// MovieIterator goes through the movies matching a filter, requesting a new
+// page from the API when the previous one has been consumed:
+//
+//	it := c.MoviesIterator(ctx, client.MovieFilter{Genre: "Crime"}, 50)
+//	for it.Next() {
+//		fmt.Println(it.Movie().Title)
+//	}
+//	if err := it.Err(); err != nil { ... }
+type MovieIterator struct {
+	ctx      context.Context
+	client   *Client
+	filter   MovieFilter
+	pageSize int
+
+	page    int
+	movies  []Movie
+	current int
+	done    bool
+	err     error
+}
+
+func (c *Client) MoviesIterator(ctx context.Context, filter MovieFilter, pageSize int) *MovieIterator {
+	return &MovieIterator{
+		ctx:      ctx,
+		client:   c,
+		filter:   filter,
+		pageSize: pageSize,
+		current:  -1,
+	}
+}
+
+// Next moves to the next movie. It returns false when there are no more
+// movies or a page could not be requested.
+func (it *MovieIterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+
+	it.current++
+	if it.current < len(it.movies) {
+		return true
+	}
+
+	if it.done {
+		return false
+	}
+
+	it.page++
+	movies, total, err := it.client.MoviesPage(it.ctx, it.filter, it.page, it.pageSize)
+	if err != nil {
+		it.err = err
+		return false
+	}
+
+	it.movies = movies
+	it.current = 0
+	it.done = len(movies) < it.pageSize || it.page*it.pageSize >= total
+
+	return len(movies) > 0
+}
+
+// Movie returns the current movie
+func (it *MovieIterator) Movie() Movie {
+	return it.movies[it.current]
+}
+
+// Err returns the error that stopped the iteration, if any
+func (it *MovieIterator) Err() error {
+	return it.err
+}
@@ -0,0 +1,140 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+)
+
+// MyLists returns every list created by the user
+func (c *Client) MyLists(ctx context.Context) ([]List, error) {
+	req, err := jsonRequest(http.MethodGet, "/lists", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var lists []List
+	_, err = c.do(ctx, req, &lists)
+
+	return lists, err
+}
+
+// PublicLists returns the public lists of every user. It does not need authentication.
+func (c *Client) PublicLists(ctx context.Context) ([]List, error) {
+	req, err := jsonRequest(http.MethodGet, "/lists/public", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.auth = false
+
+	var lists []List
+	_, err = c.do(ctx, req, &lists)
+
+	return lists, err
+}
+
+// List returns a list and its movies. Public and unlisted lists can be read
+// without authentication, private lists only by their owner.
+func (c *Client) List(ctx context.Context, id int) (*ListDetails, error) {
+	req, err := jsonRequest(http.MethodGet, "/list/"+strconv.Itoa(id), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Send the token if there is one, but do not force anonymous clients to log in
+	if name, _ := c.credentials(); name == "" {
+		req.auth = false
+		req.token = c.Token()
+	}
+
+	var list ListDetails
+	if _, err := c.do(ctx, req, &list); err != nil {
+		return nil, err
+	}
+
+	return &list, nil
+}
+
+// CreateList creates a list and returns its ID. Lists are private if no visibility is set.
+func (c *Client) CreateList(ctx context.Context, list ListInput) (int, error) {
+	req, err := jsonRequest(http.MethodPost, "/list", list)
+	if err != nil {
+		return 0, err
+	}
+
+	var id int
+	_, err = c.do(ctx, req, &id)
+
+	return id, err
+}
+
+// UpdateList changes the fields of the update that are not nil
+func (c *Client) UpdateList(ctx context.Context, id int, list ListUpdate) error {
+	req, err := jsonRequest(http.MethodPut, "/list/"+strconv.Itoa(id), list)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.do(ctx, req, nil)
+	return err
+}
+
+func (c *Client) DeleteList(ctx context.Context, id int) error {
+	req, err := jsonRequest(http.MethodDelete, "/list/"+strconv.Itoa(id), nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.do(ctx, req, nil)
+	return err
+}
+
+// ReorderList sets the order of the items. itemIds must contain every item of
+// the list exactly once.
+func (c *Client) ReorderList(ctx context.Context, id int, itemIds []int) error {
+	req, err := jsonRequest(http.MethodPut, "/list/"+strconv.Itoa(id)+"/order", map[string][]int{"item_ids": itemIds})
+	if err != nil {
+		return err
+	}
+
+	_, err = c.do(ctx, req, nil)
+	return err
+}
+
+// AddListItem appends a movie to the list and returns the ID of the item
+func (c *Client) AddListItem(ctx context.Context, id, movieId int, note string) (int, error) {
+	body := struct {
+		MovieID int    `json:"movie_id"`
+		Note    string `json:"note"`
+	}{movieId, note}
+
+	req, err := jsonRequest(http.MethodPost, "/list/"+strconv.Itoa(id)+"/items", body)
+	if err != nil {
+		return 0, err
+	}
+
+	var itemId int
+	_, err = c.do(ctx, req, &itemId)
+
+	return itemId, err
+}
+
+func (c *Client) UpdateListItem(ctx context.Context, id, itemId int, note string) error {
+	req, err := jsonRequest(http.MethodPut, "/list/"+strconv.Itoa(id)+"/items/"+strconv.Itoa(itemId), map[string]string{"note": note})
+	if err != nil {
+		return err
+	}
+
+	_, err = c.do(ctx, req, nil)
+	return err
+}
+
+func (c *Client) RemoveListItem(ctx context.Context, id, itemId int) error {
+	req, err := jsonRequest(http.MethodDelete, "/list/"+strconv.Itoa(id)+"/items/"+strconv.Itoa(itemId), nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.do(ctx, req, nil)
+	return err
+}
@@ -0,0 +1,190 @@
+package client
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+func (f MovieFilter) query() url.Values {
+	query := url.Values{}
+	if f.Title != "" {
+		query.Set("title", f.Title)
+	}
+	if f.Genre != "" {
+		query.Set("genre", f.Genre)
+	}
+	if f.Year > 0 {
+		query.Set("year", strconv.Itoa(f.Year))
+	}
+
+	return query
+}
+
+// Movies returns every movie matching the filter in a single request. Use
+// MoviesIterator to go through a large catalogue page by page.
+func (c *Client) Movies(ctx context.Context, filter MovieFilter) ([]Movie, error) {
+	req, err := jsonRequest(http.MethodGet, "/movies", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.query = filter.query()
+
+	var movies []Movie
+	_, err = c.do(ctx, req, &movies)
+
+	return movies, err
+}
+
+// MoviesPage returns one page (starting at 1) of the movies matching the
+// filter, and the total number of matching movies
+func (c *Client) MoviesPage(ctx context.Context, filter MovieFilter, page, pageSize int) ([]Movie, int, error) {
+	req, err := jsonRequest(http.MethodGet, "/movies", nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	req.query = filter.query()
+	req.query.Set("page", strconv.Itoa(page))
+	req.query.Set("page_size", strconv.Itoa(pageSize))
+
+	var movies []Movie
+	res, err := c.do(ctx, req, &movies)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	total, _ := strconv.Atoi(res.Header.Get("X-Total-Count"))
+
+	return movies, total, nil
+}
+
+// Movie returns a movie and the user who created it
+func (c *Client) Movie(ctx context.Context, id int) (*MovieDetails, error) {
+	req, err := jsonRequest(http.MethodGet, "/movie/"+strconv.Itoa(id), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var movie MovieDetails
+	if _, err := c.do(ctx, req, &movie); err != nil {
+		return nil, err
+	}
+
+	return &movie, nil
+}
+
+// CreateMovie creates a movie and returns its ID
+func (c *Client) CreateMovie(ctx context.Context, movie MovieInput) (int, error) {
+	req, err := jsonRequest(http.MethodPost, "/movie", movie)
+	if err != nil {
+		return 0, err
+	}
+
+	var id int
+	_, err = c.do(ctx, req, &id)
+
+	return id, err
+}
+
+// UpdateMovie changes the non zero fields of the input. Only the user who
+// created the movie can update it.
+func (c *Client) UpdateMovie(ctx context.Context, id int, movie MovieInput) error {
+	req, err := jsonRequest(http.MethodPut, "/movie/"+strconv.Itoa(id), movie)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.do(ctx, req, nil)
+	return err
+}
+
+// DeleteMovie moves a movie to the trash. Only the user who created the movie
+// can delete it.
+func (c *Client) DeleteMovie(ctx context.Context, id int) error {
+	req, err := jsonRequest(http.MethodDelete, "/movie/"+strconv.Itoa(id), nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.do(ctx, req, nil)
+	return err
+}
+
+// Trash returns the deleted movies of the user, most recently deleted first
+func (c *Client) Trash(ctx context.Context) ([]TrashedMovie, error) {
+	req, err := jsonRequest(http.MethodGet, "/trash", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var trash []TrashedMovie
+	_, err = c.do(ctx, req, &trash)
+
+	return trash, err
+}
+
+// RestoreMovie takes a deleted movie of the user out of the trash
+func (c *Client) RestoreMovie(ctx context.Context, id int) (*Movie, error) {
+	req, err := jsonRequest(http.MethodPost, "/movie/"+strconv.Itoa(id)+"/restore", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var movie Movie
+	if _, err := c.do(ctx, req, &movie); err != nil {
+		return nil, err
+	}
+
+	return &movie, nil
+}
+
+// ImportMovies sends a CSV or NDJSON stream of movies to be created in bulk
+func (c *Client) ImportMovies(ctx context.Context, src io.Reader, opts ImportOptions) (*ImportReport, error) {
+	req := request{
+		method: http.MethodPost,
+		path:   "/movies/import",
+		query:  url.Values{"format": {opts.Format}},
+		stream: src,
+		auth:   true,
+	}
+	if opts.DryRun {
+		req.query.Set("dry_run", "true")
+	}
+	if opts.OnDuplicate != "" {
+		req.query.Set("on_duplicate", opts.OnDuplicate)
+	}
+
+	switch opts.Format {
+	case FormatCSV:
+		req.contentType = "text/csv"
+	case FormatNDJSON:
+		req.contentType = "application/x-ndjson"
+	}
+
+	var report ImportReport
+	if _, err := c.do(ctx, req, &report); err != nil {
+		return nil, err
+	}
+
+	return &report, nil
+}
+
+// ExportMovies streams the movies matching the filter in the given format
+// (FormatCSV, FormatNDJSON or FormatJSON). The caller must close the stream.
+func (c *Client) ExportMovies(ctx context.Context, format string, filter MovieFilter) (io.ReadCloser, error) {
+	req, err := jsonRequest(http.MethodGet, "/movies/export", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.query = filter.query()
+	req.query.Set("format", format)
+
+	res, err := c.send(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	return res.Body, nil
+}
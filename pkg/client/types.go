@@ -0,0 +1,220 @@
+package client
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Movie as returned by the API
+type Movie struct {
+	ID          uint      `json:"ID"`
+	CreatedAt   time.Time `json:"CreatedAt"`
+	UpdatedAt   time.Time `json:"UpdatedAt"`
+	Title       string    `json:"Title"`
+	Director    string    `json:"Director"`
+	ReleaseDate time.Time `json:"ReleaseDate"`
+	Cast        []string  `json:"Cast"`
+	Genre       string    `json:"Genre"`
+	Synopsis    string    `json:"Synopsis"`
+	Poster      *Image    `json:"Poster"`
+	Backdrop    *Image    `json:"Backdrop"`
+	UserID      uint      `json:"UserID"`
+
+	// Time the movie was deleted, for movies in the trash
+	DeletedAt *time.Time `json:"DeletedAt"`
+}
+
+// TrashedMovie is a deleted movie, which can be restored until PurgeAt
+type TrashedMovie struct {
+	Movie   Movie     `json:"movie"`
+	PurgeAt time.Time `json:"purge_at"`
+}
+
+// Profile is the account of the user
+type Profile struct {
+	ID            uint      `json:"ID"`
+	CreatedAt     time.Time `json:"CreatedAt"`
+	Name          string    `json:"Name"`
+	Role          string    `json:"Role"`
+	Email         *string   `json:"Email"`
+	EmailVerified bool      `json:"EmailVerified"`
+	MFAEnabled    bool      `json:"MFAEnabled"`
+}
+
+// Session is a device where the user is logged in
+type Session struct {
+	ID         uint      `json:"ID"`
+	CreatedAt  time.Time `json:"CreatedAt"`
+	LastSeenAt time.Time `json:"LastSeenAt"`
+	ExpiresAt  time.Time `json:"ExpiresAt"`
+	UserAgent  string    `json:"UserAgent"`
+	IP         string    `json:"IP"`
+	Current    bool      `json:"Current"`
+}
+
+// Identity is an account of the user in the identity provider
+type Identity struct {
+	ID        uint      `json:"ID"`
+	CreatedAt time.Time `json:"CreatedAt"`
+	Issuer    string    `json:"Issuer"`
+	Subject   string    `json:"Subject"`
+	Email     string    `json:"Email"`
+}
+
+// TOTPEnrolment is the secret of an authenticator app, to confirm with one of its codes
+type TOTPEnrolment struct {
+	Secret string `json:"Secret"`
+
+	// Provisioning URI of the secret, usually shown as a QR code
+	URI string `json:"URI"`
+}
+
+// Statuses of the export jobs
+const (
+	ExportPending = "pending"
+	ExportRunning = "running"
+	ExportDone    = "done"
+	ExportFailed  = "failed"
+)
+
+// ExportJob is an export of the data of the user made in the background. Done
+// exports can be downloaded until ExpiresAt.
+type ExportJob struct {
+	ID         uint       `json:"ID"`
+	CreatedAt  time.Time  `json:"CreatedAt"`
+	Status     string     `json:"Status"`
+	Size       int64      `json:"Size"`
+	Error      string     `json:"Error"`
+	FinishedAt *time.Time `json:"FinishedAt"`
+	ExpiresAt  *time.Time `json:"ExpiresAt"`
+}
+
+// MovieDetails is a movie with the user who created it
+type MovieDetails struct {
+	Movie     Movie `json:"movie"`
+	CreatedBy struct {
+		Name   string `json:"name"`
+		UserID uint   `json:"userId"`
+	} `json:"created_by"`
+}
+
+// MovieInput holds the fields to create a movie. When updating a movie, zero
+// fields are left unchanged.
+type MovieInput struct {
+	Title       string
+	Director    string
+	ReleaseDate time.Time
+	Cast        []string
+	Genre       string
+	Synopsis    string
+}
+
+// MarshalJSON encodes the input as expected by the API: release date as
+// YYYY-MM-DD and the cast under the stringArray key
+func (in MovieInput) MarshalJSON() ([]byte, error) {
+	var releaseDate string
+	if !in.ReleaseDate.IsZero() {
+		releaseDate = in.ReleaseDate.Format("2006-01-02")
+	}
+
+	return json.Marshal(struct {
+		Title       string   `json:"Title"`
+		Director    string   `json:"Director"`
+		ReleaseDate string   `json:"ReleaseDate"`
+		Cast        []string `json:"stringArray"`
+		Genre       string   `json:"Genre"`
+		Synopsis    string   `json:"Synopsis"`
+	}{in.Title, in.Director, releaseDate, in.Cast, in.Genre, in.Synopsis})
+}
+
+// MovieFilter holds the optional filters of the movie catalogue
+type MovieFilter struct {
+	Title string
+	Genre string
+	Year  int
+}
+
+// Favourite is a movie of the user's favourites list
+type Favourite struct {
+	ID    uint  `json:"FavouriteID"`
+	Movie Movie `json:"Movie"`
+}
+
+const (
+	ListPublic   = "public"
+	ListUnlisted = "unlisted"
+	ListPrivate  = "private"
+)
+
+type List struct {
+	ID          uint      `json:"ID"`
+	CreatedAt   time.Time `json:"CreatedAt"`
+	UpdatedAt   time.Time `json:"UpdatedAt"`
+	Name        string    `json:"Name"`
+	Description string    `json:"Description"`
+	Visibility  string    `json:"Visibility"`
+	UserID      uint      `json:"UserID"`
+}
+
+// ListInput holds the fields to create a list
+type ListInput struct {
+	Name        string `json:"name,omitempty"`
+	Description string `json:"description,omitempty"`
+	Visibility  string `json:"visibility,omitempty"`
+}
+
+// ListUpdate holds the fields of a list to change. Nil fields are left
+// unchanged, and an empty description clears it.
+type ListUpdate struct {
+	Name        *string `json:"name,omitempty"`
+	Description *string `json:"description,omitempty"`
+	Visibility  *string `json:"visibility,omitempty"`
+}
+
+type ListItem struct {
+	ID       uint   `json:"ItemID"`
+	Position int    `json:"Position"`
+	Note     string `json:"Note"`
+	Movie    Movie  `json:"Movie"`
+}
+
+// ListDetails is a list with its movies sorted by position
+type ListDetails struct {
+	List  List       `json:"list"`
+	Items []ListItem `json:"items"`
+}
+
+const (
+	FormatCSV    = "csv"
+	FormatNDJSON = "ndjson"
+	FormatJSON   = "json"
+
+	OnDuplicateSkip   = "skip"
+	OnDuplicateUpsert = "upsert"
+)
+
+type ImportOptions struct {
+	// Format of the stream, FormatCSV or FormatNDJSON
+	Format string
+
+	// Validate the rows without saving any movie
+	DryRun bool
+
+	// What to do with titles that already exist, OnDuplicateSkip (default) or OnDuplicateUpsert
+	OnDuplicate string
+}
+
+type ImportReport struct {
+	DryRun  bool `json:"dry_run"`
+	Rows    int  `json:"rows"`
+	Created int  `json:"created"`
+	Updated int  `json:"updated"`
+	Skipped int  `json:"skipped"`
+	Failed  int  `json:"failed"`
+	Errors  []struct {
+		Row    int               `json:"row"`
+		Title  string            `json:"title"`
+		Error  string            `json:"error"`
+		Fields map[string]string `json:"fields"`
+	} `json:"errors"`
+}
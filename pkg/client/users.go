@@ -0,0 +1,511 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+type credentials struct {
+	Name     string `json:"name"`
+	Password string `json:"password"`
+}
+
+// Signup creates a new user. It does not log in.
+func (c *Client) Signup(ctx context.Context, name, password string) error {
+	req, err := jsonRequest(http.MethodPost, "/user/signup", credentials{name, password})
+	if err != nil {
+		return err
+	}
+	req.auth = false
+
+	_, err = c.do(ctx, req, nil)
+	return err
+}
+
+// Login gets a new access token. The credentials are kept to log in again
+// when the token expires.
+//
+// Users with two-factor authentication get a *SecondFactorError instead,
+// whose token is sent with a code to LoginMFA. Their credentials are not
+// kept, as logging in again needs a new code.
+func (c *Client) Login(ctx context.Context, name, password string) error {
+	req, err := jsonRequest(http.MethodPost, "/user/login", credentials{name, password})
+	if err != nil {
+		return err
+	}
+	req.auth = false
+
+	if err := c.login(ctx, req); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.name, c.password = name, password
+	c.mu.Unlock()
+
+	return nil
+}
+
+// LoginOIDC finishes a login with the identity provider, with the code and
+// state it sent to the redirect URL. Users with two-factor authentication
+// get a *SecondFactorError, as in Login.
+func (c *Client) LoginOIDC(ctx context.Context, code, state string) error {
+	req, err := jsonRequest(http.MethodGet, "/user/oidc/callback", nil)
+	if err != nil {
+		return err
+	}
+	req.auth = false
+	req.query = url.Values{"code": {code}, "state": {state}}
+
+	return c.login(ctx, req)
+}
+
+// login saves the access token of a login response, or returns the
+// *SecondFactorError of the users with two-factor authentication
+func (c *Client) login(ctx context.Context, req request) error {
+	res, err := c.send(ctx, req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.Header.Get("Authorization") == "" {
+		var challenge struct {
+			MFARequired bool   `json:"MFARequired"`
+			MFAToken    string `json:"MFAToken"`
+		}
+		if err := json.NewDecoder(res.Body).Decode(&challenge); err == nil && challenge.MFARequired {
+			return &SecondFactorError{MFAToken: challenge.MFAToken}
+		}
+	}
+
+	return c.saveToken(res)
+}
+
+// RefreshToken exchanges the current access token for a new one
+func (c *Client) RefreshToken(ctx context.Context) error {
+	req, err := jsonRequest(http.MethodPost, "/user/token/refresh", nil)
+	if err != nil {
+		return err
+	}
+
+	// The current token is sent as is: refreshing must not trigger another refresh
+	req.auth = false
+	req.token = c.Token()
+
+	res, err := c.do(ctx, req, nil)
+	if err != nil {
+		return err
+	}
+
+	return c.saveToken(res)
+}
+
+// Me returns the profile of the user
+func (c *Client) Me(ctx context.Context) (*Profile, error) {
+	req, err := jsonRequest(http.MethodGet, "/user/me", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var profile Profile
+	if _, err := c.do(ctx, req, &profile); err != nil {
+		return nil, err
+	}
+
+	return &profile, nil
+}
+
+// Rename changes the name of the user. The credentials of the client are
+// updated so it can log in again.
+func (c *Client) Rename(ctx context.Context, name string) (*Profile, error) {
+	req, err := jsonRequest(http.MethodPatch, "/user/me", struct {
+		Name string `json:"name"`
+	}{name})
+	if err != nil {
+		return nil, err
+	}
+
+	var profile Profile
+	if _, err := c.do(ctx, req, &profile); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	if c.name != "" {
+		c.name = profile.Name
+	}
+	c.mu.Unlock()
+
+	return &profile, nil
+}
+
+// ChangePassword sets a new password, revoking the other tokens of the user.
+// The client keeps working with the new token sent by the API.
+func (c *Client) ChangePassword(ctx context.Context, current, password string) error {
+	req, err := jsonRequest(http.MethodPost, "/user/me/password", struct {
+		CurrentPassword string `json:"current_password"`
+		NewPassword     string `json:"new_password"`
+	}{current, password})
+	if err != nil {
+		return err
+	}
+
+	res, err := c.do(ctx, req, nil)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	if c.name != "" {
+		c.password = password
+	}
+	c.mu.Unlock()
+
+	return c.saveToken(res)
+}
+
+// SetEmail changes the email address of the user. A token to verify it is
+// sent to the address; until then it cannot be used to reset the password.
+func (c *Client) SetEmail(ctx context.Context, email string) (*Profile, error) {
+	req, err := jsonRequest(http.MethodPut, "/user/me/email", struct {
+		Email string `json:"email"`
+	}{email})
+	if err != nil {
+		return nil, err
+	}
+
+	var profile Profile
+	if _, err := c.do(ctx, req, &profile); err != nil {
+		return nil, err
+	}
+
+	return &profile, nil
+}
+
+// VerifyEmail verifies the email address of a user with the token sent to it
+func (c *Client) VerifyEmail(ctx context.Context, token string) error {
+	req, err := jsonRequest(http.MethodPost, "/user/email/verify", struct {
+		Token string `json:"token"`
+	}{token})
+	if err != nil {
+		return err
+	}
+	req.auth = false
+
+	_, err = c.do(ctx, req, nil)
+	return err
+}
+
+// ForgotPassword asks for a token to reset the password of the user with the
+// verified email address. It succeeds whether the address is known or not.
+func (c *Client) ForgotPassword(ctx context.Context, email string) error {
+	req, err := jsonRequest(http.MethodPost, "/user/password/forgot", struct {
+		Email string `json:"email"`
+	}{email})
+	if err != nil {
+		return err
+	}
+	req.auth = false
+
+	_, err = c.do(ctx, req, nil)
+	return err
+}
+
+// ResetPassword sets a new password with the token sent by ForgotPassword.
+// It does not log in.
+func (c *Client) ResetPassword(ctx context.Context, token, password string) error {
+	req, err := jsonRequest(http.MethodPost, "/user/password/reset", struct {
+		Token       string `json:"token"`
+		NewPassword string `json:"new_password"`
+	}{token, password})
+	if err != nil {
+		return err
+	}
+	req.auth = false
+
+	_, err = c.do(ctx, req, nil)
+	return err
+}
+
+// DeleteAccount deletes the account of the user. Their movies are kept with
+// an anonymized author.
+func (c *Client) DeleteAccount(ctx context.Context) error {
+	req, err := jsonRequest(http.MethodDelete, "/user/me", nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.do(ctx, req, nil)
+	return err
+}
+
+// ExportAccount exports the data of the user as a ZIP archive. Small exports
+// are returned as a stream, which the caller must close. Large ones (or all
+// of them if async is true) are made in the background and the job is
+// returned instead: check it with Export and download it with DownloadExport.
+func (c *Client) ExportAccount(ctx context.Context, async bool) (io.ReadCloser, *ExportJob, error) {
+	req, err := jsonRequest(http.MethodGet, "/user/me/export", nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	req.query = url.Values{"async": {strconv.FormatBool(async)}}
+
+	res, err := c.send(ctx, req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if res.StatusCode != http.StatusAccepted {
+		return res.Body, nil, nil
+	}
+	defer res.Body.Close()
+
+	var job ExportJob
+	if err := json.NewDecoder(res.Body).Decode(&job); err != nil {
+		return nil, nil, err
+	}
+
+	return nil, &job, nil
+}
+
+// Export returns the status of an export of the user
+func (c *Client) Export(ctx context.Context, id int) (*ExportJob, error) {
+	req, err := jsonRequest(http.MethodGet, "/user/me/export/"+strconv.Itoa(id), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var job ExportJob
+	if _, err := c.do(ctx, req, &job); err != nil {
+		return nil, err
+	}
+
+	return &job, nil
+}
+
+// DownloadExport streams the archive of a done export. The caller must close the stream.
+func (c *Client) DownloadExport(ctx context.Context, id int) (io.ReadCloser, error) {
+	req, err := jsonRequest(http.MethodGet, "/user/me/export/"+strconv.Itoa(id)+"/download", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := c.send(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	return res.Body, nil
+}
+
+// LoginMFA gets a new access token with the token of a *SecondFactorError of
+// Login and a code of the authenticator app, or a recovery code
+func (c *Client) LoginMFA(ctx context.Context, mfaToken, code string) error {
+	req, err := jsonRequest(http.MethodPost, "/user/login/mfa", struct {
+		MFAToken string `json:"mfa_token"`
+		Code     string `json:"code"`
+	}{mfaToken, code})
+	if err != nil {
+		return err
+	}
+	req.auth = false
+
+	res, err := c.do(ctx, req, nil)
+	if err != nil {
+		return err
+	}
+
+	return c.saveToken(res)
+}
+
+// EnableTOTP starts the enrolment of the user in two-factor authentication.
+// It is enabled once a code of the secret is sent to ConfirmTOTP.
+func (c *Client) EnableTOTP(ctx context.Context) (*TOTPEnrolment, error) {
+	req, err := jsonRequest(http.MethodPost, "/user/me/totp", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var enrolment TOTPEnrolment
+	if _, err := c.do(ctx, req, &enrolment); err != nil {
+		return nil, err
+	}
+
+	return &enrolment, nil
+}
+
+// ConfirmTOTP enables two-factor authentication and returns the recovery codes
+func (c *Client) ConfirmTOTP(ctx context.Context, code string) ([]string, error) {
+	return c.recoveryCodes(ctx, "/user/me/totp/confirm", code)
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes of the user, after a
+// code of the second factor
+func (c *Client) RegenerateRecoveryCodes(ctx context.Context, code string) ([]string, error) {
+	return c.recoveryCodes(ctx, "/user/me/totp/recovery-codes", code)
+}
+
+func (c *Client) recoveryCodes(ctx context.Context, path, code string) ([]string, error) {
+	req, err := jsonRequest(http.MethodPost, path, struct {
+		Code string `json:"code"`
+	}{code})
+	if err != nil {
+		return nil, err
+	}
+
+	var out struct {
+		RecoveryCodes []string `json:"RecoveryCodes"`
+	}
+	if _, err := c.do(ctx, req, &out); err != nil {
+		return nil, err
+	}
+
+	return out.RecoveryCodes, nil
+}
+
+// DisableTOTP turns two-factor authentication off, with the password of the user
+func (c *Client) DisableTOTP(ctx context.Context, password string) error {
+	req, err := jsonRequest(http.MethodDelete, "/user/me/totp", struct {
+		Password string `json:"password"`
+	}{password})
+	if err != nil {
+		return err
+	}
+
+	_, err = c.do(ctx, req, nil)
+	return err
+}
+
+// MFARequiredRoles returns the roles that require two-factor authentication (admins only)
+func (c *Client) MFARequiredRoles(ctx context.Context) ([]string, error) {
+	return c.mfaPolicy(ctx, http.MethodGet, nil)
+}
+
+// SetMFARequiredRoles changes the roles that require two-factor authentication (admins only)
+func (c *Client) SetMFARequiredRoles(ctx context.Context, roles []string) ([]string, error) {
+	if roles == nil {
+		roles = []string{}
+	}
+
+	return c.mfaPolicy(ctx, http.MethodPut, struct {
+		RequiredRoles []string `json:"required_roles"`
+	}{roles})
+}
+
+func (c *Client) mfaPolicy(ctx context.Context, method string, body interface{}) ([]string, error) {
+	req, err := jsonRequest(method, "/admin/mfa", body)
+	if err != nil {
+		return nil, err
+	}
+
+	var out struct {
+		RequiredRoles []string `json:"RequiredRoles"`
+	}
+	if _, err := c.do(ctx, req, &out); err != nil {
+		return nil, err
+	}
+
+	return out.RequiredRoles, nil
+}
+
+// OIDCLoginURL is the URL that starts a login with the identity provider in
+// the browser
+func (c *Client) OIDCLoginURL() string {
+	return c.baseURL + "/user/oidc/login"
+}
+
+// Identities returns the identities of the user in the identity provider
+func (c *Client) Identities(ctx context.Context) ([]Identity, error) {
+	req, err := jsonRequest(http.MethodGet, "/user/me/identities", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var identities []Identity
+	if _, err := c.do(ctx, req, &identities); err != nil {
+		return nil, err
+	}
+
+	return identities, nil
+}
+
+// LinkIdentity returns the URL of the identity provider where the user logs
+// in to link their identity, once the provider redirects back to the API
+func (c *Client) LinkIdentity(ctx context.Context) (string, error) {
+	req, err := jsonRequest(http.MethodPost, "/user/me/identities", nil)
+	if err != nil {
+		return "", err
+	}
+
+	var out struct {
+		AuthorizationURL string `json:"AuthorizationURL"`
+	}
+	if _, err := c.do(ctx, req, &out); err != nil {
+		return "", err
+	}
+
+	return out.AuthorizationURL, nil
+}
+
+// UnlinkIdentity unlinks an identity of the user
+func (c *Client) UnlinkIdentity(ctx context.Context, id int) error {
+	req, err := jsonRequest(http.MethodDelete, "/user/me/identities/"+strconv.Itoa(id), nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.do(ctx, req, nil)
+	return err
+}
+
+// Sessions returns the devices where the user is logged in
+func (c *Client) Sessions(ctx context.Context) ([]Session, error) {
+	req, err := jsonRequest(http.MethodGet, "/user/sessions", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var sessions []Session
+	if _, err := c.do(ctx, req, &sessions); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+// DeleteSession logs a device of the user out
+func (c *Client) DeleteSession(ctx context.Context, id int) error {
+	req, err := jsonRequest(http.MethodDelete, "/user/sessions/"+strconv.Itoa(id), nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.do(ctx, req, nil)
+	return err
+}
+
+// LogoutEverywhere logs the user out of every device, this client included:
+// its token and credentials are forgotten
+func (c *Client) LogoutEverywhere(ctx context.Context) error {
+	req, err := jsonRequest(http.MethodDelete, "/user/sessions", nil)
+	if err != nil {
+		return err
+	}
+
+	if _, err := c.do(ctx, req, nil); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.name, c.password = "", ""
+	c.mu.Unlock()
+
+	c.setToken("")
+
+	return nil
+}
@@ -0,0 +1,141 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Webhook is an endpoint notified of the events it subscribes to
+type Webhook struct {
+	ID          uint       `json:"ID"`
+	CreatedAt   time.Time  `json:"CreatedAt"`
+	URL         string     `json:"URL"`
+	Description string     `json:"Description"`
+	Events      []string   `json:"Events"`
+	Active      bool       `json:"Active"`
+	Failures    int        `json:"Failures"`
+	DisabledAt  *time.Time `json:"DisabledAt"`
+
+	// Only returned when the webhook is created
+	Secret string `json:"Secret,omitempty"`
+}
+
+// WebhookInput holds the fields to register a webhook. When updating a
+// webhook, zero fields are left unchanged.
+type WebhookInput struct {
+	URL         string   `json:"url,omitempty"`
+	Description *string  `json:"description,omitempty"`
+	Events      []string `json:"events,omitempty"`
+	Active      *bool    `json:"active,omitempty"`
+}
+
+// WebhookDelivery is an attempt to send an event to a webhook
+type WebhookDelivery struct {
+	ID             uint       `json:"ID"`
+	CreatedAt      time.Time  `json:"CreatedAt"`
+	WebhookID      uint       `json:"WebhookID"`
+	EventID        string     `json:"EventID"`
+	EventType      string     `json:"EventType"`
+	Payload        string     `json:"Payload"`
+	Status         string     `json:"Status"`
+	Attempts       int        `json:"Attempts"`
+	NextAttemptAt  *time.Time `json:"NextAttemptAt"`
+	ResponseStatus int        `json:"ResponseStatus"`
+	Error          string     `json:"Error"`
+	DeliveredAt    *time.Time `json:"DeliveredAt"`
+	RedeliveryOf   *uint      `json:"RedeliveryOf"`
+}
+
+func (c *Client) Webhooks(ctx context.Context) ([]Webhook, error) {
+	req, err := jsonRequest(http.MethodGet, "/webhooks", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var webhooks []Webhook
+	_, err = c.do(ctx, req, &webhooks)
+
+	return webhooks, err
+}
+
+// CreateWebhook registers a webhook. The returned webhook has the secret to
+// verify the signatures of the deliveries, which is not returned again.
+func (c *Client) CreateWebhook(ctx context.Context, webhook WebhookInput) (*Webhook, error) {
+	req, err := jsonRequest(http.MethodPost, "/webhook", webhook)
+	if err != nil {
+		return nil, err
+	}
+
+	var created Webhook
+	if _, err := c.do(ctx, req, &created); err != nil {
+		return nil, err
+	}
+
+	return &created, nil
+}
+
+func (c *Client) Webhook(ctx context.Context, id int) (*Webhook, error) {
+	req, err := jsonRequest(http.MethodGet, "/webhook/"+strconv.Itoa(id), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var webhook Webhook
+	if _, err := c.do(ctx, req, &webhook); err != nil {
+		return nil, err
+	}
+
+	return &webhook, nil
+}
+
+// UpdateWebhook changes the non empty fields of the input. Enabling a
+// webhook resets its failures.
+func (c *Client) UpdateWebhook(ctx context.Context, id int, webhook WebhookInput) error {
+	req, err := jsonRequest(http.MethodPut, "/webhook/"+strconv.Itoa(id), webhook)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.do(ctx, req, nil)
+	return err
+}
+
+func (c *Client) DeleteWebhook(ctx context.Context, id int) error {
+	req, err := jsonRequest(http.MethodDelete, "/webhook/"+strconv.Itoa(id), nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.do(ctx, req, nil)
+	return err
+}
+
+// WebhookDeliveries returns the latest deliveries of a webhook, newest first
+func (c *Client) WebhookDeliveries(ctx context.Context, id int) ([]WebhookDelivery, error) {
+	req, err := jsonRequest(http.MethodGet, "/webhook/"+strconv.Itoa(id)+"/deliveries", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var deliveries []WebhookDelivery
+	_, err = c.do(ctx, req, &deliveries)
+
+	return deliveries, err
+}
+
+// RedeliverWebhook sends the event of a delivery again and returns the new delivery
+func (c *Client) RedeliverWebhook(ctx context.Context, id, deliveryId int) (*WebhookDelivery, error) {
+	req, err := jsonRequest(http.MethodPost, "/webhook/"+strconv.Itoa(id)+"/deliveries/"+strconv.Itoa(deliveryId)+"/redeliver", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var delivery WebhookDelivery
+	if _, err := c.do(ctx, req, &delivery); err != nil {
+		return nil, err
+	}
+
+	return &delivery, nil
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"films-api.rdelgado.es/pkg/client"
+	"films-api.rdelgado.es/src/internals/models"
+)
+
+func TestAccount(t *testing.T) {
+	_, server := newTestServer(t)
+	ctx := context.Background()
+
+	c := client.New(server.URL, client.WithCredentials("test1", testPassword))
+
+	profile, err := c.Me(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if profile.Name != "test1" || profile.Role != models.RoleUser || profile.ID == 0 {
+		t.Errorf("profile: got %+v", profile)
+	}
+
+	if _, err := c.Rename(ctx, "test2"); !errors.Is(err, models.ErrDuplicatedEntry) {
+		t.Errorf("renaming to a taken name: got %v, want %v", err, models.ErrDuplicatedEntry)
+	}
+
+	var apiErr *client.Error
+	if _, err := c.Rename(ctx, "1test"); !errors.As(err, &apiErr) || apiErr.Fields["name"] == "" {
+		t.Errorf("renaming to an invalid name: got %v", err)
+	}
+
+	renamed, err := c.Rename(ctx, "renamed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if renamed.Name != "renamed" || renamed.ID != profile.ID {
+		t.Errorf("renamed profile: got %+v", renamed)
+	}
+	if _, err := client.New(server.URL, client.WithCredentials("renamed", testPassword)).Me(ctx); err != nil {
+		t.Errorf("logging in with the new name: %v", err)
+	}
+}
+
+func TestChangePassword(t *testing.T) {
+	_, server := newTestServer(t)
+	ctx := context.Background()
+
+	c := client.New(server.URL, client.WithCredentials("test1", testPassword))
+	if err := c.Login(ctx, "test1", testPassword); err != nil {
+		t.Fatal(err)
+	}
+
+	// Another session of the same user
+	other := client.New(server.URL, client.WithToken(c.Token()))
+
+	var apiErr *client.Error
+	if err := c.ChangePassword(ctx, "Wrong.1234", "N3w.password"); !errors.As(err, &apiErr) || apiErr.Fields["current_password"] == "" {
+		t.Errorf("changing the password with a wrong one: got %v", err)
+	}
+	if err := c.ChangePassword(ctx, testPassword, "weak"); !errors.As(err, &apiErr) || apiErr.Fields["new_password"] == "" {
+		t.Errorf("changing to a weak password: got %v", err)
+	}
+
+	if err := c.ChangePassword(ctx, testPassword, "N3w.password"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The client that made the change keeps working, the other sessions are revoked
+	if _, err := c.Me(ctx); err != nil {
+		t.Errorf("session that changed the password: %v", err)
+	}
+	if _, err := other.Me(ctx); !errors.Is(err, models.ErrInvalidCredentials) {
+		t.Errorf("other session: got %v, want %v", err, models.ErrInvalidCredentials)
+	}
+
+	if err := client.New(server.URL).Login(ctx, "test1", testPassword); !errors.Is(err, models.ErrInvalidCredentials) {
+		t.Errorf("logging in with the old password: got %v, want %v", err, models.ErrInvalidCredentials)
+	}
+	if err := client.New(server.URL).Login(ctx, "test1", "N3w.password"); err != nil {
+		t.Errorf("logging in with the new password: %v", err)
+	}
+}
+
+func TestDeleteAccount(t *testing.T) {
+	app, server := newTestServer(t)
+	ctx := context.Background()
+
+	c := client.New(server.URL, client.WithCredentials("test1", testPassword))
+	other := client.New(server.URL, client.WithCredentials("test2", testPassword))
+
+	profile, err := c.Me(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := c.CreateMovie(ctx, client.MovieInput{
+		Title: "Heat", Director: "Michael Mann", ReleaseDate: time.Date(1995, 12, 15, 0, 0, 0, 0, time.UTC),
+		Cast: []string{"Al Pacino"}, Genre: "Crime", Synopsis: "A group of professional bank robbers.",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.AddFavourite(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	listId, err := c.CreateList(ctx, client.ListInput{Name: "Crime"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.AddListItem(ctx, listId, id, ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.CreateWebhook(ctx, client.WebhookInput{URL: "https://example.com/hook", Events: []string{"movie.created"}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.SetEmail(ctx, "test1@example.com"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.DeleteAccount(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.Me(ctx); !errors.Is(err, models.ErrInvalidCredentials) {
+		t.Errorf("session of the deleted user: got %v, want %v", err, models.ErrInvalidCredentials)
+	}
+
+	// The movies stay with an anonymized author, with the favourites of other users
+	movie, err := other.Movie(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := fmt.Sprintf("#deleted-%d", profile.ID); movie.CreatedBy.Name != want {
+		t.Errorf("author of the movie: got %q, want %q", movie.CreatedBy.Name, want)
+	}
+	favourites, err := other.Favourites(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(favourites) != 2 {
+		t.Errorf("favourites of another user: got %d, want 2", len(favourites))
+	}
+
+	// The rest of their data is deleted
+	for name, model := range map[string]interface{}{"favourites": &models.Favourite{}, "lists": &models.List{}, "webhooks": &models.Webhook{}} {
+		var count int64
+		app.users.DB.Unscoped().Model(model).Where("user_id = ?", profile.ID).Count(&count)
+		if count != 0 {
+			t.Errorf("%s of the deleted user: got %d", name, count)
+		}
+	}
+	if _, err := other.List(ctx, listId); !errors.Is(err, models.ErrNoRecord) {
+		t.Errorf("list of the deleted user: got %v, want %v", err, models.ErrNoRecord)
+	}
+
+	// The deletion is audited without the personal data of the user
+	entries, _, err := app.audit.GetPage(models.AuditFilter{Entity: models.EntityUser, EntityID: int(profile.ID)}, 0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Action != models.AuditDelete {
+		t.Fatalf("audit entries of the deleted user: got %+v", entries)
+	}
+	deleted := entries[0].Changes
+	if deleted["Name"].Before != "[redacted]" || deleted["Email"].Before != "[redacted]" || deleted["ID"].Before == nil {
+		t.Errorf("audit entry of the deletion: got %+v", deleted)
+	}
+	if changes, _ := json.Marshal(deleted); strings.Contains(string(changes), "test1") {
+		t.Errorf("personal data in the audit entry of the deletion: %s", changes)
+	}
+
+	// The name can be used again
+	if err := client.New(server.URL).Signup(ctx, "test1", testPassword); err != nil {
+		t.Errorf("signing up with the name of the deleted user: %v", err)
+	}
+}
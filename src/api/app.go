@@ -1,24 +1,85 @@
 package main
 
 import (
-	"errors"
 	"fmt"
 	"log/slog"
-	"time"
 
 	"films-api.rdelgado.es/src/internals/authentication"
+	"films-api.rdelgado.es/src/internals/cache"
+	"films-api.rdelgado.es/src/internals/compress"
+	"films-api.rdelgado.es/src/internals/export"
+	"films-api.rdelgado.es/src/internals/mail"
 	"films-api.rdelgado.es/src/internals/models"
-	"golang.org/x/crypto/bcrypt"
+	"films-api.rdelgado.es/src/internals/oidc"
+	"films-api.rdelgado.es/src/internals/outbox"
+	"films-api.rdelgado.es/src/internals/storage"
+	"films-api.rdelgado.es/src/internals/stream"
+	"films-api.rdelgado.es/src/internals/trash"
+	"films-api.rdelgado.es/src/internals/webhooks"
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
 )
 
 type application struct {
-	logger *slog.Logger
-	movies *models.MovieModel
-	users  *models.UserModel
-	favs   *models.FavouriteModel
-	tokens *authentication.JwtToken
+	logger  *slog.Logger
+	movies  *models.MovieModel
+	users   *models.UserModel
+	favs    *models.FavouriteModel
+	lists   *models.ListModel
+	hooks   *models.WebhookModel
+	audit   *models.AuditModel
+	exports *models.ExportModel
+	tokens  *authentication.JwtToken
+	blobs   storage.BlobStore
+
+	// Devices where the users are logged in, and the cache of the active
+	// ones checked by authenticate
+	sessions       *models.SessionModel
+	activeSessions *sessionCache
+
+	// Statuses of the users checked by authenticate
+	userCache *userCache
+
+	// Version of the movies, to answer conditional requests, and the cache of
+	// the responses of GET /movies, nil if disabled
+	catalogue      *models.CatalogueModel
+	movieResponses *cache.LRU[string, cachedResponse]
+
+	// Sends the events to the webhooks
+	webhooks *webhooks.Dispatcher
+
+	// Publishes the events saved by the models to the sinks
+	outbox *outbox.Dispatcher
+
+	// Sends the events to the clients of GET /events
+	stream *stream.Broker
+
+	// Purges the movies deleted longer ago than the trash retention
+	trash *trash.Purger
+
+	// Makes the exports of the users too large to send in the response
+	exporter *export.Exporter
+
+	// Sends the password reset and email verification tokens
+	mailer mail.Mailer
+
+	// Roles that require two-factor authentication
+	mfa *mfaPolicy
+
+	// Identity provider of the OpenID Connect logins, nil if not configured.
+	// Users logging in for the first time are created if oidcProvision is set.
+	identities    *models.IdentityModel
+	oidc          *oidc.Provider
+	oidcProvision bool
+
+	// Compresses the responses, nil if disabled
+	compressor *compress.Compressor
+
+	// Check requests against the OpenAPI document before the handlers
+	validateRequests bool
+
+	// Webhooks can have http URLs, only in development
+	insecureWebhooks bool
 }
 
 func InitDB(dbAddr, dbName, dbUser, dbPassword string) (*gorm.DB, error) {
@@ -31,84 +92,3 @@ func InitDB(dbAddr, dbName, dbUser, dbPassword string) (*gorm.DB, error) {
 
 	return db, err
 }
-
-func (app *application) seedDB(db *gorm.DB) {
-	if db.Migrator().HasTable(&models.Movie{}) && db.Migrator().HasTable(&models.User{}) {
-
-		// populate user table if empty
-		if err := db.First(&models.User{}).Error; errors.Is(err, gorm.ErrRecordNotFound) {
-
-			app.logger.Info("populating users database...")
-
-			// Hash password to create users
-			hashedPassword, err := bcrypt.GenerateFromPassword([]byte("Test.1234"), 12)
-			if err != nil {
-				return
-			}
-
-			users := []models.User{
-				{Name: "test1", Password: string(hashedPassword)},
-				{Name: "test2", Password: string(hashedPassword)},
-				{Name: "test3", Password: string(hashedPassword)},
-			}
-
-			db.Create(&users)
-		}
-
-		// populate movies table if empty
-		if err := db.First(&models.Movie{}).Error; errors.Is(err, gorm.ErrRecordNotFound) {
-
-			app.logger.Info("populating movies database...")
-
-			movies := [5]models.Movie{
-				{
-					Title:       "Inception",
-					Director:    "Christopher Nolan",
-					ReleaseDate: time.Date(2010, time.July, 16, 0, 0, 0, 0, time.UTC),
-					Cast:        models.Cast{"Leonardo DiCaprio", "Joseph Gordon-Levitt", "Ellen Page"},
-					Genre:       "Science Fiction",
-					Synopsis:    "A thief who enters the dreams of others to steal their secrets.",
-					UserID:      1,
-				},
-				{
-					Title:       "Interstellar",
-					Director:    "Christopher Nolan",
-					ReleaseDate: time.Date(2014, time.October, 26, 0, 0, 0, 0, time.UTC),
-					Cast:        models.Cast{"Matthew McConaughey", "Anne Hathaway", "Jessica Chastain"},
-					Genre:       "Science Fiction",
-					Synopsis:    "A group of explorers travels through a wormhole in space in an attempt to ensure humanity's survival.",
-					UserID:      1,
-				},
-				{
-					Title:       "The Dark Knight",
-					Director:    "Christopher Nolan",
-					ReleaseDate: time.Date(2008, time.July, 18, 0, 0, 0, 0, time.UTC),
-					Cast:        models.Cast{"Christian Bale", "Heath Ledger", "Aaron Eckhart"},
-					Genre:       "Action",
-					Synopsis:    "Batman faces the Joker in a battle for Gotham City.",
-					UserID:      2,
-				},
-				{
-					Title:       "The Matrix",
-					Director:    "Lana Wachowski, Lilly Wachowski",
-					ReleaseDate: time.Date(1999, time.March, 31, 0, 0, 0, 0, time.UTC),
-					Cast:        models.Cast{"Keanu Reeves", "Laurence Fishburne", "Carrie-Anne Moss"},
-					Genre:       "Science Fiction",
-					Synopsis:    "A computer hacker learns about the true nature of his reality.",
-					UserID:      2,
-				},
-				{
-					Title:       "Pulp Fiction",
-					Director:    "Quentin Tarantino",
-					ReleaseDate: time.Date(1994, time.May, 21, 0, 0, 0, 0, time.UTC),
-					Cast:        models.Cast{"John Travolta", "Samuel L. Jackson", "Uma Thurman"},
-					Genre:       "Crime",
-					Synopsis:    "Various interconnected stories of crime in Los Angeles.",
-					UserID:      3,
-				},
-			}
-
-			db.Create(&movies)
-		}
-	}
-}
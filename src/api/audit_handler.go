@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"films-api.rdelgado.es/src/internals/models"
+	"films-api.rdelgado.es/src/internals/validator"
+)
+
+var auditEntities = []string{models.EntityMovie, models.EntityFavourite, models.EntityUser}
+
+func (app *application) getAuditLog(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	filter, err := auditFilter(query)
+	if err != nil {
+		app.clientError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	page, pageSize := 1, defaultPageSize
+	if value := query.Get("page"); value != "" {
+		page, err = strconv.Atoi(value)
+		if err != nil || page < 1 {
+			app.clientError(w, r, http.StatusBadRequest, err)
+			return
+		}
+	}
+	if value := query.Get("page_size"); value != "" {
+		pageSize, err = strconv.Atoi(value)
+		if err != nil || pageSize < 1 || pageSize > maxPageSize {
+			app.clientError(w, r, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	entries, total, err := app.audit.GetPage(filter, (page-1)*pageSize, pageSize)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	w.Header().Set("X-Total-Count", strconv.FormatInt(total, 10))
+	if int64(page*pageSize) < total {
+		next := *r.URL
+		query.Set("page", strconv.Itoa(page+1))
+		query.Set("page_size", strconv.Itoa(pageSize))
+		next.RawQuery = query.Encode()
+		w.Header().Set("Link", "<"+next.RequestURI()+`>; rel="next"`)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(entries)
+}
+
+// auditFilter reads the filters of the audit log from the query parameters
+func auditFilter(query url.Values) (models.AuditFilter, error) {
+	var filter models.AuditFilter
+
+	if value := query.Get("entity"); value != "" {
+		if !validator.PermittedValue(value, auditEntities...) {
+			return filter, errors.New("unknown entity " + value)
+		}
+		filter.Entity = value
+	}
+
+	for name, dst := range map[string]*int{"entity_id": &filter.EntityID, "actor": &filter.ActorID} {
+		if value := query.Get(name); value != "" {
+			id, err := strconv.Atoi(value)
+			if err != nil || id < 1 {
+				return filter, errors.New("invalid " + name)
+			}
+			*dst = id
+		}
+	}
+
+	for name, dst := range map[string]*time.Time{"from": &filter.From, "to": &filter.To} {
+		if value := query.Get(name); value != "" {
+			t, err := parseAuditTime(value)
+			if err != nil {
+				return filter, err
+			}
+			*dst = t
+		}
+	}
+
+	return filter, nil
+}
+
+// parseAuditTime accepts RFC 3339 times and dates (midnight UTC)
+func parseAuditTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+
+	return time.Parse(time.DateOnly, value)
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"films-api.rdelgado.es/pkg/client"
+	"films-api.rdelgado.es/src/internals/models"
+)
+
+func TestAuditLog(t *testing.T) {
+	app, server := newTestServer(t)
+	ctx := context.Background()
+
+	if err := app.users.SetRole("test3", models.RoleAdmin); err != nil {
+		t.Fatal(err)
+	}
+	test1, err := app.users.GetByName("test1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := client.New(server.URL, client.WithCredentials("test1", testPassword))
+	admin := client.New(server.URL, client.WithCredentials("test3", testPassword))
+
+	start := time.Now().Add(-time.Second)
+
+	id, err := c.CreateMovie(ctx, client.MovieInput{
+		Title: "Heat", Director: "Michael Mann", ReleaseDate: time.Date(1995, 12, 15, 0, 0, 0, 0, time.UTC),
+		Cast: []string{"Al Pacino"}, Genre: "Crime", Synopsis: "A group of professional bank robbers.",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.UpdateMovie(ctx, id, client.MovieInput{Genre: "Thriller"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Failed changes are not recorded
+	other := client.New(server.URL, client.WithCredentials("test2", testPassword))
+	if err := other.DeleteMovie(ctx, id); !errors.Is(err, models.ErrNotAuthorized) {
+		t.Fatalf("deleting the movie of another user: got %v", err)
+	}
+
+	if err := c.DeleteMovie(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, total, err := admin.AuditLog(ctx, client.AuditFilter{Entity: models.EntityMovie, EntityID: id}, 1, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 3 || len(entries) != 3 {
+		t.Fatalf("entries of the movie: got %d of %d, want 3", len(entries), total)
+	}
+
+	deleted, updated, created := entries[0], entries[1], entries[2]
+	if created.Action != models.AuditCreate || updated.Action != models.AuditUpdate || deleted.Action != models.AuditDelete {
+		t.Errorf("actions: got %s, %s, %s", created.Action, updated.Action, deleted.Action)
+	}
+	for _, entry := range entries {
+		if entry.ActorID == nil || *entry.ActorID != test1.ID || entry.RequestID == "" || entry.IP != "127.0.0.1" {
+			t.Errorf("origin of the change: got actor %v, request %q, IP %q", entry.ActorID, entry.RequestID, entry.IP)
+		}
+	}
+
+	// Updates only have the changed fields
+	if len(updated.Changes) != 1 || string(updated.Changes["Genre"].Before) != `"Crime"` || string(updated.Changes["Genre"].After) != `"Thriller"` {
+		t.Errorf("changes of the update: got %+v", updated.Changes)
+	}
+	if string(created.Changes["Title"].Before) != "null" || string(created.Changes["Title"].After) != `"Heat"` {
+		t.Errorf("changes of the creation: got %+v", created.Changes["Title"])
+	}
+	if string(deleted.Changes["Genre"].Before) != `"Thriller"` || string(deleted.Changes["Genre"].After) != "null" {
+		t.Errorf("changes of the deletion: got %+v", deleted.Changes["Genre"])
+	}
+
+	// Favourites
+	favId, err := c.AddFavourite(ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.RemoveFavourite(ctx, favId); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, _, err = admin.AuditLog(ctx, client.AuditFilter{Entity: models.EntityFavourite, ActorID: int(test1.ID), From: start}, 1, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Action != models.AuditDelete || entries[1].Action != models.AuditCreate || entries[1].EntityID != uint(favId) {
+		t.Errorf("entries of the favourite: got %+v", entries)
+	}
+
+	// Users, without their passwords
+	if err := client.New(server.URL).Signup(ctx, "audited", testPassword); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, _, err = admin.AuditLog(ctx, client.AuditFilter{Entity: models.EntityUser}, 1, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || string(entries[0].Changes["Name"].After) != `"audited"` || string(entries[0].Changes["Password"].After) != `"[redacted]"` || entries[0].ActorID != nil {
+		t.Errorf("entry of the new user: got %+v", entries)
+	}
+
+	// The role change made by the admin command has no actor
+	role := entries[1]
+	if role.Action != models.AuditUpdate || role.ActorID != nil || string(role.Changes["Role"].After) != `"admin"` || len(role.Changes) != 1 {
+		t.Errorf("entry of the role change: got %+v", role)
+	}
+
+	if entries, total, err := admin.AuditLog(ctx, client.AuditFilter{From: time.Now().Add(time.Hour)}, 1, 20); err != nil || total != 0 || len(entries) != 0 {
+		t.Errorf("entries from the future: got %v %d %v", entries, total, err)
+	}
+
+	// Only admins can read the log
+	if _, _, err := c.AuditLog(ctx, client.AuditFilter{}, 1, 20); !errors.Is(err, models.ErrNotAuthorized) {
+		t.Errorf("audit log of a user: got %v, want %v", err, models.ErrNotAuthorized)
+	}
+
+	var apiErr *client.Error
+	if _, _, err := admin.AuditLog(ctx, client.AuditFilter{Entity: "list"}, 1, 20); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest {
+		t.Errorf("unknown entity: got %v", err)
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	_, server := newTestServer(t)
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/lists/public", nil)
+	req.Header.Set("X-Request-ID", "frontend-1234")
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	if got := res.Header.Get("X-Request-ID"); got != "frontend-1234" {
+		t.Errorf("request ID of the client: got %q", got)
+	}
+
+	// IDs that are not safe to log are replaced
+	req.Header.Set("X-Request-ID", "bad id; \"quoted\"")
+	res, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	if got := res.Header.Get("X-Request-ID"); len(got) != 32 {
+		t.Errorf("generated request ID: got %q", got)
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"films-api.rdelgado.es/src/internals/cache"
+	"films-api.rdelgado.es/src/internals/events"
+	"films-api.rdelgado.es/src/internals/models"
+)
+
+// Default size and lifetime of the cache of the user statuses
+const (
+	userCacheSize = 10000
+	userCacheTTL  = 30 * time.Second
+)
+
+type cacheStats struct {
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+	Size      int     `doc:"Entries in the cache"`
+	HitRate   float64 `doc:"Fraction of the lookups found in the cache"`
+}
+
+type cacheStatsResponse struct {
+	Users    cacheStats `doc:"Statuses of the users, checked in every authenticated request"`
+	Sessions cacheStats `doc:"Active sessions"`
+	Movies   cacheStats `doc:"Responses of GET /movies, all zero if the cache is disabled"`
+}
+
+// userCache keeps the statuses of the users, which authenticate checks in
+// every request. Statuses changed by this instance are forgotten right away,
+// and so are the ones of the user.updated and user.deleted events this
+// instance publishes, as the cache is a sink of the outbox (this is how the
+// changes of the CLI are noticed). The outbox publishes each event from a
+// single instance, so the other ones keep their local copy of the status,
+// stale, until it expires: for several instances the TTL is the only bound.
+type userCache struct {
+	users  *models.UserModel
+	local  *cache.LRU[int, models.UserStatus]
+	ttl    time.Duration
+	logger *slog.Logger
+
+	// Cache shared with the other instances, nil if there is none
+	shared cache.Shared
+}
+
+func newUserCache(users *models.UserModel, size int, ttl time.Duration, shared cache.Shared, logger *slog.Logger) *userCache {
+	return &userCache{
+		users:  users,
+		local:  cache.New[int, models.UserStatus](size, ttl),
+		ttl:    ttl,
+		logger: logger,
+		shared: shared,
+	}
+}
+
+// Status returns the status of the user from the local cache, the shared one
+// or the database. The shared cache is skipped while it fails.
+func (c *userCache) Status(ctx context.Context, id int) (models.UserStatus, error) {
+	if status, found := c.local.Get(id); found {
+		return status, nil
+	}
+
+	key := "user-status:" + strconv.Itoa(id)
+
+	if c.shared != nil {
+		value, found, err := c.shared.Get(ctx, key)
+		if err != nil {
+			c.logger.Warn("reading the shared cache", "key", key, "error", err.Error())
+		}
+
+		var status models.UserStatus
+		if found && json.Unmarshal(value, &status) == nil {
+			c.local.Set(id, status)
+			return status, nil
+		}
+	}
+
+	status, err := c.users.Status(id)
+	if err != nil {
+		return models.UserStatus{}, err
+	}
+
+	c.local.Set(id, status)
+
+	if c.shared != nil {
+		value, _ := json.Marshal(status)
+		if err := c.shared.Set(ctx, key, value, c.ttl); err != nil {
+			c.logger.Warn("writing the shared cache", "key", key, "error", err.Error())
+		}
+	}
+
+	return status, nil
+}
+
+// Forget removes the status of the user from the caches
+func (c *userCache) Forget(ctx context.Context, id int) error {
+	c.local.Delete(id)
+
+	if c.shared != nil {
+		return c.shared.Delete(ctx, "user-status:"+strconv.Itoa(id))
+	}
+
+	return nil
+}
+
+// Publish forgets the users of the user events
+func (c *userCache) Publish(ctx context.Context, event events.Event) error {
+	if event.Aggregate != "user" {
+		return nil
+	}
+
+	return c.Forget(ctx, int(event.AggregateID))
+}
+
+func (c *userCache) Stats() cache.Stats {
+	return c.local.Stats()
+}
+
+// forgetUser removes the status of the user from the caches after a change.
+// If the shared cache fails, it is removed when the event is published.
+func (app *application) forgetUser(r *http.Request, id int) {
+	if err := app.userCache.Forget(r.Context(), id); err != nil {
+		app.logger.Warn("forgetting the user in the shared cache", "user", id, "error", err.Error())
+	}
+}
+
+// getCacheStats returns the counters of the caches of this instance
+func (app *application) getCacheStats(w http.ResponseWriter, r *http.Request) {
+	response := cacheStatsResponse{
+		Users:    newCacheStats(app.userCache.Stats()),
+		Sessions: newCacheStats(app.activeSessions.Stats()),
+	}
+	if app.movieResponses != nil {
+		response.Movies = newCacheStats(app.movieResponses.Stats())
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+func newCacheStats(stats cache.Stats) cacheStats {
+	return cacheStats{
+		Hits:      stats.Hits,
+		Misses:    stats.Misses,
+		Evictions: stats.Evictions,
+		Size:      stats.Size,
+		HitRate:   stats.HitRate(),
+	}
+}
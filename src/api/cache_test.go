@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"films-api.rdelgado.es/pkg/client"
+	"films-api.rdelgado.es/src/internals/models"
+)
+
+// testSharedCache is a cache.Shared in memory, without expiry
+type testSharedCache struct {
+	mu     sync.Mutex
+	values map[string][]byte
+}
+
+func (c *testSharedCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	value, found := c.values[key]
+	return value, found, nil
+}
+
+func (c *testSharedCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.values[key] = value
+	return nil
+}
+
+func (c *testSharedCache) Delete(ctx context.Context, key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.values, key)
+	return nil
+}
+
+func TestUserCache(t *testing.T) {
+	app, server := newTestServer(t)
+	ctx := context.Background()
+
+	if err := app.users.SetRole("test3", models.RoleAdmin); err != nil {
+		t.Fatal(err)
+	}
+	admin := client.New(server.URL, client.WithCredentials("test3", testPassword))
+
+	c := client.New(server.URL, client.WithToken(loginFrom(t, server.URL, "test1", "Laptop/1.0")))
+	for i := 0; i < 3; i++ {
+		if _, err := c.Me(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	caches, err := admin.CacheStats(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if caches.Users.Hits < 2 || caches.Users.HitRate <= 0 || caches.Sessions.Hits < 2 {
+		t.Errorf("cache stats: got %+v", caches)
+	}
+
+	// Users disabled with the CLI are forgotten when the event is published
+	if err := app.users.SetDisabled("test1", true); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "disabled user to be rejected", func() bool {
+		_, err := c.Me(ctx)
+		return errors.Is(err, models.ErrInvalidCredentials)
+	})
+
+	if caches, err := admin.CacheStats(ctx); err != nil || caches.Users.Size == 0 {
+		t.Errorf("cache stats after the change: got %+v (%v)", caches, err)
+	}
+
+	// The role of the admin routes is the cached one: a change that skips
+	// the models is not seen until the user is forgotten
+	if err := app.users.DB.Model(&models.User{}).Where("name = ?", "test3").Update("role", models.RoleUser).Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := admin.CacheStats(ctx); err != nil {
+		t.Errorf("admin route with the cached role: got %v", err)
+	}
+
+	if err := app.users.SetRole("test3", models.RoleUser); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the former admin to be rejected", func() bool {
+		_, err := admin.CacheStats(ctx)
+		return errors.Is(err, models.ErrNotAuthorized)
+	})
+}
+
+func TestSharedUserCache(t *testing.T) {
+	app, _ := newTestServer(t)
+	ctx := context.Background()
+
+	user, err := app.users.GetByName("test1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := int(user.ID)
+
+	// Two instances of the API with the same shared cache
+	shared := &testSharedCache{values: make(map[string][]byte)}
+	first := newUserCache(app.users, 10, time.Minute, shared, app.logger)
+	second := newUserCache(app.users, 10, time.Minute, shared, app.logger)
+
+	if status, err := first.Status(ctx, id); err != nil || !status.Accepts(user.TokenVersion) {
+		t.Fatalf("status: got %+v (%v)", status, err)
+	}
+
+	// Changed behind the caches: the second instance gets the shared status
+	app.users.DB.Model(&models.User{}).Where("id = ?", id).Update("disabled", true)
+
+	if status, err := second.Status(ctx, id); err != nil || status.Disabled {
+		t.Errorf("status from the shared cache: got %+v (%v)", status, err)
+	}
+	if stats := second.Stats(); stats.Misses != 1 || stats.Size != 1 {
+		t.Errorf("stats of the second instance: got %+v", stats)
+	}
+
+	// Forgetting it in one instance clears the shared cache for the others,
+	// once their local entry expires
+	if err := first.Forget(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	second.local.Delete(id)
+
+	if status, err := second.Status(ctx, id); err != nil || !status.Disabled {
+		t.Errorf("status after forgetting it: got %+v (%v)", status, err)
+	}
+
+	if status, err := first.Status(ctx, 1000); err != nil || status.Accepts(0) {
+		t.Errorf("status of a missing user: got %+v (%v)", status, err)
+	}
+}
@@ -0,0 +1,388 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"strconv"
+	"strings"
+
+	"films-api.rdelgado.es/src/internals/models"
+)
+
+const (
+	formatCSV    = "csv"
+	formatNDJSON = "ndjson"
+	formatJSON   = "json"
+
+	onDuplicateSkip   = "skip"
+	onDuplicateUpsert = "upsert"
+
+	// Separator used for the cast members in a single CSV column
+	castSeparator = "|"
+
+	exportBatchSize = 100
+)
+
+var contentTypes = map[string]string{
+	formatCSV:    "text/csv",
+	formatNDJSON: "application/x-ndjson",
+	formatJSON:   "application/json",
+}
+
+// CSV columns in export order. Imports accept them in any order and ignore id and user_id.
+var movieColumns = []string{"id", "title", "director", "release_date", "cast", "genre", "synopsis", "user_id"}
+
+// movieRecord is the interchange format of a movie in imports and exports
+type movieRecord struct {
+	ID          uint     `json:"id,omitempty"`
+	Title       string   `json:"title"`
+	Director    string   `json:"director"`
+	ReleaseDate string   `json:"release_date"`
+	Cast        []string `json:"cast"`
+	Genre       string   `json:"genre"`
+	Synopsis    string   `json:"synopsis"`
+	UserID      uint     `json:"user_id,omitempty"`
+}
+
+type importOptions struct {
+	dryRun      bool
+	onDuplicate string
+
+	// Locale of the row errors (fallback locale if empty)
+	locale string
+}
+
+type importRowError struct {
+	Row    int               `json:"row"`
+	Title  string            `json:"title,omitempty"`
+	Error  string            `json:"error,omitempty"`
+	Fields map[string]string `json:"fields,omitempty"`
+}
+
+type importReport struct {
+	DryRun  bool             `json:"dry_run"`
+	Rows    int              `json:"rows"`
+	Created int              `json:"created"`
+	Updated int              `json:"updated"`
+	Skipped int              `json:"skipped"`
+	Failed  int              `json:"failed"`
+	Errors  []importRowError `json:"errors"`
+}
+
+func formatFromContentType(contentType string) string {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+
+	switch mediaType {
+	case "text/csv":
+		return formatCSV
+	case "application/x-ndjson", "application/jsonl", "application/json-lines":
+		return formatNDJSON
+	default:
+		return ""
+	}
+}
+
+// runMovieImport reads movies from src one row at a time, validates each of them
+// with the same rules used to create a single movie and stores the valid ones.
+// An error is only returned when the stream itself cannot be read, row problems
+// are collected in the report.
+func (app *application) runMovieImport(ctx context.Context, src io.Reader, format string, opts importOptions, userId int) (importReport, error) {
+	report := importReport{DryRun: opts.dryRun, Errors: []importRowError{}}
+
+	next, err := movieRecordReader(src, format)
+	if err != nil {
+		return report, err
+	}
+
+	for {
+		row, record, err := next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		report.Rows++
+
+		if err != nil {
+			var rowErr *rowParseError
+			if !errors.As(err, &rowErr) {
+				return report, err
+			}
+
+			report.Failed++
+			report.Errors = append(report.Errors, importRowError{Row: row, Error: rowErr.Error()})
+			continue
+		}
+
+		app.importMovie(ctx, &report, row, record, opts, userId)
+	}
+
+	return report, nil
+}
+
+func (app *application) importMovie(ctx context.Context, report *importReport, row int, record movieRecord, opts importOptions, userId int) {
+	req := movieRequest{
+		Title:       record.Title,
+		Director:    record.Director,
+		ReleaseDate: record.ReleaseDate,
+		Cast:        record.Cast,
+		Genre:       record.Genre,
+		Synopsis:    record.Synopsis,
+	}
+
+	parsedReleaseDate := req.validate()
+
+	if !req.IsValid() {
+		report.Failed++
+		report.Errors = append(report.Errors, importRowError{Row: row, Title: record.Title, Fields: req.LocalizedFieldErrors(opts.locale)})
+		return
+	}
+
+	existing, err := app.movies.GetByTitle(req.Title)
+	if err != nil && !errors.Is(err, models.ErrNoRecord) {
+		report.Failed++
+		report.Errors = append(report.Errors, importRowError{Row: row, Title: record.Title, Error: err.Error()})
+		return
+	}
+
+	// New movie
+	if errors.Is(err, models.ErrNoRecord) {
+		if !opts.dryRun {
+			_, err := app.movies.WithContext(ctx).Insert(req.Title, req.Director, req.Genre, req.Synopsis, parsedReleaseDate, req.Cast, userId)
+			if err != nil {
+				report.Failed++
+				report.Errors = append(report.Errors, importRowError{Row: row, Title: record.Title, Error: err.Error()})
+				return
+			}
+		}
+
+		report.Created++
+		return
+	}
+
+	// Duplicated title
+	if opts.onDuplicate == onDuplicateSkip {
+		report.Skipped++
+		return
+	}
+
+	// Only the creator of a movie can update it, as in updateMovie
+	if existing.UserID != uint(userId) {
+		report.Failed++
+		report.Errors = append(report.Errors, importRowError{Row: row, Title: record.Title, Error: models.ErrNotAuthorized.Error()})
+		return
+	}
+
+	if !opts.dryRun {
+		existing.Director = req.Director
+		existing.ReleaseDate = parsedReleaseDate
+		existing.Cast = req.Cast
+		existing.Genre = req.Genre
+		existing.Synopsis = req.Synopsis
+
+		err := app.movies.WithContext(ctx).Update(existing)
+		if err != nil {
+			report.Failed++
+			report.Errors = append(report.Errors, importRowError{Row: row, Title: record.Title, Error: err.Error()})
+			return
+		}
+	}
+
+	report.Updated++
+}
+
+// rowParseError is returned for a row that cannot be decoded. The import goes on
+// with the next row.
+type rowParseError struct {
+	err error
+}
+
+func (e *rowParseError) Error() string {
+	return e.err.Error()
+}
+
+// movieRecordReader returns an iterator over the rows of src. It returns the row
+// number (1 based, CSV header excluded) and the decoded record, or io.EOF once
+// the stream has been consumed.
+func movieRecordReader(src io.Reader, format string) (func() (int, movieRecord, error), error) {
+	row := 0
+
+	switch format {
+	case formatCSV:
+		reader := csv.NewReader(src)
+		reader.FieldsPerRecord = -1
+
+		header, err := reader.Read()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil, errors.New("csv stream is empty")
+			}
+			return nil, err
+		}
+
+		columns := make(map[string]int, len(header))
+		for i, name := range header {
+			columns[strings.ToLower(strings.TrimSpace(name))] = i
+		}
+
+		for _, name := range []string{"title", "director", "release_date", "cast", "genre", "synopsis"} {
+			if _, exists := columns[name]; !exists {
+				return nil, fmt.Errorf("csv header is missing column %q", name)
+			}
+		}
+
+		return func() (int, movieRecord, error) {
+			fields, err := reader.Read()
+			row++
+			if err != nil {
+				var parseErr *csv.ParseError
+				if errors.As(err, &parseErr) {
+					return row, movieRecord{}, &rowParseError{err}
+				}
+				return row, movieRecord{}, err
+			}
+
+			column := func(name string) string {
+				if i := columns[name]; i < len(fields) {
+					return strings.TrimSpace(fields[i])
+				}
+				return ""
+			}
+
+			var cast []string
+			for _, member := range strings.Split(column("cast"), castSeparator) {
+				if member = strings.TrimSpace(member); member != "" {
+					cast = append(cast, member)
+				}
+			}
+
+			return row, movieRecord{
+				Title:       column("title"),
+				Director:    column("director"),
+				ReleaseDate: column("release_date"),
+				Cast:        cast,
+				Genre:       column("genre"),
+				Synopsis:    column("synopsis"),
+			}, nil
+		}, nil
+
+	case formatNDJSON:
+		scanner := bufio.NewScanner(src)
+		scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+		return func() (int, movieRecord, error) {
+			for scanner.Scan() {
+				row++
+
+				line := strings.TrimSpace(scanner.Text())
+				if line == "" {
+					continue
+				}
+
+				var record movieRecord
+				if err := json.Unmarshal([]byte(line), &record); err != nil {
+					return row, movieRecord{}, &rowParseError{err}
+				}
+
+				return row, record, nil
+			}
+
+			if err := scanner.Err(); err != nil {
+				return row, movieRecord{}, err
+			}
+
+			return row, movieRecord{}, io.EOF
+		}, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported import format %q", format)
+	}
+}
+
+// writeMovieExport streams every movie matching the filters to dst
+func (app *application) writeMovieExport(dst io.Writer, format string, filters map[string]interface{}) error {
+	switch format {
+	case formatCSV:
+		writer := csv.NewWriter(dst)
+		if err := writer.Write(movieColumns); err != nil {
+			return err
+		}
+
+		err := app.movies.Each(filters, exportBatchSize, func(movie models.Movie) error {
+			record := newMovieRecord(movie)
+			return writer.Write([]string{
+				strconv.Itoa(int(record.ID)),
+				record.Title,
+				record.Director,
+				record.ReleaseDate,
+				strings.Join(record.Cast, castSeparator),
+				record.Genre,
+				record.Synopsis,
+				strconv.Itoa(int(record.UserID)),
+			})
+		})
+		if err != nil {
+			return err
+		}
+
+		writer.Flush()
+		return writer.Error()
+
+	case formatNDJSON:
+		encoder := json.NewEncoder(dst)
+
+		return app.movies.Each(filters, exportBatchSize, func(movie models.Movie) error {
+			return encoder.Encode(newMovieRecord(movie))
+		})
+
+	case formatJSON:
+		if _, err := io.WriteString(dst, "["); err != nil {
+			return err
+		}
+
+		first := true
+		err := app.movies.Each(filters, exportBatchSize, func(movie models.Movie) error {
+			if !first {
+				if _, err := io.WriteString(dst, ","); err != nil {
+					return err
+				}
+			}
+			first = false
+
+			record, err := json.Marshal(newMovieRecord(movie))
+			if err != nil {
+				return err
+			}
+
+			_, err = dst.Write(record)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+
+		_, err = io.WriteString(dst, "]\n")
+		return err
+
+	default:
+		return fmt.Errorf("unsupported export format %q", format)
+	}
+}
+
+func newMovieRecord(movie models.Movie) movieRecord {
+	return movieRecord{
+		ID:          movie.ID,
+		Title:       movie.Title,
+		Director:    movie.Director,
+		ReleaseDate: movie.ReleaseDate.Format("2006-01-02"),
+		Cast:        movie.Cast,
+		Genre:       movie.Genre,
+		Synopsis:    movie.Synopsis,
+		UserID:      movie.UserID,
+	}
+}
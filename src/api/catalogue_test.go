@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"films-api.rdelgado.es/src/internals/models"
+)
+
+func TestMovieImport(t *testing.T) {
+	app, _ := newTestServer(t)
+	ctx := context.Background()
+
+	owner, err := app.users.GetByName("test1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := app.users.GetByName("test2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	heat := "title,director,release_date,cast,genre,synopsis\n" +
+		"Heat,Michael Mann,1995-12-15,Al Pacino|Robert De Niro,Crime,Bank robbers and a detective.\n"
+	if _, err := app.runMovieImport(ctx, strings.NewReader(heat), formatCSV, importOptions{onDuplicate: onDuplicateSkip}, int(owner.ID)); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		format  string
+		input   string
+		opts    importOptions
+		userId  uint
+		want    importReport
+		wantErr bool
+	}{
+		{
+			name:   "csv columns in any order",
+			format: formatCSV,
+			input: "genre,title,synopsis,cast,director,release_date,id\n" +
+				"Thriller,Collateral,A hitman and a cab driver.,Tom Cruise,Michael Mann,2004-08-06,99\n",
+			opts: importOptions{onDuplicate: onDuplicateSkip},
+			want: importReport{Rows: 1, Created: 1},
+		},
+		{
+			name:   "invalid rows",
+			format: formatCSV,
+			input: "title,director,release_date,cast,genre,synopsis\n" +
+				"Broken,,not a date,,,\n" +
+				"\"Unclosed,Director,2000-01-01,,Drama,Quote\n",
+			opts: importOptions{onDuplicate: onDuplicateSkip},
+			want: importReport{Rows: 2, Failed: 2},
+		},
+		{
+			name:   "duplicate skipped",
+			format: formatNDJSON,
+			input:  `{"title":"Heat","director":"Michael Mann","release_date":"1995-12-15","cast":["Al Pacino"],"genre":"Crime","synopsis":"Again."}` + "\n",
+			opts:   importOptions{onDuplicate: onDuplicateSkip},
+			want:   importReport{Rows: 1, Skipped: 1},
+		},
+		{
+			name:   "duplicate of another user",
+			format: formatNDJSON,
+			input:  `{"title":"Heat","director":"Michael Mann","release_date":"1995-12-15","cast":["Al Pacino"],"genre":"Crime","synopsis":"Again."}` + "\n",
+			opts:   importOptions{onDuplicate: onDuplicateUpsert},
+			userId: other.ID,
+			want:   importReport{Rows: 1, Failed: 1},
+		},
+		{
+			name:   "dry run",
+			format: formatNDJSON,
+			input: `{"title":"Thief","director":"Michael Mann","release_date":"1981-03-27","cast":["James Caan"],"genre":"Crime","synopsis":"A safecracker."}` + "\n\n" +
+				`{"title":"Heat","director":"Michael Mann","release_date":"1995-12-15","cast":["Al Pacino"],"genre":"Crime","synopsis":"Updated."}` + "\n" +
+				"{not json}\n",
+			opts: importOptions{onDuplicate: onDuplicateUpsert, dryRun: true},
+			want: importReport{DryRun: true, Rows: 3, Created: 1, Updated: 1, Failed: 1},
+		},
+		{name: "empty csv", format: formatCSV, input: "", wantErr: true},
+		{name: "missing column", format: formatCSV, input: "title,director\nHeat,Michael Mann\n", wantErr: true},
+		{name: "unknown format", format: "xml", input: "<movies/>", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			userId := tt.userId
+			if userId == 0 {
+				userId = owner.ID
+			}
+
+			report, err := app.runMovieImport(ctx, strings.NewReader(tt.input), tt.format, tt.opts, int(userId))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want one: %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if report.DryRun != tt.want.DryRun || report.Rows != tt.want.Rows || report.Created != tt.want.Created ||
+				report.Updated != tt.want.Updated || report.Skipped != tt.want.Skipped || report.Failed != tt.want.Failed {
+				t.Errorf("got %+v, want %+v", report, tt.want)
+			}
+			if len(report.Errors) != tt.want.Failed {
+				t.Errorf("got %d row errors, want %d", len(report.Errors), tt.want.Failed)
+			}
+		})
+	}
+
+	// Dry runs do not save anything
+	if _, err := app.movies.GetByTitle("Thief"); err != models.ErrNoRecord {
+		t.Errorf("movie of a dry run: got %v, want %v", err, models.ErrNoRecord)
+	}
+	if movie, err := app.movies.GetByTitle("Heat"); err != nil || movie.Synopsis != "Bank robbers and a detective." {
+		t.Errorf("movie updated by a dry run: got %+v (%v)", movie, err)
+	}
+}
+
+func TestMovieImportRequest(t *testing.T) {
+	_, server := newTestServer(t)
+	token := loginFrom(t, server.URL, "test1", "test")
+
+	ndjson := `{"title":"Thief","director":"Michael Mann","release_date":"1981-03-27","cast":["James Caan"],"genre":"Crime","synopsis":"A safecracker."}` + "\n"
+
+	tests := []struct {
+		name        string
+		query       string
+		contentType string
+		status      int
+		field       string
+	}{
+		{name: "format from the content type", query: "?dry_run=true", contentType: "application/x-ndjson", status: http.StatusOK},
+		{name: "format from the query", query: "?format=ndjson&dry_run=true", contentType: "text/plain", status: http.StatusOK},
+		{name: "unknown format", query: "?format=xml", contentType: "application/xml", status: http.StatusUnprocessableEntity, field: "format"},
+		{name: "unknown duplicate option", query: "?format=ndjson&on_duplicate=replace", status: http.StatusUnprocessableEntity, field: "on_duplicate"},
+		{name: "unreadable stream", query: "?format=csv", contentType: "text/csv", status: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := ndjson
+			if tt.contentType == "text/csv" {
+				body = ""
+			}
+
+			req, _ := http.NewRequest(http.MethodPost, server.URL+"/movies/import"+tt.query, strings.NewReader(body))
+			req.Header.Set("Authorization", "Bearer "+token)
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+
+			res, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+
+			if res.StatusCode != tt.status {
+				t.Fatalf("got %d, want %d", res.StatusCode, tt.status)
+			}
+
+			if tt.field != "" {
+				var fields map[string]interface{}
+				json.NewDecoder(res.Body).Decode(&fields)
+				if !strings.Contains(fieldsJSON(fields), tt.field) {
+					t.Errorf("got errors %v, want one for %s", fields, tt.field)
+				}
+			}
+		})
+	}
+}
+
+// fieldsJSON encodes a decoded error response to look for the field names
+func fieldsJSON(fields map[string]interface{}) string {
+	encoded, _ := json.Marshal(fields)
+	return string(encoded)
+}
+
+func TestMovieExport(t *testing.T) {
+	_, server := newTestServer(t)
+	token := loginFrom(t, server.URL, "test1", "test")
+
+	count := func(t *testing.T, format, body string) int {
+		t.Helper()
+
+		switch format {
+		case formatCSV:
+			rows, err := csv.NewReader(strings.NewReader(body)).ReadAll()
+			if err != nil || len(rows) == 0 || strings.Join(rows[0], ",") != strings.Join(movieColumns, ",") {
+				t.Fatalf("csv export: got %q (%v)", body, err)
+			}
+			return len(rows) - 1
+		case formatNDJSON:
+			n := 0
+			scanner := bufio.NewScanner(strings.NewReader(body))
+			for scanner.Scan() {
+				var record movieRecord
+				if err := json.Unmarshal(scanner.Bytes(), &record); err != nil || record.Title == "" {
+					t.Fatalf("ndjson line %q (%v)", scanner.Text(), err)
+				}
+				n++
+			}
+			return n
+		default:
+			var records []movieRecord
+			if err := json.Unmarshal([]byte(body), &records); err != nil {
+				t.Fatalf("json export: got %q (%v)", body, err)
+			}
+			return len(records)
+		}
+	}
+
+	_, all := getWith(t, server.URL+"/movies/export", token, nil)
+	total := count(t, formatJSON, all)
+	if total == 0 {
+		t.Fatal("the export has no movies")
+	}
+
+	for _, format := range []string{formatCSV, formatNDJSON, formatJSON} {
+		t.Run(format, func(t *testing.T) {
+			res, body := getWith(t, server.URL+"/movies/export?format="+format, token, nil)
+			if res.StatusCode != http.StatusOK || res.Header.Get("Content-Type") != contentTypes[format] {
+				t.Fatalf("got %d %v", res.StatusCode, res.Header)
+			}
+			if got := count(t, format, body); got != total {
+				t.Errorf("got %d movies, want %d", got, total)
+			}
+
+			// Filters are the ones of GET /movies
+			_, filtered := getWith(t, server.URL+"/movies/export?format="+format+"&year=1800", token, nil)
+			if got := count(t, format, filtered); got != 0 {
+				t.Errorf("movies of 1800: got %d", got)
+			}
+		})
+	}
+
+	for _, query := range []string{"?format=xml", "?year=abc"} {
+		if res, _ := getWith(t, server.URL+"/movies/export"+query, token, nil); res.StatusCode != http.StatusBadRequest {
+			t.Errorf("exporting with %s: got %d, want %d", query, res.StatusCode, http.StatusBadRequest)
+		}
+	}
+}
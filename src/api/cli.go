@@ -0,0 +1,346 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"films-api.rdelgado.es/src/internals/audit"
+	"films-api.rdelgado.es/src/internals/authentication"
+	"films-api.rdelgado.es/src/internals/i18n"
+	"films-api.rdelgado.es/src/internals/models"
+	"films-api.rdelgado.es/src/internals/seed"
+	"films-api.rdelgado.es/src/internals/validator"
+	"gorm.io/gorm"
+)
+
+// command runs the admin commands. The application is opened once the
+// arguments are valid, and the output is written to out.
+type command struct {
+	cfg    config
+	logger *slog.Logger
+	in     io.Reader
+	out    io.Writer
+	open   func() (*application, *gorm.DB, error)
+}
+
+func newCommand(cfg config, logger *slog.Logger) *command {
+	return &command{
+		cfg:    cfg,
+		logger: logger,
+		in:     os.Stdin,
+		out:    os.Stdout,
+		open: func() (*application, *gorm.DB, error) {
+			return newApplication(cfg, logger)
+		},
+	}
+}
+
+func (c *command) runMigrate() error {
+	_, db, err := c.open()
+	if err != nil {
+		return err
+	}
+
+	c.logger.Info("migrating database schema...")
+
+	return migrate(db)
+}
+
+func (c *command) runSeed(args []string) error {
+	flags := flag.NewFlagSet("seed", flag.ContinueOnError)
+	dir := flags.String("dir", c.cfg.seedDir, "directory with the fixtures of each environment")
+	env := flags.String("env", c.cfg.env, "environment whose fixtures are loaded (production never seeds passwords)")
+	file := flags.String("file", "", "single YAML or JSON fixtures file, loaded instead of the directory")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	_, db, err := c.open()
+	if err != nil {
+		return err
+	}
+
+	var set seed.Set
+	if *file != "" {
+		set, err = seed.LoadFile(*file)
+	} else {
+		set, err = seed.LoadDir(*dir, *env)
+	}
+	if err != nil {
+		return err
+	}
+
+	return seedFixtures(db, c.logger, set, *env)
+}
+
+func (c *command) runUser(args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: movies-api user create|disable|enable|reset-password|reset-mfa|set-role [arguments]")
+	}
+
+	action := args[0]
+	flags := flag.NewFlagSet("user "+action, flag.ContinueOnError)
+	name := flags.String("name", "", "name of the user")
+
+	var password, role *string
+	switch action {
+	case "create":
+		password = flags.String("password", "", "password of the new user")
+		role = flags.String("role", models.RoleUser, "role of the new user (user, editor or admin)")
+	case "reset-password":
+		password = flags.String("password", "", "new password of the user")
+	case "set-role":
+		role = flags.String("role", "", "new role of the user (user, editor or admin)")
+	case "disable", "enable", "reset-mfa":
+	default:
+		return fmt.Errorf("unknown user command %q", action)
+	}
+
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	if *name == "" {
+		return errors.New("--name is required")
+	}
+
+	// Same rules applied to users signing up through the API
+	var v validator.Validator
+	if password != nil {
+		v.CheckStruct(signupRequest{Name: *name, Password: *password})
+	}
+	if role != nil {
+		v.CheckFieldMessage(validator.PermittedValue(*role, models.Roles...), "role",
+			i18n.NewMessage("validation.oneof", i18n.Params{"values": strings.Join(models.Roles, ", ")}))
+	}
+
+	if !v.IsValid() {
+		return fmt.Errorf("invalid arguments: %v", v.FieldErrors)
+	}
+
+	app, _, err := c.open()
+	if err != nil {
+		return err
+	}
+
+	switch action {
+	case "create":
+		err = app.users.InsertWithRole(*name, *password, *role)
+	case "disable":
+		err = app.users.SetDisabled(*name, true)
+	case "enable":
+		err = app.users.SetDisabled(*name, false)
+	case "reset-password":
+		err = app.users.SetPassword(*name, *password)
+	case "reset-mfa":
+		err = app.users.ResetTOTP(*name)
+	case "set-role":
+		err = app.users.SetRole(*name, *role)
+	}
+
+	if err != nil {
+		return fmt.Errorf("user %q: %w", *name, err)
+	}
+
+	c.logger.Info("user updated", "action", action, "name", *name)
+
+	return nil
+}
+
+func (c *command) runMovie(args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: movies-api movie import|export|purge [arguments]")
+	}
+
+	action := args[0]
+	flags := flag.NewFlagSet("movie "+action, flag.ContinueOnError)
+	format := flags.String("format", "", "csv or ndjson for imports, csv, ndjson or json for exports")
+	file := flags.String("file", "", "file to read from or write to (stdin or stdout if empty)")
+
+	var user, onDuplicate, title, genre *string
+	var dryRun *bool
+	var year, days *int
+	switch action {
+	case "import":
+		user = flags.String("user", "", "name of the user set as creator of the imported movies")
+		onDuplicate = flags.String("on-duplicate", onDuplicateSkip, "skip or upsert movies whose title already exists")
+		dryRun = flags.Bool("dry-run", false, "validate the rows without saving any movie")
+	case "export":
+		title = flags.String("title", "", "export movies with a similar title")
+		genre = flags.String("genre", "", "export movies of the genre")
+		year = flags.Int("year", 0, "export movies released in the year")
+	case "purge":
+		days = flags.Int("days", int(c.cfg.trashRetention.Hours()/24), "purge the movies deleted more than these days ago")
+	default:
+		return fmt.Errorf("unknown movie command %q", action)
+	}
+
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	app, _, err := c.open()
+	if err != nil {
+		return err
+	}
+
+	if action == "purge" {
+		if *days < 0 {
+			return errors.New("--days must not be negative")
+		}
+
+		app.movies.TrashRetention = time.Duration(*days) * 24 * time.Hour
+
+		purged, err := app.trash.Purge(context.Background(), time.Now())
+		if err != nil {
+			return err
+		}
+
+		c.logger.Info("trash purged", "movies", purged, "days", *days)
+
+		return nil
+	}
+
+	if action == "export" {
+		if *format == "" {
+			*format = formatJSON
+		}
+
+		filters := make(map[string]interface{})
+		if *title != "" {
+			filters["title"] = *title
+		}
+		if *genre != "" {
+			filters["genre"] = *genre
+		}
+		if *year > 0 {
+			filters["year"] = *year
+		}
+
+		dst := c.out
+		if *file != "" {
+			f, err := os.Create(*file)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			dst = f
+		}
+
+		return app.writeMovieExport(dst, *format, filters)
+	}
+
+	if !validator.PermittedValue(*onDuplicate, onDuplicateSkip, onDuplicateUpsert) {
+		return errors.New("--on-duplicate must be skip or upsert")
+	}
+
+	creator, err := app.users.GetByName(*user)
+	if err != nil {
+		return fmt.Errorf("user %q: %w", *user, err)
+	}
+
+	src := c.in
+	if *file != "" {
+		f, err := os.Open(*file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		src = f
+	}
+
+	// The movies are imported on behalf of the user
+	ctx := audit.NewContext(context.Background(), audit.Actor{UserID: int(creator.ID)})
+
+	report, err := app.runMovieImport(ctx, src, *format, importOptions{dryRun: *dryRun, onDuplicate: *onDuplicate}, int(creator.ID))
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(c.out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
+
+func (c *command) runRepair(args []string) error {
+	flags := flag.NewFlagSet("repair", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "only report the rows referencing missing records")
+	owner := flags.String("owner", "", "name of the user given the movies of missing users")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	app, db, err := c.open()
+	if err != nil {
+		return err
+	}
+
+	var orphans []models.Orphans
+	if *dryRun {
+		orphans, err = models.FindOrphans(db)
+	} else {
+		var ownerId uint
+		if *owner != "" {
+			user, err := app.users.GetByName(*owner)
+			if err != nil {
+				return fmt.Errorf("user %q: %w", *owner, err)
+			}
+			ownerId = user.ID
+		}
+
+		orphans, err = models.RepairOrphans(db, ownerId)
+	}
+	if err != nil {
+		return err
+	}
+
+	c.logger.Info("orphaned rows", "tables", len(orphans), "dry_run", *dryRun)
+
+	encoder := json.NewEncoder(c.out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(orphans)
+}
+
+func (c *command) runToken(args []string) error {
+	if len(args) == 0 || args[0] != "issue" {
+		return errors.New("usage: movies-api token issue --user <name>")
+	}
+
+	flags := flag.NewFlagSet("token issue", flag.ContinueOnError)
+	name := flags.String("user", "", "name of the user")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	app, _, err := c.open()
+	if err != nil {
+		return err
+	}
+
+	user, err := app.users.GetByName(*name)
+	if err != nil {
+		return fmt.Errorf("user %q: %w", *name, err)
+	}
+
+	session, err := app.sessions.Create(int(user.ID), "movies-api token issue", "", authentication.TokenTTL)
+	if err != nil {
+		return err
+	}
+
+	token, err := app.tokens.CreateToken(int(user.ID), user.TokenVersion, session.Key)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(c.out, token)
+
+	return nil
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"films-api.rdelgado.es/src/internals/models"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newTestCommand runs the commands against the database of the test server.
+// opened reports if the command got as far as opening the application.
+func newTestCommand(app *application, db *gorm.DB) (c *command, out *bytes.Buffer, opened *bool) {
+	out, opened = new(bytes.Buffer), new(bool)
+
+	c = &command{
+		cfg:    config{env: "development"},
+		logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+		in:     strings.NewReader(""),
+		out:    out,
+		open: func() (*application, *gorm.DB, error) {
+			*opened = true
+			return app, db, nil
+		},
+	}
+
+	return c, out, opened
+}
+
+func TestUserCommand(t *testing.T) {
+	app, _ := newTestServer(t)
+
+	tests := []struct {
+		name     string
+		args     []string
+		wantErr  bool
+		wantRole string
+	}{
+		{name: "create", args: []string{"create", "--name", "cli1", "--password", testPassword}, wantRole: models.RoleUser},
+		{name: "create with role", args: []string{"create", "--name", "cli2", "--password", testPassword, "--role", models.RoleEditor}, wantRole: models.RoleEditor},
+		{name: "set role", args: []string{"set-role", "--name", "cli1", "--role", models.RoleAdmin}, wantRole: models.RoleAdmin},
+		{name: "existing name", args: []string{"create", "--name", "test1", "--password", testPassword}, wantErr: true},
+		{name: "unknown role", args: []string{"create", "--name", "cli3", "--password", testPassword, "--role", "owner"}, wantErr: true},
+		{name: "weak password", args: []string{"create", "--name", "cli3", "--password", "short"}, wantErr: true},
+		{name: "missing name", args: []string{"disable"}, wantErr: true},
+		{name: "missing user", args: []string{"disable", "--name", "nobody"}, wantErr: true},
+		{name: "unknown flag", args: []string{"enable", "--name", "cli1", "--force"}, wantErr: true},
+		{name: "unknown action", args: []string{"remove", "--name", "cli1"}, wantErr: true},
+		{name: "no action", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _, _ := newTestCommand(app, app.users.DB)
+
+			err := c.runUser(tt.args)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want one: %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			user, err := app.users.GetByName(tt.args[2])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if user.Role != tt.wantRole {
+				t.Errorf("role: got %q, want %q", user.Role, tt.wantRole)
+			}
+		})
+	}
+
+	// Invalid arguments are rejected before opening the database
+	c, _, opened := newTestCommand(app, app.users.DB)
+	if err := c.runUser([]string{"create", "--name", "cli4", "--password", testPassword, "--role", "owner"}); err == nil || *opened {
+		t.Errorf("creating a user with an unknown role: got %v, opened %v", err, *opened)
+	}
+
+	if err := c.runUser([]string{"disable", "-h"}); !errors.Is(err, flag.ErrHelp) {
+		t.Errorf("asking for help: got %v, want %v", err, flag.ErrHelp)
+	}
+}
+
+// A user is created with its role at once, or not at all
+func TestUserCommandCreateFails(t *testing.T) {
+	tests := []struct {
+		name    string
+		fail    func(db *gorm.DB) error
+		wantErr bool
+	}{
+		{
+			name: "updates fail",
+			fail: func(db *gorm.DB) error {
+				return db.Callback().Update().Before("gorm:update").Register("fail", func(tx *gorm.DB) {
+					tx.AddError(errors.New("update failed"))
+				})
+			},
+		},
+		{
+			name: "events fail",
+			fail: func(db *gorm.DB) error {
+				return db.Callback().Create().Before("gorm:create").Register("fail", func(tx *gorm.DB) {
+					if tx.Statement.Table == "outbox_events" {
+						tx.AddError(errors.New("event failed"))
+					}
+				})
+			},
+			wantErr: true,
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, err := gorm.Open(sqlite.Open(fmt.Sprintf("file:TestUserCommandCreateFails%d?mode=memory&cache=shared", i)), &gorm.Config{
+				TranslateError: true,
+				Logger:         logger.Default.LogMode(logger.Silent),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := migrate(db); err != nil {
+				t.Fatal(err)
+			}
+			if err := tt.fail(db); err != nil {
+				t.Fatal(err)
+			}
+
+			app := &application{users: &models.UserModel{DB: db}}
+			c, _, _ := newTestCommand(app, db)
+
+			err = c.runUser([]string{"create", "--name", "editor", "--password", testPassword, "--role", models.RoleEditor})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want one: %v", err, tt.wantErr)
+			}
+
+			user, err := app.users.GetByName("editor")
+			if tt.wantErr {
+				if !errors.Is(err, models.ErrNoRecord) {
+					t.Errorf("user of a failed command: got %+v (%v)", user, err)
+				}
+				return
+			}
+			if err != nil || user.Role != models.RoleEditor {
+				t.Errorf("created user: got %+v (%v)", user, err)
+			}
+		})
+	}
+}
+
+func TestMovieCommand(t *testing.T) {
+	app, _ := newTestServer(t)
+
+	ndjson := `{"title":"Thief","director":"Michael Mann","release_date":"1981-03-27","cast":["James Caan"],"genre":"Crime","synopsis":"A safecracker."}` + "\n"
+
+	tests := []struct {
+		name    string
+		args    []string
+		input   string
+		wantErr bool
+		want    importReport
+	}{
+		{name: "dry run", args: []string{"import", "--format", "ndjson", "--user", "test1", "--dry-run"}, input: ndjson, want: importReport{DryRun: true, Rows: 1, Created: 1}},
+		{name: "import", args: []string{"import", "--format", "ndjson", "--user", "test1"}, input: ndjson, want: importReport{Rows: 1, Created: 1}},
+		{name: "skip duplicates", args: []string{"import", "--format", "ndjson", "--user", "test1"}, input: ndjson, want: importReport{Rows: 1, Skipped: 1}},
+		{name: "invalid rows", args: []string{"import", "--format", "csv", "--user", "test1"}, input: "title,director,release_date,cast,genre,synopsis\nBroken,,,,,\n", want: importReport{Rows: 1, Failed: 1}},
+		{name: "unknown format", args: []string{"import", "--format", "xml", "--user", "test1"}, input: "<movies/>", wantErr: true},
+		{name: "no format", args: []string{"import", "--user", "test1"}, input: ndjson, wantErr: true},
+		{name: "missing column", args: []string{"import", "--format", "csv", "--user", "test1"}, input: "title\nHeat\n", wantErr: true},
+		{name: "unknown duplicate option", args: []string{"import", "--format", "ndjson", "--user", "test1", "--on-duplicate", "replace"}, input: ndjson, wantErr: true},
+		{name: "missing user", args: []string{"import", "--format", "ndjson", "--user", "nobody"}, input: ndjson, wantErr: true},
+		{name: "missing file", args: []string{"import", "--format", "ndjson", "--user", "test1", "--file", "missing.ndjson"}, wantErr: true},
+		{name: "unknown action", args: []string{"delete"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, out, _ := newTestCommand(app, app.users.DB)
+			c.in = strings.NewReader(tt.input)
+
+			err := c.runMovie(tt.args)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want one: %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			var report importReport
+			if err := json.Unmarshal(out.Bytes(), &report); err != nil {
+				t.Fatalf("report %q: %v", out, err)
+			}
+			if report.DryRun != tt.want.DryRun || report.Rows != tt.want.Rows || report.Created != tt.want.Created ||
+				report.Skipped != tt.want.Skipped || report.Failed != tt.want.Failed {
+				t.Errorf("got %+v, want %+v", report, tt.want)
+			}
+		})
+	}
+
+	c, out, _ := newTestCommand(app, app.users.DB)
+	if err := c.runMovie([]string{"export", "--format", "csv", "--title", "Thief"}); err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSpace(out.String()), "\n"); len(lines) != 2 || !strings.Contains(lines[1], ",Thief,") {
+		t.Errorf("exported movies: got %q", out)
+	}
+}
+
+func TestRepairCommand(t *testing.T) {
+	// A database created before the foreign keys
+	db, err := gorm.Open(sqlite.Open("file:TestRepairCommand?mode=memory&cache=shared"), &gorm.Config{
+		TranslateError:                           true,
+		DisableForeignKeyConstraintWhenMigrating: true,
+		Logger:                                   logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := migrate(db); err != nil {
+		t.Fatal(err)
+	}
+
+	owner := models.User{Name: "owner", Password: "x"}
+	db.Create(&owner)
+	db.Create(&models.Movie{Title: "Orphan", UserID: 99})
+	db.Create(&models.Favourite{UserID: 99, MovieID: 1})
+
+	app := &application{users: &models.UserModel{DB: db}}
+
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr bool
+		want    []models.Orphans
+	}{
+		{
+			name: "dry run",
+			args: []string{"--dry-run", "--owner", "nobody"},
+			want: []models.Orphans{
+				{Table: "movies", Column: "user_id", References: "users", Rows: 1, Fix: models.OrphanReassign},
+				{Table: "favourites", Column: "user_id", References: "users", Rows: 1, Fix: models.OrphanDelete},
+			},
+		},
+		{name: "no owner", wantErr: true},
+		{name: "missing owner", args: []string{"--owner", "nobody"}, wantErr: true},
+		{
+			name: "repair",
+			args: []string{"--owner", "owner"},
+			want: []models.Orphans{
+				{Table: "movies", Column: "user_id", References: "users", Rows: 1, Fix: models.OrphanReassign},
+				{Table: "favourites", Column: "user_id", References: "users", Rows: 1, Fix: models.OrphanDelete},
+			},
+		},
+		{name: "nothing left", args: []string{"--dry-run"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, out, _ := newTestCommand(app, db)
+
+			err := c.runRepair(tt.args)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want one: %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			var got []models.Orphans
+			if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+				t.Fatalf("output %q: %v", out, err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %+v, want %+v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("got %+v, want %+v", got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestTokenCommand(t *testing.T) {
+	app, _ := newTestServer(t)
+
+	c, out, _ := newTestCommand(app, app.users.DB)
+	if err := c.runToken([]string{"issue", "--user", "test1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	user, err := app.users.GetByName("test1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := app.tokens.VerifyToken(strings.TrimSpace(out.String()))
+	if err != nil || claims.UserID != int(user.ID) {
+		t.Errorf("issued token: got %+v (%v)", claims, err)
+	}
+
+	for _, args := range [][]string{nil, {"revoke"}, {"issue", "--user", "nobody"}} {
+		if err := c.runToken(args); err == nil {
+			t.Errorf("token %v: got no error", args)
+		}
+	}
+}
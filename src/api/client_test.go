@@ -0,0 +1,311 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"films-api.rdelgado.es/pkg/client"
+	"films-api.rdelgado.es/src/internals/models"
+)
+
+func TestClientAuthentication(t *testing.T) {
+	_, server := newTestServer(t)
+	ctx := context.Background()
+
+	// Logs in on the first call
+	c := client.New(server.URL, client.WithCredentials("test1", testPassword))
+	if _, err := c.Movies(ctx, client.MovieFilter{}); err != nil {
+		t.Fatalf("listing movies: %v", err)
+	}
+	if c.Token() == "" {
+		t.Fatal("client did not log in")
+	}
+
+	if err := c.RefreshToken(ctx); err != nil {
+		t.Fatalf("refreshing token: %v", err)
+	}
+
+	// Wrong credentials
+	err := client.New(server.URL).Login(ctx, "test1", "Wrong.pass1")
+	if !errors.Is(err, models.ErrInvalidCredentials) {
+		t.Errorf("login with wrong password: got %v, want %v", err, models.ErrInvalidCredentials)
+	}
+
+	// Rejected token: the client logs in again and retries
+	c = client.New(server.URL, client.WithToken("not-a-token"), client.WithCredentials("test2", testPassword))
+	if _, err := c.Movies(ctx, client.MovieFilter{}); err != nil {
+		t.Errorf("retrying with a new token: %v", err)
+	}
+
+	// No credentials
+	_, err = client.New(server.URL).Movies(ctx, client.MovieFilter{})
+	if !errors.Is(err, models.ErrInvalidCredentials) {
+		t.Errorf("anonymous request: got %v, want %v", err, models.ErrInvalidCredentials)
+	}
+
+	// Sign up
+	anonymous := client.New(server.URL)
+	if err := anonymous.Signup(ctx, "alice", "Secret.pass1"); err != nil {
+		t.Fatalf("signup: %v", err)
+	}
+	if err := anonymous.Signup(ctx, "alice", "Secret.pass1"); !errors.Is(err, models.ErrDuplicatedEntry) {
+		t.Errorf("duplicated signup: got %v, want %v", err, models.ErrDuplicatedEntry)
+	}
+
+	var apiErr *client.Error
+	err = anonymous.Signup(ctx, "bob", "weak")
+	if !errors.As(err, &apiErr) || apiErr.Fields["password"] == "" {
+		t.Errorf("weak password: got %v, want a password field error", err)
+	}
+}
+
+func TestClientMovies(t *testing.T) {
+	_, server := newTestServer(t)
+	ctx := context.Background()
+
+	owner := client.New(server.URL, client.WithCredentials("test1", testPassword))
+	other := client.New(server.URL, client.WithCredentials("test2", testPassword))
+
+	input := client.MovieInput{
+		Title:       "Heat",
+		Director:    "Michael Mann",
+		ReleaseDate: time.Date(1995, time.December, 15, 0, 0, 0, 0, time.UTC),
+		Cast:        []string{"Al Pacino", "Robert De Niro"},
+		Genre:       "Crime",
+		Synopsis:    "A group of professional bank robbers is tracked by a detective.",
+	}
+
+	id, err := owner.CreateMovie(ctx, input)
+	if err != nil {
+		t.Fatalf("creating movie: %v", err)
+	}
+
+	if _, err := owner.CreateMovie(ctx, input); !errors.Is(err, models.ErrDuplicatedEntry) {
+		t.Errorf("duplicated movie: got %v, want %v", err, models.ErrDuplicatedEntry)
+	}
+
+	movie, err := owner.Movie(ctx, id)
+	if err != nil {
+		t.Fatalf("getting movie: %v", err)
+	}
+	if movie.Movie.Title != input.Title || len(movie.Movie.Cast) != 2 || !movie.Movie.ReleaseDate.Equal(input.ReleaseDate) {
+		t.Errorf("got movie %+v, want %+v", movie.Movie, input)
+	}
+
+	if err := owner.UpdateMovie(ctx, id, client.MovieInput{Genre: "Thriller"}); err != nil {
+		t.Fatalf("updating movie: %v", err)
+	}
+	if movie, _ := owner.Movie(ctx, id); movie.Movie.Genre != "Thriller" || movie.Movie.Director != input.Director {
+		t.Errorf("updated movie: got %+v", movie.Movie)
+	}
+
+	var apiErr *client.Error
+	err = owner.UpdateMovie(ctx, id, client.MovieInput{Title: strings.Repeat("a", 201), Cast: []string{"Al Pacino", " "}})
+	if !errors.As(err, &apiErr) || apiErr.Fields["title"] == "" || apiErr.Fields["cast[1]"] == "" {
+		t.Errorf("invalid update: got %v, want title and cast[1] field errors", err)
+	}
+
+	if err := other.DeleteMovie(ctx, id); !errors.Is(err, models.ErrNotAuthorized) {
+		t.Errorf("deleting movie of other user: got %v, want %v", err, models.ErrNotAuthorized)
+	}
+
+	if err := owner.DeleteMovie(ctx, id); err != nil {
+		t.Fatalf("deleting movie: %v", err)
+	}
+
+	if _, err := owner.Movie(ctx, id); !errors.Is(err, models.ErrNoRecord) {
+		t.Errorf("deleted movie: got %v, want %v", err, models.ErrNoRecord)
+	}
+
+	movies, err := owner.Movies(ctx, client.MovieFilter{Genre: "Crime"})
+	if err != nil || len(movies) != 1 || movies[0].Title != "Pulp Fiction" {
+		t.Errorf("filtering movies: got %v, %v", movies, err)
+	}
+}
+
+func TestClientMoviesIterator(t *testing.T) {
+	_, server := newTestServer(t)
+
+	c := client.New(server.URL, client.WithCredentials("test1", testPassword))
+
+	var titles []string
+	it := c.MoviesIterator(context.Background(), client.MovieFilter{}, 2)
+	for it.Next() {
+		titles = append(titles, it.Movie().Title)
+	}
+
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The development fixtures have five movies
+	if len(titles) != 5 {
+		t.Errorf("got %d movies (%v), want 5", len(titles), titles)
+	}
+
+	it = c.MoviesIterator(context.Background(), client.MovieFilter{Year: 1800}, 2)
+	if it.Next() || it.Err() != nil {
+		t.Errorf("empty catalogue: got a movie or error %v", it.Err())
+	}
+}
+
+func TestClientContext(t *testing.T) {
+	_, server := newTestServer(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	c := client.New(server.URL, client.WithCredentials("test1", testPassword))
+	if _, err := c.Movies(ctx, client.MovieFilter{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("canceled context: got %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestClientFavourites(t *testing.T) {
+	_, server := newTestServer(t)
+	ctx := context.Background()
+
+	// test3 has no favourites in the fixtures
+	c := client.New(server.URL, client.WithCredentials("test3", testPassword))
+
+	favourites, err := c.Favourites(ctx)
+	if err != nil || len(favourites) != 0 {
+		t.Fatalf("empty favourites: got %v, %v", favourites, err)
+	}
+
+	id, err := c.AddFavourite(ctx, 1)
+	if err != nil {
+		t.Fatalf("adding favourite: %v", err)
+	}
+
+	if _, err := c.AddFavourite(ctx, 1); !errors.Is(err, models.ErrDuplicatedEntry) {
+		t.Errorf("duplicated favourite: got %v, want %v", err, models.ErrDuplicatedEntry)
+	}
+
+	favourites, err = c.Favourites(ctx)
+	if err != nil || len(favourites) != 1 || favourites[0].Movie.ID != 1 {
+		t.Errorf("favourites: got %v, %v", favourites, err)
+	}
+
+	if err := c.RemoveFavourite(ctx, id); err != nil {
+		t.Errorf("removing favourite: %v", err)
+	}
+
+	if err := c.RemoveFavourite(ctx, id); !errors.Is(err, models.ErrNoRecord) {
+		t.Errorf("removing missing favourite: got %v, want %v", err, models.ErrNoRecord)
+	}
+}
+
+func TestClientLists(t *testing.T) {
+	_, server := newTestServer(t)
+	ctx := context.Background()
+
+	owner := client.New(server.URL, client.WithCredentials("test2", testPassword))
+	other := client.New(server.URL, client.WithCredentials("test3", testPassword))
+	anonymous := client.New(server.URL)
+
+	id, err := owner.CreateList(ctx, client.ListInput{Name: "Best Heist Films"})
+	if err != nil {
+		t.Fatalf("creating list: %v", err)
+	}
+
+	first, err := owner.AddListItem(ctx, id, 1, "")
+	if err != nil {
+		t.Fatalf("adding item: %v", err)
+	}
+	second, err := owner.AddListItem(ctx, id, 5, "Not a heist, but close")
+	if err != nil {
+		t.Fatalf("adding item: %v", err)
+	}
+
+	if _, err := other.AddListItem(ctx, id, 2, ""); !errors.Is(err, models.ErrNoRecord) {
+		t.Errorf("editing list of other user: got %v, want %v", err, models.ErrNoRecord)
+	}
+
+	// Private lists are hidden from other users
+	if _, err := anonymous.List(ctx, id); !errors.Is(err, models.ErrNoRecord) {
+		t.Errorf("anonymous read of private list: got %v, want %v", err, models.ErrNoRecord)
+	}
+
+	if err := owner.ReorderList(ctx, id, []int{second}); err == nil {
+		t.Error("reordering with missing items: got no error")
+	}
+	if err := owner.ReorderList(ctx, id, []int{second, first}); err != nil {
+		t.Fatalf("reordering list: %v", err)
+	}
+
+	unlisted := client.ListUnlisted
+	if err := owner.UpdateList(ctx, id, client.ListUpdate{Visibility: &unlisted}); err != nil {
+		t.Fatalf("sharing list: %v", err)
+	}
+
+	list, err := anonymous.List(ctx, id)
+	if err != nil {
+		t.Fatalf("anonymous read of unlisted list: %v", err)
+	}
+	if len(list.Items) != 2 || list.Items[0].Movie.ID != 5 || list.Items[0].Note == "" {
+		t.Errorf("got items %+v, want movie 5 first", list.Items)
+	}
+
+	// Unlisted lists are not public
+	public, err := anonymous.PublicLists(ctx)
+	if err != nil {
+		t.Fatalf("public lists: %v", err)
+	}
+	for _, l := range public {
+		if l.ID == uint(id) {
+			t.Error("unlisted list is listed as public")
+		}
+	}
+
+	if err := owner.DeleteList(ctx, id); err != nil {
+		t.Errorf("deleting list: %v", err)
+	}
+}
+
+func TestClientImportExport(t *testing.T) {
+	_, server := newTestServer(t)
+	ctx := context.Background()
+
+	c := client.New(server.URL, client.WithCredentials("test1", testPassword))
+
+	csv := "title,director,release_date,cast,genre,synopsis\n" +
+		"Heat,Michael Mann,1995-12-15,Al Pacino|Robert De Niro,Crime,Bank robbers and a detective.\n" +
+		"Inception,Christopher Nolan,2010-07-16,Leonardo DiCaprio,Science Fiction,Dreams.\n" +
+		"Broken,,not a date,,,\n"
+
+	report, err := c.ImportMovies(ctx, strings.NewReader(csv), client.ImportOptions{Format: client.FormatCSV, DryRun: true})
+	if err != nil {
+		t.Fatalf("dry run: %v", err)
+	}
+	if report.Created != 1 || report.Skipped != 1 || report.Failed != 1 {
+		t.Errorf("dry run report: got %+v", report)
+	}
+
+	report, err = c.ImportMovies(ctx, strings.NewReader(csv), client.ImportOptions{Format: client.FormatCSV, OnDuplicate: client.OnDuplicateUpsert})
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	if report.Created != 1 || report.Updated != 1 || report.Failed != 1 || report.Errors[0].Row != 3 {
+		t.Errorf("import report: got %+v", report)
+	}
+
+	export, err := c.ExportMovies(ctx, client.FormatNDJSON, client.MovieFilter{Genre: "Crime"})
+	if err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	defer export.Close()
+
+	content, err := io.ReadAll(export)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if lines := strings.Count(string(content), "\n"); lines != 2 || !strings.Contains(string(content), `"title":"Heat"`) {
+		t.Errorf("export: got %q", content)
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"testing"
+
+	"films-api.rdelgado.es/src/internals/models"
+	"github.com/andybalholm/brotli"
+)
+
+func TestCompression(t *testing.T) {
+	app, server := newTestServer(t)
+	token := loginFrom(t, server.URL, "test1", "test")
+
+	var logs bytes.Buffer
+	app.logger = slog.New(slog.NewJSONHandler(&logs, nil))
+
+	// Asking for an encoding turns off the decompression of the transport
+	res, compressed := getWith(t, server.URL+"/movies", token, map[string]string{"Accept-Encoding": "br;q=1, gzip;q=0.8"})
+	if res.StatusCode != http.StatusOK || res.Header.Get("Content-Encoding") != "br" || res.Header.Get("Vary") != "Accept-Encoding" {
+		t.Fatalf("listing movies: got %d %v", res.StatusCode, res.Header)
+	}
+
+	var movies []models.Movie
+	if err := json.NewDecoder(brotli.NewReader(bytes.NewReader([]byte(compressed)))).Decode(&movies); err != nil || len(movies) == 0 {
+		t.Fatalf("decompressed movies: got %d (%v)", len(movies), err)
+	}
+
+	// Browsers accept them all with the same quality
+	if res, _ := getWith(t, server.URL+"/movies", token, map[string]string{"Accept-Encoding": "gzip, deflate, br, zstd"}); res.Header.Get("Content-Encoding") != "zstd" {
+		t.Errorf("Content-Encoding on ties: got %q, want %q", res.Header.Get("Content-Encoding"), "zstd")
+	}
+
+	// Weak tags are still valid for the compressed responses
+	if res, _ := getWith(t, server.URL+"/movies", token, map[string]string{"Accept-Encoding": "gzip", "If-None-Match": res.Header.Get("ETag")}); res.StatusCode != http.StatusNotModified {
+		t.Errorf("revalidating a compressed list: got %d", res.StatusCode)
+	}
+
+	// Small responses are sent as they are
+	if res, _ := getWith(t, server.URL+"/user/me", token, map[string]string{"Accept-Encoding": "gzip"}); res.Header.Get("Content-Encoding") != "" {
+		t.Errorf("Content-Encoding of the profile: got %q", res.Header.Get("Content-Encoding"))
+	}
+
+	// The logged size is the one sent
+	var logged *int
+	scanner := bufio.NewScanner(&logs)
+	for scanner.Scan() {
+		var line struct {
+			Msg    string
+			URI    string `json:"uri"`
+			Size   int    `json:"size"`
+			Status int    `json:"status"`
+		}
+		if json.Unmarshal(scanner.Bytes(), &line) == nil && line.Msg == "CLIENT <- API" && line.URI == "/movies" && line.Status == http.StatusOK {
+			logged = &line.Size
+			break
+		}
+	}
+	if logged == nil || *logged != len(compressed) {
+		t.Errorf("logged size: got %v, want %d", logged, len(compressed))
+	}
+
+	// Clients not asking for an encoding get the response as it is
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/movies", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	res, err := (&http.Client{Transport: &http.Transport{DisableCompression: true}}).Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	plain, _ := io.ReadAll(res.Body)
+	if res.Header.Get("Content-Encoding") != "" || !json.Valid(plain) {
+		t.Errorf("listing movies without Accept-Encoding: got %v", res.Header)
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Default lifetime of the cached responses of GET /movies. They are not
+// served after any change of a movie anyway, as they are kept by version.
+const movieResponsesTTL = 10 * time.Minute
+
+// cachedResponse is a response of GET /movies kept by the response cache
+type cachedResponse struct {
+	header http.Header
+	body   []byte
+}
+
+func (c cachedResponse) write(w http.ResponseWriter) {
+	for name, values := range c.header {
+		w.Header()[name] = values
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(c.body)
+}
+
+// weakETag makes a weak entity tag from the parts of the response it depends
+// on. Weak tags are still valid when the response is compressed.
+func weakETag(parts ...interface{}) string {
+	var b bytes.Buffer
+	for _, part := range parts {
+		fmt.Fprintf(&b, "%v\x00", part)
+	}
+
+	sum := sha256.Sum256(b.Bytes())
+	return `W/"` + hex.EncodeToString(sum[:12]) + `"`
+}
+
+// notModified sets the validators of the response and responds 304 Not
+// Modified if the client already has it. If-Modified-Since is only checked
+// when there is no If-None-Match (RFC 9110, section 13.2.2).
+func notModified(w http.ResponseWriter, r *http.Request, etag string, modified time.Time) bool {
+	w.Header().Set("ETag", etag)
+	if !modified.IsZero() {
+		w.Header().Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
+	}
+
+	if match := r.Header.Get("If-None-Match"); match != "" {
+		if !etagMatches(match, etag) {
+			return false
+		}
+	} else {
+		since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+		if err != nil || modified.IsZero() || modified.Truncate(time.Second).After(since) {
+			return false
+		}
+	}
+
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// etagMatches compares the tags of If-None-Match with the weak comparison
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+
+	return false
+}
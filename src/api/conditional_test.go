@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"films-api.rdelgado.es/pkg/client"
+	"films-api.rdelgado.es/src/internals/models"
+	"films-api.rdelgado.es/src/internals/seed"
+	"gorm.io/gorm"
+)
+
+// getWith makes an authenticated GET request with the conditional headers
+func getWith(t *testing.T, url, token string, headers map[string]string) (*http.Response, string) {
+	t.Helper()
+
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	body, _ := io.ReadAll(res.Body)
+	return res, string(body)
+}
+
+func TestConditionalMovies(t *testing.T) {
+	app, server := newTestServer(t)
+	ctx := context.Background()
+
+	c := client.New(server.URL, client.WithCredentials("test1", testPassword))
+	token := loginFrom(t, server.URL, "test1", "test")
+
+	id, err := c.CreateMovie(ctx, client.MovieInput{
+		Title: "Heat", Director: "Michael Mann", ReleaseDate: time.Date(1995, 12, 15, 0, 0, 0, 0, time.UTC),
+		Cast: []string{"Al Pacino"}, Genre: "Crime", Synopsis: "A group of professional bank robbers.",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	list := server.URL + "/movies?title=Heat&page_size=1"
+	res, body := getWith(t, list, token, nil)
+	etag := res.Header.Get("ETag")
+	if res.StatusCode != http.StatusOK || etag == "" || res.Header.Get("Last-Modified") == "" || res.Header.Get("Cache-Control") != "private, no-cache" {
+		t.Fatalf("listing movies: got %d %v", res.StatusCode, res.Header)
+	}
+
+	res, _ = getWith(t, list, token, map[string]string{"If-None-Match": etag})
+	if res.StatusCode != http.StatusNotModified || res.Header.Get("ETag") != etag {
+		t.Errorf("revalidating the list: got %d %v", res.StatusCode, res.Header)
+	}
+	res, _ = getWith(t, list, token, map[string]string{"If-Modified-Since": res.Header.Get("Last-Modified")})
+	if res.StatusCode != http.StatusNotModified {
+		t.Errorf("revalidating the list by date: got %d", res.StatusCode)
+	}
+
+	// The same list is served from the cache, pagination headers included
+	before := app.movieResponses.Stats()
+	res, cached := getWith(t, list, token, nil)
+	if stats := app.movieResponses.Stats(); stats.Hits != before.Hits+1 {
+		t.Errorf("cache hits: got %d, want %d", stats.Hits, before.Hits+1)
+	}
+	if cached != body || res.Header.Get("X-Total-Count") == "" {
+		t.Errorf("cached list: got %v %s, want %s", res.Header, cached, body)
+	}
+
+	// Other queries have their own tag
+	if res, _ := getWith(t, server.URL+"/movies?genre=Drama", token, map[string]string{"If-None-Match": etag}); res.StatusCode != http.StatusOK {
+		t.Errorf("revalidating another query: got %d", res.StatusCode)
+	}
+
+	movie := server.URL + "/movie/" + strconv.Itoa(id)
+	res, _ = getWith(t, movie, token, nil)
+	movieTag := res.Header.Get("ETag")
+	if res, _ := getWith(t, movie, token, map[string]string{"If-None-Match": movieTag}); res.StatusCode != http.StatusNotModified {
+		t.Errorf("revalidating the movie: got %d", res.StatusCode)
+	}
+
+	// Any change of a movie changes the tags
+	if err := c.UpdateMovie(ctx, id, client.MovieInput{Synopsis: "Cops and robbers."}); err != nil {
+		t.Fatal(err)
+	}
+
+	res, changed := getWith(t, list, token, map[string]string{"If-None-Match": etag})
+	if res.StatusCode != http.StatusOK || res.Header.Get("ETag") == etag || changed == body {
+		t.Errorf("list after a change: got %d %v", res.StatusCode, res.Header)
+	}
+	if res, _ := getWith(t, movie, token, map[string]string{"If-None-Match": movieTag}); res.StatusCode != http.StatusOK {
+		t.Errorf("movie after a change: got %d", res.StatusCode)
+	}
+
+	catalogue, err := app.catalogue.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.DeleteMovie(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	if after, _ := app.catalogue.Get(); after.Version != catalogue.Version+1 {
+		t.Errorf("catalogue version after deleting: got %d, want %d", after.Version, catalogue.Version+1)
+	}
+
+	// The other routes are not stored
+	if res, _ := getWith(t, server.URL+"/user/me", token, nil); res.Header.Get("Cache-Control") != "no-store" {
+		t.Errorf("Cache-Control of the profile: got %q", res.Header.Get("Cache-Control"))
+	}
+}
+
+func TestCatalogueVersion(t *testing.T) {
+	app, _ := newTestServer(t)
+
+	catalogue, err := app.catalogue.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Changes of other aggregates leave it alone
+	if err := app.users.SetRole("test2", models.RoleEditor); err != nil {
+		t.Fatal(err)
+	}
+	if after, _ := app.catalogue.Get(); after.Version != catalogue.Version {
+		t.Errorf("catalogue version after a user change: got %d, want %d", after.Version, catalogue.Version)
+	}
+}
+
+func TestCatalogueChangedOutsideTheModels(t *testing.T) {
+	app, server := newTestServer(t)
+	token := loginFrom(t, server.URL, "test1", "test")
+
+	list := server.URL + "/movies"
+	res, _ := getWith(t, list, token, nil)
+	etag := res.Header.Get("ETag")
+
+	// Seeded movies change the catalogue
+	set, err := seed.LoadFile(writeFixture(t, `
+movies:
+  - title: Thief
+    director: Michael Mann
+    release_date: "1981-03-27"
+    cast: [James Caan]
+    genre: Crime
+    synopsis: A safecracker takes one last job.
+    created_by: test1
+users:
+  - name: test1
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := seedFixtures(app.users.DB, app.logger, set, seed.EnvProduction); err != nil {
+		t.Fatal(err)
+	}
+
+	res, body := getWith(t, list, token, map[string]string{"If-None-Match": etag})
+	if res.StatusCode != http.StatusOK || res.Header.Get("ETag") == etag || !strings.Contains(body, "Thief") {
+		t.Fatalf("movies after seeding: got %d %q", res.StatusCode, res.Header.Get("ETag"))
+	}
+	etag = res.Header.Get("ETag")
+
+	// Seeding again changes nothing
+	if err := seedFixtures(app.users.DB, app.logger, set, seed.EnvProduction); err != nil {
+		t.Fatal(err)
+	}
+	if res, _ := getWith(t, list, token, map[string]string{"If-None-Match": etag}); res.StatusCode != http.StatusNotModified {
+		t.Errorf("movies after seeding the same fixtures: got %d", res.StatusCode)
+	}
+
+	// So do the movies given to another user by the repairs
+	before, _ := app.catalogue.Get()
+	err = app.users.DB.Connection(func(conn *gorm.DB) error {
+		conn.Exec("PRAGMA foreign_keys = OFF")
+		defer conn.Exec("PRAGMA foreign_keys = ON")
+
+		return conn.Exec("UPDATE movies SET user_id = 99 WHERE title = ?", "Thief").Error
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	owner, _ := app.users.GetByName("test2")
+	if _, err := models.RepairOrphans(app.users.DB, owner.ID); err != nil {
+		t.Fatal(err)
+	}
+	if after, _ := app.catalogue.Get(); after.Version != before.Version+1 {
+		t.Errorf("catalogue version after a repair: got %d, want %d", after.Version, before.Version+1)
+	}
+}
+
+// writeFixture saves a fixtures file for seed.LoadFile
+func writeFixture(t *testing.T, content string) string {
+	t.Helper()
+
+	file := filepath.Join(t.TempDir(), "fixtures.yaml")
+	if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	return file
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"films-api.rdelgado.es/src/internals/seed"
+)
+
+// config holds the settings shared by the server and the admin subcommands
+type config struct {
+	env        string
+	seedDir    string
+	dbHostname string
+	dbName     string
+	dbUser     string
+	dbPassword string
+	jwtSecret  string
+	serverPort string
+
+	// Directory of the uploaded images
+	storageDir string
+
+	// Sinks of the events of the outbox: webhooks, stream, log
+	eventSinks []string
+
+	// Time the deleted movies are kept in the trash before they are purged
+	trashRetention time.Duration
+
+	// Validate requests against the OpenAPI document
+	validateRequests bool
+
+	// Locale of the messages when the client does not accept a supported one
+	locale string
+
+	// How the emails are sent: smtp, file (to mailDir) or log
+	mailSender   string
+	mailFrom     string
+	mailDir      string
+	smtpAddr     string
+	smtpUser     string
+	smtpPassword string
+
+	// OpenID Connect provider, disabled if oidcIssuer is empty
+	oidcIssuer       string
+	oidcClientID     string
+	oidcClientSecret string
+	oidcRedirectURL  string
+	oidcProvision    bool
+
+	// Size and lifetime of the cache of the user statuses. A zero lifetime
+	// disables it.
+	userCacheSize int
+	userCacheTTL  time.Duration
+
+	// Responses of GET /movies kept in memory, 0 to disable the cache
+	movieCacheSize int
+
+	// Responses of the allowed types and at least compressMinSize bytes are
+	// compressed, unless compressResponses is unset
+	compressResponses bool
+	compressMinSize   int
+	compressTypes     []string
+}
+
+func loadConfig() config {
+	cfg := config{
+		env:        os.Getenv("APP_ENV"),
+		seedDir:    os.Getenv("SEED_DIR"),
+		dbHostname: os.Getenv("MYSQL_HOSTNAME"),
+		dbName:     os.Getenv("MYSQL_DATABASE"),
+		dbUser:     os.Getenv("MYSQL_USER"),
+		dbPassword: os.Getenv("MYSQL_PASSWORD"),
+		jwtSecret:  os.Getenv("JWT_SECRET"),
+		serverPort: os.Getenv("API_PORT"),
+		storageDir: os.Getenv("STORAGE_DIR"),
+
+		validateRequests: os.Getenv("OPENAPI_VALIDATE") == "true",
+		locale:           os.Getenv("APP_LOCALE"),
+
+		mailSender:   os.Getenv("MAIL_SENDER"),
+		mailFrom:     os.Getenv("MAIL_FROM"),
+		mailDir:      os.Getenv("MAIL_DIR"),
+		smtpAddr:     os.Getenv("SMTP_ADDR"),
+		smtpUser:     os.Getenv("SMTP_USER"),
+		smtpPassword: os.Getenv("SMTP_PASSWORD"),
+
+		oidcIssuer:       os.Getenv("OIDC_ISSUER"),
+		oidcClientID:     os.Getenv("OIDC_CLIENT_ID"),
+		oidcClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+		oidcRedirectURL:  os.Getenv("OIDC_REDIRECT_URL"),
+		oidcProvision:    os.Getenv("OIDC_PROVISION") != "false",
+
+		compressResponses: os.Getenv("COMPRESS_RESPONSES") != "false",
+	}
+
+	// Fixtures with default credentials are only seeded when asked for
+	if cfg.env == "" {
+		cfg.env = seed.EnvProduction
+	}
+	if cfg.seedDir == "" {
+		cfg.seedDir = "fixtures"
+	}
+	if cfg.storageDir == "" {
+		cfg.storageDir = "storage"
+	}
+
+	if cfg.mailSender == "" {
+		cfg.mailSender = "log"
+	}
+	if cfg.mailFrom == "" {
+		cfg.mailFrom = "Films API <no-reply@localhost>"
+	}
+	if cfg.mailDir == "" {
+		cfg.mailDir = "mail"
+	}
+
+	cfg.eventSinks = strings.Fields(strings.ReplaceAll(os.Getenv("EVENT_SINKS"), ",", " "))
+	if len(cfg.eventSinks) == 0 {
+		cfg.eventSinks = []string{"webhooks", "stream"}
+	}
+
+	cfg.userCacheSize = userCacheSize
+	if size, err := strconv.Atoi(os.Getenv("USER_CACHE_SIZE")); err == nil && size > 0 {
+		cfg.userCacheSize = size
+	}
+
+	cfg.userCacheTTL = userCacheTTL
+	if seconds, err := strconv.Atoi(os.Getenv("USER_CACHE_TTL_SECONDS")); err == nil && seconds >= 0 {
+		cfg.userCacheTTL = time.Duration(seconds) * time.Second
+	}
+
+	if size, err := strconv.Atoi(os.Getenv("MOVIE_CACHE_SIZE")); err == nil && size > 0 {
+		cfg.movieCacheSize = size
+	}
+
+	cfg.compressMinSize = compressMinSize
+	if size, err := strconv.Atoi(os.Getenv("COMPRESS_MIN_SIZE")); err == nil && size >= 0 {
+		cfg.compressMinSize = size
+	}
+	cfg.compressTypes = strings.Fields(strings.ReplaceAll(os.Getenv("COMPRESS_TYPES"), ",", " "))
+
+	cfg.trashRetention = 30 * 24 * time.Hour
+	if days, err := strconv.Atoi(os.Getenv("TRASH_RETENTION_DAYS")); err == nil && days >= 0 {
+		cfg.trashRetention = time.Duration(days) * 24 * time.Hour
+	}
+
+	return cfg
+}
@@ -4,3 +4,6 @@ type contextKey string
 
 const isAuthenticatedContextKey = contextKey("isAuthenticated")
 const userIdContextKey = contextKey("userId")
+const maxBodySizeContextKey = contextKey("maxBodySize")
+const requestIdContextKey = contextKey("requestId")
+const sessionContextKey = contextKey("session")
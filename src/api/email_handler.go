@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"films-api.rdelgado.es/src/internals/i18n"
+	"films-api.rdelgado.es/src/internals/mail"
+	"films-api.rdelgado.es/src/internals/models"
+	"films-api.rdelgado.es/src/internals/validator"
+)
+
+// Time the tokens sent by email can be used
+const (
+	verifyEmailTTL   = 24 * time.Hour
+	resetPasswordTTL = time.Hour
+)
+
+// Time a message can take to be sent
+const mailTimeout = 30 * time.Second
+
+type emailRequest struct {
+	Email               string `json:"email" validate:"required,max=255,email"`
+	validator.Validator `json:"-"`
+}
+
+type verifyEmailRequest struct {
+	Token               string `json:"token" validate:"required"`
+	validator.Validator `json:"-"`
+}
+
+// resetPasswordRequest has the rules of signupRequest for the new password
+type resetPasswordRequest struct {
+	Token               string `json:"token" validate:"required"`
+	NewPassword         string `json:"new_password" validate:"required,min=8,max=24,password"`
+	validator.Validator `json:"-"`
+}
+
+// setEmail changes the address of the user and sends it a verification token
+func (app *application) setEmail(w http.ResponseWriter, r *http.Request) {
+	userId := r.Context().Value(userIdContextKey).(int)
+
+	var req emailRequest
+
+	err := app.readJSON(w, r, &req)
+	if err != nil {
+		app.clientError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	req.CheckStruct(req)
+
+	if !req.IsValid() {
+		app.failedValidation(w, r, req.Validator)
+		return
+	}
+
+	token, err := app.users.WithContext(r.Context()).SetEmail(userId, req.Email, verifyEmailTTL)
+	if err != nil {
+		if errors.Is(err, models.ErrDuplicatedEntry) {
+			app.clientError(w, r, http.StatusConflict, err)
+		} else {
+			app.serverError(w, r, err)
+		}
+
+		return
+	}
+
+	app.sendMail(r, req.Email, "mail.verify_email", token, verifyEmailTTL)
+
+	app.getMe(w, r)
+}
+
+func (app *application) verifyEmail(w http.ResponseWriter, r *http.Request) {
+	var req verifyEmailRequest
+
+	err := app.readJSON(w, r, &req)
+	if err != nil {
+		app.clientError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	req.CheckStruct(req)
+
+	if !req.IsValid() {
+		app.failedValidation(w, r, req.Validator)
+		return
+	}
+
+	err = app.users.WithContext(r.Context()).VerifyEmail(req.Token)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidOneTimeToken) {
+			req.AddFieldMessage("token", i18n.NewMessage("validation.one_time_token", nil))
+			app.failedValidation(w, r, req.Validator)
+		} else {
+			app.serverError(w, r, err)
+		}
+
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// forgotPassword sends a reset token to the user with the verified address.
+// The response is the same whether the address is known or not, so it cannot
+// be used to find out the addresses of the users.
+func (app *application) forgotPassword(w http.ResponseWriter, r *http.Request) {
+	var req emailRequest
+
+	err := app.readJSON(w, r, &req)
+	if err != nil {
+		app.clientError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	req.CheckStruct(req)
+
+	if !req.IsValid() {
+		app.failedValidation(w, r, req.Validator)
+		return
+	}
+
+	_, token, err := app.users.RequestPasswordReset(req.Email, resetPasswordTTL)
+	if err != nil && !errors.Is(err, models.ErrNoRecord) {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if err == nil {
+		app.sendMail(r, req.Email, "mail.reset_password", token, resetPasswordTTL)
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// resetPassword sets a new password with a token sent by forgotPassword. The
+// tokens of the user are revoked, so they must log in again.
+func (app *application) resetPassword(w http.ResponseWriter, r *http.Request) {
+	var req resetPasswordRequest
+
+	err := app.readJSON(w, r, &req)
+	if err != nil {
+		app.clientError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	req.CheckStruct(req)
+
+	if !req.IsValid() {
+		app.failedValidation(w, r, req.Validator)
+		return
+	}
+
+	userId, err := app.users.WithContext(r.Context()).ResetPassword(req.Token, req.NewPassword)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidOneTimeToken) {
+			req.AddFieldMessage("token", i18n.NewMessage("validation.one_time_token", nil))
+			app.failedValidation(w, r, req.Validator)
+		} else {
+			app.serverError(w, r, err)
+		}
+
+		return
+	}
+
+	app.forgetUser(r, userId)
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// sendMail sends a token in the language of the client. The message (key.subject
+// and key.body in the catalogues) is sent in the background, so the response
+// does not wait for the mail server and takes the same time whether a message
+// is sent or not.
+func (app *application) sendMail(r *http.Request, to, key, token string, ttl time.Duration) {
+	locale := app.locale(r)
+	params := i18n.Params{"token": token, "minutes": strconv.Itoa(int(ttl.Minutes()))}
+
+	msg := mail.Message{
+		To:      to,
+		Subject: i18n.T(locale, key+".subject", params),
+		Body:    i18n.T(locale, key+".body", params),
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), mailTimeout)
+		defer cancel()
+
+		if err := app.mailer.Send(ctx, msg); err != nil {
+			app.logger.Error("sending email", "subject", msg.Subject, "error", err.Error())
+		}
+	}()
+}
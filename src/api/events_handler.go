@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"films-api.rdelgado.es/src/internals/events"
+	"films-api.rdelgado.es/src/internals/models"
+)
+
+// Settings of the event stream
+const (
+	// Events kept to resume the streams
+	streamLogSize = 1000
+
+	// Events buffered for each client before it is disconnected
+	streamBufferSize = 64
+
+	// Delay before the browsers reconnect, in milliseconds
+	streamRetry = 3000
+
+	// Event sent when the events after Last-Event-ID are not in the log anymore
+	streamReset = "stream.reset"
+)
+
+// Interval of the comments that keep the idle connections open
+var streamHeartbeat = 15 * time.Second
+
+// getEvents streams the events of the catalogue and the favourites of the
+// user (of every user for admins) as Server-Sent Events
+func (app *application) getEvents(w http.ResponseWriter, r *http.Request) {
+	userId := r.Context().Value(userIdContextKey).(int)
+
+	filter, err := eventFilter(r)
+	if err != nil {
+		app.clientError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	user, err := app.users.Get(userId)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// Favourites are only sent to their owner and the admins
+	visible := func(event events.Event) bool {
+		if events.Private(event.Type) && event.UserID != uint(userId) && user.Role != models.RoleAdmin {
+			return false
+		}
+
+		return filter(event)
+	}
+
+	lastEventId := r.Header.Get("Last-Event-ID")
+	if lastEventId == "" {
+		lastEventId = r.URL.Query().Get("last_event_id")
+	}
+
+	sub, missed, found := app.stream.Subscribe(lastEventId, visible)
+	defer app.stream.Unsubscribe(sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	rc := http.NewResponseController(w)
+
+	fmt.Fprintf(w, "retry: %d\n\n", streamRetry)
+	if !found {
+		fmt.Fprintf(w, "event: %s\ndata: {}\n\n", streamReset)
+	}
+	for _, event := range missed {
+		if err := writeEvent(w, event); err != nil {
+			return
+		}
+	}
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event, ok := <-sub.C:
+			// The client did not keep up, it resumes from the log when it reconnects
+			if !ok {
+				return
+			}
+			if err := writeEvent(w, event); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		}
+
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// writeEvent writes an event in the format of Server-Sent Events. The JSON
+// has no newlines, so it fits in one data field.
+func writeEvent(w http.ResponseWriter, event events.Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+	return err
+}
+
+// eventFilter returns the filter of the types and movie query parameters
+func eventFilter(r *http.Request) (func(events.Event) bool, error) {
+	types := events.Types
+	if value := r.URL.Query().Get("types"); value != "" {
+		types = strings.Split(value, ",")
+		for _, eventType := range types {
+			if !slices.Contains(events.Types, eventType) {
+				return nil, errors.New("unknown event type " + eventType)
+			}
+		}
+	}
+
+	movieId := 0
+	if value := r.URL.Query().Get("movie"); value != "" {
+		var err error
+		movieId, err = strconv.Atoi(value)
+		if err != nil || movieId < 1 {
+			return nil, errors.New("invalid movie id")
+		}
+	}
+
+	return func(event events.Event) bool {
+		if !slices.Contains(types, event.Type) {
+			return false
+		}
+
+		return movieId == 0 || (event.Aggregate == "movie" && event.AggregateID == uint(movieId))
+	}, nil
+}
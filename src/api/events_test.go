@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"films-api.rdelgado.es/pkg/client"
+	"films-api.rdelgado.es/src/internals/events"
+)
+
+// openEvents opens an event stream and returns a channel with its events,
+// closed when the stream ends
+func openEvents(t *testing.T, ctx context.Context, c *client.Client, filter client.EventFilter) <-chan client.Event {
+	t.Helper()
+
+	stream, err := c.Events(ctx, filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { stream.Close() })
+
+	received := make(chan client.Event, 100)
+	go func() {
+		defer close(received)
+		for stream.Next() {
+			received <- stream.Event()
+		}
+	}()
+
+	return received
+}
+
+// nextEvent waits for the next event of a stream
+func nextEvent(t *testing.T, received <-chan client.Event) client.Event {
+	t.Helper()
+
+	select {
+	case event, ok := <-received:
+		if !ok {
+			t.Fatal("the stream ended")
+		}
+		return event
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for an event")
+	}
+
+	return client.Event{}
+}
+
+func TestEvents(t *testing.T) {
+	_, server := newTestServer(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	c := client.New(server.URL, client.WithCredentials("test1", testPassword))
+	other := client.New(server.URL, client.WithCredentials("test2", testPassword))
+
+	all := openEvents(t, ctx, c, client.EventFilter{})
+	othersAll := openEvents(t, ctx, other, client.EventFilter{})
+
+	id, err := c.CreateMovie(ctx, client.MovieInput{
+		Title: "Heat", Director: "Michael Mann", ReleaseDate: time.Date(1995, 12, 15, 0, 0, 0, 0, time.UTC),
+		Cast: []string{"Al Pacino"}, Genre: "Crime", Synopsis: "A group of professional bank robbers.",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	created := nextEvent(t, all)
+	var movie client.Movie
+	if err := json.Unmarshal(created.Data, &movie); err != nil || created.Type != events.MovieCreated || movie.Title != "Heat" || created.AggregateID != uint(id) {
+		t.Fatalf("movie.created event: got %+v (%v)", created, err)
+	}
+
+	// Only the updates of the movie
+	updates := openEvents(t, ctx, other, client.EventFilter{Types: []string{events.MovieUpdated}, MovieID: id})
+
+	if err := c.UpdateMovie(ctx, 1, client.MovieInput{Genre: "Sci-Fi"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.UpdateMovie(ctx, id, client.MovieInput{Genre: "Thriller"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.AddFavourite(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.DeleteMovie(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+
+	var types []string
+	for len(types) < 4 {
+		types = append(types, nextEvent(t, all).Type)
+	}
+	want := []string{events.MovieUpdated, events.MovieUpdated, events.FavouriteAdded, events.MovieDeleted}
+	if types[0] != want[0] || types[1] != want[1] || types[2] != want[2] || types[3] != want[3] {
+		t.Errorf("events: got %v, want %v", types, want)
+	}
+
+	if event := nextEvent(t, updates); event.Type != events.MovieUpdated || event.AggregateID != uint(id) {
+		t.Errorf("filtered stream: got %+v", event)
+	}
+
+	// Favourites of other users are private
+	for _, want := range []string{events.MovieCreated, events.MovieUpdated, events.MovieUpdated, events.MovieDeleted} {
+		if event := nextEvent(t, othersAll); event.Type != want {
+			t.Errorf("stream of another user: got %s, want %s", event.Type, want)
+		}
+	}
+
+	// Streams resume after the last event received
+	resumed := openEvents(t, ctx, c, client.EventFilter{LastEventID: created.ID})
+	for _, want := range want {
+		if event := nextEvent(t, resumed); event.Type != want {
+			t.Errorf("resumed stream: got %s, want %s", event.Type, want)
+		}
+	}
+
+	reset := openEvents(t, ctx, c, client.EventFilter{LastEventID: "unknown"})
+	if event := nextEvent(t, reset); event.Type != client.EventStreamReset {
+		t.Errorf("stream after an unknown event: got %+v", event)
+	}
+
+	var apiErr *client.Error
+	if _, err := c.Events(ctx, client.EventFilter{Types: []string{"movie.watched"}}); !errors.As(err, &apiErr) || apiErr.StatusCode != 400 {
+		t.Errorf("unknown event type: got %v", err)
+	}
+}
+
+func TestEventsHeartbeat(t *testing.T) {
+	defer func(interval time.Duration) { streamHeartbeat = interval }(streamHeartbeat)
+	streamHeartbeat = 10 * time.Millisecond
+
+	app, server := newTestServer(t)
+	ctx := context.Background()
+
+	c := client.New(server.URL, client.WithCredentials("test1", testPassword))
+	if err := c.Login(ctx, "test1", testPassword); err != nil {
+		t.Fatal(err)
+	}
+
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/events", nil)
+	req.Header.Set("Authorization", "Bearer "+c.Token())
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	if res.Header.Get("Content-Type") != "text/event-stream" {
+		t.Errorf("content type: got %s", res.Header.Get("Content-Type"))
+	}
+
+	reader := bufio.NewReader(res.Body)
+	for _, want := range []string{"retry: 3000\n", "\n", ": heartbeat\n"} {
+		if line, err := reader.ReadString('\n'); err != nil || line != want {
+			t.Fatalf("got %q %v, want %q", line, err, want)
+		}
+	}
+
+	if app.stream.Subscribers() != 1 {
+		t.Errorf("subscribers: got %d, want 1", app.stream.Subscribers())
+	}
+
+	// Closing the connection ends the subscription
+	res.Body.Close()
+	waitFor(t, "the subscription to end", func() bool { return app.stream.Subscribers() == 0 })
+}
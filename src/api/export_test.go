@@ -0,0 +1,195 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"films-api.rdelgado.es/pkg/client"
+	"films-api.rdelgado.es/src/internals/models"
+	"films-api.rdelgado.es/src/internals/storage"
+)
+
+// readExport reads the files of an export archive
+func readExport(t *testing.T, archive io.ReadCloser) map[string][]byte {
+	t.Helper()
+	defer archive.Close()
+
+	content, err := io.ReadAll(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string][]byte{}
+	for _, file := range reader.File {
+		f, err := file.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[file.Name], err = io.ReadAll(f)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return files
+}
+
+func TestExport(t *testing.T) {
+	_, server := newTestServer(t)
+	ctx := context.Background()
+
+	c := client.New(server.URL, client.WithCredentials("test1", testPassword))
+
+	id, err := c.CreateMovie(ctx, client.MovieInput{
+		Title: "Heat", Director: "Michael Mann", ReleaseDate: time.Date(1995, 12, 15, 0, 0, 0, 0, time.UTC),
+		Cast: []string{"Al Pacino"}, Genre: "Crime", Synopsis: "A group of professional bank robbers.",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.DeleteMovie(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+
+	archive, job, err := c.ExportAccount(ctx, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job != nil {
+		t.Fatalf("small export made in the background: %+v", job)
+	}
+
+	files := readExport(t, archive)
+	for _, name := range []string{"manifest.json", "profile.json", "movies.json", "favourites.json", "lists.json", "webhooks.json", "identities.json", "sessions.json", "audit.json"} {
+		if _, exists := files[name]; !exists {
+			t.Errorf("file %s missing from the export", name)
+		}
+	}
+
+	var profile models.Profile
+	if err := json.Unmarshal(files["profile.json"], &profile); err != nil || profile.Name != "test1" {
+		t.Errorf("profile.json: got %+v (%v)", profile, err)
+	}
+
+	// Movies in the trash are data of the user too
+	var movies []models.Movie
+	if err := json.Unmarshal(files["movies.json"], &movies); err != nil {
+		t.Fatal(err)
+	}
+	deleted := false
+	for _, movie := range movies {
+		deleted = deleted || (movie.ID == uint(id) && movie.DeletedAt.Valid)
+	}
+	if !deleted {
+		t.Errorf("movies.json: got %+v, want the deleted movie %d", movies, id)
+	}
+
+	var favourites []models.ExportedFavourite
+	if err := json.Unmarshal(files["favourites.json"], &favourites); err != nil || len(favourites) != 1 || favourites[0].Title != "The Dark Knight" {
+		t.Errorf("favourites.json: got %+v (%v)", favourites, err)
+	}
+
+	var lists []models.ExportedList
+	if err := json.Unmarshal(files["lists.json"], &lists); err != nil || len(lists) != 1 || len(lists[0].Items) != 3 {
+		t.Errorf("lists.json: got %+v (%v)", lists, err)
+	}
+
+	var entries []models.AuditEntry
+	if err := json.Unmarshal(files["audit.json"], &entries); err != nil {
+		t.Fatal(err)
+	}
+	actions := map[string]bool{}
+	for _, entry := range entries {
+		if entry.Entity == models.EntityMovie && entry.EntityID == uint(id) {
+			actions[entry.Action] = true
+		}
+	}
+	if !actions[models.AuditCreate] || !actions[models.AuditDelete] {
+		t.Errorf("audit.json: got %+v, want the creation and deletion of movie %d", entries, id)
+	}
+}
+
+func TestExportJob(t *testing.T) {
+	app, server := newTestServer(t)
+	ctx := context.Background()
+
+	c := client.New(server.URL, client.WithCredentials("test1", testPassword))
+	other := client.New(server.URL, client.WithCredentials("test2", testPassword))
+
+	_, job, err := c.ExportAccount(ctx, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job == nil || job.ID == 0 {
+		t.Fatalf("export queued: got %+v", job)
+	}
+
+	waitFor(t, "the export", func() bool {
+		job, err = c.Export(ctx, int(job.ID))
+		return err == nil && job.Status != client.ExportPending && job.Status != client.ExportRunning
+	})
+	if job.Status != client.ExportDone || job.Size == 0 || job.ExpiresAt == nil {
+		t.Fatalf("finished export: got %+v", job)
+	}
+
+	archive, err := c.DownloadExport(ctx, int(job.ID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if files := readExport(t, archive); len(files["profile.json"]) == 0 {
+		t.Errorf("downloaded export: got files %v", files)
+	}
+
+	// Exports of other users are not found
+	if _, err := other.Export(ctx, int(job.ID)); !errors.Is(err, models.ErrNoRecord) {
+		t.Errorf("getting the export of another user: got %v, want %v", err, models.ErrNoRecord)
+	}
+	if _, err := other.DownloadExport(ctx, int(job.ID)); !errors.Is(err, models.ErrNoRecord) {
+		t.Errorf("downloading the export of another user: got %v, want %v", err, models.ErrNoRecord)
+	}
+
+	// The archives are not served as images
+	user, err := app.users.GetByName("test1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored, err := app.exports.Get(int(job.ID), int(user.ID), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := http.Get(server.URL + "/images/" + stored.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusNotFound {
+		t.Errorf("getting an export as an image: got status %d, want %d", res.StatusCode, http.StatusNotFound)
+	}
+
+	// Deleting the account expires the exports, which are deleted with their archives
+	if err := c.DeleteAccount(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.exporter.RunOnce(ctx, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := app.blobs.Get(ctx, stored.Key); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("archive of a deleted account: got %v, want %v", err, storage.ErrNotFound)
+	}
+	if _, err := app.exports.Get(int(job.ID), int(user.ID), time.Time{}); !errors.Is(err, models.ErrNoRecord) {
+		t.Errorf("export of a deleted account: got %v, want %v", err, models.ErrNoRecord)
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"films-api.rdelgado.es/src/internals/export"
+	"films-api.rdelgado.es/src/internals/models"
+	"github.com/julienschmidt/httprouter"
+)
+
+// Records of the exports written in the response. Larger exports are made in
+// the background.
+const maxSyncExportRows = 1000
+
+// exportMe sends the archive with the data of the user, or queues a job to make
+// it when it is large (or the client asks for it with async=true)
+func (app *application) exportMe(w http.ResponseWriter, r *http.Request) {
+	userId := r.Context().Value(userIdContextKey).(int)
+
+	async := r.URL.Query().Get("async")
+	if async != "" && async != "true" && async != "false" {
+		app.clientError(w, r, http.StatusBadRequest, errors.New("async must be true or false"))
+		return
+	}
+
+	rows, err := app.exports.Rows(userId)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if async == "true" || rows > maxSyncExportRows {
+		app.queueExport(w, r, userId)
+		return
+	}
+
+	data, err := app.exports.Collect(userId)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	now := time.Now()
+
+	w.Header().Set("Content-Type", export.ContentType)
+	w.Header().Set("Content-Disposition", exportDisposition(userId, now))
+	w.WriteHeader(http.StatusOK)
+
+	// The status is already sent, errors can only be logged
+	if err := export.Write(w, data, now); err != nil {
+		app.logger.Error("writing export", "error", err.Error())
+	}
+}
+
+// queueExport responds with the job that makes the export of the user. A job
+// already queued is reused.
+func (app *application) queueExport(w http.ResponseWriter, r *http.Request, userId int) {
+	job, err := app.exports.Create(userId)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.exporter.Notify()
+
+	w.Header().Set("Location", fmt.Sprintf("/user/me/export/%d", job.ID))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job)
+}
+
+func (app *application) getExport(w http.ResponseWriter, r *http.Request) {
+	job, ok := app.userExport(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(job)
+}
+
+func (app *application) downloadExport(w http.ResponseWriter, r *http.Request) {
+	job, ok := app.userExport(w, r)
+	if !ok {
+		return
+	}
+
+	if job.Status != models.ExportDone {
+		app.clientError(w, r, http.StatusConflict, models.ErrExportNotReady)
+		return
+	}
+
+	blob, err := app.blobs.Get(r.Context(), job.Key)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	defer blob.Close()
+
+	w.Header().Set("Content-Type", export.ContentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(blob.Size, 10))
+	w.Header().Set("Content-Disposition", exportDisposition(int(job.UserID), *job.FinishedAt))
+	w.WriteHeader(http.StatusOK)
+
+	io.Copy(w, blob)
+}
+
+// userExport returns the export job of the :id parameter, which must be of the
+// user. Otherwise it responds with Not Found.
+func (app *application) userExport(w http.ResponseWriter, r *http.Request) (models.ExportJob, bool) {
+	userId := r.Context().Value(userIdContextKey).(int)
+
+	params := httprouter.ParamsFromContext(r.Context())
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil || id < 1 {
+		app.NotFound(w, r)
+		return models.ExportJob{}, false
+	}
+
+	job, err := app.exports.Get(id, userId, time.Now())
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return models.ExportJob{}, false
+	}
+
+	return job, true
+}
+
+func exportDisposition(userId int, exportedAt time.Time) string {
+	return fmt.Sprintf(`attachment; filename="films-api-export-%d-%s.zip"`, userId, exportedAt.UTC().Format("20060102"))
+}
@@ -12,7 +12,7 @@ import (
 )
 
 type favouriteMovieRequest struct {
-	MovieID             int `json:"movie_id"`
+	MovieID             int `json:"movie_id" validate:"min=1"`
 	validator.Validator `json:"-"`
 }
 
@@ -22,7 +22,7 @@ func (app *application) getFavMovies(w http.ResponseWriter, r *http.Request) {
 	favMovies, err := app.favs.GetAll(userId)
 	if err != nil {
 		if errors.Is(err, models.ErrNoRecord) {
-			app.NotFound(w)
+			app.NotFound(w, r)
 		} else {
 			app.serverError(w, r, err)
 		}
@@ -31,7 +31,7 @@ func (app *application) getFavMovies(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if favMovies == nil {
-		app.NotFound(w)
+		app.NotFound(w, r)
 		return
 	}
 
@@ -47,15 +47,15 @@ func (app *application) deleteMovieFromFav(w http.ResponseWriter, r *http.Reques
 	params := httprouter.ParamsFromContext(r.Context())
 
 	id, err := strconv.Atoi(params.ByName("id"))
-	if err != nil && id < 1 {
-		app.NotFound(w)
+	if err != nil || id < 1 {
+		app.NotFound(w, r)
 		return
 	}
 
-	err = app.favs.Remove(id, userId)
+	err = app.favs.WithContext(r.Context()).Remove(id, userId)
 	if err != nil {
 		if errors.Is(err, models.ErrNoRecord) {
-			app.NotFound(w)
+			app.NotFound(w, r)
 		} else {
 			app.serverError(w, r, err)
 		}
@@ -72,24 +72,25 @@ func (app *application) addMovieToFav(w http.ResponseWriter, r *http.Request) {
 
 	var req favouriteMovieRequest
 
-	err := json.NewDecoder(r.Body).Decode(&req)
+	err := app.readJSON(w, r, &req)
 	if err != nil {
-		app.clientError(w, http.StatusBadRequest, err)
+		app.clientError(w, r, http.StatusBadRequest, err)
 		return
 	}
 
-	req.CheckField(validator.IsPositiveNumber(req.MovieID), "movie", "This field must be movie ID")
+	req.CheckStruct(req)
 
 	if !req.IsValid() {
-		w.WriteHeader(http.StatusUnprocessableEntity)
-		json.NewEncoder(w).Encode(req.FieldErrors)
+		app.failedValidation(w, r, req.Validator)
 		return
 	}
 
-	id, err := app.favs.Insert(userId, req.MovieID)
+	id, err := app.favs.WithContext(r.Context()).Insert(userId, req.MovieID)
 	if err != nil {
 		if errors.Is(err, models.ErrDuplicatedEntry) {
-			app.clientError(w, http.StatusConflict, err)
+			app.clientError(w, r, http.StatusConflict, err)
+		} else if errors.Is(err, models.ErrReferencedNotFound) {
+			app.clientError(w, r, http.StatusNotFound, err)
 		} else {
 			app.serverError(w, r, err)
 		}
@@ -1,12 +1,53 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
 	"net/http"
 	"runtime/debug"
 
+	"films-api.rdelgado.es/src/internals/i18n"
 	"films-api.rdelgado.es/src/internals/models"
+	"films-api.rdelgado.es/src/internals/validator"
 )
 
+// Message keys of the errors sent to clients. The first error matched by
+// errors.Is is used, otherwise the message of the status code.
+var errorMessages = []struct {
+	err error
+	key string
+}{
+	{models.ErrInvalidCredentials, "error.invalid_credentials"},
+	{models.ErrTokenExpired, "error.token_expired"},
+	{models.ErrInvalidToken, "error.invalid_token"},
+	{models.ErrInvalidAuthHeader, "error.invalid_auth_header"},
+	{models.ErrNotAuthorized, "error.forbidden"},
+	{models.ErrNoRecord, "error.not_found"},
+	{models.ErrReferencedNotFound, "error.referenced_not_found"},
+	{models.ErrTitleInTrash, "error.title_in_trash"},
+	{models.ErrDuplicatedEntry, "error.conflict"},
+	{models.ErrWebhookDisabled, "error.webhook_disabled"},
+	{models.ErrExportNotReady, "error.export_not_ready"},
+	{models.ErrMFARequired, "error.mfa_required"},
+	{models.ErrMFALocked, "error.mfa_locked"},
+	{models.ErrTOTPEnabled, "error.totp_enabled"},
+	{models.ErrLastIdentity, "error.last_identity"},
+	{models.ErrInvalidOneTimeToken, "error.one_time_token"},
+	{errExternalLogin, "error.external_login"},
+}
+
+var statusMessages = map[int]string{
+	http.StatusBadRequest:            "error.bad_request",
+	http.StatusUnauthorized:          "error.unauthorized",
+	http.StatusForbidden:             "error.forbidden",
+	http.StatusNotFound:              "error.not_found",
+	http.StatusConflict:              "error.conflict",
+	http.StatusRequestEntityTooLarge: "error.too_large",
+	http.StatusUnsupportedMediaType:  "error.unsupported_media_type",
+	http.StatusUnprocessableEntity:   "error.unprocessable_entity",
+	http.StatusInternalServerError:   "error.internal",
+}
+
 func (app *application) serverError(w http.ResponseWriter, r *http.Request, err error) {
 	var (
 		method = r.Method
@@ -15,19 +56,68 @@ func (app *application) serverError(w http.ResponseWriter, r *http.Request, err
 	)
 
 	app.logger.Error(err.Error(), "method", method, "uri", uri, "trace", trace)
-	http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	app.errorResponse(w, r, http.StatusInternalServerError, nil)
 }
 
-func (app *application) clientError(w http.ResponseWriter, status int, err error) {
+func (app *application) clientError(w http.ResponseWriter, r *http.Request, status int, err error) {
 	if err != nil {
 		app.logger.Error(err.Error())
 	}
 
-	http.Error(w, http.StatusText(status), status)
+	app.errorResponse(w, r, status, err)
+}
+
+func (app *application) NotFound(w http.ResponseWriter, r *http.Request) {
+	app.clientError(w, r, http.StatusNotFound, models.ErrNoRecord)
+}
+
+// failedValidation sends the field errors in the language of the client
+func (app *application) failedValidation(w http.ResponseWriter, r *http.Request, v validator.Validator) {
+	locale := app.locale(r)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Language", locale)
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	json.NewEncoder(w).Encode(v.LocalizedFieldErrors(locale))
+}
+
+// errorResponse sends the message of the error (or the status) in the language of the client.
+// Errors reading the body of the request have their own status and message.
+func (app *application) errorResponse(w http.ResponseWriter, r *http.Request, status int, err error) {
+	var maxBytesError *http.MaxBytesError
+	if errors.As(err, &maxBytesError) {
+		err = decodeError(err, nil)
+	}
+
+	locale := app.locale(r)
+
+	var reqErr *requestError
+	if errors.As(err, &reqErr) {
+		w.Header().Set("Content-Language", locale)
+		http.Error(w, reqErr.In(locale), reqErr.status)
+		return
+	}
+
+	key, exists := statusMessages[status]
+	for _, known := range errorMessages {
+		if err != nil && errors.Is(err, known.err) {
+			key, exists = known.key, true
+			break
+		}
+	}
+
+	message := http.StatusText(status)
+	if exists {
+		message = i18n.T(locale, key, nil)
+	}
+
+	w.Header().Set("Content-Language", locale)
+	http.Error(w, message, status)
 }
 
-func (app *application) NotFound(w http.ResponseWriter) {
-	app.clientError(w, http.StatusNotFound, models.ErrNoRecord)
+// locale returns the supported locale preferred by the client
+func (app *application) locale(r *http.Request) string {
+	return i18n.Match(r.Header.Get("Accept-Language"))
 }
 
 func (app *application) isAuthenticated(r *http.Request) bool {
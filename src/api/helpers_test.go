@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"films-api.rdelgado.es/pkg/client"
+	"films-api.rdelgado.es/src/internals/i18n"
+	"films-api.rdelgado.es/src/internals/models"
+)
+
+func TestErrorMessagesAreTranslated(t *testing.T) {
+	for _, known := range errorMessages {
+		if !i18n.Has(known.key) {
+			t.Errorf("%v: message key %q is not in the catalogue", known.err, known.key)
+		}
+	}
+
+	for status, key := range statusMessages {
+		if !i18n.Has(key) {
+			t.Errorf("status %d: message key %q is not in the catalogue", status, key)
+		}
+	}
+}
+
+func TestLocalizedErrors(t *testing.T) {
+	_, server := newTestServer(t)
+	ctx := context.Background()
+
+	spanish := client.New(server.URL, client.WithLanguage("es-ES,es;q=0.9,en;q=0.8"))
+
+	var apiErr *client.Error
+	err := spanish.Signup(ctx, "bob", "weak")
+	if !errors.As(err, &apiErr) || apiErr.Fields["password"] != "Este campo debe tener al menos 8 caracteres" {
+		t.Errorf("spanish field errors: got %v", err)
+	}
+
+	err = spanish.Login(ctx, "test1", "Wrong.pass1")
+	if !errors.As(err, &apiErr) || apiErr.Message != i18n.T("es", "error.invalid_credentials", nil) {
+		t.Errorf("spanish error message: got %v", err)
+	}
+
+	// Unsupported languages get the fallback locale
+	res, err := http.Get(server.URL + "/list/999")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	if got := res.Header.Get("Content-Language"); got != i18n.Fallback {
+		t.Errorf("Content-Language: got %q, want %q", got, i18n.Fallback)
+	}
+
+	german := client.New(server.URL, client.WithLanguage("de"))
+	if _, err := german.List(ctx, 999); !errors.As(err, &apiErr) || !errors.Is(err, models.ErrNoRecord) || apiErr.Message != i18n.T(i18n.Fallback, "error.not_found", nil) {
+		t.Errorf("fallback error message: got %v", err)
+	}
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"films-api.rdelgado.es/src/internals/i18n"
+	"films-api.rdelgado.es/src/internals/imaging"
+	"films-api.rdelgado.es/src/internals/models"
+	"films-api.rdelgado.es/src/internals/storage"
+	"films-api.rdelgado.es/src/internals/validator"
+	"github.com/julienschmidt/httprouter"
+)
+
+// Maximum size of an uploaded image, including the multipart envelope
+const maxImageSize = 10 << 20
+
+// Images are stored under keys with a hash of their content, so their URLs
+// never change and can be cached forever
+const imageCacheControl = "public, max-age=31536000, immutable"
+
+// imageKind holds the limits of the images of a kind and the widths of their thumbnails
+type imageKind struct {
+	limits     imaging.Limits
+	thumbnails map[string]int
+}
+
+var imageKinds = map[string]imageKind{
+	models.ImagePoster: {
+		limits:     imaging.Limits{MinWidth: 100, MinHeight: 150, MaxWidth: 4000, MaxHeight: 6000},
+		thumbnails: map[string]int{"small": 185, "medium": 342, "large": 780},
+	},
+	models.ImageBackdrop: {
+		limits:     imaging.Limits{MinWidth: 300, MinHeight: 169, MaxWidth: 7680, MaxHeight: 4320},
+		thumbnails: map[string]int{"small": 300, "medium": 780, "large": 1280},
+	},
+}
+
+// uploadMovieImage returns the handler that sets the poster or backdrop of a
+// movie from the image field of a multipart form
+func (app *application) uploadMovieImage(kind string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		userId := r.Context().Value(userIdContextKey).(int)
+
+		params := httprouter.ParamsFromContext(r.Context())
+		id, err := strconv.Atoi(params.ByName("id"))
+		if err != nil || id < 1 {
+			app.NotFound(w, r)
+			return
+		}
+
+		movie, err := app.movies.Get(id)
+		if err != nil {
+			if errors.Is(err, models.ErrNoRecord) {
+				app.NotFound(w, r)
+			} else {
+				app.serverError(w, r, err)
+			}
+			return
+		}
+
+		// Only the user who created the movie can change its images
+		if movie.UserID != uint(userId) {
+			app.clientError(w, r, http.StatusForbidden, models.ErrNotAuthorized)
+			return
+		}
+
+		data, err := readImageUpload(r)
+		if err != nil {
+			var v validator.Validator
+			if errors.Is(err, http.ErrMissingFile) {
+				v.AddFieldMessage("image", i18n.NewMessage("validation.required", nil))
+				app.failedValidation(w, r, v)
+				return
+			}
+
+			app.clientError(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		img, err := imaging.Decode(data, imageKinds[kind].limits)
+		if err != nil {
+			var v validator.Validator
+			switch {
+			case errors.Is(err, imaging.ErrUnsupportedFormat):
+				v.AddFieldMessage("image", i18n.NewMessage("validation.image.format", i18n.Params{"formats": "JPEG, PNG, WebP"}))
+			case errors.Is(err, imaging.ErrDimensions):
+				limits := imageKinds[kind].limits
+				v.AddFieldMessage("image", i18n.NewMessage("validation.image.dimensions", i18n.Params{
+					"min": fmt.Sprintf("%dx%d", limits.MinWidth, limits.MinHeight),
+					"max": fmt.Sprintf("%dx%d", limits.MaxWidth, limits.MaxHeight),
+				}))
+			default:
+				app.serverError(w, r, err)
+				return
+			}
+
+			app.failedValidation(w, r, v)
+			return
+		}
+
+		image, err := app.storeImage(r, id, kind, data, img)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		previous, err := app.movies.WithContext(r.Context()).SetImage(id, kind, image)
+		if err != nil {
+			app.deleteBlobs(r, image.Keys())
+
+			if errors.Is(err, models.ErrNoRecord) {
+				app.NotFound(w, r)
+			} else {
+				app.serverError(w, r, err)
+			}
+			return
+		}
+
+		// The blobs of the replaced image are no longer referenced (uploading
+		// the same file again gives the same keys)
+		var unused []string
+		for _, key := range previous.Keys() {
+			if !slices.Contains(image.Keys(), key) {
+				unused = append(unused, key)
+			}
+		}
+		app.deleteBlobs(r, unused)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(image)
+	}
+}
+
+// readImageUpload returns the content of the image field of a multipart form
+func readImageUpload(r *http.Request) ([]byte, error) {
+	err := r.ParseMultipartForm(maxImageSize)
+	if errors.Is(err, http.ErrNotMultipart) || errors.Is(err, http.ErrMissingBoundary) {
+		return nil, newRequestError(http.StatusUnsupportedMediaType, "request.content_type", i18n.Params{"type": "multipart/form-data"}, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	file, _, err := r.FormFile("image")
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return io.ReadAll(file)
+}
+
+// storeImage saves the original image and its thumbnails. Thumbnails are
+// JPEG and only made for the sizes smaller than the original.
+func (app *application) storeImage(r *http.Request, movieId int, kind string, data []byte, img *imaging.Image) (*models.Image, error) {
+	hash := sha256.Sum256(data)
+	base := fmt.Sprintf("movies/%d/%s-%s", movieId, kind, hex.EncodeToString(hash[:8]))
+
+	image := &models.Image{
+		URL:         models.ImageURL(base + img.Extension),
+		ContentType: img.ContentType,
+		Width:       img.Width,
+		Height:      img.Height,
+		Thumbnails:  map[string]string{},
+	}
+
+	if err := app.blobs.Put(r.Context(), base+img.Extension, bytes.NewReader(data)); err != nil {
+		return nil, err
+	}
+
+	for name, width := range imageKinds[kind].thumbnails {
+		if width >= img.Width {
+			continue
+		}
+
+		var thumbnail bytes.Buffer
+		if err := imaging.EncodeJPEG(&thumbnail, imaging.Thumbnail(img, width)); err != nil {
+			app.deleteBlobs(r, image.Keys())
+			return nil, err
+		}
+
+		key := base + "-" + name + ".jpg"
+		if err := app.blobs.Put(r.Context(), key, &thumbnail); err != nil {
+			app.deleteBlobs(r, image.Keys())
+			return nil, err
+		}
+
+		image.Thumbnails[name] = models.ImageURL(key)
+	}
+
+	return image, nil
+}
+
+// deleteBlobs removes blobs that are no longer needed. Failures only leave
+// unreferenced files, so they are logged and not sent to the client.
+func (app *application) deleteBlobs(r *http.Request, keys []string) {
+	if len(keys) == 0 {
+		return
+	}
+
+	if err := app.blobs.Delete(r.Context(), keys...); err != nil {
+		app.logger.Error("deleting blobs", "keys", keys, "error", err.Error())
+	}
+}
+
+// getImage serves a stored image or thumbnail
+func (app *application) getImage(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+	key := strings.TrimPrefix(params.ByName("key"), "/")
+
+	// The store also keeps the exports of the users, which are not public
+	if !strings.HasPrefix(key, "movies/") {
+		app.NotFound(w, r)
+		return
+	}
+
+	blob, err := app.blobs.Get(r.Context(), key)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) || errors.Is(err, storage.ErrInvalidKey) {
+			app.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+	defer blob.Close()
+
+	etag := `"` + key + `"`
+
+	w.Header().Set("Cache-Control", imageCacheControl)
+	if notModified(w, r, etag, blob.ModTime) {
+		return
+	}
+
+	w.Header().Set("Content-Type", blob.ContentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(blob.Size, 10))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+
+	io.Copy(w, blob)
+}
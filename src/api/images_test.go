@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"films-api.rdelgado.es/pkg/client"
+	"films-api.rdelgado.es/src/internals/models"
+)
+
+// testPNG encodes a PNG of the given size filled with a color
+func testPNG(t *testing.T, width, height int, fill color.Color) []byte {
+	t.Helper()
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			img.Set(x, y, fill)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestMovieImages(t *testing.T) {
+	app, server := newTestServer(t)
+	ctx := context.Background()
+
+	c := client.New(server.URL, client.WithCredentials("test1", testPassword))
+
+	id, err := c.CreateMovie(ctx, client.MovieInput{
+		Title: "Heat", Director: "Michael Mann", ReleaseDate: time.Date(1995, 12, 15, 0, 0, 0, 0, time.UTC),
+		Cast: []string{"Al Pacino"}, Genre: "Crime", Synopsis: "A group of professional bank robbers.",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	poster, err := c.UploadPoster(ctx, id, "heat.png", bytes.NewReader(testPNG(t, 400, 600, color.Black)))
+	if err != nil {
+		t.Fatalf("uploading poster: %v", err)
+	}
+
+	// Thumbnails are only made for the sizes smaller than the image
+	if poster.ContentType != "image/png" || poster.Width != 400 || poster.Height != 600 || len(poster.Thumbnails) != 2 || poster.Thumbnails["large"] != "" {
+		t.Errorf("unexpected poster: %+v", poster)
+	}
+
+	movie, err := c.Movie(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if movie.Movie.Poster == nil || movie.Movie.Poster.URL != poster.URL || movie.Movie.Backdrop != nil {
+		t.Errorf("movie images: got poster %+v and backdrop %+v", movie.Movie.Poster, movie.Movie.Backdrop)
+	}
+
+	// Images are public and cached
+	res, err := http.Get(server.URL + poster.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusOK || res.Header.Get("Content-Type") != "image/png" || res.Header.Get("Cache-Control") != imageCacheControl {
+		t.Errorf("getting poster: got %d %v", res.StatusCode, res.Header)
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL+poster.Thumbnails["small"], nil)
+	req.Header.Set("If-None-Match", res.Header.Get("ETag"))
+	if res, err := http.DefaultClient.Do(req); err != nil || res.StatusCode != http.StatusOK {
+		t.Errorf("thumbnail with the ETag of another image: got %v %v", res, err)
+	}
+
+	req, _ = http.NewRequest(http.MethodGet, server.URL+poster.URL, nil)
+	req.Header.Set("If-None-Match", res.Header.Get("ETag"))
+	if res, err := http.DefaultClient.Do(req); err != nil || res.StatusCode != http.StatusNotModified {
+		t.Errorf("conditional request: got %v %v", res, err)
+	}
+
+	// Replacing the poster deletes the old files
+	newPoster, err := c.UploadPoster(ctx, id, "heat.png", bytes.NewReader(testPNG(t, 400, 600, color.White)))
+	if err != nil {
+		t.Fatalf("replacing poster: %v", err)
+	}
+	if newPoster.URL == poster.URL {
+		t.Fatal("a different image has the same URL")
+	}
+	for _, url := range []string{poster.URL, poster.Thumbnails["small"]} {
+		if res, err := http.Get(server.URL + url); err != nil || res.StatusCode != http.StatusNotFound {
+			t.Errorf("replaced image %s: got %v %v", url, res, err)
+		}
+	}
+
+	// Invalid uploads
+	var apiErr *client.Error
+	_, err = c.UploadBackdrop(ctx, id, "heat.png", strings.NewReader("not an image"))
+	if !errors.As(err, &apiErr) || apiErr.Fields["image"] != "This field must be an image in one of these formats: JPEG, PNG, WebP" {
+		t.Errorf("text file: got %v", err)
+	}
+
+	_, err = c.UploadBackdrop(ctx, id, "heat.png", bytes.NewReader(testPNG(t, 200, 600, color.Black)))
+	if !errors.As(err, &apiErr) || apiErr.Fields["image"] != "The image must be between 300x169 and 7680x4320 pixels" {
+		t.Errorf("narrow backdrop: got %v", err)
+	}
+
+	_, err = c.UploadPoster(ctx, id, "heat.png", bytes.NewReader(make([]byte, maxImageSize+1)))
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("large file: got %v", err)
+	}
+
+	other := client.New(server.URL, client.WithCredentials("test2", testPassword))
+	if _, err := other.UploadPoster(ctx, id, "heat.png", bytes.NewReader(testPNG(t, 400, 600, color.Black))); !errors.Is(err, models.ErrNotAuthorized) {
+		t.Errorf("poster of another user's movie: got %v, want %v", err, models.ErrNotAuthorized)
+	}
+
+	if _, err := c.UploadPoster(ctx, 9999, "heat.png", bytes.NewReader(testPNG(t, 400, 600, color.Black))); !errors.Is(err, models.ErrNoRecord) {
+		t.Errorf("poster of a missing movie: got %v, want %v", err, models.ErrNoRecord)
+	}
+
+	// Purging the movie deletes its images (they are kept in the trash)
+	if err := c.DeleteMovie(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := app.trash.Purge(ctx, time.Now().Add(app.movies.TrashRetention+time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	for _, url := range []string{newPoster.URL, newPoster.Thumbnails["medium"]} {
+		if res, err := http.Get(server.URL + url); err != nil || res.StatusCode != http.StatusNotFound {
+			t.Errorf("image of a purged movie %s: got %v %v", url, res, err)
+		}
+	}
+
+	// Keys cannot escape the storage directory
+	if res, err := http.Get(server.URL + "/images/../go.mod"); err != nil || res.StatusCode != http.StatusNotFound {
+		t.Errorf("path traversal: got %v %v", res, err)
+	}
+}
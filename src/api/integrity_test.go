@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"films-api.rdelgado.es/pkg/client"
+	"films-api.rdelgado.es/src/internals/models"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestReferencedNotFound(t *testing.T) {
+	app, server := newTestServer(t)
+	ctx := context.Background()
+
+	c := client.New(server.URL, client.WithCredentials("test1", testPassword))
+
+	var apiErr *client.Error
+	if _, err := c.AddFavourite(ctx, 9999); !errors.As(err, &apiErr) || !errors.Is(err, models.ErrNoRecord) || apiErr.Message != "The movie does not exist" {
+		t.Errorf("favourite of a missing movie: got %v", err)
+	}
+
+	listId, err := c.CreateList(ctx, client.ListInput{Name: "Watch later"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.AddListItem(ctx, listId, 9999, ""); !errors.Is(err, models.ErrNoRecord) {
+		t.Errorf("list item of a missing movie: got %v, want %v", err, models.ErrNoRecord)
+	}
+
+	// Movies in the trash cannot be referenced either
+	id, err := c.CreateMovie(ctx, client.MovieInput{
+		Title: "Heat", Director: "Michael Mann", ReleaseDate: time.Date(1995, 12, 15, 0, 0, 0, 0, time.UTC),
+		Cast: []string{"Al Pacino"}, Genre: "Crime", Synopsis: "A group of professional bank robbers.",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.DeleteMovie(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.AddFavourite(ctx, id); !errors.Is(err, models.ErrNoRecord) {
+		t.Errorf("favourite of a deleted movie: got %v, want %v", err, models.ErrNoRecord)
+	}
+
+	// The foreign keys reject what the models do not check
+	db := app.movies.DB
+	if err := db.Create(&models.Favourite{UserID: 1, MovieID: 9999}).Error; !errors.Is(err, gorm.ErrForeignKeyViolated) {
+		t.Errorf("inserting a favourite of a missing movie: got %v, want %v", err, gorm.ErrForeignKeyViolated)
+	}
+	if err := db.Unscoped().Delete(&models.User{}, 1).Error; err == nil {
+		t.Errorf("deleting a user with movies: got no error")
+	}
+}
+
+func TestRepairOrphans(t *testing.T) {
+	// A database created before the foreign keys
+	db, err := gorm.Open(sqlite.Open("file:TestRepairOrphans?mode=memory&cache=shared"), &gorm.Config{
+		TranslateError:                           true,
+		DisableForeignKeyConstraintWhenMigrating: true,
+		Logger:                                   logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := migrate(db); err != nil {
+		t.Fatal(err)
+	}
+
+	owner := models.User{Name: "owner", Password: "x"}
+	db.Create(&owner)
+	db.Create(&models.Movie{Title: "Orphan", UserID: 99})
+	db.Create(&models.Movie{Title: "Owned", UserID: owner.ID})
+	db.Create(&models.Favourite{UserID: owner.ID, MovieID: 99})
+	db.Create(&models.Favourite{UserID: 99, MovieID: 1})
+	db.Create(&models.List{Name: "Orphan", UserID: 99})
+	db.Create(&models.ListItem{ListID: 1, MovieID: 2, Position: 1})
+
+	orphans, err := models.FindOrphans(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(orphans) != 4 {
+		t.Fatalf("orphans: got %+v", orphans)
+	}
+
+	if err := migrate(db); err == nil {
+		t.Errorf("migrating with orphaned rows: got no error")
+	}
+
+	if _, err := models.RepairOrphans(db, 0); err == nil {
+		t.Errorf("repairing orphaned movies without owner: got no error")
+	}
+
+	fixed, err := models.RepairOrphans(db, owner.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The item is deleted with its list
+	want := []models.Orphans{
+		{Table: "lists", Column: "user_id", References: "users", Rows: 1, Fix: models.OrphanDelete},
+		{Table: "movies", Column: "user_id", References: "users", Rows: 1, Fix: models.OrphanReassign},
+		{Table: "favourites", Column: "user_id", References: "users", Rows: 1, Fix: models.OrphanDelete},
+		{Table: "favourites", Column: "movie_id", References: "movies", Rows: 1, Fix: models.OrphanDelete},
+		{Table: "list_items", Column: "list_id", References: "lists", Rows: 1, Fix: models.OrphanDelete},
+	}
+	if len(fixed) != len(want) {
+		t.Fatalf("fixed: got %+v, want %+v", fixed, want)
+	}
+	for i := range want {
+		if fixed[i] != want[i] {
+			t.Errorf("fixed %d: got %+v, want %+v", i, fixed[i], want[i])
+		}
+	}
+
+	var movie models.Movie
+	db.First(&movie, "title = ?", "Orphan")
+	if movie.UserID != owner.ID {
+		t.Errorf("owner of the orphaned movie: got %d, want %d", movie.UserID, owner.ID)
+	}
+
+	if orphans, err := models.FindOrphans(db); err != nil || len(orphans) != 0 {
+		t.Errorf("orphans after repairing: got %+v %v", orphans, err)
+	}
+}
@@ -0,0 +1,371 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"films-api.rdelgado.es/src/internals/i18n"
+	"films-api.rdelgado.es/src/internals/models"
+	"films-api.rdelgado.es/src/internals/validator"
+	"github.com/julienschmidt/httprouter"
+)
+
+type listRequest struct {
+	Name                string `json:"name" validate:"required,max=100"`
+	Description         string `json:"description"`
+	Visibility          string `json:"visibility" validate:"omitempty,oneof=public unlisted private"`
+	validator.Validator `json:"-"`
+}
+
+// listUpdateRequest has the fields of listRequest, all of them optional. An
+// empty description clears it.
+type listUpdateRequest struct {
+	Name                *string `json:"name" validate:"omitempty,required,max=100"`
+	Description         *string `json:"description"`
+	Visibility          *string `json:"visibility" validate:"omitempty,oneof=public unlisted private"`
+	validator.Validator `json:"-"`
+}
+
+type listItemRequest struct {
+	MovieID             int    `json:"movie_id" validate:"min=1"`
+	Note                string `json:"note" validate:"max=500"`
+	validator.Validator `json:"-"`
+}
+
+type listItemNoteRequest struct {
+	Note                string `json:"note" validate:"max=500"`
+	validator.Validator `json:"-"`
+}
+
+type listOrderRequest struct {
+	ItemIDs             []int `json:"item_ids" validate:"required"`
+	validator.Validator `json:"-"`
+}
+
+func (app *application) getMyLists(w http.ResponseWriter, r *http.Request) {
+	userId := r.Context().Value(userIdContextKey).(int)
+
+	lists, err := app.lists.GetAllByUser(userId)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(lists)
+}
+
+func (app *application) getPublicLists(w http.ResponseWriter, r *http.Request) {
+	lists, err := app.lists.GetAllPublic()
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(lists)
+}
+
+func (app *application) getList(w http.ResponseWriter, r *http.Request) {
+
+	// Authentication is optional: anonymous users can read public and unlisted lists
+	userId, _ := r.Context().Value(userIdContextKey).(int)
+
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil || id < 1 {
+		app.NotFound(w, r)
+		return
+	}
+
+	list, err := app.lists.GetDetails(id, userId)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(list)
+}
+
+func (app *application) addList(w http.ResponseWriter, r *http.Request) {
+	userId := r.Context().Value(userIdContextKey).(int)
+
+	var req listRequest
+
+	err := app.readJSON(w, r, &req)
+	if err != nil {
+		app.clientError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	// Lists are private unless the user asks otherwise
+	if req.Visibility == "" {
+		req.Visibility = models.ListPrivate
+	}
+
+	req.CheckStruct(req)
+
+	if !req.IsValid() {
+		app.failedValidation(w, r, req.Validator)
+		return
+	}
+
+	id, err := app.lists.Insert(userId, req.Name, req.Description, req.Visibility)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(id)
+}
+
+func (app *application) updateList(w http.ResponseWriter, r *http.Request) {
+	userId := r.Context().Value(userIdContextKey).(int)
+
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil || id < 1 {
+		app.NotFound(w, r)
+		return
+	}
+
+	var req listUpdateRequest
+
+	err = app.readJSON(w, r, &req)
+	if err != nil {
+		app.clientError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	// Only the fields sent in the request are updated
+	req.CheckStruct(req)
+
+	if !req.IsValid() {
+		app.failedValidation(w, r, req.Validator)
+		return
+	}
+
+	err = app.lists.Update(id, userId, req.Name, req.Description, req.Visibility)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+}
+
+func (app *application) deleteList(w http.ResponseWriter, r *http.Request) {
+	userId := r.Context().Value(userIdContextKey).(int)
+
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil || id < 1 {
+		app.NotFound(w, r)
+		return
+	}
+
+	err = app.lists.Delete(id, userId)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+}
+
+func (app *application) addListItem(w http.ResponseWriter, r *http.Request) {
+	userId := r.Context().Value(userIdContextKey).(int)
+
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil || id < 1 {
+		app.NotFound(w, r)
+		return
+	}
+
+	var req listItemRequest
+
+	err = app.readJSON(w, r, &req)
+	if err != nil {
+		app.clientError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	req.CheckStruct(req)
+
+	if !req.IsValid() {
+		app.failedValidation(w, r, req.Validator)
+		return
+	}
+
+	itemId, err := app.lists.AddItem(id, userId, req.MovieID, req.Note)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.NotFound(w, r)
+		} else if errors.Is(err, models.ErrReferencedNotFound) {
+			app.clientError(w, r, http.StatusNotFound, err)
+		} else if errors.Is(err, models.ErrDuplicatedEntry) {
+			app.clientError(w, r, http.StatusConflict, err)
+		} else {
+			app.serverError(w, r, err)
+		}
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(itemId)
+}
+
+func (app *application) updateListItem(w http.ResponseWriter, r *http.Request) {
+	userId := r.Context().Value(userIdContextKey).(int)
+
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil || id < 1 {
+		app.NotFound(w, r)
+		return
+	}
+
+	itemId, err := strconv.Atoi(params.ByName("item"))
+	if err != nil || itemId < 1 {
+		app.NotFound(w, r)
+		return
+	}
+
+	var req listItemNoteRequest
+
+	err = app.readJSON(w, r, &req)
+	if err != nil {
+		app.clientError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	req.CheckStruct(req)
+
+	if !req.IsValid() {
+		app.failedValidation(w, r, req.Validator)
+		return
+	}
+
+	err = app.lists.UpdateItemNote(id, userId, itemId, req.Note)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+}
+
+func (app *application) deleteListItem(w http.ResponseWriter, r *http.Request) {
+	userId := r.Context().Value(userIdContextKey).(int)
+
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil || id < 1 {
+		app.NotFound(w, r)
+		return
+	}
+
+	itemId, err := strconv.Atoi(params.ByName("item"))
+	if err != nil || itemId < 1 {
+		app.NotFound(w, r)
+		return
+	}
+
+	err = app.lists.RemoveItem(id, userId, itemId)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+}
+
+func (app *application) reorderList(w http.ResponseWriter, r *http.Request) {
+	userId := r.Context().Value(userIdContextKey).(int)
+
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil || id < 1 {
+		app.NotFound(w, r)
+		return
+	}
+
+	var req listOrderRequest
+
+	err = app.readJSON(w, r, &req)
+	if err != nil {
+		app.clientError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	req.CheckStruct(req)
+
+	if !req.IsValid() {
+		app.failedValidation(w, r, req.Validator)
+		return
+	}
+
+	err = app.lists.Reorder(id, userId, req.ItemIDs)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.NotFound(w, r)
+		} else if errors.Is(err, models.ErrInvalidOrder) {
+			req.AddFieldMessage("item_ids", i18n.NewMessage("validation.list_order", nil))
+			app.failedValidation(w, r, req.Validator)
+		} else {
+			app.serverError(w, r, err)
+		}
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+}
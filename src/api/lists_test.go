@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"films-api.rdelgado.es/pkg/client"
+	"films-api.rdelgado.es/src/internals/models"
+)
+
+func TestUpdateList(t *testing.T) {
+	_, server := newTestServer(t)
+	ctx := context.Background()
+
+	owner := client.New(server.URL, client.WithCredentials("test2", testPassword))
+	other := client.New(server.URL, client.WithCredentials("test3", testPassword))
+
+	id, err := owner.CreateList(ctx, client.ListInput{Name: "Heists", Description: "Films about heists"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	text := func(s string) *string { return &s }
+
+	tests := []struct {
+		name   string
+		update client.ListUpdate
+		want   client.List
+		field  string
+	}{
+		{
+			name:   "name only",
+			update: client.ListUpdate{Name: text("Best heists")},
+			want:   client.List{Name: "Best heists", Description: "Films about heists", Visibility: client.ListPrivate},
+		},
+		{
+			name:   "clear the description",
+			update: client.ListUpdate{Description: text("")},
+			want:   client.List{Name: "Best heists", Visibility: client.ListPrivate},
+		},
+		{
+			name:   "visibility",
+			update: client.ListUpdate{Visibility: text(client.ListPublic)},
+			want:   client.List{Name: "Best heists", Visibility: client.ListPublic},
+		},
+		{
+			name:   "nothing",
+			update: client.ListUpdate{},
+			want:   client.List{Name: "Best heists", Visibility: client.ListPublic},
+		},
+		{name: "empty name", update: client.ListUpdate{Name: text("")}, field: "name"},
+		{name: "unknown visibility", update: client.ListUpdate{Visibility: text("friends")}, field: "visibility"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := owner.UpdateList(ctx, id, tt.update)
+
+			if tt.field != "" {
+				var apiErr *client.Error
+				if !errors.As(err, &apiErr) || apiErr.Fields[tt.field] == "" {
+					t.Errorf("got %v, want an error in %s", err, tt.field)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			details, err := owner.List(ctx, id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := details.List
+			if got.Name != tt.want.Name || got.Description != tt.want.Description || got.Visibility != tt.want.Visibility {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	if err := other.UpdateList(ctx, id, client.ListUpdate{Description: text("Mine now")}); !errors.Is(err, models.ErrNoRecord) {
+		t.Errorf("updating the list of another user: got %v, want %v", err, models.ErrNoRecord)
+	}
+}
+
+func TestListItems(t *testing.T) {
+	_, server := newTestServer(t)
+	ctx := context.Background()
+
+	owner := client.New(server.URL, client.WithCredentials("test2", testPassword))
+
+	id, err := owner.CreateList(ctx, client.ListInput{Name: "Watch later"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var items []int
+	for _, movie := range []int{1, 2, 3} {
+		item, err := owner.AddListItem(ctx, id, movie, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		items = append(items, item)
+	}
+
+	if _, err := owner.AddListItem(ctx, id, 1, ""); !errors.Is(err, models.ErrDuplicatedEntry) {
+		t.Errorf("adding a movie twice: got %v, want %v", err, models.ErrDuplicatedEntry)
+	}
+	if err := owner.UpdateListItem(ctx, id, items[1], "Rewatch"); err != nil {
+		t.Fatal(err)
+	}
+	if err := owner.RemoveListItem(ctx, id, items[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	orders := []struct {
+		name  string
+		order []int
+		valid bool
+	}{
+		{"reversed", []int{items[2], items[1]}, true},
+		{"missing item", []int{items[2]}, false},
+		{"removed item", []int{items[2], items[0]}, false},
+		{"repeated item", []int{items[2], items[2]}, false},
+	}
+
+	for _, tt := range orders {
+		if err := owner.ReorderList(ctx, id, tt.order); (err == nil) != tt.valid {
+			t.Errorf("reordering with %s: got %v", tt.name, err)
+		}
+	}
+
+	list, err := owner.List(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Items) != 2 || list.Items[0].ID != uint(items[2]) || list.Items[1].Note != "Rewatch" {
+		t.Errorf("got items %+v", list.Items)
+	}
+}
+
+func TestReorderListWithTrashedMovie(t *testing.T) {
+	_, server := newTestServer(t)
+	ctx := context.Background()
+
+	owner := client.New(server.URL, client.WithCredentials("test2", testPassword))
+
+	trashed, err := owner.CreateMovie(ctx, client.MovieInput{
+		Title: "Heat", Director: "Michael Mann", ReleaseDate: time.Date(1995, 12, 15, 0, 0, 0, 0, time.UTC),
+		Cast: []string{"Al Pacino"}, Genre: "Crime", Synopsis: "A group of professional bank robbers.",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := owner.CreateList(ctx, client.ListInput{Name: "Watch later"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var items []int
+	for _, movie := range []int{1, trashed, 2, 3} {
+		item, err := owner.AddListItem(ctx, id, movie, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		items = append(items, item)
+	}
+
+	if err := owner.DeleteMovie(ctx, trashed); err != nil {
+		t.Fatal(err)
+	}
+
+	// The list shows the other items, and they are the ones to order
+	if err := owner.ReorderList(ctx, id, []int{items[3], items[1], items[2], items[0]}); err == nil {
+		t.Error("reordering with the item of a trashed movie: got no error")
+	}
+	if err := owner.ReorderList(ctx, id, []int{items[3], items[2], items[0]}); err != nil {
+		t.Fatal(err)
+	}
+
+	order := func() []int {
+		t.Helper()
+
+		list, err := owner.List(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ids := []int{}
+		for _, item := range list.Items {
+			ids = append(ids, int(item.ID))
+		}
+		return ids
+	}
+
+	if got, want := order(), []int{items[3], items[2], items[0]}; !reflect.DeepEqual(got, want) {
+		t.Errorf("items after reordering: got %v, want %v", got, want)
+	}
+
+	// The restored movie is back in its place
+	if _, err := owner.RestoreMovie(ctx, trashed); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := order(), []int{items[3], items[1], items[2], items[0]}; !reflect.DeepEqual(got, want) {
+		t.Errorf("items after restoring the movie: got %v, want %v", got, want)
+	}
+}
@@ -1,55 +1,148 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
 	"log/slog"
 	"net/http"
 	"os"
 
 	"films-api.rdelgado.es/src/internals/authentication"
+	"films-api.rdelgado.es/src/internals/cache"
+	"films-api.rdelgado.es/src/internals/compress"
+	"films-api.rdelgado.es/src/internals/export"
+	"films-api.rdelgado.es/src/internals/i18n"
+	"films-api.rdelgado.es/src/internals/mail"
 	"films-api.rdelgado.es/src/internals/models"
+	"films-api.rdelgado.es/src/internals/oidc"
+	"films-api.rdelgado.es/src/internals/outbox"
+	"films-api.rdelgado.es/src/internals/seed"
+	"films-api.rdelgado.es/src/internals/storage"
+	"films-api.rdelgado.es/src/internals/stream"
+	"films-api.rdelgado.es/src/internals/trash"
+	"films-api.rdelgado.es/src/internals/webhooks"
+	"gorm.io/gorm"
 )
 
+const usage = `Usage: movies-api <command> [arguments]
+
+Commands:
+  serve                                   start the HTTP server (default)
+  migrate                                 migrate the database schema
+  seed [--dir fixtures] [--env name] [--file fixtures.json]
+                                          populate the database with fixture data
+  user create|disable|enable|reset-password|reset-mfa|set-role
+                                          manage users
+  movie import|export|purge               import or export the movie catalogue, or empty the trash
+  repair [--dry-run] [--owner name]       fix the rows referencing missing records
+  token issue --user <name>               issue an access token for debugging
+  openapi                                 print the OpenAPI document
+
+Run 'movies-api <command> -h' for the arguments of each command.
+`
+
 func main() {
 
 	// enviroment variables
-	db_hostname := os.Getenv("MYSQL_HOSTNAME")
-	db_name := os.Getenv("MYSQL_DATABASE")
-	db_user := os.Getenv("MYSQL_USER")
-	db_password := os.Getenv("MYSQL_PASSWORD")
-	jwt_secret := os.Getenv("JWT_SECRET")
-	server_port := os.Getenv("API_PORT")
+	cfg := loadConfig()
 
-	// init logger
-	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	// the server is started when no command is given
+	command := "serve"
+	var args []string
+	if len(os.Args) > 1 {
+		command, args = os.Args[1], os.Args[2:]
+	}
 
-	// init database conn
-	db, err := InitDB(db_hostname, db_name, db_user, db_password)
+	// init logger (admin commands log to stderr so their output can be piped)
+	logOutput := os.Stdout
+	if command != "serve" {
+		logOutput = os.Stderr
+	}
+	logger := slog.New(slog.NewTextHandler(logOutput, nil))
+
+	if cfg.locale != "" {
+		if !i18n.Supported(cfg.locale) {
+			logger.Error("unsupported APP_LOCALE", "locale", cfg.locale, "supported", i18n.Locales())
+			os.Exit(1)
+		}
+		i18n.Fallback = cfg.locale
+	}
+
+	var err error
+	cmd := newCommand(cfg, logger)
+
+	switch command {
+	case "serve":
+		err = serve(cfg, logger)
+	case "migrate":
+		err = cmd.runMigrate()
+	case "seed":
+		err = cmd.runSeed(args)
+	case "user":
+		err = cmd.runUser(args)
+	case "movie":
+		err = cmd.runMovie(args)
+	case "repair":
+		err = cmd.runRepair(args)
+	case "token":
+		err = cmd.runToken(args)
+	case "openapi":
+		_, document := apiSpec()
+		_, err = fmt.Fprintln(os.Stdout, string(document))
+	case "help", "-h", "--help":
+		fmt.Fprint(os.Stdout, usage)
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	// the flags already printed their usage or error
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
 	if err != nil {
 		logger.Error(err.Error())
 		os.Exit(1)
 	}
+}
+
+func serve(cfg config, logger *slog.Logger) error {
+	app, db, err := newApplication(cfg, logger)
+	if err != nil {
+		return err
+	}
 
 	// migrate schemas db
-	err = db.AutoMigrate(&models.User{}, &models.Movie{}, &models.Favourite{})
+	err = migrate(db)
 	if err != nil && db.Migrator().HasTable(&models.Movie{}) {
-		logger.Error(err.Error())
-		os.Exit(1)
+		return err
 	}
 
-	// create app struct (models, etc)
-	app := &application{
-		logger: logger,
-		movies: &models.MovieModel{DB: db},
-		users:  &models.UserModel{DB: db},
-		favs:   &models.FavouriteModel{DB: db},
-		tokens: &authentication.JwtToken{SecretJwt: []byte(jwt_secret)},
+	// seed db with the fixtures of the environment (existing records are kept)
+	set, err := seed.LoadDir(cfg.seedDir, cfg.env)
+	if err != nil {
+		return err
 	}
 
-	// seed db (if db is empty)
-	app.seedDB(db)
+	err = seedFixtures(db, logger, set, cfg.env)
+	if err != nil {
+		return err
+	}
+
+	// publish the events of the outbox and send the webhook deliveries in the background
+	go app.outbox.Run(context.Background())
+	go app.webhooks.Run(context.Background())
+
+	// purge the expired movies of the trash in the background
+	go app.trash.Run(context.Background())
+
+	// make the queued exports of the users and delete the expired ones
+	go app.exporter.Run(context.Background())
 
 	// init http server
-	addr := ":" + server_port
+	addr := ":" + cfg.serverPort
 
 	server := &http.Server{
 		Addr:     addr,
@@ -59,7 +152,164 @@ func main() {
 
 	logger.Info("stating movies api server", slog.String("port", addr))
 
-	err = server.ListenAndServe()
-	logger.Error(err.Error())
-	os.Exit(1)
+	return server.ListenAndServe()
+}
+
+// newApplication opens the database connection and creates the app struct (models, etc)
+func newApplication(cfg config, logger *slog.Logger) (*application, *gorm.DB, error) {
+
+	// init database conn
+	db, err := InitDB(cfg.dbHostname, cfg.dbName, cfg.dbUser, cfg.dbPassword)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	blobs, err := storage.NewLocalStore(cfg.storageDir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	hooks := &models.WebhookModel{DB: db}
+	dispatcher := webhooks.New(hooks, logger)
+	if cfg.env == "development" {
+		// Receivers running in the same machine
+		dispatcher.Client = webhooks.NewClient(true)
+	}
+	broker := stream.New(streamLogSize, streamBufferSize)
+
+	users := &models.UserModel{DB: db}
+
+	// Statuses of the users. An implementation of cache.Shared can be passed
+	// to share them between instances, but each instance still keeps its own
+	// copies until they expire after the TTL, see userCache.
+	userCache := newUserCache(users, cfg.userCacheSize, cfg.userCacheTTL, nil, logger)
+
+	// The cache is told of the changes of the users made elsewhere
+	sinks := outbox.Sinks{userCache}
+	for _, name := range cfg.eventSinks {
+		switch name {
+		case "webhooks":
+			sinks = append(sinks, dispatcher)
+		case "stream":
+			sinks = append(sinks, broker)
+		case "log":
+			sinks = append(sinks, outbox.LogSink{Logger: logger})
+		default:
+			return nil, nil, fmt.Errorf("unknown event sink %q", name)
+		}
+	}
+
+	var mailer mail.Mailer
+	switch cfg.mailSender {
+	case "smtp":
+		mailer = &mail.SMTP{Addr: cfg.smtpAddr, Username: cfg.smtpUser, Password: cfg.smtpPassword, From: cfg.mailFrom}
+	case "file":
+		mailer = &mail.File{Dir: cfg.mailDir, From: cfg.mailFrom}
+	case "log":
+		mailer = &mail.Log{Logger: logger}
+	default:
+		return nil, nil, fmt.Errorf("unknown mail sender %q", cfg.mailSender)
+	}
+
+	// The provider is discovered on the first login
+	var provider *oidc.Provider
+	if cfg.oidcIssuer != "" {
+		provider = oidc.New(oidc.Config{
+			Issuer:       cfg.oidcIssuer,
+			ClientID:     cfg.oidcClientID,
+			ClientSecret: cfg.oidcClientSecret,
+			RedirectURL:  cfg.oidcRedirectURL,
+		})
+	}
+
+	movies := &models.MovieModel{DB: db, Blobs: blobs, TrashRetention: cfg.trashRetention}
+	exports := &models.ExportModel{DB: db}
+
+	sessions := &models.SessionModel{DB: db}
+
+	var movieResponses *cache.LRU[string, cachedResponse]
+	if cfg.movieCacheSize > 0 {
+		movieResponses = cache.New[string, cachedResponse](cfg.movieCacheSize, movieResponsesTTL)
+	}
+
+	var compressor *compress.Compressor
+	if cfg.compressResponses {
+		compressor = compress.New(cfg.compressMinSize, cfg.compressTypes, compressEncodings...)
+	}
+
+	app := &application{
+		logger:  logger,
+		movies:  movies,
+		users:   users,
+		favs:    &models.FavouriteModel{DB: db},
+		lists:   &models.ListModel{DB: db},
+		hooks:   hooks,
+		audit:   &models.AuditModel{DB: db},
+		exports: exports,
+		tokens:  &authentication.JwtToken{SecretJwt: []byte(cfg.jwtSecret)},
+		blobs:   blobs,
+
+		sessions:       sessions,
+		activeSessions: newSessionCache(sessions),
+		userCache:      userCache,
+
+		catalogue:      &models.CatalogueModel{DB: db},
+		movieResponses: movieResponses,
+
+		webhooks: dispatcher,
+		outbox:   outbox.New(&models.OutboxModel{DB: db}, sinks, logger),
+		stream:   broker,
+		trash:    trash.New(movies, logger),
+		exporter: export.New(exports, blobs, logger),
+		mailer:   mailer,
+		mfa:      newMFAPolicy(&models.SettingsModel{DB: db}),
+
+		identities:    &models.IdentityModel{DB: db},
+		oidc:          provider,
+		oidcProvision: cfg.oidcProvision,
+
+		compressor: compressor,
+
+		validateRequests: cfg.validateRequests,
+		insecureWebhooks: cfg.env == "development",
+	}
+
+	return app, db, nil
+}
+
+func seedFixtures(db *gorm.DB, logger *slog.Logger, set seed.Set, env string) error {
+	report, err := seed.Run(db, set, env)
+	if err != nil {
+		return fmt.Errorf("seeding database: %w", err)
+	}
+
+	for entity, counts := range report {
+		logger.Info("database seeded", "entity", entity, "created", counts.Created, "existing", counts.Existing, "env", env)
+	}
+
+	return nil
+}
+
+// migrate creates the tables and their foreign keys. The keys cannot be added
+// while there are orphaned rows, which are fixed with the repair command.
+func migrate(db *gorm.DB) error {
+	orphans, err := models.FindOrphans(db)
+	if err != nil {
+		return err
+	}
+	if len(orphans) > 0 {
+		return fmt.Errorf("found rows referencing missing records %+v, run 'movies-api repair' to fix them", orphans)
+	}
+
+	err = db.AutoMigrate(&models.User{}, &models.Movie{}, &models.Favourite{}, &models.List{}, &models.ListItem{}, &models.Webhook{}, &models.WebhookDelivery{}, &models.OutboxEvent{}, &models.AuditEntry{}, &models.ExportJob{}, &models.OneTimeToken{}, &models.RecoveryCode{}, &models.Setting{}, &models.Identity{}, &models.LoginState{}, &models.Session{}, &models.Catalogue{})
+	if err != nil {
+		return err
+	}
+
+	// Deliveries no longer keep the body of the responses
+	if db.Migrator().HasColumn(&models.WebhookDelivery{}, "response_body") {
+		return db.Migrator().DropColumn(&models.WebhookDelivery{}, "response_body")
+	}
+
+	return nil
 }
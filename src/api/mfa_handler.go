@@ -0,0 +1,378 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"films-api.rdelgado.es/src/internals/i18n"
+	"films-api.rdelgado.es/src/internals/models"
+	"films-api.rdelgado.es/src/internals/totp"
+	"films-api.rdelgado.es/src/internals/validator"
+)
+
+// Issuer of the codes shown by the authenticator apps
+const totpIssuer = "Films API"
+
+// Time the roles that require two-factor authentication are cached
+const mfaPolicyTTL = 30 * time.Second
+
+type mfaLoginRequest struct {
+	MFAToken            string `json:"mfa_token" validate:"required"`
+	Code                string `json:"code" validate:"required" doc:"Code of the authenticator app or a recovery code"`
+	validator.Validator `json:"-"`
+}
+
+type totpCodeRequest struct {
+	Code                string `json:"code" validate:"required"`
+	validator.Validator `json:"-"`
+}
+
+type disableTOTPRequest struct {
+	Password            string `json:"password" validate:"required"`
+	validator.Validator `json:"-"`
+}
+
+type mfaPolicyRequest struct {
+	RequiredRoles       []string `json:"required_roles" validate:"dive,oneof=editor admin"`
+	validator.Validator `json:"-"`
+}
+
+// mfaChallengeResponse is the response of the login of the users with
+// two-factor authentication, instead of the access token
+type mfaChallengeResponse struct {
+	MFARequired bool
+	MFAToken    string `doc:"Token for POST /user/login/mfa, valid for 5 minutes"`
+}
+
+type totpEnrolmentResponse struct {
+	Secret string `doc:"Secret for the authenticator app, in base32"`
+	URI    string `doc:"Provisioning URI of the secret, to show as a QR code"`
+}
+
+type recoveryCodesResponse struct {
+	RecoveryCodes []string `doc:"Codes to log in without the authenticator app, each valid once. They are not shown again."`
+}
+
+type mfaPolicyResponse struct {
+	RequiredRoles []string `doc:"Roles whose users must enable two-factor authentication"`
+}
+
+// mfaPolicy caches the roles that require two-factor authentication, which
+// are checked in every authenticated request
+type mfaPolicy struct {
+	settings *models.SettingsModel
+
+	mu      sync.Mutex
+	roles   []string
+	expires time.Time
+}
+
+func newMFAPolicy(settings *models.SettingsModel) *mfaPolicy {
+	return &mfaPolicy{settings: settings}
+}
+
+func (p *mfaPolicy) Roles() ([]string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if time.Now().Before(p.expires) {
+		return p.roles, nil
+	}
+
+	roles, err := p.settings.MFARequiredRoles()
+	if err != nil {
+		return nil, err
+	}
+
+	p.roles, p.expires = roles, time.Now().Add(mfaPolicyTTL)
+	return roles, nil
+}
+
+func (p *mfaPolicy) SetRoles(roles []string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err := p.settings.SetMFARequiredRoles(roles); err != nil {
+		return err
+	}
+
+	p.roles, p.expires = roles, time.Now().Add(mfaPolicyTTL)
+	return nil
+}
+
+// Requires reports if the users of the role must enable two-factor authentication
+func (p *mfaPolicy) Requires(role string) (bool, error) {
+	roles, err := p.Roles()
+	if err != nil {
+		return false, err
+	}
+
+	return slices.Contains(roles, role), nil
+}
+
+// sendMFAChallenge responds to the login of a user with two-factor
+// authentication with a token to send the code with
+func (app *application) sendMFAChallenge(w http.ResponseWriter, r *http.Request, user models.User) {
+	token, err := app.tokens.CreateMFAToken(int(user.ID), user.TokenVersion)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(mfaChallengeResponse{MFARequired: true, MFAToken: token})
+}
+
+// userLoginMFA exchanges the token of sendMFAChallenge and a code of the
+// second factor for an access token
+func (app *application) userLoginMFA(w http.ResponseWriter, r *http.Request) {
+	var req mfaLoginRequest
+
+	err := app.readJSON(w, r, &req)
+	if err != nil {
+		app.clientError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	req.CheckStruct(req)
+
+	if !req.IsValid() {
+		app.failedValidation(w, r, req.Validator)
+		return
+	}
+
+	claims, err := app.tokens.VerifyMFAToken(req.MFAToken)
+	if err != nil {
+		app.clientError(w, r, http.StatusUnauthorized, models.ErrInvalidToken)
+		return
+	}
+
+	// The password may have changed or the user been disabled since the login
+	id := claims.UserID
+	exists, err := app.users.Exists(id, claims.Version)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	if !exists {
+		app.clientError(w, r, http.StatusUnauthorized, models.ErrInvalidToken)
+		return
+	}
+
+	err = app.users.VerifySecondFactor(id, req.Code, time.Now())
+	if err != nil {
+		app.mfaError(w, r, &req.Validator, err)
+		return
+	}
+
+	app.sendToken(w, r, id)
+}
+
+// startTOTP creates a new secret for the user, which is enabled by confirmTOTP
+func (app *application) startTOTP(w http.ResponseWriter, r *http.Request) {
+	userId := r.Context().Value(userIdContextKey).(int)
+
+	secret, err := app.users.StartTOTP(userId)
+	if err != nil {
+		if errors.Is(err, models.ErrTOTPEnabled) {
+			app.clientError(w, r, http.StatusConflict, err)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	user, err := app.users.Get(userId)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(totpEnrolmentResponse{Secret: secret, URI: totp.URI(secret, totpIssuer, user.Name)})
+}
+
+func (app *application) confirmTOTP(w http.ResponseWriter, r *http.Request) {
+	userId := r.Context().Value(userIdContextKey).(int)
+
+	var req totpCodeRequest
+
+	err := app.readJSON(w, r, &req)
+	if err != nil {
+		app.clientError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	req.CheckStruct(req)
+
+	if !req.IsValid() {
+		app.failedValidation(w, r, req.Validator)
+		return
+	}
+
+	codes, err := app.users.WithContext(r.Context()).ConfirmTOTP(userId, req.Code, time.Now())
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrNoRecord):
+			app.NotFound(w, r)
+		case errors.Is(err, models.ErrTOTPEnabled):
+			app.clientError(w, r, http.StatusConflict, err)
+		default:
+			app.mfaError(w, r, &req.Validator, err)
+		}
+		return
+	}
+
+	app.forgetUser(r, userId)
+
+	app.sendRecoveryCodes(w, codes)
+}
+
+func (app *application) disableTOTP(w http.ResponseWriter, r *http.Request) {
+	userId := r.Context().Value(userIdContextKey).(int)
+
+	var req disableTOTPRequest
+
+	err := app.readJSON(w, r, &req)
+	if err != nil {
+		app.clientError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	req.CheckStruct(req)
+
+	if !req.IsValid() {
+		app.failedValidation(w, r, req.Validator)
+		return
+	}
+
+	user, err := app.users.Get(userId)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	required, err := app.mfa.Requires(user.Role)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	if required {
+		app.clientError(w, r, http.StatusForbidden, models.ErrMFARequired)
+		return
+	}
+
+	err = app.users.WithContext(r.Context()).DisableTOTP(userId, req.Password)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrInvalidCredentials):
+			req.AddFieldMessage("password", i18n.NewMessage("validation.current_password", nil))
+			app.failedValidation(w, r, req.Validator)
+		case errors.Is(err, models.ErrNoRecord):
+			app.NotFound(w, r)
+		default:
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.forgetUser(r, userId)
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (app *application) regenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	userId := r.Context().Value(userIdContextKey).(int)
+
+	var req totpCodeRequest
+
+	err := app.readJSON(w, r, &req)
+	if err != nil {
+		app.clientError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	req.CheckStruct(req)
+
+	if !req.IsValid() {
+		app.failedValidation(w, r, req.Validator)
+		return
+	}
+
+	codes, err := app.users.RegenerateRecoveryCodes(userId, req.Code, time.Now())
+	if err != nil {
+		app.mfaError(w, r, &req.Validator, err)
+		return
+	}
+
+	app.sendRecoveryCodes(w, codes)
+}
+
+func (app *application) sendRecoveryCodes(w http.ResponseWriter, codes []string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(recoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// mfaError responds to the errors of the checks of the codes. Wrong codes are
+// errors of the code field.
+func (app *application) mfaError(w http.ResponseWriter, r *http.Request, v *validator.Validator, err error) {
+	switch {
+	case errors.Is(err, models.ErrInvalidCredentials):
+		v.AddFieldMessage("code", i18n.NewMessage("validation.mfa_code", nil))
+		app.failedValidation(w, r, *v)
+	case errors.Is(err, models.ErrMFALocked):
+		app.clientError(w, r, http.StatusTooManyRequests, err)
+	default:
+		app.serverError(w, r, err)
+	}
+}
+
+func (app *application) getMFAPolicy(w http.ResponseWriter, r *http.Request) {
+	roles, err := app.mfa.Roles()
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(mfaPolicyResponse{RequiredRoles: roles})
+}
+
+// setMFAPolicy changes the roles that require two-factor authentication. The
+// users of the roles without it can only enrol until they enable it.
+func (app *application) setMFAPolicy(w http.ResponseWriter, r *http.Request) {
+	var req mfaPolicyRequest
+
+	err := app.readJSON(w, r, &req)
+	if err != nil {
+		app.clientError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	req.CheckStruct(req)
+
+	if !req.IsValid() {
+		app.failedValidation(w, r, req.Validator)
+		return
+	}
+
+	roles := req.RequiredRoles
+	if roles == nil {
+		roles = []string{}
+	}
+
+	if err := app.mfa.SetRoles(roles); err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.getMFAPolicy(w, r)
+}
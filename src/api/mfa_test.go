@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"films-api.rdelgado.es/pkg/client"
+	"films-api.rdelgado.es/src/internals/models"
+	"films-api.rdelgado.es/src/internals/totp"
+)
+
+// totpCodes returns a function with the code of the secret offset periods
+// from now. It waits for a new period if this one is about to end, so the
+// codes do not change period while the test runs.
+func totpCodes(t *testing.T, secret string) func(offset int64) string {
+	t.Helper()
+
+	if left := totp.Period - time.Duration(time.Now().UnixNano())%totp.Period; left < 5*time.Second {
+		time.Sleep(left)
+	}
+	now := totp.Counter(time.Now())
+
+	return func(offset int64) string {
+		code, err := totp.Code(secret, now+offset)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return code
+	}
+}
+
+// enableTOTP enrols the user of the client with the code of the previous period
+func enableTOTP(t *testing.T, c *client.Client) {
+	t.Helper()
+	ctx := context.Background()
+
+	enrolment, err := c.EnableTOTP(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.ConfirmTOTP(ctx, totpCodes(t, enrolment.Secret)(-1)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTOTP(t *testing.T) {
+	app, server := newTestServer(t)
+	ctx := context.Background()
+
+	c := client.New(server.URL, client.WithCredentials("test1", testPassword))
+
+	enrolment, err := c.EnableTOTP(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(enrolment.URI, "otpauth://totp/") || !strings.Contains(enrolment.URI, "secret="+enrolment.Secret) {
+		t.Errorf("provisioning URI: got %s", enrolment.URI)
+	}
+
+	var apiErr *client.Error
+	if _, err := c.ConfirmTOTP(ctx, "abcdef"); !errors.As(err, &apiErr) || apiErr.Fields["code"] == "" {
+		t.Errorf("confirming a wrong code: got %v", err)
+	}
+
+	codes := totpCodes(t, enrolment.Secret)
+	recovery, err := c.ConfirmTOTP(ctx, codes(-1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recovery) != models.RecoveryCodes {
+		t.Errorf("recovery codes: got %d, want %d", len(recovery), models.RecoveryCodes)
+	}
+
+	if _, err := c.EnableTOTP(ctx); !errors.Is(err, models.ErrDuplicatedEntry) {
+		t.Errorf("enrolling again: got %v, want %v", err, models.ErrDuplicatedEntry)
+	}
+
+	// The password is not enough to log in
+	other := client.New(server.URL)
+	var challenge *client.SecondFactorError
+	if err := other.Login(ctx, "test1", testPassword); !errors.As(err, &challenge) {
+		t.Fatalf("logging in with the password: got %v", err)
+	}
+	if other.Token() != "" {
+		t.Errorf("access token sent before the second factor")
+	}
+	if _, err := client.New(server.URL, client.WithToken(challenge.MFAToken)).Me(ctx); err == nil {
+		t.Errorf("MFA token accepted as an access token")
+	}
+
+	if err := other.LoginMFA(ctx, challenge.MFAToken, codes(0)); err != nil {
+		t.Fatal(err)
+	}
+	profile, err := other.Me(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !profile.MFAEnabled {
+		t.Errorf("profile with two-factor authentication: got %+v", profile)
+	}
+
+	// Codes cannot be used twice
+	if err := other.LoginMFA(ctx, challenge.MFAToken, codes(0)); !errors.As(err, &apiErr) || apiErr.Fields["code"] == "" {
+		t.Errorf("using a code twice: got %v", err)
+	}
+
+	// Recovery codes are accepted in any case, once
+	if err := other.LoginMFA(ctx, challenge.MFAToken, strings.ToUpper(recovery[0])); err != nil {
+		t.Errorf("logging in with a recovery code: %v", err)
+	}
+	if err := other.LoginMFA(ctx, challenge.MFAToken, recovery[0]); !errors.As(err, &apiErr) || apiErr.Fields["code"] == "" {
+		t.Errorf("using a recovery code twice: got %v", err)
+	}
+
+	// Only the hashes of the codes are stored
+	var stored int64
+	app.users.DB.Model(&models.RecoveryCode{}).Where("hash = ?", recovery[1]).Count(&stored)
+	if stored != 0 {
+		t.Errorf("recovery code stored in clear")
+	}
+
+	renewed, err := c.RegenerateRecoveryCodes(ctx, recovery[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := other.LoginMFA(ctx, challenge.MFAToken, recovery[2]); !errors.As(err, &apiErr) || apiErr.Fields["code"] == "" {
+		t.Errorf("using a replaced recovery code: got %v", err)
+	}
+
+	// Wrong codes lock the second factor, even for the right ones
+	for i := 1; i < models.MaxMFAFailures; i++ {
+		other.LoginMFA(ctx, challenge.MFAToken, "abcdef")
+	}
+	if err := other.LoginMFA(ctx, challenge.MFAToken, renewed[0]); !errors.Is(err, models.ErrMFALocked) {
+		t.Errorf("logging in after %d wrong codes: got %v, want %v", models.MaxMFAFailures, err, models.ErrMFALocked)
+	}
+
+	if err := c.DisableTOTP(ctx, "Wrong.1234"); !errors.As(err, &apiErr) || apiErr.Fields["password"] == "" {
+		t.Errorf("disabling with a wrong password: got %v", err)
+	}
+	if err := c.DisableTOTP(ctx, testPassword); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.New(server.URL).Login(ctx, "test1", testPassword); err != nil {
+		t.Errorf("logging in after disabling the second factor: %v", err)
+	}
+}
+
+func TestMFAPolicy(t *testing.T) {
+	app, server := newTestServer(t)
+	ctx := context.Background()
+
+	if err := app.users.SetRole("test3", models.RoleAdmin); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.users.SetRole("test2", models.RoleEditor); err != nil {
+		t.Fatal(err)
+	}
+
+	admin := client.New(server.URL, client.WithCredentials("test3", testPassword))
+	editor := client.New(server.URL, client.WithCredentials("test2", testPassword))
+	user := client.New(server.URL, client.WithCredentials("test1", testPassword))
+
+	if _, err := user.SetMFARequiredRoles(ctx, []string{models.RoleEditor}); !errors.Is(err, models.ErrNotAuthorized) {
+		t.Errorf("changing the policy as a user: got %v, want %v", err, models.ErrNotAuthorized)
+	}
+
+	var apiErr *client.Error
+	if _, err := admin.SetMFARequiredRoles(ctx, []string{models.RoleUser}); !errors.As(err, &apiErr) || len(apiErr.Fields) == 0 {
+		t.Errorf("requiring two-factor authentication for every user: got %v", err)
+	}
+
+	roles, err := admin.SetMFARequiredRoles(ctx, []string{models.RoleEditor})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(roles) != 1 || roles[0] != models.RoleEditor {
+		t.Errorf("required roles: got %v", roles)
+	}
+
+	// Editors can only see their profile and enrol until they enable it
+	if _, err := editor.Movies(ctx, client.MovieFilter{}); !errors.Is(err, models.ErrNotAuthorized) {
+		t.Errorf("listing movies without two-factor authentication: got %v, want %v", err, models.ErrNotAuthorized)
+	}
+	if _, err := editor.Me(ctx); err != nil {
+		t.Errorf("getting the profile without two-factor authentication: %v", err)
+	}
+	if _, err := user.Movies(ctx, client.MovieFilter{}); err != nil {
+		t.Errorf("listing movies as a user: %v", err)
+	}
+
+	enableTOTP(t, editor)
+
+	if _, err := editor.Movies(ctx, client.MovieFilter{}); err != nil {
+		t.Errorf("listing movies with two-factor authentication: %v", err)
+	}
+	if err := editor.DisableTOTP(ctx, testPassword); !errors.Is(err, models.ErrNotAuthorized) {
+		t.Errorf("disabling a required second factor: got %v, want %v", err, models.ErrNotAuthorized)
+	}
+
+	// Users who lost their device are reset with the CLI
+	if err := app.users.ResetTOTP("test2"); err != nil {
+		t.Fatal(err)
+	}
+	var codes int64
+	app.users.DB.Model(&models.RecoveryCode{}).Count(&codes)
+	if codes != 0 {
+		t.Errorf("recovery codes after a reset: got %d", codes)
+	}
+	if profile, err := editor.Me(ctx); err != nil || profile.MFAEnabled {
+		t.Errorf("profile after a reset: got %+v (%v)", profile, err)
+	}
+}
@@ -2,11 +2,17 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
+	"slices"
 	"time"
 
+	"films-api.rdelgado.es/src/internals/audit"
+	"films-api.rdelgado.es/src/internals/compress"
 	"films-api.rdelgado.es/src/internals/models"
 )
 
@@ -37,28 +43,48 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 			return
 		}
 
-		id, err := app.tokens.VerifyToken(tokenString)
+		claims, err := app.tokens.VerifyToken(tokenString)
 		if err != nil {
 
 			if errors.Is(err, models.ErrInvalidToken) {
-				app.clientError(w, http.StatusBadRequest, err)
+				app.clientError(w, r, http.StatusBadRequest, err)
 			} else {
-				app.clientError(w, http.StatusUnauthorized, err)
+				app.clientError(w, r, http.StatusUnauthorized, err)
 			}
 
 			return
 		}
-		// Otherwise, we check to see if a user with that ID exists in our database.
-		exists, err := app.users.Exists(id)
+		// Otherwise, we check to see if a user with that ID exists in our database
+		// and has not revoked the token.
+		id := claims.UserID
+		status, err := app.userCache.Status(r.Context(), id)
 		if err != nil {
 			app.serverError(w, r, err)
 			return
 		}
+		exists := status.Accepts(claims.Version)
+
+		// The device must not have been logged out. Tokens issued before the
+		// sessions have none, they are valid until they expire.
+		if exists && claims.Session != "" {
+			exists, err = app.activeSessions.Active(claims.Session, id)
+			if err != nil {
+				app.serverError(w, r, err)
+				return
+			}
+		}
 
 		// Save user_id to context
 		if exists {
 			ctx := context.WithValue(r.Context(), isAuthenticatedContextKey, true)
 			ctx = context.WithValue(ctx, userIdContextKey, id)
+			ctx = context.WithValue(ctx, sessionContextKey, claims.Session)
+
+			// The changes of the request are made by the user
+			actor, _ := audit.FromContext(ctx)
+			actor.UserID = id
+			ctx = audit.NewContext(ctx, actor)
+
 			r = r.WithContext(ctx)
 		}
 
@@ -66,14 +92,127 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 	})
 }
 
+// requireAuthentication is requireLogin for the routes that the users whose
+// role requires two-factor authentication cannot use until they enable it
 func (app *application) requireAuthentication(next http.HandlerFunc) http.Handler {
+	return app.requireLogin(func(w http.ResponseWriter, r *http.Request) {
+		roles, err := app.mfa.Roles()
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		if len(roles) > 0 {
+			userId := r.Context().Value(userIdContextKey).(int)
+
+			status, err := app.userCache.Status(r.Context(), userId)
+			if err != nil {
+				app.serverError(w, r, err)
+				return
+			}
+
+			if !status.MFAEnabled && slices.Contains(roles, status.Role) {
+				app.clientError(w, r, http.StatusForbidden, models.ErrMFARequired)
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requireLogin responds 401 to the requests without a valid access token
+func (app *application) requireLogin(next http.HandlerFunc) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if !app.isAuthenticated(r) {
-			app.clientError(w, http.StatusUnauthorized, errors.New("not authenticated"))
+			app.clientError(w, r, http.StatusUnauthorized, errors.New("not authenticated"))
+			return
+		}
+
+		// Unless the route allows revalidating them
+		if w.Header().Get("Cache-Control") == "" {
+			w.Header().Set("Cache-Control", "no-store")
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requireAdmin is requireAuthentication for the users with the admin role
+func (app *application) requireAdmin(next http.HandlerFunc) http.Handler {
+	return app.requireAuthentication(func(w http.ResponseWriter, r *http.Request) {
+		userId := r.Context().Value(userIdContextKey).(int)
+
+		status, err := app.userCache.Status(r.Context(), userId)
+		if err != nil {
+			app.serverError(w, r, err)
 			return
 		}
 
-		w.Header().Add("Cache-Control", "no-store")
+		if status.Role != models.RoleAdmin {
+			app.clientError(w, r, http.StatusForbidden, models.ErrNotAuthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requestID identifies each request with the X-Request-ID header of the
+// client, or a random one. It is sent back in the response, added to the
+// logs and recorded in the audit log with the IP of the client.
+func (app *application) requestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+
+		ip, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			ip = r.RemoteAddr
+		}
+
+		ctx := context.WithValue(r.Context(), requestIdContextKey, id)
+		ctx = audit.NewContext(ctx, audit.Actor{RequestID: id, IP: ip})
+
+		w.Header().Set("X-Request-ID", id)
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// validRequestID accepts the IDs of up to 64 letters, digits, dots, dashes
+// and underscores, so they are safe to log
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 64 {
+		return false
+	}
+
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '.' || c == '-' || c == '_') {
+			return false
+		}
+	}
+
+	return true
+}
+
+func newRequestID() string {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		panic(err)
+	}
+
+	return hex.EncodeToString(id)
+}
+
+// maxBodySize limits the size of the request body. Reading past the limit
+// fails with *http.MaxBytesError, which is sent as 413 Request Entity Too Large.
+func (app *application) maxBodySize(limit int64, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, limit)
+		r = r.WithContext(context.WithValue(r.Context(), maxBodySizeContextKey, limit))
 
 		next.ServeHTTP(w, r)
 	})
@@ -92,6 +231,25 @@ func (app *application) recoverPanic(next http.Handler) http.Handler {
 	})
 }
 
+// Default size of the smallest response compressed. Smaller ones barely
+// shrink, and take the time of the encoder all the same.
+const compressMinSize = 1024
+
+// Encodings offered to the clients, in order of preference on ties. Zstandard
+// compresses about as well as Brotli in less time, and gzip is understood by
+// every client.
+var compressEncodings = []compress.Encoding{compress.Zstd, compress.Brotli, compress.Gzip}
+
+// compress compresses the responses with the encodings accepted by the client.
+// It goes inside logResponse, so the logged sizes are the compressed ones.
+func (app *application) compress(next http.Handler) http.Handler {
+	if app.compressor == nil {
+		return next
+	}
+
+	return app.compressor.Handler(next)
+}
+
 func (app *application) logRequest(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		var (
@@ -106,7 +264,8 @@ func (app *application) logRequest(next http.Handler) http.Handler {
 			"addr", ip,
 			"proto", proto,
 			"method", method,
-			"uri", uri)
+			"uri", uri,
+			"requestId", r.Context().Value(requestIdContextKey))
 
 		// Serve HTTP request to rest of middleware and handlers
 		next.ServeHTTP(w, r)
@@ -145,7 +304,8 @@ func (app *application) logResponse(next http.Handler) http.Handler {
 			"size", logResponseWriter.responseData.size,
 			"status", logResponseWriter.responseData.status,
 			"duration", duration.String(),
-			"userId", userId)
+			"userId", userId,
+			"requestId", r.Context().Value(requestIdContextKey))
 	})
 }
 
@@ -159,3 +319,15 @@ func (r *loggingResponseWriter) WriteHeader(statusCode int) {
 	r.ResponseWriter.WriteHeader(statusCode) // write status code using original http.ResponseWriter
 	r.responseData.status = statusCode       // capture status code
 }
+
+// Flush sends the buffered data to the client, for streaming responses
+func (r *loggingResponseWriter) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap returns the original http.ResponseWriter, for http.ResponseController
+func (r *loggingResponseWriter) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
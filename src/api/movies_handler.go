@@ -1,24 +1,42 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"net/http"
 	"strconv"
 	"time"
 
+	"films-api.rdelgado.es/src/internals/i18n"
 	"films-api.rdelgado.es/src/internals/models"
 	"films-api.rdelgado.es/src/internals/validator"
 	"github.com/julienschmidt/httprouter"
 )
 
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
 type movieRequest struct {
-	Title               string
-	Director            string
-	ReleaseDate         string
-	Cast                []string `json:"stringArray"`
-	Genre               string
-	Synopsis            string
+	Title               string   `validate:"required,max=200"`
+	Director            string   `validate:"required,max=100"`
+	ReleaseDate         string   `validate:"required,date=2006-01-02"`
+	Cast                []string `json:"stringArray" field:"cast" validate:"required,dive,required,max=100"`
+	Genre               string   `validate:"required,max=50"`
+	Synopsis            string   `validate:"required,max=2000"`
+	validator.Validator `json:"-"`
+}
+
+// movieUpdateRequest has the fields of movieRequest, all of them optional
+type movieUpdateRequest struct {
+	Title               string   `validate:"omitempty,max=200"`
+	Director            string   `validate:"omitempty,max=100"`
+	ReleaseDate         string   `validate:"omitempty,date=2006-01-02"`
+	Cast                []string `json:"stringArray" field:"cast" validate:"omitempty,dive,required,max=100"`
+	Genre               string   `validate:"omitempty,max=50"`
+	Synopsis            string   `validate:"omitempty,max=2000"`
 	validator.Validator `json:"-"`
 }
 
@@ -27,16 +45,23 @@ func (app *application) updateMovie(w http.ResponseWriter, r *http.Request) {
 	// Get ID of movie to update
 	params := httprouter.ParamsFromContext(r.Context())
 	id, err := strconv.Atoi(params.ByName("id"))
-	if err != nil && id < 1 {
-		app.NotFound(w)
+	if err != nil || id < 1 {
+		app.NotFound(w, r)
 		return
 	}
 
 	// Parse request fields to be updated
-	var req movieRequest
-	err = json.NewDecoder(r.Body).Decode(&req)
+	var req movieUpdateRequest
+	err = app.readJSON(w, r, &req)
 	if err != nil {
-		app.clientError(w, http.StatusBadRequest, err)
+		app.clientError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	req.CheckStruct(req)
+
+	if !req.IsValid() {
+		app.failedValidation(w, r, req.Validator)
 		return
 	}
 
@@ -44,7 +69,7 @@ func (app *application) updateMovie(w http.ResponseWriter, r *http.Request) {
 	movieToUpdate, err := app.movies.Get(id)
 	if err != nil {
 		if errors.Is(err, models.ErrNoRecord) {
-			app.NotFound(w)
+			app.NotFound(w, r)
 		} else {
 			app.serverError(w, r, err)
 		}
@@ -54,10 +79,8 @@ func (app *application) updateMovie(w http.ResponseWriter, r *http.Request) {
 	// Check that the user is the creator of this film
 	userId := r.Context().Value(userIdContextKey).(int)
 
-	app.logger.Info("userid", "id", userId)
-
 	if movieToUpdate.UserID != uint(userId) {
-		app.clientError(w, http.StatusForbidden, nil)
+		app.clientError(w, r, http.StatusForbidden, nil)
 		return
 	}
 
@@ -71,12 +94,7 @@ func (app *application) updateMovie(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if validator.NoBlank(req.ReleaseDate) {
-		parseDate, err := time.Parse("2006-01-02", req.ReleaseDate)
-		if err != nil {
-			app.clientError(w, http.StatusBadRequest, err)
-			return
-		}
-		movieToUpdate.ReleaseDate = parseDate
+		movieToUpdate.ReleaseDate, _ = time.Parse("2006-01-02", req.ReleaseDate)
 	}
 
 	if validator.NoEmptyTextSlice(req.Cast) {
@@ -92,9 +110,13 @@ func (app *application) updateMovie(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get movie to be updated
-	err = app.movies.Update(movieToUpdate)
+	err = app.movies.WithContext(r.Context()).Update(movieToUpdate)
 	if err != nil {
-		app.serverError(w, r, err)
+		if errors.Is(err, models.ErrDuplicatedEntry) {
+			app.clientError(w, r, http.StatusConflict, err)
+		} else {
+			app.serverError(w, r, err)
+		}
 		return
 	}
 
@@ -105,29 +127,134 @@ func (app *application) updateMovie(w http.ResponseWriter, r *http.Request) {
 func (app *application) getAllMovies(w http.ResponseWriter, r *http.Request) {
 
 	// Get query params for optional filtering movies
-	filters := make(map[string]interface{})
-	if title := r.URL.Query().Get("title"); title != "" {
-		filters["title"] = title
+	filters, err := movieFilters(r)
+	if err != nil {
+		app.clientError(w, r, http.StatusBadRequest, err)
+		return
 	}
-	if genre := r.URL.Query().Get("genre"); genre != "" {
-		filters["genre"] = genre
+
+	// Movies are paginated only if the client asks for a page
+	query := r.URL.Query()
+	page, pageSize := 0, defaultPageSize
+	if query.Has("page") || query.Has("page_size") {
+		page = 1
+
+		if value := query.Get("page"); value != "" {
+			page, err = strconv.Atoi(value)
+			if err != nil || page < 1 {
+				app.clientError(w, r, http.StatusBadRequest, err)
+				return
+			}
+		}
+		if value := query.Get("page_size"); value != "" {
+			pageSize, err = strconv.Atoi(value)
+			if err != nil || pageSize < 1 || pageSize > maxPageSize {
+				app.clientError(w, r, http.StatusBadRequest, err)
+				return
+			}
+		}
 	}
-	if year := r.URL.Query().Get("year"); year != "" {
 
-		yearNumber, err := strconv.Atoi(year) // Check if year is a valid int (2019, 2022, etc)
-		if err != nil && yearNumber < 1 {
-			app.clientError(w, http.StatusBadRequest, err)
+	// The list is the same for every user until a movie changes, so the
+	// version of the catalogue and the query identify it
+	catalogue, err := app.catalogue.Get()
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	etag := weakETag(catalogue.Version, query.Encode())
+	if notModified(w, r, etag, catalogue.UpdatedAt) {
+		return
+	}
+
+	if app.movieResponses != nil {
+		if response, found := app.movieResponses.Get(etag); found {
+			response.write(w)
 			return
 		}
+	}
 
-		filters["year"] = yearNumber
+	// The version is read first: a change in between makes a newer list
+	// kept with the older version, which is never served after the change
+	response, err := app.listMovies(r, filters, page, pageSize)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+
+		return
 	}
 
-	// Query movies from database (using filters if any)
-	movies, err := app.movies.GetAll(filters)
+	if app.movieResponses != nil {
+		app.movieResponses.Set(etag, response)
+	}
+
+	response.write(w)
+}
+
+// listMovies makes the response of GET /movies: every movie matching the
+// filters, or a page of them if page is not 0
+func (app *application) listMovies(r *http.Request, filters map[string]interface{}, page, pageSize int) (cachedResponse, error) {
+	response := cachedResponse{header: http.Header{}}
+
+	var movies []models.Movie
+	var err error
+
+	if page == 0 {
+		// Query movies from database (using filters if any)
+		movies, err = app.movies.GetAll(filters)
+		if err != nil {
+			return cachedResponse{}, err
+		}
+	} else {
+		var total int64
+		movies, total, err = app.movies.GetPage(filters, (page-1)*pageSize, pageSize)
+		if err != nil {
+			return cachedResponse{}, err
+		}
+
+		// Pagination details are sent in headers so the body is the same list of movies
+		response.header.Set("X-Total-Count", strconv.FormatInt(total, 10))
+		if int64(page*pageSize) < total {
+			next := *r.URL
+			query := next.Query()
+			query.Set("page", strconv.Itoa(page+1))
+			query.Set("page_size", strconv.Itoa(pageSize))
+			next.RawQuery = query.Encode()
+			response.header.Set("Link", "<"+next.RequestURI()+`>; rel="next"`)
+		}
+	}
+
+	var body bytes.Buffer
+	if err := json.NewEncoder(&body).Encode(movies); err != nil {
+		return cachedResponse{}, err
+	}
+	response.body = body.Bytes()
+
+	return response, nil
+}
+
+func (app *application) deleteMovie(w http.ResponseWriter, r *http.Request) {
+
+	userId := r.Context().Value(userIdContextKey).(int)
+
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil || id < 1 {
+		app.NotFound(w, r)
+		return
+	}
+
+	err = app.movies.WithContext(r.Context()).Delete(id, userId)
 	if err != nil {
 		if errors.Is(err, models.ErrNoRecord) {
-			app.NotFound(w)
+			app.NotFound(w, r)
+		} else if errors.Is(err, models.ErrNotAuthorized) {
+			app.clientError(w, r, http.StatusForbidden, err)
 		} else {
 			app.serverError(w, r, err)
 		}
@@ -137,27 +264,40 @@ func (app *application) getAllMovies(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(movies)
 }
 
-func (app *application) deleteMovie(w http.ResponseWriter, r *http.Request) {
+// getTrash lists the deleted movies of the user, which can still be restored
+func (app *application) getTrash(w http.ResponseWriter, r *http.Request) {
+	userId := r.Context().Value(userIdContextKey).(int)
+
+	trash, err := app.movies.GetTrash(userId)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(trash)
+}
 
+func (app *application) restoreMovie(w http.ResponseWriter, r *http.Request) {
 	userId := r.Context().Value(userIdContextKey).(int)
 
 	params := httprouter.ParamsFromContext(r.Context())
 
 	id, err := strconv.Atoi(params.ByName("id"))
-	if err != nil && id < 1 {
-		app.NotFound(w)
+	if err != nil || id < 1 {
+		app.NotFound(w, r)
 		return
 	}
 
-	err = app.movies.Delete(id, userId)
+	movie, err := app.movies.WithContext(r.Context()).Restore(id, userId)
 	if err != nil {
 		if errors.Is(err, models.ErrNoRecord) {
-			app.NotFound(w)
+			app.NotFound(w, r)
 		} else if errors.Is(err, models.ErrNotAuthorized) {
-			app.clientError(w, http.StatusForbidden, err)
+			app.clientError(w, r, http.StatusForbidden, err)
 		} else {
 			app.serverError(w, r, err)
 		}
@@ -167,6 +307,7 @@ func (app *application) deleteMovie(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(movie)
 }
 
 func (app *application) getMovie(w http.ResponseWriter, r *http.Request) {
@@ -174,15 +315,15 @@ func (app *application) getMovie(w http.ResponseWriter, r *http.Request) {
 	params := httprouter.ParamsFromContext(r.Context())
 
 	id, err := strconv.Atoi(params.ByName("id"))
-	if err != nil && id < 1 {
-		app.NotFound(w)
+	if err != nil || id < 1 {
+		app.NotFound(w, r)
 		return
 	}
 
 	movie, err := app.movies.GetMovieAndAuthor(id)
 	if err != nil {
 		if errors.Is(err, models.ErrNoRecord) {
-			app.NotFound(w)
+			app.NotFound(w, r)
 		} else {
 			app.serverError(w, r, err)
 		}
@@ -190,6 +331,12 @@ func (app *application) getMovie(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The name of the author is part of the response too
+	etag := weakETag(movie.ID, movie.UpdatedAt.UnixNano(), movie.CreatedBy.UserId, movie.CreatedBy.Name)
+	if notModified(w, r, etag, movie.UpdatedAt) {
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 
@@ -200,38 +347,26 @@ func (app *application) addMovie(w http.ResponseWriter, r *http.Request) {
 
 	var req movieRequest
 
-	err := json.NewDecoder(r.Body).Decode(&req)
+	err := app.readJSON(w, r, &req)
 	if err != nil {
-		app.clientError(w, http.StatusBadRequest, err)
+		app.clientError(w, r, http.StatusBadRequest, err)
 		return
 	}
 
-	// Check and parse release date
-	parsedReleaseDate, err := time.Parse("2006-01-02", req.ReleaseDate)
-	if err != nil {
-		app.clientError(w, http.StatusBadRequest, err)
-		return
-	}
-
-	req.CheckField(validator.NoBlank(req.Title), "title", "This field must no be blank")
-	req.CheckField(validator.NoBlank(req.Director), "director", "This field must no be blank")
-	req.CheckField(validator.NoBlank(req.Genre), "genre", "This field must no be blank")
-	req.CheckField(validator.NoBlank(req.Synopsis), "synopsis", "This field must no be blank")
-	req.CheckField(validator.NoEmptyTextSlice(req.Cast), "cast", "This field must not be empty")
+	parsedReleaseDate := req.validate()
 
 	if !req.IsValid() {
-		w.WriteHeader(http.StatusUnprocessableEntity)
-		json.NewEncoder(w).Encode(req.FieldErrors)
+		app.failedValidation(w, r, req.Validator)
 		return
 	}
 
 	// Get user_id for insertion
 	userId := r.Context().Value(userIdContextKey).(int)
 
-	id, err := app.movies.Insert(req.Title, req.Director, req.Genre, req.Synopsis, parsedReleaseDate, req.Cast, userId)
+	id, err := app.movies.WithContext(r.Context()).Insert(req.Title, req.Director, req.Genre, req.Synopsis, parsedReleaseDate, req.Cast, userId)
 	if err != nil {
 		if errors.Is(err, models.ErrDuplicatedEntry) {
-			app.clientError(w, http.StatusConflict, err)
+			app.clientError(w, r, http.StatusConflict, err)
 		} else {
 			app.serverError(w, r, err)
 		}
@@ -243,3 +378,109 @@ func (app *application) addMovie(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(id)
 }
+
+func (app *application) importMovies(w http.ResponseWriter, r *http.Request) {
+
+	// Format is taken from the query or guessed from the Content-Type header
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = formatFromContentType(r.Header.Get("Content-Type"))
+	}
+
+	opts := importOptions{
+		dryRun:      r.URL.Query().Get("dry_run") == "true",
+		onDuplicate: r.URL.Query().Get("on_duplicate"),
+		locale:      app.locale(r),
+	}
+	if opts.onDuplicate == "" {
+		opts.onDuplicate = onDuplicateSkip
+	}
+
+	var v validator.Validator
+	v.CheckFieldMessage(validator.PermittedValue(format, formatCSV, formatNDJSON), "format",
+		i18n.NewMessage("validation.oneof", i18n.Params{"values": formatCSV + ", " + formatNDJSON}))
+	v.CheckFieldMessage(validator.PermittedValue(opts.onDuplicate, onDuplicateSkip, onDuplicateUpsert), "on_duplicate",
+		i18n.NewMessage("validation.oneof", i18n.Params{"values": onDuplicateSkip + ", " + onDuplicateUpsert}))
+
+	if !v.IsValid() {
+		app.failedValidation(w, r, v)
+		return
+	}
+
+	userId := r.Context().Value(userIdContextKey).(int)
+
+	report, err := app.runMovieImport(r.Context(), r.Body, format, opts, userId)
+	if err != nil {
+		app.clientError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(report)
+}
+
+func (app *application) exportMovies(w http.ResponseWriter, r *http.Request) {
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = formatJSON
+	}
+
+	if !validator.PermittedValue(format, formatCSV, formatNDJSON, formatJSON) {
+		app.clientError(w, r, http.StatusBadRequest, nil)
+		return
+	}
+
+	filters, err := movieFilters(r)
+	if err != nil {
+		app.clientError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentTypes[format])
+	w.Header().Set("Content-Disposition", `attachment; filename="movies.`+format+`"`)
+	w.WriteHeader(http.StatusOK)
+
+	// Headers are already sent, so errors while streaming can only be logged
+	err = app.writeMovieExport(w, format, filters)
+	if err != nil {
+		app.logger.Error(err.Error(), "method", r.Method, "uri", r.URL.RequestURI())
+	}
+}
+
+// movieFilters reads the optional title, genre and year filters from the query
+func movieFilters(r *http.Request) (map[string]interface{}, error) {
+	filters := make(map[string]interface{})
+	if title := r.URL.Query().Get("title"); title != "" {
+		filters["title"] = title
+	}
+	if genre := r.URL.Query().Get("genre"); genre != "" {
+		filters["genre"] = genre
+	}
+	if year := r.URL.Query().Get("year"); year != "" {
+
+		yearNumber, err := strconv.Atoi(year) // Check if year is a valid int (2019, 2022, etc)
+		if err != nil {
+			return nil, err
+		}
+		if yearNumber < 1 {
+			return nil, errors.New("year must be a positive number")
+		}
+
+		filters["year"] = yearNumber
+	}
+
+	return filters, nil
+}
+
+// validate checks the fields required to create a movie and returns the parsed
+// release date. Errors are saved in the request validator.
+func (req *movieRequest) validate() time.Time {
+	req.CheckStruct(req)
+
+	// The date format is checked by the validate tag
+	parsedReleaseDate, _ := time.Parse("2006-01-02", req.ReleaseDate)
+
+	return parsedReleaseDate
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestInvalidMovieID(t *testing.T) {
+	_, server := newTestServer(t)
+	token := loginFrom(t, server.URL, "test1", "test")
+
+	tests := []struct {
+		method string
+		path   string
+	}{
+		{http.MethodGet, "/movie/0"},
+		{http.MethodGet, "/movie/-1"},
+		{http.MethodGet, "/movie/abc"},
+		{http.MethodGet, "/movie/1abc"},
+		{http.MethodPut, "/movie/0"},
+		{http.MethodPut, "/movie/abc"},
+		{http.MethodDelete, "/movie/-1"},
+		{http.MethodDelete, "/movie/abc"},
+		{http.MethodDelete, "/favourites/0"},
+		{http.MethodDelete, "/favourites/abc"},
+	}
+
+	for _, tt := range tests {
+		req, _ := http.NewRequest(tt.method, server.URL+tt.path, strings.NewReader(`{"title":"Heat"}`))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+
+		if res.StatusCode != http.StatusNotFound {
+			t.Errorf("%s %s: got %d, want %d", tt.method, tt.path, res.StatusCode, http.StatusNotFound)
+		}
+	}
+}
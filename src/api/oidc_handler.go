@@ -0,0 +1,206 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"films-api.rdelgado.es/src/internals/models"
+	"films-api.rdelgado.es/src/internals/oidc"
+	"github.com/julienschmidt/httprouter"
+)
+
+// Time the users have to log in with the identity provider
+const oidcLoginTTL = 10 * time.Minute
+
+// errExternalLogin is returned when the identity provider did not log the user in
+var errExternalLogin = errors.New("the identity provider did not log in the user")
+
+// identityLinkResponse has the URL where the user logs in to link their identity
+type identityLinkResponse struct {
+	AuthorizationURL string `doc:"URL of the identity provider to open in the browser"`
+}
+
+// oidcLogin redirects the browser to the identity provider
+func (app *application) oidcLogin(w http.ResponseWriter, r *http.Request) {
+	if app.oidc == nil {
+		app.NotFound(w, r)
+		return
+	}
+
+	authURL, err := app.startOIDCLogin(r, nil)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// linkIdentity returns the URL where the user logs in with the identity
+// provider to link their identity to the account
+func (app *application) linkIdentity(w http.ResponseWriter, r *http.Request) {
+	userId := r.Context().Value(userIdContextKey).(int)
+
+	if app.oidc == nil {
+		app.NotFound(w, r)
+		return
+	}
+
+	id := uint(userId)
+	authURL, err := app.startOIDCLogin(r, &id)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(identityLinkResponse{AuthorizationURL: authURL})
+}
+
+// startOIDCLogin saves the state of a login and returns the URL of the
+// provider. The state and nonce are random, and the PKCE verifier never
+// leaves the API.
+func (app *application) startOIDCLogin(r *http.Request, userId *uint) (string, error) {
+	var secrets [3]string
+	for i := range secrets {
+		secret, err := oidc.NewVerifier()
+		if err != nil {
+			return "", err
+		}
+		secrets[i] = secret
+	}
+	state, nonce, verifier := secrets[0], secrets[1], secrets[2]
+
+	if err := app.identities.StartLogin(state, nonce, verifier, userId, oidcLoginTTL); err != nil {
+		return "", err
+	}
+
+	return app.oidc.AuthCodeURL(r.Context(), state, nonce, verifier)
+}
+
+// oidcCallback is where the provider redirects the browser back. Logins get
+// an access token, as in userLogin; links get the linked identity.
+func (app *application) oidcCallback(w http.ResponseWriter, r *http.Request) {
+	if app.oidc == nil {
+		app.NotFound(w, r)
+		return
+	}
+
+	query := r.URL.Query()
+
+	login, err := app.identities.UseLogin(query.Get("state"), time.Now())
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidOneTimeToken) {
+			app.clientError(w, r, http.StatusBadRequest, err)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	// The user cancelled or the provider refused the login
+	if query.Get("error") != "" || query.Get("code") == "" {
+		app.logger.Warn("login with the identity provider failed", "error", query.Get("error"), "description", query.Get("error_description"))
+		app.clientError(w, r, http.StatusUnauthorized, errExternalLogin)
+		return
+	}
+
+	claims, err := app.oidc.Exchange(r.Context(), query.Get("code"), login.Verifier, login.Nonce)
+	if err != nil {
+		app.logger.Warn("login with the identity provider failed", "error", err.Error())
+		app.clientError(w, r, http.StatusUnauthorized, errExternalLogin)
+		return
+	}
+
+	external := models.ExternalIdentity{
+		Issuer:        claims.Issuer,
+		Subject:       claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: claims.EmailVerified,
+		Names:         []string{claims.PreferredUsername, claims.Email, claims.Name},
+	}
+
+	if login.UserID != nil {
+		identity, err := app.identities.Link(*login.UserID, external)
+		if err != nil {
+			if errors.Is(err, models.ErrDuplicatedEntry) {
+				app.clientError(w, r, http.StatusConflict, err)
+			} else {
+				app.serverError(w, r, err)
+			}
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(identity)
+		return
+	}
+
+	user, err := app.identities.Login(external, app.oidcProvision)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.clientError(w, r, http.StatusUnauthorized, errExternalLogin)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	if user.Disabled {
+		app.clientError(w, r, http.StatusUnauthorized, models.ErrInvalidCredentials)
+		return
+	}
+
+	// The second factor of the API is asked for as well
+	if user.TOTPEnabledAt != nil {
+		app.sendMFAChallenge(w, r, user)
+		return
+	}
+
+	app.sendToken(w, r, int(user.ID))
+}
+
+func (app *application) getIdentities(w http.ResponseWriter, r *http.Request) {
+	userId := r.Context().Value(userIdContextKey).(int)
+
+	identities, err := app.identities.GetAll(userId)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(identities)
+}
+
+func (app *application) unlinkIdentity(w http.ResponseWriter, r *http.Request) {
+	userId := r.Context().Value(userIdContextKey).(int)
+
+	params := httprouter.ParamsFromContext(r.Context())
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil || id < 1 {
+		app.NotFound(w, r)
+		return
+	}
+
+	err = app.identities.Delete(id, userId)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrNoRecord):
+			app.NotFound(w, r)
+		case errors.Is(err, models.ErrLastIdentity):
+			app.clientError(w, r, http.StatusConflict, err)
+		default:
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"films-api.rdelgado.es/pkg/client"
+	"films-api.rdelgado.es/src/internals/models"
+	"films-api.rdelgado.es/src/internals/oidc"
+	"films-api.rdelgado.es/src/internals/oidc/oidctest"
+)
+
+// newTestProvider starts an identity provider and configures the API to use it
+func newTestProvider(t *testing.T, app *application, server *httptest.Server) *oidctest.Provider {
+	t.Helper()
+
+	idp := oidctest.NewProvider("films-api", "secret")
+	t.Cleanup(idp.Close)
+
+	app.oidc = oidc.New(oidc.Config{
+		Issuer:       idp.Issuer(),
+		ClientID:     "films-api",
+		ClientSecret: "secret",
+		RedirectURL:  server.URL + "/user/oidc/callback",
+	})
+
+	return idp
+}
+
+// followOIDC goes through the identity provider as a browser would, and
+// returns the URL of the callback with the code and state
+func followOIDC(t *testing.T, authURL string) *url.URL {
+	t.Helper()
+
+	noRedirect := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+
+	for i := 0; i < 3; i++ {
+		res, err := noRedirect.Get(authURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+
+		if res.StatusCode != http.StatusFound {
+			t.Fatalf("following %s: got status %d", authURL, res.StatusCode)
+		}
+
+		location, err := url.Parse(res.Header.Get("Location"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if location.Path == "/user/oidc/callback" {
+			return location
+		}
+		authURL = location.String()
+	}
+
+	t.Fatalf("no redirection to the callback")
+	return nil
+}
+
+// loginOIDC logs the client in with the identity provider
+func loginOIDC(t *testing.T, server *httptest.Server, c *client.Client) (*url.URL, error) {
+	t.Helper()
+
+	callback := followOIDC(t, server.URL+"/user/oidc/login")
+	return callback, c.LoginOIDC(context.Background(), callback.Query().Get("code"), callback.Query().Get("state"))
+}
+
+func TestOIDCLogin(t *testing.T) {
+	app, server := newTestServer(t)
+	ctx := context.Background()
+
+	if res, err := http.Get(server.URL + "/user/oidc/login"); err != nil || res.StatusCode != http.StatusNotFound {
+		t.Errorf("logging in without a provider: got %v (%v)", res.StatusCode, err)
+	}
+
+	idp := newTestProvider(t, app, server)
+
+	// Users are provisioned with a free name and the verified address
+	idp.Login(oidctest.User{Subject: "1", Email: "test1@example.com", EmailVerified: true, PreferredUsername: "test1"})
+
+	c := client.New(server.URL)
+	callback, err := loginOIDC(t, server, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	profile, err := c.Me(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if profile.Name != "test1-2" || profile.Email == nil || *profile.Email != "test1@example.com" || !profile.EmailVerified {
+		t.Errorf("provisioned profile: got %+v", profile)
+	}
+
+	// States can be used once
+	if err := c.LoginOIDC(ctx, callback.Query().Get("code"), callback.Query().Get("state")); err == nil {
+		t.Errorf("reusing the state succeeded")
+	}
+
+	// The identity logs in the same user again
+	again := client.New(server.URL)
+	if _, err := loginOIDC(t, server, again); err != nil {
+		t.Fatal(err)
+	}
+	if other, err := again.Me(ctx); err != nil || other.ID != profile.ID {
+		t.Errorf("logging in again: got %+v (%v), want user %d", other, err, profile.ID)
+	}
+
+	// Provisioned users have no password, so their only identity stays linked
+	identities, err := c.Identities(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(identities) != 1 || identities[0].Issuer != idp.Issuer() || identities[0].Subject != "1" {
+		t.Fatalf("identities: got %+v", identities)
+	}
+	if err := c.UnlinkIdentity(ctx, int(identities[0].ID)); !errors.Is(err, models.ErrDuplicatedEntry) {
+		t.Errorf("unlinking the last identity: got %v, want %v", err, models.ErrDuplicatedEntry)
+	}
+	if err := c.Login(ctx, profile.Name, ""); err == nil {
+		t.Errorf("logging in a provisioned user without a password succeeded")
+	}
+
+	// Unknown identities are refused without provisioning
+	app.oidcProvision = false
+	idp.Login(oidctest.User{Subject: "2", Email: "new@example.com", EmailVerified: true})
+	if _, err := loginOIDC(t, server, client.New(server.URL)); !errors.Is(err, models.ErrInvalidCredentials) {
+		t.Errorf("logging in without provisioning: got %v, want %v", err, models.ErrInvalidCredentials)
+	}
+}
+
+func TestOIDCLink(t *testing.T) {
+	app, server := newTestServer(t)
+	ctx := context.Background()
+	idp := newTestProvider(t, app, server)
+	app.oidcProvision = false
+
+	// Identities with the verified address of a user are linked to it
+	user, err := app.users.GetByName("test2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := app.users.SetEmail(int(user.ID), "test2@example.com", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := app.users.VerifyEmail(token); err != nil {
+		t.Fatal(err)
+	}
+
+	idp.Login(oidctest.User{Subject: "2", Email: "test2@example.com", EmailVerified: true})
+	c := client.New(server.URL)
+	if _, err := loginOIDC(t, server, c); err != nil {
+		t.Fatal(err)
+	}
+	if profile, err := c.Me(ctx); err != nil || profile.Name != "test2" {
+		t.Errorf("logging in with the address of test2: got %+v (%v)", profile, err)
+	}
+
+	// Unverified addresses are not trusted
+	idp.Login(oidctest.User{Subject: "3", Email: "test2@example.com"})
+	if _, err := loginOIDC(t, server, client.New(server.URL)); !errors.Is(err, models.ErrInvalidCredentials) {
+		t.Errorf("logging in with an unverified address: got %v, want %v", err, models.ErrInvalidCredentials)
+	}
+
+	// Logged in users link identities explicitly
+	test1 := client.New(server.URL, client.WithCredentials("test1", testPassword))
+	authURL, err := test1.LinkIdentity(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := http.Get(followOIDC(t, authURL).String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("linking the identity: got status %d", res.StatusCode)
+	}
+
+	identities, err := test1.Identities(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(identities) != 1 || identities[0].Subject != "3" {
+		t.Fatalf("linked identities: got %+v", identities)
+	}
+
+	// An identity belongs to one user
+	idp.Login(oidctest.User{Subject: "2"})
+	if authURL, err = test1.LinkIdentity(ctx); err != nil {
+		t.Fatal(err)
+	}
+	res, err = http.Get(followOIDC(t, authURL).String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusConflict {
+		t.Errorf("linking the identity of test2: got status %d, want %d", res.StatusCode, http.StatusConflict)
+	}
+
+	// Users with a password can unlink every identity
+	if err := test1.UnlinkIdentity(ctx, int(identities[0].ID)); err != nil {
+		t.Fatal(err)
+	}
+	if err := test1.UnlinkIdentity(ctx, int(identities[0].ID)); !errors.Is(err, models.ErrNoRecord) {
+		t.Errorf("unlinking twice: got %v, want %v", err, models.ErrNoRecord)
+	}
+}
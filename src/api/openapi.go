@@ -0,0 +1,1093 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"films-api.rdelgado.es/src/internals/events"
+	"films-api.rdelgado.es/src/internals/export"
+	"films-api.rdelgado.es/src/internals/models"
+	"films-api.rdelgado.es/src/internals/openapi"
+	"films-api.rdelgado.es/src/internals/validator"
+)
+
+//go:embed swagger.html
+var swaggerPage []byte
+
+// fieldErrors is the body of the 422 responses, with a message for each invalid field
+type fieldErrors map[string]string
+
+var apiInfo = openapi.Info{
+	Title:       "Films API",
+	Description: "API to manage a catalogue of movies, favourites and movie lists. Access tokens are returned in the Authorization header of the login response.",
+	Version:     "1.0.0",
+}
+
+var apiTags = []openapi.Tag{
+	{Name: "movies", Description: "Movie catalogue"},
+	{Name: "favourites", Description: "Favourite movies of the user"},
+	{Name: "lists", Description: "Movie lists curated by the users"},
+	{Name: "users", Description: "Sign up and authentication"},
+	{Name: "events", Description: "Live stream of the changes of the catalogue and the favourites"},
+	{Name: "webhooks", Description: "Endpoints notified of the changes of the catalogue and the favourites"},
+	{Name: "admin", Description: "Administration, for the users with the admin role"},
+	{Name: "docs", Description: "API documentation"},
+}
+
+// Common responses
+var (
+	okResponse = openapi.Response{Description: "Done"}
+
+	badRequest      = textResponse("Malformed request")
+	unauthenticated = textResponse("Missing, invalid or expired token")
+	forbidden       = textResponse("The resource belongs to another user")
+	adminOnly       = textResponse("The user is not an admin")
+	notFound        = textResponse("Not found")
+	conflict        = textResponse("Already exists")
+	invalidFields   = openapi.Response{Description: "Invalid fields", Body: fieldErrors{}}
+
+	mfaRequired = textResponse("The role of the user requires two-factor authentication, which is not enabled")
+	mfaLocked   = textResponse("Too many wrong codes, the second factor is locked for a while")
+
+	unchanged = openapi.Response{Description: "Not changed since the ETag of If-None-Match, or the date of If-Modified-Since"}
+
+	tooLarge         = textResponse("The body is larger than the limit of the route")
+	unsupportedMedia = textResponse("The body is not sent as application/json")
+
+	tokenResponse = openapi.Response{
+		Description: "Authenticated. The access token is sent in the Authorization header, not in the body.",
+		Headers: map[string]*openapi.Header{
+			"Authorization": {Description: "Bearer access token", Schema: &openapi.Schema{Type: "string", Example: "Bearer eyJhbGciOiJIUzI1NiIs..."}},
+		},
+	}
+
+	// Validators of the responses that can be revalidated
+	validatorHeaders = map[string]*openapi.Header{
+		"ETag":          {Description: "Send it in If-None-Match to get a 304 response while it does not change", Schema: &openapi.Schema{Type: "string"}},
+		"Last-Modified": {Description: "Date of the last change, for If-Modified-Since", Schema: &openapi.Schema{Type: "string"}},
+		"Cache-Control": {Description: "Clients may store the response but must revalidate it", Schema: &openapi.Schema{Type: "string", Example: "private, no-cache"}},
+	}
+
+	exportArchive = openapi.Response{
+		Description: "ZIP with manifest.json, profile.json, movies.json, favourites.json, lists.json, webhooks.json, identities.json, sessions.json and audit.json",
+		Content: map[string]*openapi.MediaType{
+			export.ContentType: {Schema: &openapi.Schema{Type: "string", Format: "binary"}},
+		},
+	}
+)
+
+var movieQuery = []openapi.Parameter{
+	{Name: "title", Description: "Movies whose title contains the text"},
+	{Name: "genre", Description: "Movies of the genre"},
+	{Name: "year", Description: "Movies released in the year", Schema: &openapi.Schema{Type: "integer"}},
+}
+
+// apiDocs documents every route, keyed by method and httprouter path
+var apiDocs = map[string]openapi.Operation{
+	// Movies
+	"GET /movies": {
+		Summary: "List movies",
+		Description: "Returns every movie matching the filters. If page or page_size are set the result is paginated: " +
+			"the total is sent in the X-Total-Count header and the next page in the Link header. " +
+			"The ETag changes with any change of a movie.",
+		Tags: []string{"movies"},
+		Query: append([]openapi.Parameter{
+			{Name: "page", Description: "Page number, starting at 1", Schema: &openapi.Schema{Type: "integer"}},
+			{Name: "page_size", Description: "Movies per page (20 by default, 100 at most)", Schema: &openapi.Schema{Type: "integer"}},
+		}, movieQuery...),
+		Responses: map[int]openapi.Response{
+			http.StatusOK: {
+				Description: "Movies",
+				Body:        []models.Movie{},
+				Headers: withHeaders(validatorHeaders, map[string]*openapi.Header{
+					"X-Total-Count": {Description: "Number of movies matching the filters (paginated requests)", Schema: &openapi.Schema{Type: "integer"}},
+					"Link":          {Description: `URL of the next page with rel="next" (paginated requests)`, Schema: &openapi.Schema{Type: "string"}},
+				}),
+			},
+			http.StatusNotModified:  unchanged,
+			http.StatusBadRequest:   badRequest,
+			http.StatusUnauthorized: unauthenticated,
+		},
+	},
+	"POST /movie": {
+		Summary: "Add a movie",
+		Tags:    []string{"movies"},
+		Request: movieRequest{},
+		Responses: map[int]openapi.Response{
+			http.StatusOK:                    {Description: "ID of the new movie", Body: 0},
+			http.StatusBadRequest:            badRequest,
+			http.StatusRequestEntityTooLarge: tooLarge,
+			http.StatusUnsupportedMediaType:  unsupportedMedia,
+			http.StatusUnauthorized:          unauthenticated,
+			http.StatusConflict:              textResponse("Another movie has the title, maybe in the trash"),
+			http.StatusUnprocessableEntity:   invalidFields,
+		},
+	},
+	"GET /movie/:id": {
+		Summary: "Get a movie and its author",
+		Tags:    []string{"movies"},
+		Responses: map[int]openapi.Response{
+			http.StatusOK:           {Description: "Movie", Body: models.MovieAndAuthor{}, Headers: validatorHeaders},
+			http.StatusNotModified:  unchanged,
+			http.StatusUnauthorized: unauthenticated,
+			http.StatusNotFound:     notFound,
+		},
+	},
+	"PUT /movie/:id": {
+		Summary:     "Update a movie",
+		Description: "Changes the non blank fields. Only the user who added the movie can update it.",
+		Tags:        []string{"movies"},
+		Request:     movieUpdateRequest{},
+		Responses: map[int]openapi.Response{
+			http.StatusOK:                    okResponse,
+			http.StatusBadRequest:            badRequest,
+			http.StatusRequestEntityTooLarge: tooLarge,
+			http.StatusUnsupportedMediaType:  unsupportedMedia,
+			http.StatusUnauthorized:          unauthenticated,
+			http.StatusForbidden:             forbidden,
+			http.StatusNotFound:              notFound,
+			http.StatusConflict:              textResponse("Another movie has the title, maybe in the trash"),
+			http.StatusUnprocessableEntity:   invalidFields,
+		},
+	},
+	"DELETE /movie/:id": {
+		Summary: "Delete a movie",
+		Description: "Moves the movie to the trash, where it can be restored until it is purged. " +
+			"Only the user who added the movie can delete it.",
+		Tags: []string{"movies"},
+		Responses: map[int]openapi.Response{
+			http.StatusOK:           okResponse,
+			http.StatusUnauthorized: unauthenticated,
+			http.StatusForbidden:    forbidden,
+			http.StatusNotFound:     notFound,
+		},
+	},
+	"POST /movie/:id/restore": {
+		Summary:     "Restore a deleted movie",
+		Description: "Takes the movie out of the trash with its favourites and list items. Only the user who added the movie can restore it.",
+		Tags:        []string{"movies"},
+		Responses: map[int]openapi.Response{
+			http.StatusOK:           {Description: "Restored movie", Body: models.Movie{}},
+			http.StatusUnauthorized: unauthenticated,
+			http.StatusForbidden:    forbidden,
+			http.StatusNotFound:     notFound,
+		},
+	},
+	"GET /trash": {
+		Summary:     "List the deleted movies",
+		Description: "Movies deleted by the user, most recently deleted first, with the time they will be purged.",
+		Tags:        []string{"movies"},
+		Responses: map[int]openapi.Response{
+			http.StatusOK:           {Description: "Deleted movies", Body: []models.TrashedMovie{}},
+			http.StatusUnauthorized: unauthenticated,
+		},
+	},
+	"POST /movies/import": {
+		Summary:     "Import movies",
+		Description: "Adds the movies of a CSV or NDJSON file of up to 50 MB. Each row is validated like a new movie and failed rows are reported without stopping the import.",
+		Tags:        []string{"movies"},
+		Query: []openapi.Parameter{
+			{Name: "format", Description: "Format of the body, taken from the Content-Type header if missing", Schema: &openapi.Schema{Type: "string", Enum: []string{formatCSV, formatNDJSON}}},
+			{Name: "dry_run", Description: "Validate the file without saving the movies", Schema: &openapi.Schema{Type: "boolean"}},
+			{Name: "on_duplicate", Description: "Skip movies with an existing title or update them (only movies of the user)", Schema: &openapi.Schema{Type: "string", Enum: []string{onDuplicateSkip, onDuplicateUpsert}}},
+		},
+		RequestBody: &openapi.RequestBody{
+			Required: true,
+			Content: map[string]*openapi.MediaType{
+				contentTypes[formatCSV]:    {Schema: &openapi.Schema{Type: "string", Description: "Columns " + strings.Join(movieColumns, ", ") + ". Cast members are separated by " + castSeparator}},
+				contentTypes[formatNDJSON]: {Schema: &openapi.Schema{Type: "string", Description: "One movie record per line"}},
+			},
+		},
+		Responses: map[int]openapi.Response{
+			http.StatusOK:                    {Description: "Import report", Body: importReport{}},
+			http.StatusBadRequest:            badRequest,
+			http.StatusRequestEntityTooLarge: tooLarge,
+			http.StatusUnauthorized:          unauthenticated,
+			http.StatusUnprocessableEntity:   invalidFields,
+		},
+	},
+	"GET /movies/export": {
+		Summary:     "Export movies",
+		Description: "Streams the movies matching the filters as a file download.",
+		Tags:        []string{"movies"},
+		Query: append([]openapi.Parameter{
+			{Name: "format", Description: "Format of the file (json by default)", Schema: &openapi.Schema{Type: "string", Enum: []string{formatCSV, formatNDJSON, formatJSON}}},
+		}, movieQuery...),
+		Responses: map[int]openapi.Response{
+			http.StatusOK: {
+				Description: "Movie records",
+				Content: map[string]*openapi.MediaType{
+					contentTypes[formatJSON]:   {Schema: &openapi.Schema{Type: "array", Items: &openapi.Schema{Ref: "#/components/schemas/movieRecord"}}},
+					contentTypes[formatCSV]:    {Schema: &openapi.Schema{Type: "string"}},
+					contentTypes[formatNDJSON]: {Schema: &openapi.Schema{Type: "string"}},
+				},
+			},
+			http.StatusBadRequest:   badRequest,
+			http.StatusUnauthorized: unauthenticated,
+		},
+	},
+	"POST /movie/:id/poster":   imageUpload(models.ImagePoster),
+	"POST /movie/:id/backdrop": imageUpload(models.ImageBackdrop),
+	"GET /images/*key": {
+		Summary:     "Get a movie image",
+		Description: "Serves the images and thumbnails linked from the movies. Their URLs change with their content, so they can be cached forever.",
+		Tags:        []string{"movies"},
+		Security:    openapi.AuthNone,
+		Responses: map[int]openapi.Response{
+			http.StatusOK: {
+				Description: "Image",
+				Headers: map[string]*openapi.Header{
+					"Cache-Control": {Description: "Images are immutable", Schema: &openapi.Schema{Type: "string", Example: imageCacheControl}},
+					"ETag":          {Description: "Send it in If-None-Match to get a 304 response", Schema: &openapi.Schema{Type: "string"}},
+				},
+				Content: map[string]*openapi.MediaType{
+					"image/jpeg": {Schema: &openapi.Schema{Type: "string", Format: "binary"}},
+					"image/png":  {Schema: &openapi.Schema{Type: "string", Format: "binary"}},
+					"image/webp": {Schema: &openapi.Schema{Type: "string", Format: "binary"}},
+				},
+			},
+			http.StatusNotModified: {Description: "The image has not changed"},
+			http.StatusNotFound:    notFound,
+		},
+	},
+
+	// Favourites
+	"POST /favourite": {
+		Summary:     "Add a movie to the favourites",
+		Description: "The movie must exist and not be in the trash.",
+		Tags:        []string{"favourites"},
+		Request:     favouriteMovieRequest{},
+		Responses: map[int]openapi.Response{
+			http.StatusOK:                    {Description: "ID of the favourite", Body: 0},
+			http.StatusBadRequest:            badRequest,
+			http.StatusRequestEntityTooLarge: tooLarge,
+			http.StatusUnsupportedMediaType:  unsupportedMedia,
+			http.StatusUnauthorized:          unauthenticated,
+			http.StatusNotFound:              notFound,
+			http.StatusConflict:              conflict,
+			http.StatusUnprocessableEntity:   invalidFields,
+		},
+	},
+	"GET /favourites": {
+		Summary: "List the favourite movies",
+		Tags:    []string{"favourites"},
+		Responses: map[int]openapi.Response{
+			http.StatusOK:           {Description: "Favourites", Body: []models.GetFavouriteInfo{}},
+			http.StatusUnauthorized: unauthenticated,
+			http.StatusNotFound:     textResponse("The user has no favourites"),
+		},
+	},
+	"DELETE /favourites/:id": {
+		Summary:     "Remove a favourite",
+		Description: "The ID is the one of the favourite, not the movie.",
+		Tags:        []string{"favourites"},
+		Responses: map[int]openapi.Response{
+			http.StatusOK:           okResponse,
+			http.StatusUnauthorized: unauthenticated,
+			http.StatusNotFound:     notFound,
+		},
+	},
+
+	// Lists
+	"GET /lists/public": {
+		Summary:  "List the public lists of every user",
+		Tags:     []string{"lists"},
+		Security: openapi.AuthNone,
+		Responses: map[int]openapi.Response{
+			http.StatusOK: {Description: "Lists", Body: []models.List{}},
+		},
+	},
+	"GET /lists": {
+		Summary: "List the lists of the user",
+		Tags:    []string{"lists"},
+		Responses: map[int]openapi.Response{
+			http.StatusOK:           {Description: "Lists", Body: []models.List{}},
+			http.StatusUnauthorized: unauthenticated,
+		},
+	},
+	"POST /list": {
+		Summary: "Create a list",
+		Tags:    []string{"lists"},
+		Request: listRequest{},
+		Responses: map[int]openapi.Response{
+			http.StatusOK:                    {Description: "ID of the new list", Body: 0},
+			http.StatusBadRequest:            badRequest,
+			http.StatusRequestEntityTooLarge: tooLarge,
+			http.StatusUnsupportedMediaType:  unsupportedMedia,
+			http.StatusUnauthorized:          unauthenticated,
+			http.StatusUnprocessableEntity:   invalidFields,
+		},
+	},
+	"GET /list/:id": {
+		Summary:     "Get a list and its movies",
+		Description: "Public and unlisted lists can be read by anyone, private lists only by their owner.",
+		Tags:        []string{"lists"},
+		Security:    openapi.AuthOptional,
+		Responses: map[int]openapi.Response{
+			http.StatusOK:       {Description: "List", Body: models.ListDetails{}},
+			http.StatusNotFound: notFound,
+		},
+	},
+	"PUT /list/:id": {
+		Summary:     "Update a list",
+		Description: "Changes the fields sent. An empty description clears it.",
+		Tags:        []string{"lists"},
+		Request:     listUpdateRequest{},
+		Responses: map[int]openapi.Response{
+			http.StatusOK:                    okResponse,
+			http.StatusBadRequest:            badRequest,
+			http.StatusRequestEntityTooLarge: tooLarge,
+			http.StatusUnsupportedMediaType:  unsupportedMedia,
+			http.StatusUnauthorized:          unauthenticated,
+			http.StatusNotFound:              notFound,
+			http.StatusUnprocessableEntity:   invalidFields,
+		},
+	},
+	"DELETE /list/:id": {
+		Summary: "Delete a list",
+		Tags:    []string{"lists"},
+		Responses: map[int]openapi.Response{
+			http.StatusOK:           okResponse,
+			http.StatusUnauthorized: unauthenticated,
+			http.StatusNotFound:     notFound,
+		},
+	},
+	"PUT /list/:id/order": {
+		Summary:     "Reorder a list",
+		Description: "item_ids must contain every item of the list exactly once.",
+		Tags:        []string{"lists"},
+		Request:     listOrderRequest{},
+		Responses: map[int]openapi.Response{
+			http.StatusOK:                    okResponse,
+			http.StatusBadRequest:            badRequest,
+			http.StatusRequestEntityTooLarge: tooLarge,
+			http.StatusUnsupportedMediaType:  unsupportedMedia,
+			http.StatusUnauthorized:          unauthenticated,
+			http.StatusNotFound:              notFound,
+			http.StatusUnprocessableEntity:   invalidFields,
+		},
+	},
+	"POST /list/:id/items": {
+		Summary: "Add a movie to a list",
+		Tags:    []string{"lists"},
+		Request: listItemRequest{},
+		Responses: map[int]openapi.Response{
+			http.StatusOK:                    {Description: "ID of the new item", Body: 0},
+			http.StatusBadRequest:            badRequest,
+			http.StatusRequestEntityTooLarge: tooLarge,
+			http.StatusUnsupportedMediaType:  unsupportedMedia,
+			http.StatusUnauthorized:          unauthenticated,
+			http.StatusNotFound:              notFound,
+			http.StatusConflict:              conflict,
+			http.StatusUnprocessableEntity:   invalidFields,
+		},
+	},
+	"PUT /list/:id/items/:item": {
+		Summary: "Change the note of a list item",
+		Tags:    []string{"lists"},
+		Request: listItemNoteRequest{},
+		Responses: map[int]openapi.Response{
+			http.StatusOK:                    okResponse,
+			http.StatusBadRequest:            badRequest,
+			http.StatusRequestEntityTooLarge: tooLarge,
+			http.StatusUnsupportedMediaType:  unsupportedMedia,
+			http.StatusUnauthorized:          unauthenticated,
+			http.StatusNotFound:              notFound,
+			http.StatusUnprocessableEntity:   invalidFields,
+		},
+	},
+	"DELETE /list/:id/items/:item": {
+		Summary: "Remove a movie from a list",
+		Tags:    []string{"lists"},
+		Responses: map[int]openapi.Response{
+			http.StatusOK:           okResponse,
+			http.StatusUnauthorized: unauthenticated,
+			http.StatusNotFound:     notFound,
+		},
+	},
+
+	// Users
+	"POST /user/signup": {
+		Summary:  "Sign up",
+		Tags:     []string{"users"},
+		Security: openapi.AuthNone,
+		Request:  signupRequest{},
+		Responses: map[int]openapi.Response{
+			http.StatusOK:                    {Description: "User created"},
+			http.StatusBadRequest:            badRequest,
+			http.StatusRequestEntityTooLarge: tooLarge,
+			http.StatusUnsupportedMediaType:  unsupportedMedia,
+			http.StatusConflict:              conflict,
+			http.StatusUnprocessableEntity:   invalidFields,
+		},
+	},
+	"POST /user/login": {
+		Summary: "Log in",
+		Description: "Users with two-factor authentication get no access token: the body has MFARequired and an MFAToken " +
+			"to send with a code to POST /user/login/mfa.",
+		Tags:     []string{"users"},
+		Security: openapi.AuthNone,
+		Request:  userRequest{},
+		Responses: map[int]openapi.Response{
+			http.StatusOK: {
+				Description: tokenResponse.Description + " With two-factor authentication, the token to send the code with.",
+				Headers:     tokenResponse.Headers,
+				Body:        mfaChallengeResponse{},
+			},
+			http.StatusBadRequest:            badRequest,
+			http.StatusRequestEntityTooLarge: tooLarge,
+			http.StatusUnsupportedMediaType:  unsupportedMedia,
+			http.StatusUnauthorized:          textResponse("Invalid credentials"),
+			http.StatusUnprocessableEntity:   invalidFields,
+		},
+	},
+	"POST /user/login/mfa": {
+		Summary: "Log in with the second factor",
+		Description: "Exchanges the MFAToken of POST /user/login and a code of the authenticator app, or a recovery code, for an access token. " +
+			"After " + strconv.Itoa(models.MaxMFAFailures) + " wrong codes in a row the second factor is locked for " + models.MFALockout.String() + ".",
+		Tags:     []string{"users"},
+		Security: openapi.AuthNone,
+		Request:  mfaLoginRequest{},
+		Responses: map[int]openapi.Response{
+			http.StatusOK:                    tokenResponse,
+			http.StatusBadRequest:            badRequest,
+			http.StatusRequestEntityTooLarge: tooLarge,
+			http.StatusUnsupportedMediaType:  unsupportedMedia,
+			http.StatusUnauthorized:          textResponse("Invalid or expired MFA token"),
+			http.StatusUnprocessableEntity:   invalidFields,
+			http.StatusTooManyRequests:       mfaLocked,
+		},
+	},
+	"GET /user/oidc/login": {
+		Summary: "Log in with the identity provider",
+		Description: "Redirects the browser to the OpenID Connect provider, which redirects it back to GET /user/oidc/callback. " +
+			"Only available if the provider is configured.",
+		Tags:     []string{"users"},
+		Security: openapi.AuthNone,
+		Responses: map[int]openapi.Response{
+			http.StatusFound: {
+				Description: "Redirection to the provider",
+				Headers: map[string]*openapi.Header{
+					"Location": {Description: "Authorization URL of the provider", Schema: &openapi.Schema{Type: "string"}},
+				},
+			},
+			http.StatusNotFound: textResponse("No identity provider is configured"),
+		},
+	},
+	"GET /user/oidc/callback": {
+		Summary: "Finish the login with the identity provider",
+		Description: "Logins get an access token, or the MFAToken for POST /user/login/mfa if the user has two-factor authentication, as in POST /user/login. " +
+			"The identity is linked to the user with the same verified email address, or to a new user without a password. " +
+			"Links started by POST /user/me/identities get the linked identity.",
+		Tags:     []string{"users"},
+		Security: openapi.AuthNone,
+		Query: []openapi.Parameter{
+			{Name: "code", Description: "Authorization code"},
+			{Name: "state", Description: "State of the login"},
+			{Name: "error", Description: "Error of the provider"},
+			{Name: "error_description", Description: "Description of the error of the provider"},
+		},
+		Responses: map[int]openapi.Response{
+			http.StatusOK: {
+				Description: tokenResponse.Description + " Links get the identity instead.",
+				Headers:     tokenResponse.Headers,
+				Body:        models.Identity{},
+			},
+			http.StatusBadRequest:   textResponse("Unknown or expired state"),
+			http.StatusUnauthorized: textResponse("The provider did not log in the user"),
+			http.StatusNotFound:     textResponse("No identity provider is configured"),
+			http.StatusConflict:     textResponse("The identity is linked to another user"),
+		},
+	},
+	"POST /user/token/refresh": {
+		Summary:     "Refresh the access token",
+		Description: "The new token belongs to the same session, which is extended.",
+		Tags:        []string{"users"},
+		Responses: map[int]openapi.Response{
+			http.StatusOK:           tokenResponse,
+			http.StatusUnauthorized: unauthenticated,
+		},
+	},
+	"POST /user/email/verify": {
+		Summary:     "Verify the email address",
+		Description: "Takes the token sent to the address by PUT /user/me/email.",
+		Tags:        []string{"users"},
+		Security:    openapi.AuthNone,
+		Request:     verifyEmailRequest{},
+		Responses: map[int]openapi.Response{
+			http.StatusOK:                    okResponse,
+			http.StatusBadRequest:            badRequest,
+			http.StatusRequestEntityTooLarge: tooLarge,
+			http.StatusUnsupportedMediaType:  unsupportedMedia,
+			http.StatusUnprocessableEntity:   invalidFields,
+		},
+	},
+	"POST /user/password/forgot": {
+		Summary: "Request a password reset",
+		Description: "Sends a token to reset the password to the address, if it is the verified email of an enabled user. " +
+			"The response is the same when it is not, so it does not tell which addresses are registered.",
+		Tags:     []string{"users"},
+		Security: openapi.AuthNone,
+		Request:  emailRequest{},
+		Responses: map[int]openapi.Response{
+			http.StatusOK:                    okResponse,
+			http.StatusBadRequest:            badRequest,
+			http.StatusRequestEntityTooLarge: tooLarge,
+			http.StatusUnsupportedMediaType:  unsupportedMedia,
+			http.StatusUnprocessableEntity:   invalidFields,
+		},
+	},
+	"POST /user/password/reset": {
+		Summary: "Reset the password",
+		Description: "Sets a new password with a token sent by POST /user/password/forgot. Tokens expire after " +
+			strconv.Itoa(int(resetPasswordTTL.Minutes())) + " minutes and can be used once. The access tokens of the user are revoked.",
+		Tags:     []string{"users"},
+		Security: openapi.AuthNone,
+		Request:  resetPasswordRequest{},
+		Responses: map[int]openapi.Response{
+			http.StatusOK:                    okResponse,
+			http.StatusBadRequest:            badRequest,
+			http.StatusRequestEntityTooLarge: tooLarge,
+			http.StatusUnsupportedMediaType:  unsupportedMedia,
+			http.StatusUnprocessableEntity:   invalidFields,
+		},
+	},
+	"GET /user/me": {
+		Summary: "Get the profile of the user",
+		Tags:    []string{"users"},
+		Responses: map[int]openapi.Response{
+			http.StatusOK:           {Description: "Profile", Body: models.Profile{}},
+			http.StatusUnauthorized: unauthenticated,
+		},
+	},
+	"PATCH /user/me": {
+		Summary: "Rename the user",
+		Tags:    []string{"users"},
+		Request: profileRequest{},
+		Responses: map[int]openapi.Response{
+			http.StatusOK:                    {Description: "Updated profile", Body: models.Profile{}},
+			http.StatusBadRequest:            badRequest,
+			http.StatusRequestEntityTooLarge: tooLarge,
+			http.StatusUnsupportedMediaType:  unsupportedMedia,
+			http.StatusUnauthorized:          unauthenticated,
+			http.StatusConflict:              conflict,
+			http.StatusUnprocessableEntity:   invalidFields,
+		},
+	},
+	"POST /user/me/password": {
+		Summary: "Change the password",
+		Description: "Requires the current password. The other access tokens of the user are revoked, " +
+			"and a new one is sent for the client that made the change.",
+		Tags:    []string{"users"},
+		Request: passwordRequest{},
+		Responses: map[int]openapi.Response{
+			http.StatusOK:                    tokenResponse,
+			http.StatusBadRequest:            badRequest,
+			http.StatusRequestEntityTooLarge: tooLarge,
+			http.StatusUnsupportedMediaType:  unsupportedMedia,
+			http.StatusUnauthorized:          unauthenticated,
+			http.StatusUnprocessableEntity:   invalidFields,
+		},
+	},
+	"PUT /user/me/email": {
+		Summary:     "Change the email address",
+		Description: "The address is used to reset the password once verified: a token to verify it is sent to it, valid for 24 hours.",
+		Tags:        []string{"users"},
+		Request:     emailRequest{},
+		Responses: map[int]openapi.Response{
+			http.StatusOK:                    {Description: "Updated profile", Body: models.Profile{}},
+			http.StatusBadRequest:            badRequest,
+			http.StatusRequestEntityTooLarge: tooLarge,
+			http.StatusUnsupportedMediaType:  unsupportedMedia,
+			http.StatusUnauthorized:          unauthenticated,
+			http.StatusConflict:              conflict,
+			http.StatusUnprocessableEntity:   invalidFields,
+		},
+	},
+	"DELETE /user/me": {
+		Summary: "Delete the account of the user",
+		Description: "Deletes the favourites, lists and webhooks of the user and revokes their access tokens. " +
+			"The movies created by the user stay in the catalogue, with the author anonymized as #deleted-<id>.",
+		Tags: []string{"users"},
+		Responses: map[int]openapi.Response{
+			http.StatusOK:           okResponse,
+			http.StatusUnauthorized: unauthenticated,
+		},
+	},
+
+	"POST /user/me/totp": {
+		Summary: "Start the two-factor authentication enrolment",
+		Description: "Creates a secret for an authenticator app. Two-factor authentication is enabled once a code of the app " +
+			"is sent to POST /user/me/totp/confirm.",
+		Tags: []string{"users"},
+		Responses: map[int]openapi.Response{
+			http.StatusOK:           {Description: "Secret and its provisioning URI", Body: totpEnrolmentResponse{}},
+			http.StatusUnauthorized: unauthenticated,
+			http.StatusConflict:     textResponse("Two-factor authentication is already enabled"),
+		},
+	},
+	"POST /user/me/totp/confirm": {
+		Summary:     "Enable two-factor authentication",
+		Description: "Takes a code of the secret of POST /user/me/totp and returns the recovery codes of the user.",
+		Tags:        []string{"users"},
+		Request:     totpCodeRequest{},
+		Responses: map[int]openapi.Response{
+			http.StatusOK:                    {Description: "Recovery codes", Body: recoveryCodesResponse{}},
+			http.StatusBadRequest:            badRequest,
+			http.StatusRequestEntityTooLarge: tooLarge,
+			http.StatusUnsupportedMediaType:  unsupportedMedia,
+			http.StatusUnauthorized:          unauthenticated,
+			http.StatusNotFound:              textResponse("The enrolment has not been started"),
+			http.StatusConflict:              textResponse("Two-factor authentication is already enabled"),
+			http.StatusUnprocessableEntity:   invalidFields,
+		},
+	},
+	"DELETE /user/me/totp": {
+		Summary:     "Disable two-factor authentication",
+		Description: "Requires the password. Users whose role requires two-factor authentication cannot disable it.",
+		Tags:        []string{"users"},
+		Request:     disableTOTPRequest{},
+		Responses: map[int]openapi.Response{
+			http.StatusOK:                    okResponse,
+			http.StatusBadRequest:            badRequest,
+			http.StatusRequestEntityTooLarge: tooLarge,
+			http.StatusUnsupportedMediaType:  unsupportedMedia,
+			http.StatusUnauthorized:          unauthenticated,
+			http.StatusForbidden:             textResponse("The role of the user requires two-factor authentication"),
+			http.StatusNotFound:              textResponse("Two-factor authentication is not enabled"),
+			http.StatusUnprocessableEntity:   invalidFields,
+		},
+	},
+	"POST /user/me/totp/recovery-codes": {
+		Summary:     "Replace the recovery codes",
+		Description: "Takes a code of the authenticator app, or a recovery code, and returns new recovery codes. The old ones are no longer valid.",
+		Tags:        []string{"users"},
+		Request:     totpCodeRequest{},
+		Responses: map[int]openapi.Response{
+			http.StatusOK:                    {Description: "Recovery codes", Body: recoveryCodesResponse{}},
+			http.StatusBadRequest:            badRequest,
+			http.StatusRequestEntityTooLarge: tooLarge,
+			http.StatusUnsupportedMediaType:  unsupportedMedia,
+			http.StatusUnauthorized:          unauthenticated,
+			http.StatusForbidden:             mfaRequired,
+			http.StatusUnprocessableEntity:   invalidFields,
+			http.StatusTooManyRequests:       mfaLocked,
+		},
+	},
+	"GET /user/me/identities": {
+		Summary: "Identities of the user in the identity provider",
+		Tags:    []string{"users"},
+		Responses: map[int]openapi.Response{
+			http.StatusOK:           {Description: "Identities", Body: []models.Identity{}},
+			http.StatusUnauthorized: unauthenticated,
+		},
+	},
+	"POST /user/me/identities": {
+		Summary: "Link an identity of the identity provider",
+		Description: "Returns the URL of the provider to open in the browser. The identity the user logs in with is linked " +
+			"when the provider redirects back to GET /user/oidc/callback.",
+		Tags: []string{"users"},
+		Responses: map[int]openapi.Response{
+			http.StatusOK:           {Description: "Authorization URL", Body: identityLinkResponse{}},
+			http.StatusUnauthorized: unauthenticated,
+			http.StatusNotFound:     textResponse("No identity provider is configured"),
+		},
+	},
+	"DELETE /user/me/identities/:id": {
+		Summary: "Unlink an identity",
+		Tags:    []string{"users"},
+		Responses: map[int]openapi.Response{
+			http.StatusOK:           okResponse,
+			http.StatusUnauthorized: unauthenticated,
+			http.StatusNotFound:     notFound,
+			http.StatusConflict:     textResponse("The user has no password and no other identity"),
+		},
+	},
+	"GET /user/sessions": {
+		Summary:     "Devices where the user is logged in",
+		Description: "Each login starts a session, which lasts as long as its token and is extended when the token is refreshed.",
+		Tags:        []string{"users"},
+		Responses: map[int]openapi.Response{
+			http.StatusOK:           {Description: "Active sessions, the last seen first", Body: []sessionResponse{}},
+			http.StatusUnauthorized: unauthenticated,
+		},
+	},
+	"DELETE /user/sessions": {
+		Summary:     "Log out everywhere",
+		Description: "Ends every session of the user, including the one of the request, and revokes the tokens issued before the sessions.",
+		Tags:        []string{"users"},
+		Responses: map[int]openapi.Response{
+			http.StatusOK:           okResponse,
+			http.StatusUnauthorized: unauthenticated,
+		},
+	},
+	"DELETE /user/sessions/:id": {
+		Summary: "Log a device out",
+		Tags:    []string{"users"},
+		Responses: map[int]openapi.Response{
+			http.StatusOK:           okResponse,
+			http.StatusUnauthorized: unauthenticated,
+			http.StatusNotFound:     notFound,
+		},
+	},
+
+	"GET /user/me/export": {
+		Summary: "Export the data of the user",
+		Description: "Sends a ZIP of JSON files with the profile, created movies (including the trash), favourites, lists, webhooks and audit entries of the user. " +
+			"Exports of more than " + strconv.Itoa(maxSyncExportRows) + " records are made in the background: the response is then 202 with the job, " +
+			"whose status is at the Location header.",
+		Tags: []string{"users"},
+		Query: []openapi.Parameter{
+			{Name: "async", Description: "Make the export in the background whatever its size", Schema: &openapi.Schema{Type: "boolean"}},
+		},
+		Responses: map[int]openapi.Response{
+			http.StatusOK:           exportArchive,
+			http.StatusAccepted:     {Description: "Export queued", Body: models.ExportJob{}, Headers: map[string]*openapi.Header{"Location": {Description: "Status of the export", Schema: &openapi.Schema{Type: "string"}}}},
+			http.StatusBadRequest:   badRequest,
+			http.StatusUnauthorized: unauthenticated,
+		},
+	},
+	"GET /user/me/export/:id": {
+		Summary:     "Get the status of an export",
+		Description: "Done exports can be downloaded until they expire, then they are deleted.",
+		Tags:        []string{"users"},
+		Responses: map[int]openapi.Response{
+			http.StatusOK:           {Description: "Export job", Body: models.ExportJob{}},
+			http.StatusUnauthorized: unauthenticated,
+			http.StatusNotFound:     notFound,
+		},
+	},
+	"GET /user/me/export/:id/download": {
+		Summary: "Download an export",
+		Tags:    []string{"users"},
+		Responses: map[int]openapi.Response{
+			http.StatusOK:           exportArchive,
+			http.StatusUnauthorized: unauthenticated,
+			http.StatusNotFound:     notFound,
+			http.StatusConflict:     textResponse("The export has not finished"),
+		},
+	},
+
+	// Admin
+	"GET /admin/audit": {
+		Summary: "Audit log",
+		Description: "Changes of the movies, favourites and users, newest first, with the user, request ID and IP that made them. " +
+			"The total is sent in the X-Total-Count header and the next page in the Link header.",
+		Tags: []string{"admin"},
+		Query: []openapi.Parameter{
+			{Name: "entity", Description: "Entries of an entity", Schema: &openapi.Schema{Type: "string", Enum: auditEntities}},
+			{Name: "entity_id", Description: "Entries of the entity with this ID", Schema: &openapi.Schema{Type: "integer"}},
+			{Name: "actor", Description: "Entries of the changes made by this user ID", Schema: &openapi.Schema{Type: "integer"}},
+			{Name: "from", Description: "Entries since this time (RFC 3339 or date)"},
+			{Name: "to", Description: "Entries before this time (RFC 3339 or date)"},
+			{Name: "page", Description: "Page number, starting at 1", Schema: &openapi.Schema{Type: "integer"}},
+			{Name: "page_size", Description: "Entries per page (20 by default, 100 at most)", Schema: &openapi.Schema{Type: "integer"}},
+		},
+		Responses: map[int]openapi.Response{
+			http.StatusOK: {
+				Description: "Entries",
+				Body:        []models.AuditEntry{},
+				Headers: map[string]*openapi.Header{
+					"X-Total-Count": {Description: "Number of entries matching the filters", Schema: &openapi.Schema{Type: "integer"}},
+					"Link":          {Description: `URL of the next page with rel="next"`, Schema: &openapi.Schema{Type: "string"}},
+				},
+			},
+			http.StatusBadRequest:   badRequest,
+			http.StatusUnauthorized: unauthenticated,
+			http.StatusForbidden:    adminOnly,
+		},
+	},
+	"GET /admin/cache": {
+		Summary:     "Counters of the caches",
+		Description: "Hits, misses and evictions of the caches of the instance that answers, since it started.",
+		Tags:        []string{"admin"},
+		Responses: map[int]openapi.Response{
+			http.StatusOK:           {Description: "Counters", Body: cacheStatsResponse{}},
+			http.StatusUnauthorized: unauthenticated,
+			http.StatusForbidden:    adminOnly,
+		},
+	},
+	"GET /admin/mfa": {
+		Summary: "Roles that require two-factor authentication",
+		Tags:    []string{"admin"},
+		Responses: map[int]openapi.Response{
+			http.StatusOK:           {Description: "Roles", Body: mfaPolicyResponse{}},
+			http.StatusUnauthorized: unauthenticated,
+			http.StatusForbidden:    adminOnly,
+		},
+	},
+	"PUT /admin/mfa": {
+		Summary: "Require two-factor authentication for roles",
+		Description: "The users of the roles without two-factor authentication get 403 on every route except GET /user/me " +
+			"and the enrolment (POST /user/me/totp and POST /user/me/totp/confirm) until they enable it.",
+		Tags:    []string{"admin"},
+		Request: mfaPolicyRequest{},
+		Responses: map[int]openapi.Response{
+			http.StatusOK:                    {Description: "Roles", Body: mfaPolicyResponse{}},
+			http.StatusBadRequest:            badRequest,
+			http.StatusRequestEntityTooLarge: tooLarge,
+			http.StatusUnsupportedMediaType:  unsupportedMedia,
+			http.StatusUnauthorized:          unauthenticated,
+			http.StatusForbidden:             adminOnly,
+			http.StatusUnprocessableEntity:   invalidFields,
+		},
+	},
+
+	// Events
+	"GET /events": {
+		Summary: "Stream the changes of the catalogue",
+		Description: "Server-Sent Events stream of the events of the movies and of the favourites of the user (of every user for admins). " +
+			"Each event has its ID, its type as the event name and the JSON of the event as data. Clients resume after the last event received " +
+			"with the Last-Event-ID header (or the last_event_id parameter); if it is too old a " + streamReset + " event is sent first. " +
+			"Idle connections get a comment every 15 seconds. Clients that do not keep up are disconnected and should reconnect.",
+		Tags: []string{"events"},
+		Query: []openapi.Parameter{
+			{Name: "types", Description: "Comma separated event types (all by default): " + strings.Join(events.Types, ", ")},
+			{Name: "movie", Description: "Only the events of the movie with this ID", Schema: &openapi.Schema{Type: "integer"}},
+			{Name: "last_event_id", Description: "ID of the last event received, for clients that can not set the Last-Event-ID header"},
+		},
+		Responses: map[int]openapi.Response{
+			http.StatusOK:           {Description: "Event stream", Content: map[string]*openapi.MediaType{"text/event-stream": {Schema: &openapi.Schema{Type: "string"}}}},
+			http.StatusBadRequest:   badRequest,
+			http.StatusUnauthorized: unauthenticated,
+		},
+	},
+
+	// Webhooks
+	"GET /webhooks": {
+		Summary: "Get the webhooks of the user",
+		Tags:    []string{"webhooks"},
+		Responses: map[int]openapi.Response{
+			http.StatusOK:           {Description: "Webhooks", Body: []models.Webhook{}},
+			http.StatusUnauthorized: unauthenticated,
+		},
+	},
+	"POST /webhook": {
+		Summary:     "Register a webhook",
+		Description: "The URL must use https outside development. The secret to verify the signatures of the deliveries is only returned here.",
+		Tags:        []string{"webhooks"},
+		Request:     webhookRequest{},
+		Responses: map[int]openapi.Response{
+			http.StatusOK:                    {Description: "New webhook", Body: newWebhookResponse{}},
+			http.StatusBadRequest:            badRequest,
+			http.StatusRequestEntityTooLarge: tooLarge,
+			http.StatusUnsupportedMediaType:  unsupportedMedia,
+			http.StatusUnauthorized:          unauthenticated,
+			http.StatusUnprocessableEntity:   invalidFields,
+		},
+	},
+	"GET /webhook/:id": {
+		Summary: "Get a webhook",
+		Tags:    []string{"webhooks"},
+		Responses: map[int]openapi.Response{
+			http.StatusOK:           {Description: "Webhook", Body: models.Webhook{}},
+			http.StatusUnauthorized: unauthenticated,
+			http.StatusNotFound:     notFound,
+		},
+	},
+	"PUT /webhook/:id": {
+		Summary: "Update a webhook",
+		Tags:    []string{"webhooks"},
+		Request: webhookUpdateRequest{},
+		Responses: map[int]openapi.Response{
+			http.StatusOK:                    okResponse,
+			http.StatusBadRequest:            badRequest,
+			http.StatusRequestEntityTooLarge: tooLarge,
+			http.StatusUnsupportedMediaType:  unsupportedMedia,
+			http.StatusUnauthorized:          unauthenticated,
+			http.StatusNotFound:              notFound,
+			http.StatusUnprocessableEntity:   invalidFields,
+		},
+	},
+	"DELETE /webhook/:id": {
+		Summary: "Delete a webhook and its deliveries",
+		Tags:    []string{"webhooks"},
+		Responses: map[int]openapi.Response{
+			http.StatusOK:           okResponse,
+			http.StatusUnauthorized: unauthenticated,
+			http.StatusNotFound:     notFound,
+		},
+	},
+	"GET /webhook/:id/deliveries": {
+		Summary: "Get the latest deliveries of a webhook",
+		Tags:    []string{"webhooks"},
+		Responses: map[int]openapi.Response{
+			http.StatusOK:           {Description: "Deliveries, newest first", Body: []models.WebhookDelivery{}},
+			http.StatusUnauthorized: unauthenticated,
+			http.StatusNotFound:     notFound,
+		},
+	},
+	"POST /webhook/:id/deliveries/:delivery/redeliver": {
+		Summary: "Send a delivery again",
+		Tags:    []string{"webhooks"},
+		Responses: map[int]openapi.Response{
+			http.StatusOK:           {Description: "New delivery", Body: models.WebhookDelivery{}},
+			http.StatusUnauthorized: unauthenticated,
+			http.StatusNotFound:     notFound,
+			http.StatusConflict:     textResponse("The webhook is disabled"),
+		},
+	},
+
+	// Documentation
+	"GET /openapi.json": {
+		Summary:  "OpenAPI document",
+		Tags:     []string{"docs"},
+		Security: openapi.AuthNone,
+		Responses: map[int]openapi.Response{
+			http.StatusOK: {Description: "OpenAPI 3 document of the API", Content: map[string]*openapi.MediaType{"application/json": {Schema: &openapi.Schema{Type: "object"}}}},
+		},
+	},
+	"GET /docs": {
+		Summary:  "Swagger UI",
+		Tags:     []string{"docs"},
+		Security: openapi.AuthNone,
+		Responses: map[int]openapi.Response{
+			http.StatusOK: {Description: "HTML page", Content: map[string]*openapi.MediaType{"text/html": {Schema: &openapi.Schema{Type: "string"}}}},
+		},
+	},
+}
+
+var (
+	spec     *openapi.Document
+	specJSON []byte
+	specOnce sync.Once
+)
+
+// apiSpec returns the OpenAPI document of the API, built from apiDocs on the first call
+func apiSpec() (*openapi.Document, []byte) {
+	specOnce.Do(func() {
+		generator := openapi.NewGenerator(apiInfo, apiTags...)
+
+		// The export schema is referenced by name in the response content
+		generator.Schema(movieRecord{})
+
+		for route, op := range apiDocs {
+			method, path := splitRoute(route)
+			generator.Add(openapi.Route{Method: method, Path: path, Operation: op})
+		}
+
+		spec = generator.Document()
+
+		// The event types of the webhooks are checked by checkWebhookEvents
+		for _, request := range []interface{}{webhookRequest{}, webhookUpdateRequest{}} {
+			name := strings.TrimPrefix(generator.Schema(request).Ref, "#/components/schemas/")
+			spec.Components.Schemas[name].Properties["events"].Items.Enum = events.Types
+		}
+
+		var err error
+		specJSON, err = json.MarshalIndent(spec, "", "  ")
+		if err != nil {
+			panic(err)
+		}
+	})
+
+	return spec, specJSON
+}
+
+func (app *application) getOpenAPI(w http.ResponseWriter, r *http.Request) {
+	_, document := apiSpec()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(document)
+}
+
+func (app *application) getDocs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(swaggerPage)
+}
+
+// validateRequest checks the request against the operation documented for the
+// route before calling the handler. Invalid requests get the field errors
+// like the handlers send them.
+func (app *application) validateRequest(method, path string, next http.Handler) http.Handler {
+	document, _ := apiSpec()
+	requiresAuth := apiDocs[method+" "+path].Security == openapi.AuthRequired
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Anonymous requests to protected routes are rejected by the handler
+		if requiresAuth && !app.isAuthenticated(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		errs, err := document.ValidateRequest(method, path, r)
+		if err != nil {
+			app.clientError(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		if len(errs) > 0 {
+			var v validator.Validator
+			for field, message := range errs {
+				v.AddFieldMessage(field, message)
+			}
+
+			app.failedValidation(w, r, v)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// imageUpload documents the upload of a poster or backdrop
+func imageUpload(kind string) openapi.Operation {
+	limits := imageKinds[kind].limits
+
+	var sizes []string
+	for name, width := range imageKinds[kind].thumbnails {
+		sizes = append(sizes, fmt.Sprintf("%s (%dpx)", name, width))
+	}
+	sort.Strings(sizes)
+
+	return openapi.Operation{
+		Summary: "Upload the " + kind + " of a movie",
+		Description: fmt.Sprintf("Replaces the %s of the movie with a JPEG, PNG or WebP image of %dx%d to %dx%d pixels and up to %d MB. "+
+			"JPEG thumbnails are made for the widths smaller than the image: %s. Only the user who created the movie can change it.",
+			kind, limits.MinWidth, limits.MinHeight, limits.MaxWidth, limits.MaxHeight, maxImageSize>>20, strings.Join(sizes, ", ")),
+		Tags: []string{"movies"},
+		RequestBody: &openapi.RequestBody{
+			Required: true,
+			Content: map[string]*openapi.MediaType{
+				"multipart/form-data": {Schema: &openapi.Schema{
+					Type:       "object",
+					Required:   []string{"image"},
+					Properties: map[string]*openapi.Schema{"image": {Type: "string", Format: "binary"}},
+				}},
+			},
+		},
+		Responses: map[int]openapi.Response{
+			http.StatusOK:                    {Description: "The new " + kind, Body: models.Image{}},
+			http.StatusBadRequest:            badRequest,
+			http.StatusUnauthorized:          unauthenticated,
+			http.StatusForbidden:             forbidden,
+			http.StatusNotFound:              notFound,
+			http.StatusRequestEntityTooLarge: tooLarge,
+			http.StatusUnsupportedMediaType:  textResponse("The body is not sent as multipart/form-data"),
+			http.StatusUnprocessableEntity:   invalidFields,
+		},
+	}
+}
+
+// withHeaders merges the headers of a response with the common ones
+func withHeaders(common, headers map[string]*openapi.Header) map[string]*openapi.Header {
+	for name, header := range common {
+		headers[name] = header
+	}
+	return headers
+}
+
+func textResponse(description string) openapi.Response {
+	return openapi.Response{
+		Description: description,
+		Content:     map[string]*openapi.MediaType{"text/plain": {Schema: &openapi.Schema{Type: "string"}}},
+	}
+}
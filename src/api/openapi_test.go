@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"films-api.rdelgado.es/pkg/client"
+)
+
+func TestOpenAPIDocumentsEveryRoute(t *testing.T) {
+	app := &application{}
+	document, _ := apiSpec()
+
+	registered := map[string]bool{}
+	for _, route := range app.router().routes {
+		registered[route] = true
+
+		method, path := splitRoute(route)
+		if document.Operation(method, path) == nil {
+			t.Errorf("route %s is not documented in apiDocs", route)
+		}
+	}
+
+	for route := range apiDocs {
+		if !registered[route] {
+			t.Errorf("apiDocs documents %s, which is not registered in routes()", route)
+		}
+	}
+}
+
+func TestOpenAPIEndpoints(t *testing.T) {
+	_, server := newTestServer(t)
+
+	res, err := http.Get(server.URL + "/openapi.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	var document struct {
+		OpenAPI    string
+		Paths      map[string]map[string]json.RawMessage
+		Components struct {
+			Schemas map[string]struct {
+				Properties map[string]json.RawMessage
+			}
+		}
+	}
+	if err := json.NewDecoder(res.Body).Decode(&document); err != nil {
+		t.Fatalf("decoding document: %v", err)
+	}
+
+	if document.OpenAPI == "" || document.Paths["/movie/{id}"]["get"] == nil {
+		t.Errorf("got document without GET /movie/{id}: %+v", document.Paths)
+	}
+
+	// The cast is sent in the stringArray key
+	if _, ok := document.Components.Schemas["movieRequest"].Properties["stringArray"]; !ok {
+		t.Errorf("movieRequest schema: got %v, want a stringArray property", document.Components.Schemas["movieRequest"])
+	}
+
+	res, err = http.Get(server.URL + "/docs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusOK || !strings.HasPrefix(res.Header.Get("Content-Type"), "text/html") {
+		t.Errorf("docs page: got %d %s", res.StatusCode, res.Header.Get("Content-Type"))
+	}
+}
+
+func TestOpenAPIValidation(t *testing.T) {
+	app, server := newTestServer(t)
+	app.validateRequests = true
+	server.Config.Handler = app.routes()
+
+	c := client.New(server.URL, client.WithCredentials("test1", testPassword))
+
+	tests := []struct {
+		name  string
+		route string
+		body  string
+		field string
+	}{
+		{"wrong type", "/movie", `{"Title": 12}`, "Title"},
+		{"case insensitive keys", "/movie", `{"releasedate": "15/12/1995"}`, "ReleaseDate"},
+		{"list items", "/movie", `{"stringArray": ["Al Pacino", 3]}`, "stringArray[1]"},
+		{"enum", "/list", `{"name": "Heists", "visibility": "friends"}`, "visibility"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodPost, server.URL+tt.route, strings.NewReader(tt.body))
+			req.Header.Set("Authorization", "Bearer "+token(t, c))
+
+			res, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+
+			var errs map[string]string
+			json.NewDecoder(res.Body).Decode(&errs)
+
+			if res.StatusCode != http.StatusUnprocessableEntity || errs[tt.field] == "" {
+				t.Errorf("got %d %v, want 422 with an error for %s", res.StatusCode, errs, tt.field)
+			}
+		})
+	}
+
+	// Valid requests reach the handler
+	if _, err := c.CreateList(context.Background(), client.ListInput{Name: "Heists", Visibility: client.ListPublic}); err != nil {
+		t.Errorf("valid request: %v", err)
+	}
+
+	// Anonymous requests are rejected before validation
+	res, err := http.Post(server.URL+"/movie", "application/json", strings.NewReader(`{"Title": 12}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("anonymous request: got %d, want %d", res.StatusCode, http.StatusUnauthorized)
+	}
+}
+
+// token logs the client in and returns its access token
+func token(t *testing.T, c *client.Client) string {
+	t.Helper()
+
+	if c.Token() == "" {
+		if _, err := c.MyLists(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return c.Token()
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"films-api.rdelgado.es/pkg/client"
+	"films-api.rdelgado.es/src/internals/models"
+)
+
+// The tokens are on their own line in the messages
+var mailTokenRX = regexp.MustCompile(`\n\n(\S+)\n\n`)
+
+// mailToken waits for the nth message (from 1) sent to an address and returns its token
+func mailToken(t *testing.T, app *application, to string, n int) string {
+	t.Helper()
+
+	mailer := app.mailer.(*testMailer)
+	waitFor(t, "the email to "+to, func() bool { return len(mailer.Messages(to)) >= n })
+
+	msg := mailer.Messages(to)[n-1]
+	match := mailTokenRX.FindStringSubmatch(msg.Body)
+	if match == nil {
+		t.Fatalf("no token in the email %q", msg.Body)
+	}
+
+	return match[1]
+}
+
+func TestVerifyEmail(t *testing.T) {
+	app, server := newTestServer(t)
+	ctx := context.Background()
+
+	c := client.New(server.URL, client.WithCredentials("test1", testPassword))
+	other := client.New(server.URL, client.WithCredentials("test2", testPassword))
+
+	var apiErr *client.Error
+	if _, err := c.SetEmail(ctx, "Test <test1@example.com>"); !errors.As(err, &apiErr) || apiErr.Fields["email"] == "" {
+		t.Errorf("setting an invalid address: got %v", err)
+	}
+
+	profile, err := c.SetEmail(ctx, "test1@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if profile.Email == nil || *profile.Email != "test1@example.com" || profile.EmailVerified {
+		t.Errorf("profile with a new address: got %+v", profile)
+	}
+
+	if _, err := other.SetEmail(ctx, "test1@example.com"); !errors.Is(err, models.ErrDuplicatedEntry) {
+		t.Errorf("setting the address of another user: got %v, want %v", err, models.ErrDuplicatedEntry)
+	}
+
+	// Tokens sent to a replaced address are not valid
+	first := mailToken(t, app, "test1@example.com", 1)
+	if _, err := c.SetEmail(ctx, "new@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.VerifyEmail(ctx, first); !errors.As(err, &apiErr) || apiErr.Fields["token"] == "" {
+		t.Errorf("verifying a replaced address: got %v", err)
+	}
+
+	token := mailToken(t, app, "new@example.com", 1)
+	if err := c.VerifyEmail(ctx, token); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.VerifyEmail(ctx, token); !errors.As(err, &apiErr) || apiErr.Fields["token"] == "" {
+		t.Errorf("using a token twice: got %v", err)
+	}
+
+	profile, err = c.Me(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !profile.EmailVerified {
+		t.Errorf("profile with a verified address: got %+v", profile)
+	}
+
+	// Only the hashes of the tokens are stored
+	var stored int64
+	app.users.DB.Model(&models.OneTimeToken{}).Where("hash = ?", token).Count(&stored)
+	if stored != 0 {
+		t.Errorf("token stored in clear")
+	}
+}
+
+func TestPasswordReset(t *testing.T) {
+	app, server := newTestServer(t)
+	ctx := context.Background()
+
+	c := client.New(server.URL, client.WithCredentials("test1", testPassword))
+	if err := c.Login(ctx, "test1", testPassword); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.SetEmail(ctx, "test1@example.com"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Unverified addresses do not get reset tokens, and the response does not tell
+	anonymous := client.New(server.URL)
+	if err := anonymous.ForgotPassword(ctx, "test1@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if err := anonymous.ForgotPassword(ctx, "unknown@example.com"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.VerifyEmail(ctx, mailToken(t, app, "test1@example.com", 1)); err != nil {
+		t.Fatal(err)
+	}
+	if err := anonymous.ForgotPassword(ctx, "test1@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	token := mailToken(t, app, "test1@example.com", 2)
+
+	var apiErr *client.Error
+	if err := anonymous.ResetPassword(ctx, "not-a-token", "N3w.password"); !errors.As(err, &apiErr) || apiErr.Fields["token"] == "" {
+		t.Errorf("resetting with a wrong token: got %v", err)
+	}
+	if err := anonymous.ResetPassword(ctx, token, "weak"); !errors.As(err, &apiErr) || apiErr.Fields["new_password"] == "" {
+		t.Errorf("resetting to a weak password: got %v", err)
+	}
+
+	if err := anonymous.ResetPassword(ctx, token, "N3w.password"); err != nil {
+		t.Fatal(err)
+	}
+	if err := anonymous.ResetPassword(ctx, token, "Other.passw0rd"); !errors.As(err, &apiErr) || apiErr.Fields["token"] == "" {
+		t.Errorf("using a reset token twice: got %v", err)
+	}
+
+	// The sessions of the user are revoked
+	if _, err := client.New(server.URL, client.WithToken(c.Token())).Me(ctx); !errors.Is(err, models.ErrInvalidCredentials) {
+		t.Errorf("session before the reset: got %v, want %v", err, models.ErrInvalidCredentials)
+	}
+	if err := client.New(server.URL).Login(ctx, "test1", "N3w.password"); err != nil {
+		t.Errorf("logging in with the new password: %v", err)
+	}
+
+	// Expired tokens are not valid
+	if err := anonymous.ForgotPassword(ctx, "test1@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	expired := mailToken(t, app, "test1@example.com", 3)
+	app.users.DB.Model(&models.OneTimeToken{}).Where("used_at IS NULL").Update("expires_at", time.Now().Add(-time.Minute))
+	if err := anonymous.ResetPassword(ctx, expired, "Other.passw0rd"); !errors.As(err, &apiErr) || apiErr.Fields["token"] == "" {
+		t.Errorf("resetting with an expired token: got %v", err)
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"films-api.rdelgado.es/src/internals/i18n"
+)
+
+// Maximum size of the request bodies, unless the route sets another in bodySizes
+const defaultMaxBodySize = 1 << 20
+
+// requestError is a problem with the body of a request. It is sent to the
+// client with its own status and message.
+type requestError struct {
+	status  int
+	message i18n.Message
+	err     error
+}
+
+func (e *requestError) Error() string {
+	if e.err != nil {
+		return e.In(i18n.Fallback) + ": " + e.err.Error()
+	}
+
+	return e.In(i18n.Fallback)
+}
+
+// In translates the message to a locale, including the name of the JSON type
+// of type errors
+func (e *requestError) In(locale string) string {
+	params := i18n.Params{}
+	for name, value := range e.message.Params {
+		params[name] = value
+	}
+	if key, exists := params["type"]; exists {
+		params["type"] = i18n.T(locale, key, nil)
+	}
+
+	return i18n.T(locale, e.message.Key, params)
+}
+
+func (e *requestError) Unwrap() error {
+	return e.err
+}
+
+func newRequestError(status int, key string, params i18n.Params, err error) *requestError {
+	return &requestError{status: status, message: i18n.NewMessage(key, params), err: err}
+}
+
+// readJSON decodes the body of a request into dst. The body must be a single
+// JSON value sent as application/json, no larger than the limit of the route,
+// and without fields missing from dst. Errors are *requestError with a
+// message for the client.
+func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst any) error {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != "application/json" {
+		return newRequestError(http.StatusUnsupportedMediaType, "request.content_type", i18n.Params{"type": "application/json"}, err)
+	}
+
+	if _, limited := r.Context().Value(maxBodySizeContextKey).(int64); !limited {
+		r.Body = http.MaxBytesReader(w, r.Body, defaultMaxBodySize)
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(dst); err != nil {
+		return decodeError(err, dst)
+	}
+
+	// Anything after the value is rejected, including a second value
+	if err := decoder.Decode(&struct{}{}); !errors.Is(err, io.EOF) {
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			return decodeError(err, dst)
+		}
+
+		return newRequestError(http.StatusBadRequest, "request.multiple_values", nil, err)
+	}
+
+	return nil
+}
+
+// decodeError converts an error of encoding/json into a request error with
+// the field and offset of the problem
+func decodeError(err error, dst any) *requestError {
+	var (
+		syntaxError    *json.SyntaxError
+		typeError      *json.UnmarshalTypeError
+		maxBytesError  *http.MaxBytesError
+		invalidUnmarsh *json.InvalidUnmarshalError
+	)
+
+	switch {
+	case errors.As(err, &syntaxError):
+		return newRequestError(http.StatusBadRequest, "request.syntax", i18n.Params{"offset": strconv.FormatInt(syntaxError.Offset, 10)}, err)
+
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return newRequestError(http.StatusBadRequest, "request.truncated", nil, err)
+
+	case errors.Is(err, io.EOF):
+		return newRequestError(http.StatusBadRequest, "request.empty", nil, err)
+
+	case errors.As(err, &typeError):
+		field := typeError.Field
+		if field == "" {
+			field = "body"
+		}
+
+		return newRequestError(http.StatusBadRequest, "request.type", i18n.Params{
+			"field":  field,
+			"type":   jsonType(typeError.Type),
+			"offset": strconv.FormatInt(typeError.Offset, 10),
+		}, err)
+
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		field := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+		return newRequestError(http.StatusBadRequest, "request.unknown_field", i18n.Params{"field": field, "fields": jsonFields(dst)}, err)
+
+	case errors.As(err, &maxBytesError):
+		return newRequestError(http.StatusRequestEntityTooLarge, "request.too_large", i18n.Params{"size": strconv.FormatInt(maxBytesError.Limit, 10)}, err)
+
+	case errors.As(err, &invalidUnmarsh):
+		// The handler passed something that is not a pointer
+		panic(err)
+	}
+
+	return newRequestError(http.StatusBadRequest, "error.bad_request", nil, err)
+}
+
+// jsonType is the message key of the JSON type a Go type is decoded from
+func jsonType(t reflect.Type) string {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return "request.type.string"
+	case reflect.Bool:
+		return "request.type.boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "request.type.number"
+	case reflect.Slice, reflect.Array:
+		return "request.type.array"
+	}
+
+	return "request.type.object"
+}
+
+// jsonFields lists the JSON names of the fields of a struct, to help clients with typos
+func jsonFields(dst any) string {
+	t := reflect.TypeOf(dst)
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return ""
+	}
+
+	var fields []string
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if !field.IsExported() || name == "-" || field.Anonymous && name == "" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		fields = append(fields, name)
+	}
+
+	return strings.Join(fields, ", ")
+}
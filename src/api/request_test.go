@@ -0,0 +1,77 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"films-api.rdelgado.es/pkg/client"
+)
+
+func TestReadJSON(t *testing.T) {
+	_, server := newTestServer(t)
+
+	c := client.New(server.URL, client.WithCredentials("test1", testPassword))
+
+	tests := []struct {
+		name        string
+		route       string
+		contentType string
+		body        string
+		status      int
+		message     string
+	}{
+		{"unknown field", "/movie", "application/json", `{"Title": "Heat", "cast": ["Al Pacino"]}`, http.StatusBadRequest, "cast is not a valid field, expected one of: Title, Director, ReleaseDate, stringArray, Genre, Synopsis"},
+		{"trailing garbage", "/movie", "application/json", `{"Title": "Heat"} garbage`, http.StatusBadRequest, "The request body must contain a single JSON value"},
+		{"multiple values", "/favourite", "application/json", `{"movie_id": 1}{"movie_id": 2}`, http.StatusBadRequest, "The request body must contain a single JSON value"},
+		{"wrong type", "/movie", "application/json", `{"Director": "Michael Mann", "Title": 12}`, http.StatusBadRequest, "Title must be a string at offset 40"},
+		{"string for a number", "/favourite", "application/json", `{"movie_id": "1"}`, http.StatusBadRequest, "movie_id must be a number at offset 16"},
+		{"malformed", "/movie", "application/json", `{"Title": "Heat",}`, http.StatusBadRequest, "The request body has malformed JSON at offset 18"},
+		{"truncated", "/movie", "application/json", `{"Title": "Heat"`, http.StatusBadRequest, "The request body is not complete JSON"},
+		{"empty", "/movie", "application/json", ``, http.StatusBadRequest, "The request body cannot be empty"},
+		{"content type", "/movie", "text/plain", `{"Title": "Heat"}`, http.StatusUnsupportedMediaType, "The request body must be sent as application/json"},
+		{"too large", "/user/login", "application/json", `{"name": "` + strings.Repeat("a", 5000) + `"}`, http.StatusRequestEntityTooLarge, "The request body must not be larger than 4096 bytes"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodPost, server.URL+tt.route, strings.NewReader(tt.body))
+			req.Header.Set("Authorization", "Bearer "+token(t, c))
+			req.Header.Set("Content-Type", tt.contentType)
+
+			res, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+
+			body, _ := io.ReadAll(res.Body)
+			if got := strings.TrimSpace(string(body)); res.StatusCode != tt.status || got != tt.message {
+				t.Errorf("got %d %q, want %d %q", res.StatusCode, got, tt.status, tt.message)
+			}
+		})
+	}
+}
+
+func TestReadJSONLocalized(t *testing.T) {
+	_, server := newTestServer(t)
+
+	c := client.New(server.URL, client.WithCredentials("test1", testPassword))
+
+	req, _ := http.NewRequest(http.MethodPost, server.URL+"/movie", strings.NewReader(`{"Title": 12}`))
+	req.Header.Set("Authorization", "Bearer "+token(t, c))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept-Language", "es")
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	body, _ := io.ReadAll(res.Body)
+	if got, want := strings.TrimSpace(string(body)), "Title debe ser un texto en la posición 12"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -2,12 +2,94 @@ package main
 
 import (
 	"net/http"
+	"strings"
 
+	"films-api.rdelgado.es/src/internals/models"
 	"github.com/julienschmidt/httprouter"
 )
 
+// router is an httprouter that keeps the method and path of every route, so
+// they can be checked against the OpenAPI document
+type router struct {
+	*httprouter.Router
+	routes []string
+
+	// validate wraps the handlers with the OpenAPI request validation
+	validate func(method, path string, handler http.Handler) http.Handler
+
+	// maxBodySize limits the size of the request bodies
+	maxBodySize func(limit int64, handler http.Handler) http.Handler
+}
+
+// Maximum size of the request bodies of the routes that do not use defaultMaxBodySize
+var bodySizes = map[string]int64{
+	"POST /movies/import":               50 << 20,
+	"POST /movie/:id/poster":            maxImageSize,
+	"POST /movie/:id/backdrop":          maxImageSize,
+	"POST /user/signup":                 4 << 10,
+	"POST /user/login":                  4 << 10,
+	"POST /user/me/password":            4 << 10,
+	"PUT /user/me/email":                4 << 10,
+	"POST /user/email/verify":           4 << 10,
+	"POST /user/password/forgot":        4 << 10,
+	"POST /user/password/reset":         4 << 10,
+	"POST /user/login/mfa":              4 << 10,
+	"POST /user/me/totp/confirm":        4 << 10,
+	"DELETE /user/me/totp":              4 << 10,
+	"POST /user/me/totp/recovery-codes": 4 << 10,
+}
+
+// Cache-Control of the routes that can be revalidated with their ETag. The
+// other routes of logged in users are not stored at all.
+var cacheControls = map[string]string{
+	"GET /movies":    "private, no-cache",
+	"GET /movie/:id": "private, no-cache",
+}
+
+func (rt *router) Handler(method, path string, handler http.Handler) {
+	rt.routes = append(rt.routes, method+" "+path)
+
+	if value, exists := cacheControls[method+" "+path]; exists {
+		handler = cacheControl(value, handler)
+	}
+
+	if rt.validate != nil {
+		handler = rt.validate(method, path, handler)
+	}
+
+	// The limit goes first so the validation does not read bodies over it
+	if rt.maxBodySize != nil {
+		limit, exists := bodySizes[method+" "+path]
+		if !exists {
+			limit = defaultMaxBodySize
+		}
+		handler = rt.maxBodySize(limit, handler)
+	}
+
+	rt.Router.Handler(method, path, handler)
+}
+
+// cacheControl sets the Cache-Control of the responses of a route
+func cacheControl(value string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", value)
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (rt *router) HandlerFunc(method, path string, handler http.HandlerFunc) {
+	rt.Handler(method, path, handler)
+}
+
 func (app *application) routes() http.Handler {
-	router := httprouter.New()
+	return app.recoverPanic(app.requestID(app.logRequest(app.authenticate(app.logResponse(app.compress(app.router()))))))
+}
+
+func (app *application) router() *router {
+	router := &router{Router: httprouter.New(), maxBodySize: app.maxBodySize}
+	if app.validateRequests {
+		router.validate = app.validateRequest
+	}
 
 	/*router.NotFound = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		app.clientError(w, r, "Not found")
@@ -19,15 +101,92 @@ func (app *application) routes() http.Handler {
 	router.Handler(http.MethodGet, "/movie/:id", app.requireAuthentication(app.getMovie))
 	router.Handler(http.MethodDelete, "/movie/:id", app.requireAuthentication(app.deleteMovie))
 	router.Handler(http.MethodPut, "/movie/:id", app.requireAuthentication(app.updateMovie))
+	router.Handler(http.MethodPost, "/movie/:id/restore", app.requireAuthentication(app.restoreMovie))
+	router.Handler(http.MethodGet, "/trash", app.requireAuthentication(app.getTrash))
+	router.Handler(http.MethodPost, "/movies/import", app.requireAuthentication(app.importMovies))
+	router.Handler(http.MethodGet, "/movies/export", app.requireAuthentication(app.exportMovies))
+	router.Handler(http.MethodPost, "/movie/:id/poster", app.requireAuthentication(app.uploadMovieImage(models.ImagePoster)))
+	router.Handler(http.MethodPost, "/movie/:id/backdrop", app.requireAuthentication(app.uploadMovieImage(models.ImageBackdrop)))
+
+	// Movie images (public, their URLs are in the movies)
+	router.HandlerFunc(http.MethodGet, "/images/*key", app.getImage)
 
 	// Favourites movies endpoints (auth required)
 	router.Handler(http.MethodPost, "/favourite", app.requireAuthentication(app.addMovieToFav))
 	router.Handler(http.MethodGet, "/favourites", app.requireAuthentication(app.getFavMovies))
 	router.Handler(http.MethodDelete, "/favourites/:id", app.requireAuthentication(app.deleteMovieFromFav))
 
+	// Movie lists endpoints (auth required to edit, public and unlisted lists can be read by anyone)
+	router.HandlerFunc(http.MethodGet, "/lists/public", app.getPublicLists)
+	router.Handler(http.MethodGet, "/lists", app.requireAuthentication(app.getMyLists))
+	router.Handler(http.MethodPost, "/list", app.requireAuthentication(app.addList))
+	router.HandlerFunc(http.MethodGet, "/list/:id", app.getList)
+	router.Handler(http.MethodPut, "/list/:id", app.requireAuthentication(app.updateList))
+	router.Handler(http.MethodDelete, "/list/:id", app.requireAuthentication(app.deleteList))
+	router.Handler(http.MethodPut, "/list/:id/order", app.requireAuthentication(app.reorderList))
+	router.Handler(http.MethodPost, "/list/:id/items", app.requireAuthentication(app.addListItem))
+	router.Handler(http.MethodPut, "/list/:id/items/:item", app.requireAuthentication(app.updateListItem))
+	router.Handler(http.MethodDelete, "/list/:id/items/:item", app.requireAuthentication(app.deleteListItem))
+
+	// Admin endpoints (admin role required)
+	router.Handler(http.MethodGet, "/admin/audit", app.requireAdmin(app.getAuditLog))
+	router.Handler(http.MethodGet, "/admin/mfa", app.requireAdmin(app.getMFAPolicy))
+	router.Handler(http.MethodPut, "/admin/mfa", app.requireAdmin(app.setMFAPolicy))
+	router.Handler(http.MethodGet, "/admin/cache", app.requireAdmin(app.getCacheStats))
+
+	// Event stream (auth required)
+	router.Handler(http.MethodGet, "/events", app.requireAuthentication(app.getEvents))
+
+	// Webhooks endpoints (auth required)
+	router.Handler(http.MethodGet, "/webhooks", app.requireAuthentication(app.getWebhooks))
+	router.Handler(http.MethodPost, "/webhook", app.requireAuthentication(app.addWebhook))
+	router.Handler(http.MethodGet, "/webhook/:id", app.requireAuthentication(app.getWebhook))
+	router.Handler(http.MethodPut, "/webhook/:id", app.requireAuthentication(app.updateWebhook))
+	router.Handler(http.MethodDelete, "/webhook/:id", app.requireAuthentication(app.deleteWebhook))
+	router.Handler(http.MethodGet, "/webhook/:id/deliveries", app.requireAuthentication(app.getWebhookDeliveries))
+	router.Handler(http.MethodPost, "/webhook/:id/deliveries/:delivery/redeliver", app.requireAuthentication(app.redeliverWebhook))
+
 	// Authentication endpoints
 	router.HandlerFunc(http.MethodPost, "/user/signup", app.userSignup)
 	router.HandlerFunc(http.MethodPost, "/user/login", app.userLogin)
+	router.HandlerFunc(http.MethodPost, "/user/login/mfa", app.userLoginMFA)
+	router.HandlerFunc(http.MethodGet, "/user/oidc/login", app.oidcLogin)
+	router.HandlerFunc(http.MethodGet, "/user/oidc/callback", app.oidcCallback)
+	router.Handler(http.MethodPost, "/user/token/refresh", app.requireAuthentication(app.userRefreshToken))
+	router.HandlerFunc(http.MethodPost, "/user/email/verify", app.verifyEmail)
+	router.HandlerFunc(http.MethodPost, "/user/password/forgot", app.forgotPassword)
+	router.HandlerFunc(http.MethodPost, "/user/password/reset", app.resetPassword)
+
+	// Account of the user (auth required). The profile and the enrolment in
+	// two-factor authentication do not need it enabled when the role requires it.
+	router.Handler(http.MethodGet, "/user/me", app.requireLogin(app.getMe))
+	router.Handler(http.MethodPatch, "/user/me", app.requireAuthentication(app.updateMe))
+	router.Handler(http.MethodPost, "/user/me/password", app.requireAuthentication(app.changePassword))
+	router.Handler(http.MethodPut, "/user/me/email", app.requireAuthentication(app.setEmail))
+	router.Handler(http.MethodDelete, "/user/me", app.requireAuthentication(app.deleteMe))
+	router.Handler(http.MethodGet, "/user/me/export", app.requireAuthentication(app.exportMe))
+	router.Handler(http.MethodGet, "/user/me/export/:id", app.requireAuthentication(app.getExport))
+	router.Handler(http.MethodGet, "/user/me/export/:id/download", app.requireAuthentication(app.downloadExport))
+	router.Handler(http.MethodPost, "/user/me/totp", app.requireLogin(app.startTOTP))
+	router.Handler(http.MethodPost, "/user/me/totp/confirm", app.requireLogin(app.confirmTOTP))
+	router.Handler(http.MethodDelete, "/user/me/totp", app.requireAuthentication(app.disableTOTP))
+	router.Handler(http.MethodPost, "/user/me/totp/recovery-codes", app.requireAuthentication(app.regenerateRecoveryCodes))
+	router.Handler(http.MethodGet, "/user/me/identities", app.requireAuthentication(app.getIdentities))
+	router.Handler(http.MethodPost, "/user/me/identities", app.requireAuthentication(app.linkIdentity))
+	router.Handler(http.MethodDelete, "/user/me/identities/:id", app.requireAuthentication(app.unlinkIdentity))
+	router.Handler(http.MethodGet, "/user/sessions", app.requireAuthentication(app.getSessions))
+	router.Handler(http.MethodDelete, "/user/sessions", app.requireAuthentication(app.deleteSessions))
+	router.Handler(http.MethodDelete, "/user/sessions/:id", app.requireAuthentication(app.deleteSession))
+
+	// API documentation
+	router.HandlerFunc(http.MethodGet, "/openapi.json", app.getOpenAPI)
+	router.HandlerFunc(http.MethodGet, "/docs", app.getDocs)
+
+	return router
+}
 
-	return app.recoverPanic(app.logRequest(app.authenticate(app.logResponse(router))))
+// splitRoute splits "GET /movie/:id" into the method and path
+func splitRoute(route string) (string, string) {
+	method, path, _ := strings.Cut(route, " ")
+	return method, path
 }
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"films-api.rdelgado.es/src/internals/cache"
+	"films-api.rdelgado.es/src/internals/models"
+	"github.com/julienschmidt/httprouter"
+)
+
+// Time an active session is trusted without checking the database. Sessions
+// deleted by another instance of the API keep working for up to this long.
+const sessionCacheTTL = time.Minute
+
+// Most sessions kept in the cache
+const sessionCacheSize = 10000
+
+type sessionResponse struct {
+	ID         uint
+	CreatedAt  time.Time
+	LastSeenAt time.Time `doc:"Updated at most once a minute"`
+	ExpiresAt  time.Time
+	UserAgent  string
+	IP         string
+	Current    bool `doc:"Whether it is the session of the token of the request"`
+}
+
+// sessionCache remembers the active sessions, which are checked in every
+// authenticated request
+type sessionCache struct {
+	sessions *models.SessionModel
+
+	// User of each active session
+	active *cache.LRU[string, int]
+}
+
+func newSessionCache(sessions *models.SessionModel) *sessionCache {
+	return &sessionCache{sessions: sessions, active: cache.New[string, int](sessionCacheSize, sessionCacheTTL)}
+}
+
+// Active reports if the session of the user is active. The database, which
+// records when the session was last seen, is checked once per sessionCacheTTL.
+func (c *sessionCache) Active(key string, userId int) (bool, error) {
+	if cached, found := c.active.Get(key); found && cached == userId {
+		return true, nil
+	}
+
+	active, err := c.sessions.Touch(key, userId, time.Now())
+	if err != nil || !active {
+		c.active.Delete(key)
+		return false, err
+	}
+
+	c.active.Set(key, userId)
+	return true, nil
+}
+
+// Forget removes the deleted sessions from the cache
+func (c *sessionCache) Forget(keys ...string) {
+	for _, key := range keys {
+		c.active.Delete(key)
+	}
+}
+
+func (c *sessionCache) Stats() cache.Stats {
+	return c.active.Stats()
+}
+
+func (app *application) getSessions(w http.ResponseWriter, r *http.Request) {
+	userId := r.Context().Value(userIdContextKey).(int)
+	current, _ := r.Context().Value(sessionContextKey).(string)
+
+	sessions, err := app.sessions.GetAll(userId)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	response := make([]sessionResponse, 0, len(sessions))
+	for _, session := range sessions {
+		response = append(response, sessionResponse{
+			ID:         session.ID,
+			CreatedAt:  session.CreatedAt,
+			LastSeenAt: session.LastSeenAt,
+			ExpiresAt:  session.ExpiresAt,
+			UserAgent:  session.UserAgent,
+			IP:         session.IP,
+			Current:    session.Key == current,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// deleteSession logs a device of the user out
+func (app *application) deleteSession(w http.ResponseWriter, r *http.Request) {
+	userId := r.Context().Value(userIdContextKey).(int)
+
+	params := httprouter.ParamsFromContext(r.Context())
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil || id < 1 {
+		app.NotFound(w, r)
+		return
+	}
+
+	session, err := app.sessions.Delete(id, userId)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.activeSessions.Forget(session.Key)
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// deleteSessions logs the user out everywhere, including the device of the request
+func (app *application) deleteSessions(w http.ResponseWriter, r *http.Request) {
+	userId := r.Context().Value(userIdContextKey).(int)
+
+	keys, err := app.sessions.WithContext(r.Context()).DeleteAll(userId)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.activeSessions.Forget(keys...)
+	app.forgetUser(r, userId)
+
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"films-api.rdelgado.es/pkg/client"
+	"films-api.rdelgado.es/src/internals/models"
+)
+
+// loginFrom logs the user in from a device with the user agent and returns the token
+func loginFrom(t *testing.T, serverURL, name, userAgent string) string {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodPost, serverURL+"/user/login", strings.NewReader(`{"name":"`+name+`","password":"`+testPassword+`"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", userAgent)
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	token, found := strings.CutPrefix(res.Header.Get("Authorization"), "Bearer ")
+	if res.StatusCode != http.StatusOK || !found {
+		t.Fatalf("logging in: got status %d", res.StatusCode)
+	}
+
+	return token
+}
+
+func TestSessions(t *testing.T) {
+	app, server := newTestServer(t)
+	ctx := context.Background()
+
+	phone := client.New(server.URL, client.WithToken(loginFrom(t, server.URL, "test1", "Phone/1.0")))
+	laptop := client.New(server.URL, client.WithCredentials("test1", testPassword))
+
+	sessions, err := laptop.Sessions(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 2 || !sessions[0].Current || sessions[1].Current {
+		t.Fatalf("sessions: got %+v", sessions)
+	}
+	if sessions[1].UserAgent != "Phone/1.0" || sessions[1].IP != "127.0.0.1" {
+		t.Errorf("session of the phone: got %+v", sessions[1])
+	}
+
+	// Refreshing the token keeps the session
+	if err := laptop.RefreshToken(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if refreshed, err := laptop.Sessions(ctx); err != nil || len(refreshed) != 2 || refreshed[0].ID != sessions[0].ID {
+		t.Errorf("sessions after a refresh: got %+v (%v)", refreshed, err)
+	}
+
+	// Other users cannot log the devices out
+	other := client.New(server.URL, client.WithCredentials("test2", testPassword))
+	if err := other.DeleteSession(ctx, int(sessions[1].ID)); !errors.Is(err, models.ErrNoRecord) {
+		t.Errorf("deleting a session of another user: got %v, want %v", err, models.ErrNoRecord)
+	}
+
+	if _, err := phone.Me(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := laptop.DeleteSession(ctx, int(sessions[1].ID)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := phone.Me(ctx); !errors.Is(err, models.ErrInvalidCredentials) {
+		t.Errorf("using the token of a deleted session: got %v, want %v", err, models.ErrInvalidCredentials)
+	}
+	if err := laptop.DeleteSession(ctx, int(sessions[1].ID)); !errors.Is(err, models.ErrNoRecord) {
+		t.Errorf("deleting a session twice: got %v, want %v", err, models.ErrNoRecord)
+	}
+
+	// Tokens issued before the sessions are revoked when logging out everywhere
+	user, err := app.users.GetByName("test1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacy, err := app.tokens.CreateToken(int(user.ID), user.TokenVersion, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := client.New(server.URL, client.WithToken(legacy))
+	if _, err := old.Me(ctx); err != nil {
+		t.Fatalf("using a token without a session: %v", err)
+	}
+
+	tablet := client.New(server.URL, client.WithToken(loginFrom(t, server.URL, "test1", "Tablet/1.0")))
+
+	if err := laptop.LogoutEverywhere(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if laptop.Token() != "" {
+		t.Errorf("token kept after logging out everywhere")
+	}
+	for name, c := range map[string]*client.Client{"tablet": tablet, "token without a session": old} {
+		if _, err := c.Me(ctx); !errors.Is(err, models.ErrInvalidCredentials) {
+			t.Errorf("%s after logging out everywhere: got %v, want %v", name, err, models.ErrInvalidCredentials)
+		}
+	}
+
+	// The revocation is audited like any other change of the user
+	entries, _, err := app.audit.GetPage(models.AuditFilter{Entity: models.EntityUser, EntityID: int(user.ID)}, 0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Action != models.AuditUpdate || entries[0].ActorID == nil || *entries[0].ActorID != user.ID {
+		t.Fatalf("audit entries after logging out everywhere: got %+v", entries)
+	}
+	if change := entries[0].Changes["TokenVersion"]; change.Before != float64(user.TokenVersion) || change.After != float64(user.TokenVersion+1) {
+		t.Errorf("token version in the audit entry: got %+v", change)
+	}
+
+	// Changing the password ends the other sessions too
+	if err := other.ChangePassword(ctx, testPassword, "N3w.password"); err != nil {
+		t.Fatal(err)
+	}
+	if sessions, err := other.Sessions(ctx); err != nil || len(sessions) != 1 || !sessions[0].Current {
+		t.Errorf("sessions after changing the password: got %+v (%v)", sessions, err)
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"films-api.rdelgado.es/src/internals/authentication"
+	"films-api.rdelgado.es/src/internals/cache"
+	"films-api.rdelgado.es/src/internals/compress"
+	"films-api.rdelgado.es/src/internals/export"
+	"films-api.rdelgado.es/src/internals/mail"
+	"films-api.rdelgado.es/src/internals/models"
+	"films-api.rdelgado.es/src/internals/outbox"
+	"films-api.rdelgado.es/src/internals/seed"
+	"films-api.rdelgado.es/src/internals/storage"
+	"films-api.rdelgado.es/src/internals/stream"
+	"films-api.rdelgado.es/src/internals/trash"
+	"films-api.rdelgado.es/src/internals/webhooks"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// Password of the users in the development fixtures
+const testPassword = "Test.1234"
+
+// newTestServer starts the API on an in-memory SQLite database seeded with the
+// development fixtures. Each test gets its own database.
+func newTestServer(t *testing.T) (*application, *httptest.Server) {
+	t.Helper()
+
+	dsn := "file:" + strings.ReplaceAll(t.Name(), "/", "_") + "?mode=memory&cache=shared&_pragma=foreign_keys(1)"
+
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{
+		TranslateError: true,
+		Logger:         logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := migrate(db); err != nil {
+		t.Fatal(err)
+	}
+
+	blobs, err := storage.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	hooks := &models.WebhookModel{DB: db}
+
+	// Deliveries are retried quickly so the tests do not wait, and sent to the
+	// receivers of the tests in the same machine
+	dispatcher := webhooks.New(hooks, logger)
+	dispatcher.Client = webhooks.NewClient(true)
+	dispatcher.Backoff = 10 * time.Millisecond
+	dispatcher.PollInterval = 10 * time.Millisecond
+
+	broker := stream.New(streamLogSize, streamBufferSize)
+
+	users := &models.UserModel{DB: db}
+	userCache := newUserCache(users, userCacheSize, userCacheTTL, nil, logger)
+
+	events := outbox.New(&models.OutboxModel{DB: db}, outbox.Sinks{userCache, dispatcher, broker}, logger)
+	events.PollInterval = 10 * time.Millisecond
+	events.Backoff = 10 * time.Millisecond
+
+	movies := &models.MovieModel{DB: db, Blobs: blobs, TrashRetention: 30 * 24 * time.Hour}
+	exports := &models.ExportModel{DB: db}
+
+	exporter := export.New(exports, blobs, logger)
+	exporter.PollInterval = 10 * time.Millisecond
+
+	sessions := &models.SessionModel{DB: db}
+
+	app := &application{
+		logger:  logger,
+		movies:  movies,
+		users:   users,
+		favs:    &models.FavouriteModel{DB: db},
+		lists:   &models.ListModel{DB: db},
+		hooks:   hooks,
+		audit:   &models.AuditModel{DB: db},
+		exports: exports,
+		tokens:  &authentication.JwtToken{SecretJwt: []byte("test-secret")},
+		blobs:   blobs,
+
+		sessions:       sessions,
+		activeSessions: newSessionCache(sessions),
+		userCache:      userCache,
+
+		catalogue:      &models.CatalogueModel{DB: db},
+		movieResponses: cache.New[string, cachedResponse](100, movieResponsesTTL),
+
+		webhooks: dispatcher,
+		outbox:   events,
+		stream:   broker,
+		trash:    trash.New(movies, logger),
+		exporter: exporter,
+		mailer:   &testMailer{},
+		mfa:      newMFAPolicy(&models.SettingsModel{DB: db}),
+
+		identities:    &models.IdentityModel{DB: db},
+		oidcProvision: true,
+
+		compressor: compress.New(compressMinSize, nil, compressEncodings...),
+
+		// The receivers of the tests use http
+		insecureWebhooks: true,
+	}
+
+	set, err := seed.LoadDir("../../fixtures", "development")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := seedFixtures(db, app.logger, set, "development"); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go dispatcher.Run(ctx)
+	go events.Run(ctx)
+	go exporter.Run(ctx)
+
+	server := httptest.NewServer(app.routes())
+	t.Cleanup(func() {
+		cancel()
+		server.Close()
+
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	return app, server
+}
+
+// testMailer keeps the messages sent by the API
+type testMailer struct {
+	mu       sync.Mutex
+	messages []mail.Message
+}
+
+func (m *testMailer) Send(ctx context.Context, msg mail.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+// Messages returns the messages sent to an address
+func (m *testMailer) Messages(to string) []mail.Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var sent []mail.Message
+	for _, msg := range m.messages {
+		if msg.To == to {
+			sent = append(sent, msg)
+		}
+	}
+
+	return sent
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image/color"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"films-api.rdelgado.es/pkg/client"
+	"films-api.rdelgado.es/src/internals/models"
+)
+
+func TestTrash(t *testing.T) {
+	app, server := newTestServer(t)
+	ctx := context.Background()
+
+	c := client.New(server.URL, client.WithCredentials("test1", testPassword))
+	other := client.New(server.URL, client.WithCredentials("test2", testPassword))
+
+	id, err := c.CreateMovie(ctx, client.MovieInput{
+		Title: "Heat", Director: "Michael Mann", ReleaseDate: time.Date(1995, 12, 15, 0, 0, 0, 0, time.UTC),
+		Cast: []string{"Al Pacino"}, Genre: "Crime", Synopsis: "A group of professional bank robbers.",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	poster, err := c.UploadPoster(ctx, id, "heat.png", bytes.NewReader(testPNG(t, 400, 600, color.Black)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	favId, err := other.AddFavourite(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	listId, err := other.CreateList(ctx, client.ListInput{Name: "Crime"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.AddListItem(ctx, listId, id, "Best heist"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.DeleteMovie(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+
+	// Deleted movies and their dependents are hidden
+	if _, err := c.Movie(ctx, id); !errors.Is(err, models.ErrNoRecord) {
+		t.Errorf("getting a deleted movie: got %v, want %v", err, models.ErrNoRecord)
+	}
+	if err := c.UpdateMovie(ctx, id, client.MovieInput{Genre: "Thriller"}); !errors.Is(err, models.ErrNoRecord) {
+		t.Errorf("updating a deleted movie: got %v, want %v", err, models.ErrNoRecord)
+	}
+	favourites, err := other.Favourites(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, favourite := range favourites {
+		if favourite.ID == uint(favId) {
+			t.Errorf("favourite of a deleted movie is listed")
+		}
+	}
+	list, err := other.List(ctx, listId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Items) != 0 {
+		t.Errorf("items of the list: got %d, want 0", len(list.Items))
+	}
+
+	// Titles stay taken while the movie is in the trash
+	if _, err := c.CreateMovie(ctx, client.MovieInput{
+		Title: "Heat", Director: "Michael Mann", ReleaseDate: time.Date(1995, 12, 15, 0, 0, 0, 0, time.UTC),
+		Cast: []string{"Al Pacino"}, Genre: "Crime", Synopsis: "A group of professional bank robbers.",
+	}); !errors.Is(err, models.ErrDuplicatedEntry) {
+		t.Errorf("creating a movie with the title of a deleted one: got %v, want %v", err, models.ErrDuplicatedEntry)
+	}
+
+	trash, err := c.Trash(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trash) != 1 || trash[0].Movie.ID != uint(id) || trash[0].Movie.DeletedAt == nil ||
+		!trash[0].PurgeAt.Equal(trash[0].Movie.DeletedAt.Add(app.movies.TrashRetention)) {
+		t.Fatalf("trash: got %+v", trash)
+	}
+	if trash, err := other.Trash(ctx); err != nil || len(trash) != 0 {
+		t.Errorf("trash of another user: got %v %v", trash, err)
+	}
+
+	// Only the creator can restore it
+	if _, err := other.RestoreMovie(ctx, id); !errors.Is(err, models.ErrNotAuthorized) {
+		t.Errorf("restoring the movie of another user: got %v, want %v", err, models.ErrNotAuthorized)
+	}
+	if _, err := c.RestoreMovie(ctx, 1); !errors.Is(err, models.ErrNoRecord) {
+		t.Errorf("restoring a movie not in the trash: got %v, want %v", err, models.ErrNoRecord)
+	}
+
+	movie, err := c.RestoreMovie(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if movie.Title != "Heat" || movie.DeletedAt != nil || movie.Poster == nil || movie.Poster.URL != poster.URL {
+		t.Errorf("restored movie: got %+v", movie)
+	}
+
+	// The favourites and list items are back
+	favourites, err = other.Favourites(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, favourite := range favourites {
+		found = found || favourite.ID == uint(favId)
+	}
+	if !found {
+		t.Errorf("favourite of the restored movie is not listed")
+	}
+	if list, err := other.List(ctx, listId); err != nil || len(list.Items) != 1 {
+		t.Errorf("items of the list: got %v %v", list, err)
+	}
+	if trash, err := c.Trash(ctx); err != nil || len(trash) != 0 {
+		t.Errorf("trash after restoring: got %v %v", trash, err)
+	}
+
+	entries, _, err := app.audit.GetPage(models.AuditFilter{Entity: models.EntityMovie, EntityID: id}, 0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entries[0].Action != models.AuditRestore || entries[0].Changes["DeletedAt"].After != nil {
+		t.Errorf("audit of the restore: got %+v", entries[0])
+	}
+
+	// Movies are purged with their dependents once the retention is over
+	if err := c.DeleteMovie(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+
+	if purged, err := app.trash.Purge(ctx, time.Now()); err != nil || purged != 0 {
+		t.Fatalf("purging before the retention: got %d %v", purged, err)
+	}
+	if purged, err := app.trash.Purge(ctx, time.Now().Add(app.movies.TrashRetention+time.Second)); err != nil || purged != 1 {
+		t.Fatalf("purging after the retention: got %d %v", purged, err)
+	}
+
+	if trash, err := c.Trash(ctx); err != nil || len(trash) != 0 {
+		t.Errorf("trash after purging: got %v %v", trash, err)
+	}
+	if _, err := c.RestoreMovie(ctx, id); !errors.Is(err, models.ErrNoRecord) {
+		t.Errorf("restoring a purged movie: got %v, want %v", err, models.ErrNoRecord)
+	}
+
+	var favs, items int64
+	app.movies.DB.Unscoped().Model(&models.Favourite{}).Where("movie_id = ?", id).Count(&favs)
+	app.movies.DB.Unscoped().Model(&models.ListItem{}).Where("movie_id = ?", id).Count(&items)
+	if favs != 0 || items != 0 {
+		t.Errorf("dependents of the purged movie: got %d favourites and %d list items", favs, items)
+	}
+
+	res, err := http.Get(server.URL + poster.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusNotFound {
+		t.Errorf("poster of the purged movie: got status %d", res.StatusCode)
+	}
+
+	// The title can be used again
+	if _, err := c.CreateMovie(ctx, client.MovieInput{
+		Title: "Heat", Director: "Michael Mann", ReleaseDate: time.Date(1995, 12, 15, 0, 0, 0, 0, time.UTC),
+		Cast: []string{"Al Pacino"}, Genre: "Crime", Synopsis: "A group of professional bank robbers.",
+	}); err != nil {
+		t.Errorf("creating a movie with the title of a purged one: %v", err)
+	}
+}
+
+func TestTrashedTitles(t *testing.T) {
+	app, server := newTestServer(t)
+	ctx := context.Background()
+
+	c := client.New(server.URL, client.WithCredentials("test1", testPassword))
+
+	heat := client.MovieInput{
+		Title: "Heat", Director: "Michael Mann", ReleaseDate: time.Date(1995, 12, 15, 0, 0, 0, 0, time.UTC),
+		Cast: []string{"Al Pacino"}, Genre: "Crime", Synopsis: "A group of professional bank robbers.",
+	}
+	id, err := c.CreateMovie(ctx, heat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := c.CreateMovie(ctx, client.MovieInput{
+		Title: "Thief", Director: "Michael Mann", ReleaseDate: time.Date(1981, 3, 27, 0, 0, 0, 0, time.UTC),
+		Cast: []string{"James Caan"}, Genre: "Crime", Synopsis: "A safecracker.",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.DeleteMovie(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := app.movies.GetByTitle("Heat"); !errors.Is(err, models.ErrTitleInTrash) {
+		t.Errorf("getting a trashed title: got %v, want %v", err, models.ErrTitleInTrash)
+	}
+
+	// The conflicts say where the title is
+	if _, err := c.CreateMovie(ctx, heat); !errors.Is(err, models.ErrDuplicatedEntry) || !strings.Contains(err.Error(), "trash") {
+		t.Errorf("creating a movie with a trashed title: got %v", err)
+	}
+	if err := c.UpdateMovie(ctx, other, client.MovieInput{Title: "Heat"}); !errors.Is(err, models.ErrDuplicatedEntry) || !strings.Contains(err.Error(), "trash") {
+		t.Errorf("renaming a movie to a trashed title: got %v", err)
+	}
+
+	user, err := app.users.GetByName("test1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ndjson := `{"title":"Heat","director":"Michael Mann","release_date":"1995-12-15","cast":["Al Pacino"],"genre":"Crime","synopsis":"Imported."}` + "\n"
+
+	for _, onDuplicate := range []string{onDuplicateSkip, onDuplicateUpsert} {
+		for _, dryRun := range []bool{true, false} {
+			report, err := app.runMovieImport(ctx, strings.NewReader(ndjson), formatNDJSON, importOptions{onDuplicate: onDuplicate, dryRun: dryRun}, int(user.ID))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if report.Failed != 1 || len(report.Errors) != 1 || report.Errors[0].Error != models.ErrTitleInTrash.Error() {
+				t.Errorf("importing a trashed title (%s, dry run %v): got %+v", onDuplicate, dryRun, report)
+			}
+		}
+	}
+
+	// Once restored, the movie is a duplicate like any other
+	if _, err := c.RestoreMovie(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	report, err := app.runMovieImport(ctx, strings.NewReader(ndjson), formatNDJSON, importOptions{onDuplicate: onDuplicateSkip}, int(user.ID))
+	if err != nil || report.Skipped != 1 {
+		t.Errorf("importing a restored title: got %+v (%v)", report, err)
+	}
+	if _, err := c.CreateMovie(ctx, heat); !errors.Is(err, models.ErrDuplicatedEntry) || strings.Contains(err.Error(), "trash") {
+		t.Errorf("creating a movie with a taken title: got %v", err)
+	}
+}
@@ -5,45 +5,127 @@ import (
 	"errors"
 	"net/http"
 
+	"films-api.rdelgado.es/src/internals/audit"
+	"films-api.rdelgado.es/src/internals/authentication"
+	"films-api.rdelgado.es/src/internals/i18n"
 	"films-api.rdelgado.es/src/internals/models"
 	"films-api.rdelgado.es/src/internals/validator"
 )
 
 type userRequest struct {
-	Name                string `json:"name"`
-	Password            string `json:"password"`
+	Name                string `json:"name" validate:"required"`
+	Password            string `json:"password" validate:"required"`
+	validator.Validator `json:"-"`
+}
+
+// profileRequest has the fields users can change of their account
+type profileRequest struct {
+	Name                string `json:"name" validate:"required,username"`
+	validator.Validator `json:"-"`
+}
+
+// passwordRequest has the rules of signupRequest for the new password
+type passwordRequest struct {
+	CurrentPassword     string `json:"current_password" validate:"required"`
+	NewPassword         string `json:"new_password" validate:"required,min=8,max=24,password"`
+	validator.Validator `json:"-"`
+}
+
+// signupRequest has the rules for new users
+type signupRequest struct {
+	Name                string `json:"name" validate:"required,username"`
+	Password            string `json:"password" validate:"required,min=8,max=24,password"`
 	validator.Validator `json:"-"`
 }
 
 func (app *application) userLogin(w http.ResponseWriter, r *http.Request) {
 	var req userRequest
 
-	err := json.NewDecoder(r.Body).Decode(&req)
+	err := app.readJSON(w, r, &req)
 	if err != nil {
-		app.clientError(w, http.StatusBadRequest, err)
+		app.clientError(w, r, http.StatusBadRequest, err)
 		return
 	}
 
-	req.CheckField(validator.NoBlank(req.Name), "name", "This field must no be blank")
-	req.CheckField(validator.NoBlank(req.Password), "password", "This field must no be blank")
+	req.CheckStruct(req)
 
 	if !req.IsValid() {
-		w.WriteHeader(http.StatusUnprocessableEntity)
-		json.NewEncoder(w).Encode(req.FieldErrors)
+		app.failedValidation(w, r, req.Validator)
 		return
 	}
 
 	id, err := app.users.Authenticate(req.Name, req.Password)
 	if err != nil {
 		if errors.Is(err, models.ErrInvalidCredentials) {
-			app.clientError(w, http.StatusUnauthorized, err)
+			app.clientError(w, r, http.StatusUnauthorized, err)
 		} else {
 			app.serverError(w, r, err)
 		}
 		return
 	}
 
-	token, err := app.tokens.CreateToken(id)
+	user, err := app.users.Get(id)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// The users with two-factor authentication get the token after the code
+	if user.TOTPEnabledAt != nil {
+		app.sendMFAChallenge(w, r, user)
+		return
+	}
+
+	app.sendToken(w, r, id)
+}
+
+// userRefreshToken renews the token of the session of the request. Tokens
+// issued before the sessions get a new one.
+func (app *application) userRefreshToken(w http.ResponseWriter, r *http.Request) {
+	userId := r.Context().Value(userIdContextKey).(int)
+	session := r.Context().Value(sessionContextKey).(string)
+
+	if session == "" {
+		app.sendToken(w, r, userId)
+		return
+	}
+
+	err := app.sessions.Refresh(session, userId, authentication.TokenTTL)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.clientError(w, r, http.StatusUnauthorized, models.ErrInvalidToken)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.writeToken(w, r, userId, session)
+}
+
+// sendToken starts a session of the user on the device of the request and
+// responds with its token
+func (app *application) sendToken(w http.ResponseWriter, r *http.Request, userId int) {
+	actor, _ := audit.FromContext(r.Context())
+
+	session, err := app.sessions.Create(userId, r.UserAgent(), actor.IP, authentication.TokenTTL)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.writeToken(w, r, userId, session.Key)
+}
+
+// writeToken responds with a new token of the session in the Authorization header
+func (app *application) writeToken(w http.ResponseWriter, r *http.Request, userId int, session string) {
+	user, err := app.users.Get(userId)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	token, err := app.tokens.CreateToken(userId, user.TokenVersion, session)
 	if err != nil {
 		app.serverError(w, r, err)
 		return
@@ -55,31 +137,71 @@ func (app *application) userLogin(w http.ResponseWriter, r *http.Request) {
 
 func (app *application) userSignup(w http.ResponseWriter, r *http.Request) {
 
-	var req userRequest
+	var req signupRequest
+
+	err := app.readJSON(w, r, &req)
+	if err != nil {
+		app.clientError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	req.CheckStruct(req)
+
+	if !req.IsValid() {
+		app.failedValidation(w, r, req.Validator)
+		return
+	}
 
-	err := json.NewDecoder(r.Body).Decode(&req)
+	err = app.users.WithContext(r.Context()).Insert(req.Name, req.Password)
 	if err != nil {
-		app.clientError(w, http.StatusBadRequest, err)
+		if errors.Is(err, models.ErrDuplicatedEntry) {
+			app.clientError(w, r, http.StatusConflict, err)
+		} else {
+			app.serverError(w, r, err)
+		}
+
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (app *application) getMe(w http.ResponseWriter, r *http.Request) {
+	userId := r.Context().Value(userIdContextKey).(int)
+
+	user, err := app.users.Get(userId)
+	if err != nil {
+		app.serverError(w, r, err)
 		return
 	}
 
-	req.CheckField(validator.NoBlank(req.Name), "name", "This field must no be blank")
-	req.CheckField(validator.NoBlank(req.Password), "password", "This field must no be blank")
-	req.CheckField(validator.MinChars(req.Password, 8), "password", "Password must be 8 characters long")
-	req.CheckField(validator.MaxChars(req.Password, 24), "password", "Password must be less than 24 characters long")
-	req.CheckField(validator.Matches(req.Name, validator.UsernameRX), "name", "This field must start with a letter")
-	req.CheckField(validator.IsStrongPassword(req.Password), "password", "Password must contain all characters")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(user.Profile())
+}
+
+func (app *application) updateMe(w http.ResponseWriter, r *http.Request) {
+	userId := r.Context().Value(userIdContextKey).(int)
+
+	var req profileRequest
+
+	err := app.readJSON(w, r, &req)
+	if err != nil {
+		app.clientError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	req.CheckStruct(req)
 
 	if !req.IsValid() {
-		w.WriteHeader(http.StatusUnprocessableEntity)
-		json.NewEncoder(w).Encode(req.FieldErrors)
+		app.failedValidation(w, r, req.Validator)
 		return
 	}
 
-	err = app.users.Insert(req.Name, req.Password)
+	err = app.users.WithContext(r.Context()).Rename(userId, req.Name)
 	if err != nil {
 		if errors.Is(err, models.ErrDuplicatedEntry) {
-			app.clientError(w, http.StatusConflict, err)
+			app.clientError(w, r, http.StatusConflict, err)
 		} else {
 			app.serverError(w, r, err)
 		}
@@ -87,5 +209,58 @@ func (app *application) userSignup(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	app.getMe(w, r)
+}
+
+// changePassword sets a new password and revokes the other tokens of the
+// user. The response has a new token for the client that made the change.
+func (app *application) changePassword(w http.ResponseWriter, r *http.Request) {
+	userId := r.Context().Value(userIdContextKey).(int)
+
+	var req passwordRequest
+
+	err := app.readJSON(w, r, &req)
+	if err != nil {
+		app.clientError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	req.CheckStruct(req)
+
+	if !req.IsValid() {
+		app.failedValidation(w, r, req.Validator)
+		return
+	}
+
+	err = app.users.WithContext(r.Context()).ChangePassword(userId, req.CurrentPassword, req.NewPassword)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidCredentials) {
+			req.AddFieldMessage("current_password", i18n.NewMessage("validation.current_password", nil))
+			app.failedValidation(w, r, req.Validator)
+		} else {
+			app.serverError(w, r, err)
+		}
+
+		return
+	}
+
+	app.forgetUser(r, userId)
+
+	app.sendToken(w, r, userId)
+}
+
+// deleteMe deletes the account of the user (see UserModel.Delete)
+func (app *application) deleteMe(w http.ResponseWriter, r *http.Request) {
+	userId := r.Context().Value(userIdContextKey).(int)
+
+	err := app.users.WithContext(r.Context()).Delete(userId)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.forgetUser(r, userId)
+
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 }
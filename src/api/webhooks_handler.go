@@ -0,0 +1,283 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"films-api.rdelgado.es/src/internals/events"
+	"films-api.rdelgado.es/src/internals/i18n"
+	"films-api.rdelgado.es/src/internals/models"
+	"films-api.rdelgado.es/src/internals/validator"
+	"films-api.rdelgado.es/src/internals/webhooks"
+	"github.com/julienschmidt/httprouter"
+)
+
+// Deliveries returned by the delivery log
+const deliveryLogSize = 100
+
+type webhookRequest struct {
+	URL                 string   `json:"url" validate:"required,max=2000,url"`
+	Description         string   `json:"description" validate:"max=200"`
+	Events              []string `json:"events" validate:"required"`
+	validator.Validator `json:"-"`
+}
+
+// webhookUpdateRequest has the fields of webhookRequest, all of them optional
+type webhookUpdateRequest struct {
+	URL                 string   `json:"url" validate:"omitempty,max=2000,url"`
+	Description         *string  `json:"description" validate:"omitempty,max=200"`
+	Events              []string `json:"events"`
+	Active              *bool    `json:"active" doc:"Enabling a webhook resets its failures"`
+	validator.Validator `json:"-"`
+}
+
+// newWebhookResponse is the only response with the secret of the webhook
+type newWebhookResponse struct {
+	models.Webhook
+	Secret string `doc:"Key of the HMAC-SHA256 signatures of the deliveries"`
+}
+
+// checkWebhookURL requires https outside development, as the deliveries carry
+// the changes of the users
+func (app *application) checkWebhookURL(v *validator.Validator, value string) {
+	if app.insecureWebhooks || value == "" {
+		return
+	}
+
+	u, err := url.Parse(value)
+	v.CheckFieldMessage(err == nil && u.Scheme == "https", "url", i18n.NewMessage("validation.https", nil))
+}
+
+// checkWebhookEvents accepts the types of events.Types, the only list of the
+// events the webhooks can subscribe to
+func checkWebhookEvents(v *validator.Validator, types []string) {
+	for i, eventType := range types {
+		v.CheckFieldMessage(slices.Contains(events.Types, eventType), fmt.Sprintf("events[%d]", i),
+			i18n.NewMessage("validation.oneof", i18n.Params{"values": strings.Join(events.Types, ", ")}))
+	}
+}
+
+func (app *application) getWebhooks(w http.ResponseWriter, r *http.Request) {
+	userId := r.Context().Value(userIdContextKey).(int)
+
+	hooks, err := app.hooks.GetAll(userId)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(hooks)
+}
+
+func (app *application) addWebhook(w http.ResponseWriter, r *http.Request) {
+	userId := r.Context().Value(userIdContextKey).(int)
+
+	var req webhookRequest
+
+	err := app.readJSON(w, r, &req)
+	if err != nil {
+		app.clientError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	req.CheckStruct(req)
+	app.checkWebhookURL(&req.Validator, req.URL)
+	checkWebhookEvents(&req.Validator, req.Events)
+
+	if !req.IsValid() {
+		app.failedValidation(w, r, req.Validator)
+		return
+	}
+
+	hook := models.Webhook{
+		UserID:      uint(userId),
+		URL:         req.URL,
+		Description: req.Description,
+		Secret:      webhooks.NewSecret(),
+		Events:      req.Events,
+	}
+
+	err = app.hooks.Insert(&hook)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(newWebhookResponse{Webhook: hook, Secret: hook.Secret})
+}
+
+func (app *application) getWebhook(w http.ResponseWriter, r *http.Request) {
+	hook, ok := app.userWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(hook)
+}
+
+func (app *application) updateWebhook(w http.ResponseWriter, r *http.Request) {
+	var req webhookUpdateRequest
+
+	err := app.readJSON(w, r, &req)
+	if err != nil {
+		app.clientError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	req.CheckStruct(req)
+	app.checkWebhookURL(&req.Validator, req.URL)
+	checkWebhookEvents(&req.Validator, req.Events)
+
+	if !req.IsValid() {
+		app.failedValidation(w, r, req.Validator)
+		return
+	}
+
+	hook, ok := app.userWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	if validator.NoBlank(req.URL) {
+		hook.URL = req.URL
+	}
+
+	if req.Description != nil {
+		hook.Description = *req.Description
+	}
+
+	if validator.NoEmptyTextSlice(req.Events) {
+		hook.Events = req.Events
+	}
+
+	if req.Active != nil {
+		hook.Active = *req.Active
+	}
+
+	err = app.hooks.Update(hook)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+}
+
+func (app *application) deleteWebhook(w http.ResponseWriter, r *http.Request) {
+	userId := r.Context().Value(userIdContextKey).(int)
+
+	params := httprouter.ParamsFromContext(r.Context())
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil || id < 1 {
+		app.NotFound(w, r)
+		return
+	}
+
+	err = app.hooks.Delete(id, userId)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+}
+
+func (app *application) getWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	hook, ok := app.userWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	deliveries, err := app.hooks.Deliveries(int(hook.ID), deliveryLogSize)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(deliveries)
+}
+
+func (app *application) redeliverWebhook(w http.ResponseWriter, r *http.Request) {
+	hook, ok := app.userWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	params := httprouter.ParamsFromContext(r.Context())
+	deliveryId, err := strconv.Atoi(params.ByName("delivery"))
+	if err != nil || deliveryId < 1 {
+		app.NotFound(w, r)
+		return
+	}
+
+	delivery, err := app.hooks.GetDelivery(int(hook.ID), deliveryId)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	// Disabled webhooks would fail the delivery right away
+	if !hook.Active {
+		app.clientError(w, r, http.StatusConflict, models.ErrWebhookDisabled)
+		return
+	}
+
+	redelivery, err := app.webhooks.Redeliver(delivery)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(redelivery)
+}
+
+// userWebhook loads the webhook of the id parameter if it belongs to the
+// user. Otherwise it sends the error response and returns false.
+func (app *application) userWebhook(w http.ResponseWriter, r *http.Request) (models.Webhook, bool) {
+	userId := r.Context().Value(userIdContextKey).(int)
+
+	params := httprouter.ParamsFromContext(r.Context())
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil || id < 1 {
+		app.NotFound(w, r)
+		return models.Webhook{}, false
+	}
+
+	hook, err := app.hooks.Get(id, userId)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return models.Webhook{}, false
+	}
+
+	return hook, true
+}
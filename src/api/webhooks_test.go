@@ -0,0 +1,411 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"films-api.rdelgado.es/pkg/client"
+	"films-api.rdelgado.es/src/internals/events"
+	"films-api.rdelgado.es/src/internals/models"
+	"films-api.rdelgado.es/src/internals/validator"
+	"films-api.rdelgado.es/src/internals/webhooks"
+)
+
+// receiver is a webhook endpoint that records the events it receives
+type receiver struct {
+	*httptest.Server
+
+	mu     sync.Mutex
+	secret string
+	status int
+	events []events.Event
+	errors []error
+}
+
+func newReceiver(t *testing.T) *receiver {
+	rec := &receiver{status: http.StatusNoContent}
+
+	rec.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		rec.mu.Lock()
+		defer rec.mu.Unlock()
+
+		if err := webhooks.Verify(rec.secret, r.Header.Get(webhooks.HeaderSignature), body, time.Now(), time.Minute); err != nil {
+			rec.errors = append(rec.errors, err)
+		}
+
+		var event events.Event
+		if err := json.Unmarshal(body, &event); err != nil {
+			rec.errors = append(rec.errors, err)
+		}
+		if r.Header.Get(webhooks.HeaderEvent) != event.Type || r.Header.Get(webhooks.HeaderID) != event.ID {
+			rec.errors = append(rec.errors, errors.New("headers do not match the event"))
+		}
+
+		rec.events = append(rec.events, event)
+		w.WriteHeader(rec.status)
+	}))
+	t.Cleanup(rec.Close)
+
+	return rec
+}
+
+func (rec *receiver) setSecret(secret string) {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	rec.secret = secret
+}
+
+func (rec *receiver) setStatus(status int) {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	rec.status = status
+}
+
+// received returns the types of the events received, in order
+func (rec *receiver) received() []string {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	types := []string{}
+	for _, event := range rec.events {
+		types = append(types, event.Type)
+	}
+
+	return types
+}
+
+// waitFor polls cond until it is true or a second passes
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestWebhooks(t *testing.T) {
+	_, server := newTestServer(t)
+	ctx := context.Background()
+
+	c := client.New(server.URL, client.WithCredentials("test1", testPassword))
+	other := client.New(server.URL, client.WithCredentials("test2", testPassword))
+
+	rec := newReceiver(t)
+	hook, err := c.CreateWebhook(ctx, client.WebhookInput{URL: rec.URL, Events: events.Types})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(hook.Secret, "whsec_") || !hook.Active {
+		t.Fatalf("unexpected webhook: %+v", hook)
+	}
+	rec.setSecret(hook.Secret)
+
+	// Favourites of other users are private
+	otherRec := newReceiver(t)
+	otherHook, err := other.CreateWebhook(ctx, client.WebhookInput{URL: otherRec.URL, Events: []string{events.MovieCreated, events.FavouriteAdded}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherRec.setSecret(otherHook.Secret)
+
+	id, err := c.CreateMovie(ctx, client.MovieInput{
+		Title: "Heat", Director: "Michael Mann", ReleaseDate: time.Date(1995, 12, 15, 0, 0, 0, 0, time.UTC),
+		Cast: []string{"Al Pacino"}, Genre: "Crime", Synopsis: "A group of professional bank robbers.",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.UpdateMovie(ctx, id, client.MovieInput{Genre: "Thriller"}); err != nil {
+		t.Fatal(err)
+	}
+	favId, err := c.AddFavourite(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.RemoveFavourite(ctx, favId); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.DeleteMovie(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the events of each aggregate keep their order
+	want := []string{events.MovieCreated, events.MovieUpdated, events.MovieDeleted, events.FavouriteAdded, events.FavouriteRemoved}
+	waitFor(t, "the events", func() bool { return len(rec.received()) == len(want) })
+
+	got := rec.received()
+	sort.SliceStable(got, func(i, j int) bool {
+		return strings.HasPrefix(got[i], "movie.") && !strings.HasPrefix(got[j], "movie.")
+	})
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("events: got %v, want %v", rec.received(), want)
+	}
+
+	rec.mu.Lock()
+	var created events.Event
+	for _, event := range rec.events {
+		if event.Type == events.MovieCreated {
+			created = event
+		}
+	}
+	if len(rec.errors) > 0 {
+		t.Errorf("invalid deliveries: %v", rec.errors)
+	}
+	rec.mu.Unlock()
+
+	waitFor(t, "the events of the other user", func() bool { return len(otherRec.received()) == 1 })
+	if got := otherRec.received(); got[0] != events.MovieCreated {
+		t.Errorf("events of the other user: got %v", got)
+	}
+
+	if data, ok := created.Data.(map[string]interface{}); !ok || data["Title"] != "Heat" || created.UserID == 0 {
+		t.Errorf("movie.created event: got %+v", created)
+	}
+
+	deliveries, err := c.WebhookDeliveries(ctx, int(hook.ID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deliveries) != len(want) || deliveries[0].Status != models.DeliverySucceeded {
+		t.Errorf("deliveries: got %+v", deliveries)
+	}
+
+	// Redeliveries send the same event again
+	redelivery, err := c.RedeliverWebhook(ctx, int(hook.ID), int(deliveries[0].ID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if redelivery.EventID != deliveries[0].EventID || redelivery.RedeliveryOf == nil || *redelivery.RedeliveryOf != deliveries[0].ID {
+		t.Errorf("redelivery: got %+v", redelivery)
+	}
+	waitFor(t, "the redelivery", func() bool { return len(rec.received()) == len(want)+1 })
+
+	// Webhooks of other users are not found
+	if _, err := other.Webhook(ctx, int(hook.ID)); !errors.Is(err, models.ErrNoRecord) {
+		t.Errorf("webhook of another user: got %v, want %v", err, models.ErrNoRecord)
+	}
+	if _, err := other.WebhookDeliveries(ctx, int(hook.ID)); !errors.Is(err, models.ErrNoRecord) {
+		t.Errorf("deliveries of another user: got %v, want %v", err, models.ErrNoRecord)
+	}
+
+	var apiErr *client.Error
+	_, err = c.CreateWebhook(ctx, client.WebhookInput{URL: "ftp://example.com", Events: []string{"movie.watched"}})
+	if !errors.As(err, &apiErr) || apiErr.Fields["url"] == "" || apiErr.Fields["events[0]"] == "" {
+		t.Errorf("invalid webhook: got %v", err)
+	}
+
+	if err := c.DeleteWebhook(ctx, int(hook.ID)); err != nil {
+		t.Fatal(err)
+	}
+	if hooks, err := c.Webhooks(ctx); err != nil || len(hooks) != 0 {
+		t.Errorf("webhooks after deleting: got %v %v", hooks, err)
+	}
+}
+
+func TestWebhookFailures(t *testing.T) {
+	app, server := newTestServer(t)
+	ctx := context.Background()
+
+	app.webhooks.MaxAttempts = 2
+	app.webhooks.MaxFailures = 3
+
+	c := client.New(server.URL, client.WithCredentials("test1", testPassword))
+
+	rec := newReceiver(t)
+	rec.setStatus(http.StatusInternalServerError)
+
+	hook, err := c.CreateWebhook(ctx, client.WebhookInput{URL: rec.URL, Events: []string{events.FavouriteAdded}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec.setSecret(hook.Secret)
+
+	// Each delivery fails after two attempts, and the third failure disables the webhook
+	if _, err := c.AddFavourite(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.AddFavourite(ctx, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	waitFor(t, "the webhook to be disabled", func() bool {
+		hook, err := c.Webhook(ctx, int(hook.ID))
+		return err == nil && !hook.Active
+	})
+
+	deliveries, err := c.WebhookDeliveries(ctx, int(hook.ID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, delivery := range deliveries {
+		if delivery.Status != models.DeliveryFailed || delivery.ResponseStatus == http.StatusOK {
+			t.Errorf("delivery of a failing webhook: got %+v", delivery)
+		}
+	}
+
+	if _, err := c.RedeliverWebhook(ctx, int(hook.ID), int(deliveries[0].ID)); !errors.Is(err, models.ErrDuplicatedEntry) {
+		t.Errorf("redelivery to a disabled webhook: got %v, want a conflict", err)
+	}
+
+	// Enabling the webhook again resets the failures
+	rec.setStatus(http.StatusOK)
+	active := true
+	if err := c.UpdateWebhook(ctx, int(hook.ID), client.WebhookInput{Active: &active}); err != nil {
+		t.Fatal(err)
+	}
+
+	enabled, err := c.Webhook(ctx, int(hook.ID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !enabled.Active || enabled.Failures != 0 || enabled.DisabledAt != nil {
+		t.Errorf("enabled webhook: got %+v", enabled)
+	}
+
+	if _, err := c.RedeliverWebhook(ctx, int(hook.ID), int(deliveries[0].ID)); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the redelivery", func() bool {
+		deliveries, err := c.WebhookDeliveries(ctx, int(hook.ID))
+		return err == nil && deliveries[0].Status == models.DeliverySucceeded
+	})
+}
+
+// The events accepted by the requests are the ones published
+func TestWebhookEventTypes(t *testing.T) {
+	var v validator.Validator
+	checkWebhookEvents(&v, events.Types)
+	if !v.IsValid() {
+		t.Errorf("subscribing to every type: got %v", v.FieldErrors)
+	}
+
+	checkWebhookEvents(&v, []string{events.MovieCreated, "movie.purged"})
+	if _, invalid := v.FieldErrors["events[1]"]; len(v.FieldErrors) != 1 || !invalid {
+		t.Errorf("subscribing to an unknown type: got %v", v.FieldErrors)
+	}
+
+	// The documented types are the same
+	spec, _ := apiSpec()
+	for _, name := range []string{"webhookRequest", "webhookUpdateRequest"} {
+		if got := spec.Components.Schemas[name].Properties["events"].Items.Enum; !reflect.DeepEqual(got, events.Types) {
+			t.Errorf("%s events: got %v, want %v", name, got, events.Types)
+		}
+	}
+}
+
+func TestWebhookAddresses(t *testing.T) {
+	tests := []struct {
+		ip     string
+		public bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"fd00::1", false},
+		{"169.254.169.254", false},
+		{"fe80::1", false},
+		{"0.0.0.0", false},
+		{"::", false},
+		{"::ffff:127.0.0.1", false},
+		{"224.0.0.1", false},
+	}
+
+	for _, tt := range tests {
+		if got := webhooks.Public(netip.MustParseAddr(tt.ip)); got != tt.public {
+			t.Errorf("Public(%s): got %v, want %v", tt.ip, got, tt.public)
+		}
+	}
+
+	// The address is checked once the host is resolved
+	rec := newReceiver(t)
+	for _, url := range []string{rec.URL, strings.Replace(rec.URL, "127.0.0.1", "localhost", 1)} {
+		res, err := webhooks.NewClient(false).Post(url, "application/json", strings.NewReader("{}"))
+		if err == nil {
+			res.Body.Close()
+		}
+		if !errors.Is(err, webhooks.ErrPrivateAddress) {
+			t.Errorf("posting to %s: got %v, want %v", url, err, webhooks.ErrPrivateAddress)
+		}
+	}
+	if got := rec.received(); len(got) != 0 {
+		t.Errorf("events received by a private address: got %v", got)
+	}
+}
+
+func TestWebhookRedirects(t *testing.T) {
+	_, server := newTestServer(t)
+	ctx := context.Background()
+
+	c := client.New(server.URL, client.WithCredentials("test1", testPassword))
+
+	target := newReceiver(t)
+	redirect := httptest.NewServer(http.RedirectHandler(target.URL, http.StatusTemporaryRedirect))
+	t.Cleanup(redirect.Close)
+
+	hook, err := c.CreateWebhook(ctx, client.WebhookInput{URL: redirect.URL, Events: []string{events.FavouriteAdded}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.AddFavourite(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	// The redirect is the response of the endpoint
+	waitFor(t, "the failed attempt", func() bool {
+		deliveries, err := c.WebhookDeliveries(ctx, int(hook.ID))
+		return err == nil && len(deliveries) == 1 && deliveries[0].Attempts > 0
+	})
+
+	deliveries, _ := c.WebhookDeliveries(ctx, int(hook.ID))
+	if delivery := deliveries[0]; delivery.ResponseStatus != http.StatusTemporaryRedirect || delivery.Status == models.DeliverySucceeded {
+		t.Errorf("delivery to a redirect: got %+v", delivery)
+	}
+	if got := target.received(); len(got) != 0 {
+		t.Errorf("events received through a redirect: got %v", got)
+	}
+}
+
+func TestWebhookHTTPS(t *testing.T) {
+	app, server := newTestServer(t)
+	ctx := context.Background()
+
+	app.insecureWebhooks = false
+
+	c := client.New(server.URL, client.WithCredentials("test1", testPassword))
+
+	var apiErr *client.Error
+	_, err := c.CreateWebhook(ctx, client.WebhookInput{URL: "http://example.com/hook", Events: []string{events.MovieCreated}})
+	if !errors.As(err, &apiErr) || apiErr.Fields["url"] == "" {
+		t.Fatalf("http webhook: got %v", err)
+	}
+
+	hook, err := c.CreateWebhook(ctx, client.WebhookInput{URL: "https://example.com/hook", Events: []string{events.MovieCreated}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.UpdateWebhook(ctx, int(hook.ID), client.WebhookInput{URL: "http://example.com/hook"}); !errors.As(err, &apiErr) || apiErr.Fields["url"] == "" {
+		t.Errorf("changing to an http URL: got %v", err)
+	}
+}
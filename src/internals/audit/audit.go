@@ -0,0 +1,32 @@
+// Package audit carries who makes a request through the context, so the
+// models can record it in the audit log with the changes it makes.
+package audit
+
+import "context"
+
+// Actor is the origin of a change. Changes made without an actor (admin
+// commands, fixtures) are recorded as made by the system.
+type Actor struct {
+	// User who made the request, 0 if it is not authenticated
+	UserID int
+
+	RequestID string
+	IP        string
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx with the actor
+func NewContext(ctx context.Context, actor Actor) context.Context {
+	return context.WithValue(ctx, contextKey{}, actor)
+}
+
+// FromContext returns the actor of ctx, if it has one
+func FromContext(ctx context.Context) (Actor, bool) {
+	if ctx == nil {
+		return Actor{}, false
+	}
+
+	actor, ok := ctx.Value(contextKey{}).(Actor)
+	return actor, ok
+}
@@ -30,7 +30,40 @@ func (t *JwtToken) ExtractToken(r *http.Request) (string, error) {
 	return parts[1], nil
 }
 
-func (t *JwtToken) VerifyToken(tokenString string) (int, error) {
+// Scope of the tokens issued after the password of a user with two-factor
+// authentication, only valid to send the code
+const ScopeMFAPending = "mfa_pending"
+
+// Lifetime of the access tokens
+const TokenTTL = 24 * time.Hour
+
+// Lifetime of the mfa_pending tokens
+const MFATokenTTL = 5 * time.Minute
+
+// Claims are the claims of a valid token
+type Claims struct {
+	UserID int
+
+	// Tokens issued before the versions have version 0
+	Version int
+
+	// Key of the session of the access token, empty in the tokens issued
+	// before the sessions and in the mfa_pending tokens
+	Session string
+}
+
+// VerifyToken returns the claims of a valid access token
+func (t *JwtToken) VerifyToken(tokenString string) (Claims, error) {
+	return t.verify(tokenString, "")
+}
+
+// VerifyMFAToken is VerifyToken for the mfa_pending tokens
+func (t *JwtToken) VerifyMFAToken(tokenString string) (Claims, error) {
+	return t.verify(tokenString, ScopeMFAPending)
+}
+
+// verify checks the token has the scope, empty for the full access tokens
+func (t *JwtToken) verify(tokenString, scope string) (Claims, error) {
 
 	// TODO: Pasar el logger aqui
 	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
@@ -42,33 +75,72 @@ func (t *JwtToken) VerifyToken(tokenString string) (int, error) {
 
 	if err != nil {
 		if errors.Is(err, jwt.ErrTokenExpired) {
-			return 0, models.ErrTokenExpired
+			return Claims{}, models.ErrTokenExpired
 		} else {
-			return 0, err
+			return Claims{}, err
 		}
 	}
 
+	claims := token.Claims.(jwt.MapClaims)
+
 	// Check if token has key "user_id"
-	id, ok := token.Claims.(jwt.MapClaims)["user_id"]
+	id, ok := claims["user_id"]
 	if !ok {
-		return 0, models.ErrInvalidToken
+		return Claims{}, models.ErrInvalidToken
 	}
 
 	// Check user_id value is a number
 	user_id, ok := id.(float64)
 	if !ok {
-		return 0, models.ErrInvalidToken
+		return Claims{}, models.ErrInvalidToken
+	}
+
+	version := 0.0
+	if value, exists := claims["version"]; exists {
+		if version, ok = value.(float64); !ok {
+			return Claims{}, models.ErrInvalidToken
+		}
+	}
+
+	// Tokens of a scope are not valid for anything else
+	tokenScope, _ := claims["scope"].(string)
+	if tokenScope != scope {
+		return Claims{}, models.ErrInvalidToken
 	}
 
-	return int(user_id), nil
+	session, _ := claims["sid"].(string)
+
+	return Claims{UserID: int(user_id), Version: int(version), Session: session}, nil
 }
 
-func (t *JwtToken) CreateToken(id int) (string, error) {
+// CreateToken issues a token of the user for the session. Only the tokens
+// with the current version of the user are accepted, so increasing it revokes
+// the others.
+func (t *JwtToken) CreateToken(id, version int, session string) (string, error) {
 	claims := jwt.MapClaims{
 		"user_id": id,
-		"exp":     time.Now().Add(24 * time.Hour).Unix(),
+		"version": version,
+		"sid":     session,
+		"exp":     time.Now().Add(TokenTTL).Unix(),
 	}
 
+	return t.sign(claims)
+}
+
+// CreateMFAToken issues a short-lived token that can only be exchanged for
+// an access token along with a code of the second factor
+func (t *JwtToken) CreateMFAToken(id, version int) (string, error) {
+	claims := jwt.MapClaims{
+		"user_id": id,
+		"version": version,
+		"scope":   ScopeMFAPending,
+		"exp":     time.Now().Add(MFATokenTTL).Unix(),
+	}
+
+	return t.sign(claims)
+}
+
+func (t *JwtToken) sign(claims jwt.MapClaims) (string, error) {
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 
 	tokenString, err := token.SignedString(t.SecretJwt)
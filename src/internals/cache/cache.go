@@ -0,0 +1,153 @@
+// Package cache keeps values in memory for a while: an LRU holds up to a
+// number of entries, evicting the least recently used when it is full, and
+// each entry expires some time after it was set. It is safe for concurrent
+// use and counts its hits, misses and evictions.
+//
+// Deployments with several instances of the API can share values in a cache
+// such as Redis or Memcached by implementing Shared for its client.
+package cache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// Shared is a cache shared by the instances of the API, such as Redis or
+// Memcached. Implementations wrap the client of the cache; the API does not
+// depend on any.
+type Shared interface {
+	// Get returns the value of the key, and false if it is not cached
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+
+	// Set caches the value of the key for ttl
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+
+	Delete(ctx context.Context, key string) error
+}
+
+// Stats are the counters of a cache since it was created
+type Stats struct {
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+
+	// Entries in the cache, including the expired ones not evicted yet
+	Size int
+}
+
+// HitRate is the fraction of the lookups found in the cache
+func (s Stats) HitRate() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
+
+type entry[K comparable, V any] struct {
+	key     K
+	value   V
+	expires time.Time
+}
+
+// LRU is a cache of up to size entries that expire after ttl. It must be
+// created with New.
+type LRU[K comparable, V any] struct {
+	size int
+	ttl  time.Duration
+
+	// Replaced in the tests
+	now func() time.Time
+
+	mu      sync.Mutex
+	order   *list.List // most recently used first
+	entries map[K]*list.Element
+	stats   Stats
+}
+
+func New[K comparable, V any](size int, ttl time.Duration) *LRU[K, V] {
+	if size < 1 {
+		size = 1
+	}
+
+	return &LRU[K, V]{
+		size:    size,
+		ttl:     ttl,
+		now:     time.Now,
+		order:   list.New(),
+		entries: make(map[K]*list.Element),
+	}
+}
+
+// Get returns the value of the key, and false if it is not cached or has expired
+func (c *LRU[K, V]) Get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, exists := c.entries[key]
+	if !exists {
+		c.stats.Misses++
+		var zero V
+		return zero, false
+	}
+
+	e := element.Value.(*entry[K, V])
+	if !c.now().Before(e.expires) {
+		c.remove(element)
+		c.stats.Misses++
+		var zero V
+		return zero, false
+	}
+
+	c.order.MoveToFront(element)
+	c.stats.Hits++
+	return e.value, true
+}
+
+// Set caches the value of the key, evicting the least recently used entry if
+// the cache is full
+func (c *LRU[K, V]) Set(key K, value V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expires := c.now().Add(c.ttl)
+
+	if element, exists := c.entries[key]; exists {
+		e := element.Value.(*entry[K, V])
+		e.value, e.expires = value, expires
+		c.order.MoveToFront(element)
+		return
+	}
+
+	if c.order.Len() >= c.size {
+		c.remove(c.order.Back())
+		c.stats.Evictions++
+	}
+
+	c.entries[key] = c.order.PushFront(&entry[K, V]{key: key, value: value, expires: expires})
+}
+
+func (c *LRU[K, V]) Delete(key K) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, exists := c.entries[key]; exists {
+		c.remove(element)
+	}
+}
+
+func (c *LRU[K, V]) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := c.stats
+	stats.Size = c.order.Len()
+	return stats
+}
+
+func (c *LRU[K, V]) remove(element *list.Element) {
+	c.order.Remove(element)
+	delete(c.entries, element.Value.(*entry[K, V]).key)
+}
@@ -0,0 +1,99 @@
+package cache
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLRU(t *testing.T) {
+	c := New[string, int](2, time.Minute)
+
+	c.Set("a", 1)
+	c.Set("b", 2)
+
+	// a is used, so b is the least recently used
+	if value, found := c.Get("a"); !found || value != 1 {
+		t.Errorf("a: got %d, %t", value, found)
+	}
+	c.Set("c", 3)
+
+	if _, found := c.Get("b"); found {
+		t.Errorf("b not evicted")
+	}
+	for key, want := range map[string]int{"a": 1, "c": 3} {
+		if value, found := c.Get(key); !found || value != want {
+			t.Errorf("%s: got %d, %t, want %d", key, value, found, want)
+		}
+	}
+
+	c.Delete("a")
+	if _, found := c.Get("a"); found {
+		t.Errorf("a not deleted")
+	}
+
+	stats := c.Stats()
+	if stats.Hits != 3 || stats.Misses != 2 || stats.Evictions != 1 || stats.Size != 1 {
+		t.Errorf("stats: got %+v", stats)
+	}
+	if rate := stats.HitRate(); rate != 0.6 {
+		t.Errorf("hit rate: got %f, want 0.6", rate)
+	}
+}
+
+func TestLRUExpiry(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+
+	c := New[int, string](10, time.Minute)
+	c.now = func() time.Time { return now }
+
+	c.Set(1, "one")
+	now = now.Add(30 * time.Second)
+	c.Set(2, "two")
+
+	// Setting a key again renews it
+	c.Set(1, "uno")
+
+	now = now.Add(45 * time.Second)
+	if value, found := c.Get(1); !found || value != "uno" {
+		t.Errorf("renewed entry: got %q, %t", value, found)
+	}
+
+	now = now.Add(time.Minute)
+	if _, found := c.Get(2); found {
+		t.Errorf("expired entry found")
+	}
+	if size := c.Stats().Size; size != 1 {
+		t.Errorf("size after reading an expired entry: got %d, want 1", size)
+	}
+}
+
+func TestLRUConcurrency(t *testing.T) {
+	c := New[int, int](100, time.Minute)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				key := (i*1000 + j) % 150
+				if _, found := c.Get(key); !found {
+					c.Set(key, j)
+				}
+				if j%100 == 0 {
+					c.Delete(key)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	stats := c.Stats()
+	if stats.Size > 100 {
+		t.Errorf("size: got %d, want at most 100", stats.Size)
+	}
+	if stats.Hits+stats.Misses != 8000 {
+		t.Errorf("lookups: got %d, want 8000", stats.Hits+stats.Misses)
+	}
+}
@@ -0,0 +1,316 @@
+// Package compress compresses the HTTP responses with an encoding accepted by
+// the client in Accept-Encoding. Only the responses of the allowed content
+// types and larger than a minimum size are compressed; the smaller ones are
+// buffered until the size is known and sent as they are.
+//
+// Gzip, Brotli and Zstd are provided. Other encodings are added with an
+// Encoding whose writer satisfies Encoder.
+package compress
+
+import (
+	"compress/gzip"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Encoder compresses the bytes written to it. Flush sends what was written
+// so far, for streaming responses; Reset reuses it for another response.
+type Encoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+// Encoding is a content coding of Accept-Encoding and its encoder
+type Encoding struct {
+	Name       string
+	NewEncoder func(w io.Writer) Encoder
+}
+
+// Gzip is the gzip encoding with the default compression level
+var Gzip = Encoding{
+	Name: "gzip",
+	NewEncoder: func(w io.Writer) Encoder {
+		return gzip.NewWriter(w)
+	},
+}
+
+// Brotli is the br encoding with the default quality
+var Brotli = Encoding{
+	Name: "br",
+	NewEncoder: func(w io.Writer) Encoder {
+		return brotli.NewWriterLevel(w, brotli.DefaultCompression)
+	},
+}
+
+// Zstd is the zstd encoding with the default level. Each encoder compresses
+// in the goroutine of its response, without starting others.
+var Zstd = Encoding{
+	Name: "zstd",
+	NewEncoder: func(w io.Writer) Encoder {
+		// The options are fixed, so the writer never fails
+		encoder, _ := zstd.NewWriter(w, zstd.WithEncoderConcurrency(1), zstd.WithEncoderLevel(zstd.SpeedDefault))
+		return encoder
+	},
+}
+
+// DefaultTypes are the media types compressed if no others are given
+var DefaultTypes = []string{
+	"application/json",
+	"application/x-ndjson",
+	"text/csv",
+	"text/html",
+	"text/plain",
+}
+
+// Compressor is the middleware. Its encodings are in order of preference,
+// used when the client accepts several with the same quality.
+type Compressor struct {
+	encodings []Encoding
+	pools     map[string]*sync.Pool
+	minSize   int
+	types     map[string]bool
+}
+
+// New returns a compressor for the responses of the types of at least
+// minSize bytes. It uses DefaultTypes if types is empty, and Gzip if no
+// encodings are given.
+func New(minSize int, types []string, encodings ...Encoding) *Compressor {
+	if len(types) == 0 {
+		types = DefaultTypes
+	}
+	if len(encodings) == 0 {
+		encodings = []Encoding{Gzip}
+	}
+
+	c := &Compressor{
+		encodings: encodings,
+		pools:     make(map[string]*sync.Pool),
+		minSize:   minSize,
+		types:     make(map[string]bool),
+	}
+
+	for _, encoding := range encodings {
+		newEncoder := encoding.NewEncoder
+		c.pools[encoding.Name] = &sync.Pool{New: func() interface{} { return newEncoder(io.Discard) }}
+	}
+	for _, t := range types {
+		c.types[strings.ToLower(strings.TrimSpace(t))] = true
+	}
+
+	return c
+}
+
+// Handler compresses the responses of next
+func (c *Compressor) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+
+		encoding := c.negotiate(r.Header.Get("Accept-Encoding"))
+		if encoding == "" || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Not deferred: after a panic nothing is sent, so the recovery can
+		// still send an error
+		cw := &responseWriter{ResponseWriter: w, compressor: c, encoding: encoding}
+		next.ServeHTTP(cw, r)
+		cw.Close()
+	})
+}
+
+// negotiate returns the accepted encoding with the highest quality, or ""
+// to send the response as it is (RFC 9110, section 12.5.3)
+func (c *Compressor) negotiate(header string) string {
+	qualities := make(map[string]float64)
+	for _, item := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(item, ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		quality := 1.0
+		if key, value, found := strings.Cut(strings.TrimSpace(params), "="); found && strings.TrimSpace(key) == "q" {
+			if q, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+				quality = q
+			}
+		}
+		qualities[name] = quality
+	}
+
+	best, bestQuality := "", 0.0
+	for _, encoding := range c.encodings {
+		quality, listed := qualities[encoding.Name]
+		if !listed {
+			quality, listed = qualities["*"]
+		}
+
+		if listed && quality > bestQuality {
+			best, bestQuality = encoding.Name, quality
+		}
+	}
+
+	return best
+}
+
+// compressible reports if a response with the headers can be compressed
+func (c *Compressor) compressible(status int, header http.Header) bool {
+	if status < http.StatusOK || status == http.StatusNoContent || status == http.StatusPartialContent || status == http.StatusNotModified {
+		return false
+	}
+	if header.Get("Content-Encoding") != "" {
+		return false
+	}
+
+	mediaType, _, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+
+	return c.types[mediaType]
+}
+
+// responseWriter holds the body back until it reaches the minimum size, and
+// then sends it compressed. Bodies smaller than that are sent as they are by
+// Close, or by Flush for streaming responses.
+type responseWriter struct {
+	http.ResponseWriter
+	compressor *Compressor
+	encoding   string
+
+	status      int
+	wroteHeader bool
+	buffer      []byte
+
+	// Set once the response is being compressed
+	encoder Encoder
+
+	// Set once the response is sent as it is
+	passthrough bool
+}
+
+func (w *responseWriter) WriteHeader(status int) {
+	if w.wroteHeader || w.passthrough || w.encoder != nil {
+		return
+	}
+
+	// Informational responses are sent right away
+	if status >= 100 && status < 200 {
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+
+	w.status, w.wroteHeader = status, true
+
+	if !w.compressor.compressible(status, w.Header()) {
+		w.sendPlain()
+	}
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader && !w.passthrough && w.encoder == nil {
+		if w.Header().Get("Content-Type") == "" {
+			w.Header().Set("Content-Type", http.DetectContentType(b))
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+
+	switch {
+	case w.passthrough:
+		return w.ResponseWriter.Write(b)
+	case w.encoder != nil:
+		return w.encoder.Write(b)
+	}
+
+	w.buffer = append(w.buffer, b...)
+	if len(w.buffer) >= w.compressor.minSize {
+		if err := w.startEncoding(); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(b), nil
+}
+
+// Flush sends what was written so far. A body smaller than the minimum size
+// is sent as it is, as the rest may take long to come.
+func (w *responseWriter) Flush() {
+	if !w.passthrough && w.encoder == nil {
+		if !w.wroteHeader {
+			w.WriteHeader(http.StatusOK)
+		}
+		if !w.passthrough {
+			w.sendPlain()
+		}
+	}
+
+	if w.encoder != nil {
+		w.encoder.Flush()
+	}
+
+	http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Unwrap returns the original http.ResponseWriter, for http.ResponseController
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Close ends the response, sending the buffered body if it is still small
+func (w *responseWriter) Close() error {
+	if w.encoder != nil {
+		err := w.encoder.Close()
+		w.encoder.Reset(io.Discard)
+		w.compressor.pools[w.encoding].Put(w.encoder)
+		w.encoder = nil
+		return err
+	}
+
+	if !w.passthrough && w.wroteHeader {
+		w.sendPlain()
+	}
+
+	return nil
+}
+
+// sendPlain sends the headers and the buffered body without compressing them
+func (w *responseWriter) sendPlain() {
+	w.passthrough = true
+	w.ResponseWriter.WriteHeader(w.status)
+
+	if len(w.buffer) > 0 {
+		w.ResponseWriter.Write(w.buffer)
+		w.buffer = nil
+	}
+}
+
+// startEncoding sends the headers of the compressed response and the
+// buffered body through the encoder
+func (w *responseWriter) startEncoding() error {
+	header := w.Header()
+	header.Set("Content-Encoding", w.encoding)
+	header.Del("Content-Length")
+
+	// The compressed body is not byte for byte the one of a strong tag
+	if etag := header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		header.Set("ETag", "W/"+etag)
+	}
+
+	w.ResponseWriter.WriteHeader(w.status)
+
+	w.encoder = w.compressor.pools[w.encoding].Get().(Encoder)
+	w.encoder.Reset(w.ResponseWriter)
+
+	_, err := w.encoder.Write(w.buffer)
+	w.buffer = nil
+	return err
+}
@@ -0,0 +1,328 @@
+package compress
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// deflate stands in for the encodings of other packages
+var deflate = Encoding{
+	Name: "deflate",
+	NewEncoder: func(w io.Writer) Encoder {
+		return zlib.NewWriter(w)
+	},
+}
+
+// decode decompresses a body of the encoding
+func decode(t *testing.T, encoding string, body []byte) []byte {
+	t.Helper()
+
+	var r io.Reader
+	switch encoding {
+	case "gzip":
+		zr, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		r = zr
+	case "br":
+		r = brotli.NewReader(bytes.NewReader(body))
+	case "zstd":
+		zr, err := zstd.NewReader(bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer zr.Close()
+		r = zr
+	default:
+		t.Fatalf("unknown encoding %q", encoding)
+	}
+
+	decoded, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("decoding %s: %v", encoding, err)
+	}
+	return decoded
+}
+
+func TestNegotiate(t *testing.T) {
+	c := New(0, nil, deflate, Gzip)
+
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{"", ""},
+		{"identity", ""},
+		{"gzip", "gzip"},
+		{"gzip, deflate", "deflate"},
+		{"GZIP;q=1, deflate;q=0.5", "gzip"},
+		{"gzip;q=0", ""},
+		{"*", "deflate"},
+		{"deflate;q=0, *;q=0.1", "gzip"},
+		{"br, zstd", ""},
+	}
+
+	for _, tt := range tests {
+		if got := c.negotiate(tt.header); got != tt.want {
+			t.Errorf("negotiate(%q): got %q, want %q", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestNegotiateEncodings(t *testing.T) {
+	c := New(0, nil, Zstd, Brotli, Gzip)
+
+	tests := []struct {
+		header string
+		want   string
+	}{
+		// Ties go to the first encoding of the compressor
+		{"gzip, deflate, br, zstd", "zstd"},
+		{"gzip, br", "br"},
+		{"*", "zstd"},
+		{"deflate", ""},
+
+		// The quality of the client comes first
+		{"zstd;q=0.5, br;q=0.8, gzip;q=0.9", "gzip"},
+		{"zstd;q=0.5, br;q=0.9, gzip;q=0.9", "br"},
+		{"br;q=1, gzip;q=0.8", "br"},
+		{"gzip, *;q=0.5", "gzip"},
+		{"BR;Q=0.7, gzip;q=0.6", "br"},
+
+		// Refused encodings are never picked, not even through *
+		{"zstd;q=0, br;q=0", ""},
+		{"zstd;q=0, *", "br"},
+		{"zstd;q=0, br;q=0, *;q=0.1", "gzip"},
+		{"*;q=0", ""},
+	}
+
+	for _, tt := range tests {
+		if got := c.negotiate(tt.header); got != tt.want {
+			t.Errorf("negotiate(%q): got %q, want %q", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestHandler(t *testing.T) {
+	large := strings.Repeat(`{"title":"Heat"},`, 100)
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		etag        string
+		encoding    string
+		wantEtag    string
+	}{
+		{name: "large", contentType: "application/json", body: large, etag: `"v1"`, encoding: "gzip", wantEtag: `W/"v1"`},
+		{name: "small", contentType: "application/json", body: `{"title":"Heat"}`, etag: `"v1"`, wantEtag: `"v1"`},
+		{name: "parameters", contentType: "text/plain; charset=utf-8", body: large, encoding: "gzip"},
+		{name: "not allowed", contentType: "image/png", body: large},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := New(1024, nil).Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", tt.contentType)
+				if tt.etag != "" {
+					w.Header().Set("ETag", tt.etag)
+				}
+				w.WriteHeader(http.StatusOK)
+
+				// In pieces, as the encoders write it
+				for i := 0; i < len(tt.body); i += 100 {
+					io.WriteString(w, tt.body[i:min(i+100, len(tt.body))])
+				}
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Accept-Encoding", "gzip")
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if got := rec.Header().Get("Content-Encoding"); got != tt.encoding {
+				t.Fatalf("Content-Encoding: got %q, want %q", got, tt.encoding)
+			}
+			if got := rec.Header().Get("Vary"); got != "Accept-Encoding" {
+				t.Errorf("Vary: got %q", got)
+			}
+			if got := rec.Header().Get("ETag"); got != tt.wantEtag {
+				t.Errorf("ETag: got %q, want %q", got, tt.wantEtag)
+			}
+
+			body := rec.Body.Bytes()
+			if tt.encoding == "gzip" {
+				if len(body) >= len(tt.body) {
+					t.Errorf("compressed %d bytes into %d", len(tt.body), len(body))
+				}
+
+				body = decode(t, tt.encoding, body)
+			}
+			if string(body) != tt.body {
+				t.Errorf("body: got %q", body)
+			}
+		})
+	}
+}
+
+func TestEncodings(t *testing.T) {
+	handler := New(1024, nil, Zstd, Brotli, Gzip).Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.Copy(w, r.Body)
+	}))
+
+	for _, encoding := range []string{"zstd", "br", "gzip"} {
+		t.Run(encoding, func(t *testing.T) {
+			// The second response reuses the encoder of the first one
+			for i := 0; i < 2; i++ {
+				body := strings.Repeat(fmt.Sprintf(`{"title":"Heat %d"},`, i), 100)
+
+				req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+				req.Header.Set("Accept-Encoding", encoding)
+				rec := httptest.NewRecorder()
+				handler.ServeHTTP(rec, req)
+
+				if got := rec.Header().Get("Content-Encoding"); got != encoding {
+					t.Fatalf("Content-Encoding: got %q, want %q", got, encoding)
+				}
+				if rec.Body.Len() >= len(body) {
+					t.Errorf("compressed %d bytes into %d", len(body), rec.Body.Len())
+				}
+				if got := decode(t, encoding, rec.Body.Bytes()); string(got) != body {
+					t.Errorf("response %d: got %q", i, got)
+				}
+			}
+		})
+	}
+}
+
+func TestNotCompressed(t *testing.T) {
+	c := New(0, nil)
+
+	tests := []struct {
+		name   string
+		header string
+		method string
+		status int
+	}{
+		{name: "not accepted", method: http.MethodGet, status: http.StatusOK},
+		{name: "head", header: "gzip", method: http.MethodHead, status: http.StatusOK},
+		{name: "not modified", header: "gzip", method: http.MethodGet, status: http.StatusNotModified},
+		{name: "no content", header: "gzip", method: http.MethodGet, status: http.StatusNoContent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := c.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(tt.status)
+			}))
+
+			req := httptest.NewRequest(tt.method, "/", nil)
+			if tt.header != "" {
+				req.Header.Set("Accept-Encoding", tt.header)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status || rec.Header().Get("Content-Encoding") != "" || rec.Body.Len() != 0 {
+				t.Errorf("got %d %v %q", rec.Code, rec.Header(), rec.Body)
+			}
+		})
+	}
+}
+
+func TestFlush(t *testing.T) {
+	flushed := make(chan struct{})
+	proceed := make(chan struct{})
+
+	handler := New(1024, nil).Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		io.WriteString(w, "{\"n\":1}\n")
+
+		// The body is still small, it is sent as it is
+		if err := http.NewResponseController(w).Flush(); err != nil {
+			t.Error(err)
+		}
+		close(flushed)
+		<-proceed
+
+		io.WriteString(w, "{\"n\":2}\n")
+	}))
+
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	<-flushed
+	if res.Header.Get("Content-Encoding") != "" {
+		t.Errorf("Content-Encoding of a flushed small body: got %q", res.Header.Get("Content-Encoding"))
+	}
+
+	line := make([]byte, 8)
+	if _, err := io.ReadFull(res.Body, line); err != nil || string(line) != "{\"n\":1}\n" {
+		t.Errorf("first line before the end of the response: got %q (%v)", line, err)
+	}
+
+	close(proceed)
+	rest, _ := io.ReadAll(res.Body)
+	if string(rest) != "{\"n\":2}\n" {
+		t.Errorf("rest of the body: got %q", rest)
+	}
+}
+
+func TestFlushCompressed(t *testing.T) {
+	proceed := make(chan struct{})
+	large := strings.Repeat("{\"title\":\"Heat\"}\n", 100)
+
+	handler := New(1024, nil).Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		io.WriteString(w, large)
+		http.NewResponseController(w).Flush()
+		<-proceed
+	}))
+
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	defer close(proceed)
+
+	if res.Header.Get("Content-Encoding") != "gzip" {
+		t.Fatalf("Content-Encoding: got %q", res.Header.Get("Content-Encoding"))
+	}
+
+	// What was flushed can be decompressed before the end of the response
+	zr, err := gzip.NewReader(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := make([]byte, len(large))
+	if _, err := io.ReadFull(zr, body); err != nil || string(body) != large {
+		t.Errorf("flushed body: got %d bytes (%v)", len(body), err)
+	}
+}
@@ -0,0 +1,89 @@
+// Package events describes the changes of the catalogue, the favourites and
+// the users that are sent to other services, such as the webhooks. Events are
+// saved in the outbox with the change that causes them (see the outbox package).
+package events
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+	"time"
+)
+
+const (
+	MovieCreated     = "movie.created"
+	MovieUpdated     = "movie.updated"
+	MovieDeleted     = "movie.deleted"
+	MovieRestored    = "movie.restored"
+	FavouriteAdded   = "favourite.added"
+	FavouriteRemoved = "favourite.removed"
+	UserCreated      = "user.created"
+	UserUpdated      = "user.updated"
+	UserDeleted      = "user.deleted"
+)
+
+// Types are the types of the events the webhooks can subscribe to, in the
+// order they are documented. User events are only sent to the outbox sinks.
+var Types = []string{MovieCreated, MovieUpdated, MovieDeleted, MovieRestored, FavouriteAdded, FavouriteRemoved}
+
+// Private reports if the events of a type belong to the user who caused them
+// (favourites), instead of being about the shared catalogue
+func Private(eventType string) bool {
+	return strings.HasPrefix(eventType, "favourite.")
+}
+
+// Event is a change made by a user. Data is the changed resource, or its ID
+// if it was deleted. The aggregate is the resource changed (movie, favourite
+// or user), named by the prefix of the type.
+type Event struct {
+	ID          string    `json:"id"`
+	Type        string    `json:"type"`
+	CreatedAt   time.Time `json:"created_at"`
+	UserID      uint      `json:"user_id"`
+	Aggregate   string    `json:"aggregate"`
+	AggregateID uint      `json:"aggregate_id"`
+	Data        any       `json:"data"`
+}
+
+// Deleted is the data of the events of deleted resources
+type Deleted struct {
+	ID uint
+}
+
+// Favourite is the data of the favourite.added event
+type Favourite struct {
+	ID      uint
+	MovieID uint
+}
+
+// User is the data of the user events, without the credentials
+type User struct {
+	ID   uint
+	Name string
+	Role string
+}
+
+// New returns an event of the aggregate with the given ID, caused by a user
+func New(eventType string, aggregateId uint, userId int, data any) Event {
+	aggregate, _, _ := strings.Cut(eventType, ".")
+
+	return Event{
+		ID:          newID(),
+		Type:        eventType,
+		CreatedAt:   time.Now().UTC(),
+		UserID:      uint(userId),
+		Aggregate:   aggregate,
+		AggregateID: aggregateId,
+		Data:        data,
+	}
+}
+
+// newID returns a random ID of 16 bytes in hex
+func newID() string {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		panic(err)
+	}
+
+	return hex.EncodeToString(id)
+}
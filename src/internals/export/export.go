@@ -0,0 +1,257 @@
+// Package export makes the archive with the personal data of a user: a ZIP of
+// JSON files with their profile, movies, favourites, lists, webhooks, linked
+// identities, sessions and audit log entries. Small exports are written straight to the
+// response; large ones are queued as jobs and made by the Exporter, which
+// keeps the archives in the blob store until they expire.
+package export
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+
+	"films-api.rdelgado.es/src/internals/models"
+	"films-api.rdelgado.es/src/internals/storage"
+)
+
+// ContentType of the archives
+const ContentType = "application/zip"
+
+// Manifest describes the archive, it is saved as manifest.json
+type Manifest struct {
+	UserID     uint
+	ExportedAt time.Time
+	Files      []string
+}
+
+// Write writes the archive with the data of a user to w
+func Write(w io.Writer, data models.UserData, now time.Time) error {
+	files := []struct {
+		name    string
+		content interface{}
+	}{
+		{"profile.json", data.Profile},
+		{"movies.json", data.Movies},
+		{"favourites.json", data.Favourites},
+		{"lists.json", data.Lists},
+		{"webhooks.json", data.Webhooks},
+		{"identities.json", data.Identities},
+		{"sessions.json", data.Sessions},
+		{"audit.json", data.Audit},
+	}
+
+	manifest := Manifest{UserID: data.Profile.ID, ExportedAt: now.UTC()}
+	for _, file := range files {
+		manifest.Files = append(manifest.Files, file.name)
+	}
+
+	archive := zip.NewWriter(w)
+
+	if err := writeJSON(archive, "manifest.json", manifest, now); err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		if err := writeJSON(archive, file.name, file.content, now); err != nil {
+			return err
+		}
+	}
+
+	return archive.Close()
+}
+
+func writeJSON(archive *zip.Writer, name string, content interface{}, now time.Time) error {
+	file, err := archive.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: now})
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(content)
+}
+
+// Exporter makes the queued exports in the background and deletes the expired
+// ones. It must be created with New, which sets the default settings.
+type Exporter struct {
+	Exports *models.ExportModel
+	Blobs   storage.BlobStore
+	Logger  *slog.Logger
+
+	// Time the archives can be downloaded
+	Retention time.Duration
+
+	// How often the queue is checked, besides when a job is queued
+	PollInterval time.Duration
+
+	// Expired jobs deleted on each round
+	BatchSize int
+
+	wake chan struct{}
+}
+
+func New(exports *models.ExportModel, blobs storage.BlobStore, logger *slog.Logger) *Exporter {
+	return &Exporter{
+		Exports:      exports,
+		Blobs:        blobs,
+		Logger:       logger,
+		Retention:    24 * time.Hour,
+		PollInterval: time.Minute,
+		BatchSize:    100,
+		wake:         make(chan struct{}, 1),
+	}
+}
+
+// Notify wakes the exporter up to make a job queued
+func (e *Exporter) Notify() {
+	select {
+	case e.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run makes the queued exports until the context is canceled. The jobs left
+// running by a previous run are made again.
+func (e *Exporter) Run(ctx context.Context) {
+	if err := e.Exports.Requeue(); err != nil {
+		e.Logger.Error("requeuing the exports", "error", err.Error())
+	}
+
+	ticker := time.NewTicker(e.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := e.RunOnce(ctx, time.Now()); err != nil {
+			e.Logger.Error("making the exports", "error", err.Error())
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-e.wake:
+		}
+	}
+}
+
+// RunOnce makes the queued exports and deletes the expired ones
+func (e *Exporter) RunOnce(ctx context.Context, now time.Time) error {
+	for ctx.Err() == nil {
+		job, err := e.Exports.Next()
+		if errors.Is(err, models.ErrNoRecord) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := e.make(ctx, job, now); err != nil {
+			return err
+		}
+	}
+
+	return e.purge(ctx, now)
+}
+
+// make saves the archive of a job. Errors of the export fail the job, errors
+// saving its result are returned.
+func (e *Exporter) make(ctx context.Context, job models.ExportJob, now time.Time) error {
+	key, size, err := e.save(ctx, job)
+	expiresAt := now.Add(e.Retention)
+
+	if err != nil {
+		e.Logger.Error("export failed", "job", job.ID, "user", job.UserID, "error", err.Error())
+		err = e.Exports.Fail(job.ID, err, now, expiresAt)
+		if errors.Is(err, models.ErrNoRecord) {
+			return nil
+		}
+		return err
+	}
+
+	err = e.Exports.Finish(job.ID, key, size, now, expiresAt)
+	if errors.Is(err, models.ErrNoRecord) {
+		// The job was canceled while it was made, the archive is not needed
+		return e.Blobs.Delete(ctx, key)
+	}
+	if err != nil {
+		return err
+	}
+
+	e.Logger.Info("export done", "job", job.ID, "user", job.UserID, "bytes", size)
+	return nil
+}
+
+// save writes the archive of the job to the blob store and returns its key and size
+func (e *Exporter) save(ctx context.Context, job models.ExportJob) (string, int64, error) {
+	data, err := e.Exports.Collect(int(job.UserID))
+	if err != nil {
+		return "", 0, err
+	}
+
+	// The key is random, so the archives cannot be found by their job ID
+	suffix := make([]byte, 16)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", 0, err
+	}
+	key := fmt.Sprintf("exports/%d/%d-%s.zip", job.UserID, job.ID, hex.EncodeToString(suffix))
+
+	reader, writer := io.Pipe()
+	counter := &countingWriter{w: writer}
+
+	go func() {
+		writer.CloseWithError(Write(counter, data, time.Now()))
+	}()
+
+	if err := e.Blobs.Put(ctx, key, reader); err != nil {
+		reader.CloseWithError(err)
+		return "", 0, err
+	}
+
+	return key, counter.n, nil
+}
+
+// purge deletes the archives and jobs that expired
+func (e *Exporter) purge(ctx context.Context, now time.Time) error {
+	for ctx.Err() == nil {
+		jobs, err := e.Exports.Expired(now, e.BatchSize)
+		if err != nil {
+			return err
+		}
+
+		for _, job := range jobs {
+			if job.Key != "" {
+				if err := e.Blobs.Delete(ctx, job.Key); err != nil {
+					return err
+				}
+			}
+
+			if err := e.Exports.Delete(job.ID); err != nil {
+				return err
+			}
+		}
+
+		if len(jobs) < e.BatchSize {
+			break
+		}
+	}
+
+	return nil
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,162 @@
+// Package i18n translates the user-facing messages of the API. Messages are
+// identified by keys and loaded from the JSON catalogues embedded from the
+// locales directory, one file per locale.
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//go:embed locales/*.json
+var files embed.FS
+
+// Fallback is the locale used when the client does not accept any of the
+// supported locales, and for messages missing from a catalogue
+var Fallback = "en"
+
+// Params are the values of the {placeholders} of a message
+type Params map[string]string
+
+// Message is a translatable message: a catalogue key and its parameters
+type Message struct {
+	Key    string
+	Params Params
+}
+
+func NewMessage(key string, params Params) Message {
+	return Message{Key: key, Params: params}
+}
+
+// In translates the message to a locale
+func (m Message) In(locale string) string {
+	return T(locale, m.Key, m.Params)
+}
+
+// String returns the message in the fallback locale
+func (m Message) String() string {
+	return m.In(Fallback)
+}
+
+var catalogues = map[string]map[string]string{}
+
+func init() {
+	entries, err := files.ReadDir("locales")
+	if err != nil {
+		panic(err)
+	}
+
+	for _, entry := range entries {
+		content, err := files.ReadFile(path.Join("locales", entry.Name()))
+		if err != nil {
+			panic(err)
+		}
+
+		messages := map[string]string{}
+		if err := json.Unmarshal(content, &messages); err != nil {
+			panic(fmt.Sprintf("i18n: %s: %v", entry.Name(), err))
+		}
+
+		catalogues[strings.TrimSuffix(entry.Name(), ".json")] = messages
+	}
+}
+
+// T returns the message of a key in a locale, with the {placeholders}
+// replaced by the params. Keys missing from the locale are taken from the
+// fallback locale, and unknown keys are used as the message itself.
+func T(locale, key string, params Params) string {
+	message, exists := catalogues[locale][key]
+	if !exists {
+		message, exists = catalogues[Fallback][key]
+	}
+	if !exists {
+		message = key
+	}
+
+	for name, value := range params {
+		message = strings.ReplaceAll(message, "{"+name+"}", value)
+	}
+
+	return message
+}
+
+// Has reports if the key is in the catalogue of the fallback locale
+func Has(key string) bool {
+	_, exists := catalogues[Fallback][key]
+	return exists
+}
+
+// Locales returns the supported locales, sorted
+func Locales() []string {
+	var locales []string
+	for locale := range catalogues {
+		locales = append(locales, locale)
+	}
+
+	sort.Strings(locales)
+	return locales
+}
+
+// Keys returns the keys of the catalogue of a locale, sorted
+func Keys(locale string) []string {
+	var keys []string
+	for key := range catalogues[locale] {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+	return keys
+}
+
+// Supported reports if there is a catalogue for the locale
+func Supported(locale string) bool {
+	_, exists := catalogues[locale]
+	return exists
+}
+
+// Match returns the supported locale preferred by an Accept-Language header
+// (es-ES,es;q=0.9,en;q=0.8), or the fallback locale if none is supported.
+// Regional variants are matched by their language (es-ES is es).
+func Match(acceptLanguage string) string {
+	type preference struct {
+		locale  string
+		quality float64
+	}
+
+	var preferences []preference
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, options, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if tag == "" {
+			continue
+		}
+
+		quality := 1.0
+		if q, found := strings.CutPrefix(strings.TrimSpace(options), "q="); found {
+			var err error
+			if quality, err = strconv.ParseFloat(q, 64); err != nil {
+				continue
+			}
+		}
+
+		language, _, _ := strings.Cut(strings.ToLower(tag), "-")
+		preferences = append(preferences, preference{language, quality})
+	}
+
+	// Stable to keep the order of the header between equal qualities
+	sort.SliceStable(preferences, func(i, j int) bool {
+		return preferences[i].quality > preferences[j].quality
+	})
+
+	for _, p := range preferences {
+		if p.quality > 0 && Supported(p.locale) {
+			return p.locale
+		}
+	}
+
+	return Fallback
+}
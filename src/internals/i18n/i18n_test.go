@@ -0,0 +1,75 @@
+package i18n
+
+import (
+	"regexp"
+	"slices"
+	"testing"
+)
+
+var placeholderRX = regexp.MustCompile(`\{[a-z_]+\}`)
+
+// Every locale must translate every key of the fallback locale with the same placeholders
+func TestCataloguesHaveEveryKey(t *testing.T) {
+	reference := catalogues[Fallback]
+	if len(reference) == 0 {
+		t.Fatalf("fallback locale %q has no messages", Fallback)
+	}
+
+	for _, locale := range Locales() {
+		for key, message := range reference {
+			translation, exists := catalogues[locale][key]
+			if !exists {
+				t.Errorf("%s: missing key %q", locale, key)
+				continue
+			}
+
+			want := placeholderRX.FindAllString(message, -1)
+			got := placeholderRX.FindAllString(translation, -1)
+			slices.Sort(want)
+			slices.Sort(got)
+			if !slices.Equal(got, want) {
+				t.Errorf("%s: %q has placeholders %v, want %v", locale, key, got, want)
+			}
+		}
+
+		for key := range catalogues[locale] {
+			if _, exists := reference[key]; !exists {
+				t.Errorf("%s: key %q is not in the %s catalogue", locale, key, Fallback)
+			}
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	tests := map[string]string{
+		"":                          Fallback,
+		"es":                        "es",
+		"es-ES,es;q=0.9,en;q=0.8":   "es",
+		"fr-FR,fr;q=0.9,es;q=0.5":   "es",
+		"en;q=0.5,es;q=0.8":         "es",
+		"de,*;q=0.1":                Fallback,
+		"es;q=0,en":                 "en",
+		"ES-mx":                     "es",
+		"not a ; valid header,,;q=": Fallback,
+	}
+
+	for header, want := range tests {
+		if got := Match(header); got != want {
+			t.Errorf("Match(%q) = %q, want %q", header, got, want)
+		}
+	}
+}
+
+func TestT(t *testing.T) {
+	if got := T("es", "validation.max.string", Params{"max": "100"}); got != "Este campo debe tener menos de 100 caracteres" {
+		t.Errorf("got %q", got)
+	}
+
+	// Unknown locales use the fallback, unknown keys are the message
+	if got := T("fr", "validation.required", nil); got != T(Fallback, "validation.required", nil) {
+		t.Errorf("unknown locale: got %q", got)
+	}
+	if got := T("es", "Value must be {n}", Params{"n": "3"}); got != "Value must be 3" {
+		t.Errorf("unknown key: got %q", got)
+	}
+}
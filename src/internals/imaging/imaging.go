@@ -0,0 +1,116 @@
+// Package imaging checks uploaded images and makes their thumbnails. JPEG,
+// PNG and WebP images are accepted; the format is sniffed from the content,
+// never taken from the file name or the Content-Type of the upload.
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+
+	"golang.org/x/image/draw"
+	"golang.org/x/image/webp"
+)
+
+var ErrUnsupportedFormat = errors.New("image format is not supported")
+var ErrDimensions = errors.New("image dimensions are out of the limits")
+
+// Quality of the JPEG thumbnails
+const thumbnailQuality = 85
+
+type format struct {
+	extension    string
+	decode       func(io.Reader) (image.Image, error)
+	decodeConfig func(io.Reader) (image.Config, error)
+}
+
+// Accepted formats by sniffed content type
+var formats = map[string]format{
+	"image/jpeg": {".jpg", jpeg.Decode, jpeg.DecodeConfig},
+	"image/png":  {".png", png.Decode, png.DecodeConfig},
+	"image/webp": {".webp", webp.Decode, webp.DecodeConfig},
+}
+
+// ContentTypes returns the accepted content types
+func ContentTypes() []string {
+	return []string{"image/jpeg", "image/png", "image/webp"}
+}
+
+// Limits are the accepted dimensions of an image, in pixels
+type Limits struct {
+	MinWidth, MinHeight int
+	MaxWidth, MaxHeight int
+}
+
+// Image is a decoded image and the details of its original encoding
+type Image struct {
+	image.Image
+
+	ContentType string
+	Extension   string
+	Width       int
+	Height      int
+}
+
+// Decode sniffs the format of the data and decodes it. The dimensions are
+// checked before decoding the pixels, so huge images are rejected without
+// allocating them.
+func Decode(data []byte, limits Limits) (*Image, error) {
+	contentType := http.DetectContentType(data)
+
+	f, supported := formats[contentType]
+	if !supported {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedFormat, contentType)
+	}
+
+	config, err := f.decodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupportedFormat, err)
+	}
+
+	if config.Width < limits.MinWidth || config.Height < limits.MinHeight ||
+		config.Width > limits.MaxWidth || config.Height > limits.MaxHeight {
+		return nil, fmt.Errorf("%w: %dx%d", ErrDimensions, config.Width, config.Height)
+	}
+
+	img, err := f.decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupportedFormat, err)
+	}
+
+	return &Image{
+		Image:       img,
+		ContentType: contentType,
+		Extension:   f.extension,
+		Width:       config.Width,
+		Height:      config.Height,
+	}, nil
+}
+
+// Thumbnail scales the image down to a width, keeping its aspect ratio.
+// Transparent pixels are drawn over white, as JPEG has no alpha channel.
+func Thumbnail(img image.Image, width int) image.Image {
+	bounds := img.Bounds()
+
+	height := bounds.Dy() * width / bounds.Dx()
+	if height < 1 {
+		height = 1
+	}
+
+	thumbnail := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(thumbnail, thumbnail.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.CatmullRom.Scale(thumbnail, thumbnail.Bounds(), img, bounds, draw.Over, nil)
+
+	return thumbnail
+}
+
+// EncodeJPEG encodes a thumbnail as JPEG
+func EncodeJPEG(w io.Writer, img image.Image) error {
+	return jpeg.Encode(w, img, &jpeg.Options{Quality: thumbnailQuality})
+}
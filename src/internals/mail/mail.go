@@ -0,0 +1,132 @@
+// Package mail sends the emails of the API, such as the password reset and
+// email verification links. Messages go through the Mailer interface: SMTP
+// sends them to a mail server, while File and Log keep them on disk or in the
+// logs, so the flows can be used offline and in tests.
+package mail
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Message is a plain text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// SMTP sends the messages to a mail server. Authentication is only used
+// when Username is set; it requires TLS (STARTTLS) unless the server is local.
+type SMTP struct {
+	// host:port of the server
+	Addr     string
+	Username string
+	Password string
+
+	// Sender address, with an optional display name
+	From string
+}
+
+func (s *SMTP) Send(ctx context.Context, msg Message) error {
+	from, err := mail.ParseAddress(s.From)
+	if err != nil {
+		return fmt.Errorf("sender address: %w", err)
+	}
+
+	var auth smtp.Auth
+	if s.Username != "" {
+		host, _, err := net.SplitHostPort(s.Addr)
+		if err != nil {
+			return err
+		}
+		auth = smtp.PlainAuth("", s.Username, s.Password, host)
+	}
+
+	content, err := format(s.From, msg, time.Now())
+	if err != nil {
+		return err
+	}
+
+	// smtp.SendMail does not take a context, so it is only checked before sending
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return smtp.SendMail(s.Addr, auth, from.Address, []string{msg.To}, content)
+}
+
+// File writes each message as an .eml file of the directory
+type File struct {
+	Dir  string
+	From string
+}
+
+func (f *File) Send(ctx context.Context, msg Message) error {
+	content, err := format(f.From, msg, time.Now())
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(f.Dir, 0o755); err != nil {
+		return err
+	}
+
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%s.eml", time.Now().UTC().Format("20060102T150405.000000000"), hex.EncodeToString(suffix))
+
+	return os.WriteFile(filepath.Join(f.Dir, name), content, 0o600)
+}
+
+// Log writes the messages to the logger. Messages may have secrets (such as
+// the reset links), so it should only be used in development.
+type Log struct {
+	Logger *slog.Logger
+}
+
+func (l *Log) Send(ctx context.Context, msg Message) error {
+	l.Logger.Info("email", "to", msg.To, "subject", msg.Subject, "body", msg.Body)
+	return nil
+}
+
+// format builds the RFC 5322 message. Headers with line breaks are rejected,
+// as they could add other headers.
+func format(from string, msg Message, date time.Time) ([]byte, error) {
+	for _, header := range []string{from, msg.To, msg.Subject} {
+		if strings.ContainsAny(header, "\r\n") {
+			return nil, fmt.Errorf("mail header %q has a line break", header)
+		}
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&buf, "Content-Type: text/plain; charset=utf-8\r\n")
+	fmt.Fprintf(&buf, "Content-Transfer-Encoding: 8bit\r\n")
+	fmt.Fprintf(&buf, "\r\n")
+	buf.WriteString(strings.ReplaceAll(strings.ReplaceAll(msg.Body, "\r\n", "\n"), "\n", "\r\n"))
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,49 @@
+package mail
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFile(t *testing.T) {
+	dir := t.TempDir()
+	mailer := &File{Dir: dir, From: "Films API <no-reply@example.com>"}
+
+	msg := Message{To: "user@example.com", Subject: "Restablece tu contraseña", Body: "Token:\n\nabc\n"}
+	if err := mailer.Send(context.Background(), msg); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if err != nil || len(files) != 1 {
+		t.Fatalf("messages written: got %v (%v)", files, err)
+	}
+
+	content, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{
+		"From: Films API <no-reply@example.com>\r\n",
+		"To: user@example.com\r\n",
+		"Subject: =?utf-8?q?Restablece_tu_contrase=C3=B1a?=\r\n",
+		"\r\n\r\nToken:\r\n\r\nabc\r\n",
+	} {
+		if !strings.Contains(string(content), want) {
+			t.Errorf("message %q does not contain %q", content, want)
+		}
+	}
+}
+
+func TestHeaderInjection(t *testing.T) {
+	mailer := &File{Dir: t.TempDir(), From: "no-reply@example.com"}
+
+	msg := Message{To: "user@example.com\r\nBcc: other@example.com", Subject: "Hi", Body: "Hi"}
+	if err := mailer.Send(context.Background(), msg); err == nil {
+		t.Error("sent a message with a line break in a header")
+	}
+}
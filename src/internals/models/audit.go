@@ -0,0 +1,212 @@
+package models
+
+import (
+	"encoding/json"
+	"reflect"
+	"slices"
+	"time"
+
+	"films-api.rdelgado.es/src/internals/audit"
+	"gorm.io/gorm"
+)
+
+// Actions of the audit log
+const (
+	AuditCreate = "create"
+	AuditUpdate = "update"
+	AuditDelete = "delete"
+
+	// Movies taken out of the trash, and deleted for good
+	AuditRestore = "restore"
+	AuditPurge   = "purge"
+)
+
+// Entities of the audit log
+const (
+	EntityMovie     = "movie"
+	EntityFavourite = "favourite"
+	EntityUser      = "user"
+)
+
+// Fields left out of the diffs, fields whose values are not recorded, and
+// fields with personal data, not recorded when the entity is erased
+var (
+	unauditedFields = []string{"UpdatedAt"}
+	redactedFields  = []string{"Password"}
+	personalFields  = []string{"Name", "Email"}
+)
+
+const redacted = "[redacted]"
+
+// AuditModel reads the audit log. Entries are only written by the other
+// models, in the transactions of their changes, and never changed.
+type AuditModel struct {
+	DB *gorm.DB
+}
+
+// AuditEntry is a change of an entity. Changes has the fields that changed,
+// with their values before and after it (null when created or deleted).
+type AuditEntry struct {
+	ID        uint      `gorm:"primarykey"`
+	CreatedAt time.Time `gorm:"index"`
+
+	// User who made the change, null for the system
+	ActorID   *uint `gorm:"index"`
+	RequestID string
+	IP        string
+
+	Action   string            `gorm:"not null"`
+	Entity   string            `gorm:"not null; size:32; index:idx_audit_entity"`
+	EntityID uint              `gorm:"not null; index:idx_audit_entity"`
+	Changes  map[string]Change `gorm:"type:text; serializer:json"`
+}
+
+type Change struct {
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// AuditFilter selects the entries of the audit log. Zero fields do not filter.
+type AuditFilter struct {
+	Entity   string
+	EntityID int
+	ActorID  int
+	From     time.Time
+	To       time.Time
+}
+
+// GetPage returns the entries matching the filter, newest first, and how many they are
+func (m *AuditModel) GetPage(filter AuditFilter, offset, limit int) ([]AuditEntry, int64, error) {
+	query := m.DB.Model(&AuditEntry{})
+
+	if filter.Entity != "" {
+		query = query.Where("entity = ?", filter.Entity)
+	}
+	if filter.EntityID > 0 {
+		query = query.Where("entity_id = ?", filter.EntityID)
+	}
+	if filter.ActorID > 0 {
+		query = query.Where("actor_id = ?", filter.ActorID)
+	}
+	if !filter.From.IsZero() {
+		query = query.Where("created_at >= ?", filter.From)
+	}
+	if !filter.To.IsZero() {
+		query = query.Where("created_at < ?", filter.To)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	entries := []AuditEntry{}
+	result := query.Order("id DESC").Offset(offset).Limit(limit).Find(&entries)
+	if err := result.Error; err != nil {
+		return nil, 0, err
+	}
+
+	return entries, total, nil
+}
+
+// writeAudit records a change in the audit log with the actor of the context
+// of the transaction. before is nil for created entities and after for
+// deleted ones.
+func writeAudit(tx *gorm.DB, action, entity string, entityId uint, before, after interface{}) error {
+	changes, err := diff(before, after)
+	if err != nil {
+		return err
+	}
+
+	entry := AuditEntry{
+		Action:   action,
+		Entity:   entity,
+		EntityID: entityId,
+		Changes:  changes,
+	}
+
+	if actor, ok := audit.FromContext(tx.Statement.Context); ok {
+		if actor.UserID > 0 {
+			id := uint(actor.UserID)
+			entry.ActorID = &id
+		}
+		entry.RequestID = actor.RequestID
+		entry.IP = actor.IP
+	}
+
+	return tx.Create(&entry).Error
+}
+
+// diff compares the JSON fields of two values of an entity
+func diff(before, after interface{}) (map[string]Change, error) {
+	beforeFields, err := jsonFields(before)
+	if err != nil {
+		return nil, err
+	}
+	afterFields, err := jsonFields(after)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := map[string]Change{}
+	for _, fields := range []map[string]interface{}{beforeFields, afterFields} {
+		for name := range fields {
+			if _, done := changes[name]; done || slices.Contains(unauditedFields, name) {
+				continue
+			}
+
+			change := Change{Before: beforeFields[name], After: afterFields[name]}
+			if reflect.DeepEqual(change.Before, change.After) {
+				continue
+			}
+
+			if slices.Contains(redactedFields, name) {
+				change = Change{Before: redactedValue(change.Before), After: redactedValue(change.After)}
+			}
+
+			changes[name] = change
+		}
+	}
+
+	return changes, nil
+}
+
+func jsonFields(value interface{}) (map[string]interface{}, error) {
+	fields := map[string]interface{}{}
+	if value == nil {
+		return fields, nil
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	return fields, json.Unmarshal(data, &fields)
+}
+
+// withoutPersonalData returns the JSON fields of an entity with the personal
+// data redacted, to record the deletion of an account without keeping what
+// the deletion erases
+func withoutPersonalData(value interface{}) (map[string]interface{}, error) {
+	fields, err := jsonFields(value)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range personalFields {
+		if _, exists := fields[name]; exists {
+			fields[name] = redactedValue(fields[name])
+		}
+	}
+
+	return fields, nil
+}
+
+func redactedValue(value interface{}) interface{} {
+	if value == nil {
+		return nil
+	}
+
+	return redacted
+}
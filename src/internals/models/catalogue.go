@@ -0,0 +1,52 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Catalogue has the version of the movie catalogue, increased with every
+// change of a movie. Responses made from a version can be reused, or answered
+// with 304 Not Modified, while it does not change.
+type Catalogue struct {
+	ID        uint `gorm:"primarykey"`
+	Version   int  `gorm:"not null; default:0"`
+	UpdatedAt time.Time
+}
+
+// The catalogue is the only row of its table
+const catalogueID = 1
+
+type CatalogueModel struct {
+	DB *gorm.DB
+}
+
+// Get returns the current version, zero before the first change
+func (m *CatalogueModel) Get() (Catalogue, error) {
+	var catalogue Catalogue
+
+	result := m.DB.Where("id = ?", catalogueID).Limit(1).Find(&catalogue)
+	if err := result.Error; err != nil {
+		return Catalogue{}, err
+	}
+
+	return catalogue, nil
+}
+
+// BumpCatalogue increases the version of the catalogue. It must be called in
+// the transaction of every change of the movies, including the ones made
+// outside of MovieModel such as seeding or repairs. The row is created by the
+// first change.
+func BumpCatalogue(tx *gorm.DB) error {
+	upsert := clause.OnConflict{
+		Columns: []clause.Column{{Name: "id"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"version":    gorm.Expr("version + 1"),
+			"updated_at": time.Now(),
+		}),
+	}
+
+	return tx.Clauses(upsert).Create(&Catalogue{ID: catalogueID, Version: 1}).Error
+}
@@ -1,11 +1,24 @@
 package models
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+)
 
 var ErrNoRecord = errors.New("no mathing records found or empty dataset")
 var ErrDuplicatedEntry = errors.New("duplicated entry found")
+var ErrTitleInTrash = fmt.Errorf("%w: a movie with this title is in the trash", ErrDuplicatedEntry)
+var ErrReferencedNotFound = errors.New("referenced record not found")
 var ErrInvalidCredentials = errors.New("credentials are invalid")
 var ErrTokenExpired = errors.New("access token has expired")
 var ErrInvalidToken = errors.New("access token is invalid")
 var ErrInvalidAuthHeader = errors.New("Authorization header does not have the correct formatting")
 var ErrNotAuthorized = errors.New("User is not authorized to perform this action")
+var ErrInvalidOrder = errors.New("order must contain every item of the list exactly once")
+var ErrWebhookDisabled = errors.New("webhook is disabled")
+var ErrExportNotReady = errors.New("export is not ready")
+var ErrInvalidOneTimeToken = errors.New("token is not valid, has expired or was already used")
+var ErrTOTPEnabled = errors.New("two-factor authentication is already enabled")
+var ErrMFALocked = errors.New("too many wrong codes, two-factor authentication is locked for a while")
+var ErrMFARequired = errors.New("two-factor authentication is required for the role of the user")
+var ErrLastIdentity = errors.New("the last identity of a user without a password cannot be unlinked")
@@ -0,0 +1,314 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	ExportPending = "pending"
+	ExportRunning = "running"
+	ExportDone    = "done"
+	ExportFailed  = "failed"
+)
+
+type ExportModel struct {
+	DB *gorm.DB
+}
+
+// ExportJob is an export of the data of a user made in the background. The
+// archive is kept in the blob store until ExpiresAt.
+type ExportJob struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+
+	UserID     uint   `gorm:"index"`
+	Status     string `gorm:"not null; index"`
+	Key        string `json:"-"`
+	Size       int64
+	Error      string
+	FinishedAt *time.Time
+	ExpiresAt  *time.Time `gorm:"index"`
+
+	// Only used for the foreign key, jobs go with their user
+	User *User `json:"-" gorm:"constraint:OnDelete:CASCADE"`
+}
+
+// UserData is everything the API keeps about a user. Movies include the ones
+// in the trash.
+type UserData struct {
+	Profile    Profile
+	Movies     []Movie
+	Favourites []ExportedFavourite
+	Lists      []ExportedList
+	Webhooks   []Webhook
+	Identities []Identity
+	Sessions   []Session
+	Audit      []AuditEntry
+}
+
+// ExportedFavourite is a favourite with the title of its movie
+type ExportedFavourite struct {
+	ID        uint
+	CreatedAt time.Time
+	MovieID   uint
+	Title     string
+}
+
+type ExportedList struct {
+	List
+	Items []ListItem
+}
+
+// Rows returns how many records the export of the user has, to decide if it
+// is made in the background
+func (m *ExportModel) Rows(userId int) (int64, error) {
+	total := int64(0)
+
+	queries := []*gorm.DB{
+		m.DB.Unscoped().Model(&Movie{}).Where("user_id = ?", userId),
+		m.DB.Model(&Favourite{}).Where("user_id = ?", userId),
+		m.DB.Model(&ListItem{}).Where("list_id IN (?)", m.DB.Model(&List{}).Select("id").Where("user_id = ?", userId)),
+		m.userAudit(userId),
+	}
+
+	for _, query := range queries {
+		var rows int64
+		if err := query.Count(&rows).Error; err != nil {
+			return 0, err
+		}
+		total += rows
+	}
+
+	return total, nil
+}
+
+// Collect loads the data of the user, with the movies and favourites of the
+// User associations
+func (m *ExportModel) Collect(userId int) (UserData, error) {
+	var user User
+
+	unscoped := func(db *gorm.DB) *gorm.DB { return db.Unscoped() }
+
+	result := m.DB.
+		Preload("Movie", unscoped).
+		Preload("Favorites").
+		Preload("Favorites.Movie", unscoped).
+		First(&user, userId)
+	if err := result.Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return UserData{}, ErrNoRecord
+		}
+		return UserData{}, err
+	}
+
+	data := UserData{
+		Profile:    user.Profile(),
+		Movies:     user.Movie,
+		Favourites: make([]ExportedFavourite, 0, len(user.Favorites)),
+		Lists:      []ExportedList{},
+		Webhooks:   []Webhook{},
+		Identities: []Identity{},
+		Sessions:   []Session{},
+		Audit:      []AuditEntry{},
+	}
+
+	if data.Movies == nil {
+		data.Movies = []Movie{}
+	}
+
+	for _, favourite := range user.Favorites {
+		exported := ExportedFavourite{ID: favourite.ID, CreatedAt: favourite.CreatedAt, MovieID: favourite.MovieID}
+		if favourite.Movie != nil {
+			exported.Title = favourite.Movie.Title
+		}
+		data.Favourites = append(data.Favourites, exported)
+	}
+
+	var lists []List
+	if err := m.DB.Where("user_id = ?", userId).Order("id").Find(&lists).Error; err != nil {
+		return UserData{}, err
+	}
+
+	for _, list := range lists {
+		items := []ListItem{}
+		if err := m.DB.Where("list_id = ?", list.ID).Order("position").Find(&items).Error; err != nil {
+			return UserData{}, err
+		}
+		data.Lists = append(data.Lists, ExportedList{List: list, Items: items})
+	}
+
+	if err := m.DB.Where("user_id = ?", userId).Order("id").Find(&data.Webhooks).Error; err != nil {
+		return UserData{}, err
+	}
+
+	if err := m.DB.Where("user_id = ?", userId).Order("id").Find(&data.Identities).Error; err != nil {
+		return UserData{}, err
+	}
+
+	if err := m.DB.Where("user_id = ?", userId).Order("id").Find(&data.Sessions).Error; err != nil {
+		return UserData{}, err
+	}
+
+	if err := m.userAudit(userId).Order("id").Find(&data.Audit).Error; err != nil {
+		return UserData{}, err
+	}
+
+	return data, nil
+}
+
+// userAudit selects the changes made by the user and the changes of their
+// account (made by the admins)
+func (m *ExportModel) userAudit(userId int) *gorm.DB {
+	return m.DB.Model(&AuditEntry{}).Where("actor_id = ? OR (entity = ? AND entity_id = ?)", userId, EntityUser, userId)
+}
+
+// Create returns the pending or running job of the user, or queues a new one
+func (m *ExportModel) Create(userId int) (ExportJob, error) {
+	var job ExportJob
+
+	err := m.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("user_id = ?", userId).
+			Where("status IN ?", []string{ExportPending, ExportRunning}).
+			Limit(1).
+			Find(&job)
+		if err := result.Error; err != nil {
+			return err
+		}
+
+		if result.RowsAffected > 0 {
+			return nil
+		}
+
+		job = ExportJob{UserID: uint(userId), Status: ExportPending}
+		return tx.Create(&job).Error
+	})
+	if err != nil {
+		return ExportJob{}, err
+	}
+
+	return job, nil
+}
+
+// Get returns a job of the user. Jobs of other users and expired jobs are not found.
+func (m *ExportModel) Get(id, userId int, now time.Time) (ExportJob, error) {
+	var job ExportJob
+
+	result := m.DB.Where("user_id = ?", userId).
+		Where("expires_at IS NULL OR expires_at > ?", now).
+		Limit(1).
+		Find(&job, id)
+	if err := result.Error; err != nil {
+		return ExportJob{}, err
+	}
+
+	if result.RowsAffected == 0 {
+		return ExportJob{}, ErrNoRecord
+	}
+
+	return job, nil
+}
+
+// Next claims the oldest pending job, marking it as running. It returns
+// ErrNoRecord if there is none.
+func (m *ExportModel) Next() (ExportJob, error) {
+	for {
+		var job ExportJob
+
+		result := m.DB.Where("status = ?", ExportPending).Order("id").Limit(1).Find(&job)
+		if err := result.Error; err != nil {
+			return ExportJob{}, err
+		}
+
+		if result.RowsAffected == 0 {
+			return ExportJob{}, ErrNoRecord
+		}
+
+		// Another exporter may have claimed it in the meantime
+		result = m.DB.Model(&ExportJob{}).
+			Where("id = ? AND status = ?", job.ID, ExportPending).
+			Update("status", ExportRunning)
+		if err := result.Error; err != nil {
+			return ExportJob{}, err
+		}
+
+		if result.RowsAffected > 0 {
+			job.Status = ExportRunning
+			return job, nil
+		}
+	}
+}
+
+// Requeue sets the running jobs back to pending, for the jobs left running
+// when the server stopped
+func (m *ExportModel) Requeue() error {
+	return m.DB.Model(&ExportJob{}).Where("status = ?", ExportRunning).Update("status", ExportPending).Error
+}
+
+// Finish saves the archive of a running job. It returns ErrNoRecord if the
+// job is not running anymore, as when its user was deleted.
+func (m *ExportModel) Finish(id uint, key string, size int64, now time.Time, expiresAt time.Time) error {
+	return m.finish(id, map[string]interface{}{
+		"status":      ExportDone,
+		"key":         key,
+		"size":        size,
+		"finished_at": now,
+		"expires_at":  expiresAt,
+	})
+}
+
+// Fail records the error of a running job
+func (m *ExportModel) Fail(id uint, cause error, now time.Time, expiresAt time.Time) error {
+	return m.finish(id, map[string]interface{}{
+		"status":      ExportFailed,
+		"error":       cause.Error(),
+		"finished_at": now,
+		"expires_at":  expiresAt,
+	})
+}
+
+func (m *ExportModel) finish(id uint, updates map[string]interface{}) error {
+	result := m.DB.Model(&ExportJob{}).Where("id = ? AND status = ?", id, ExportRunning).Updates(updates)
+	if err := result.Error; err != nil {
+		return err
+	}
+
+	if result.RowsAffected == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
+
+// Expired returns up to limit jobs that expired before now
+func (m *ExportModel) Expired(now time.Time, limit int) ([]ExportJob, error) {
+	var jobs []ExportJob
+
+	result := m.DB.Where("expires_at <= ?", now).Order("expires_at").Limit(limit).Find(&jobs)
+	if err := result.Error; err != nil {
+		return nil, err
+	}
+
+	return jobs, nil
+}
+
+// Delete removes a job, once its archive has been deleted
+func (m *ExportModel) Delete(id uint) error {
+	return m.DB.Delete(&ExportJob{}, id).Error
+}
+
+// expireExports cancels the queued jobs of a user and expires their archives,
+// so the exporter deletes them
+func expireExports(tx *gorm.DB, userId int, now time.Time) error {
+	err := tx.Where("user_id = ?", userId).
+		Where("status IN ?", []string{ExportPending, ExportRunning}).
+		Delete(&ExportJob{}).Error
+	if err != nil {
+		return err
+	}
+
+	return tx.Model(&ExportJob{}).Where("user_id = ?", userId).Update("expires_at", now).Error
+}
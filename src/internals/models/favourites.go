@@ -1,8 +1,10 @@
 package models
 
 import (
+	"context"
 	"errors"
 
+	"films-api.rdelgado.es/src/internals/events"
 	"gorm.io/gorm"
 )
 
@@ -14,6 +16,9 @@ type Favourite struct {
 	gorm.Model
 	UserID  uint `gorm:"uniqueIndex:idx_userid_movieid"`
 	MovieID uint `gorm:"uniqueIndex:idx_userid_movieid"`
+
+	// Only used for the foreign key, favourites go with their movie
+	Movie *Movie `json:"-" gorm:"constraint:OnDelete:CASCADE"`
 }
 
 type GetFavouriteInfo struct {
@@ -21,32 +26,53 @@ type GetFavouriteInfo struct {
 	Movie       Movie `gorm:"embedded"`
 }
 
+// WithContext returns a copy of the model whose changes are recorded in the
+// audit log with the actor of ctx
+func (m *FavouriteModel) WithContext(ctx context.Context) *FavouriteModel {
+	return &FavouriteModel{DB: m.DB.WithContext(ctx)}
+}
+
 func (m *FavouriteModel) Remove(favId, userId int) error {
+	return m.DB.Transaction(func(tx *gorm.DB) error {
+		var favourite Favourite
 
-	result := m.DB.Unscoped().
-		Where("id = ?", favId).
-		Where("user_id = ?", userId).
-		Delete(&Favourite{})
+		result := tx.Where("user_id = ?", userId).Limit(1).Find(&favourite, favId)
+		if err := result.Error; err != nil {
+			return err
+		}
 
-	if err := result.Error; err != nil {
+		// return Not Found error if there is no favourite to delete
+		if result.RowsAffected == 0 {
+			return ErrNoRecord
+		}
+
+		return deleteFavourite(tx, favourite)
+	})
+}
+
+// deleteFavourite deletes the favourite on behalf of its user. Favourites are
+// added again rather than restored, so the row is deleted to free its unique
+// index.
+func deleteFavourite(tx *gorm.DB, favourite Favourite) error {
+	if err := tx.Unscoped().Delete(&favourite).Error; err != nil {
 		return err
 	}
 
-	// return Not Found error if no record has been deleted
-	if result.RowsAffected == 0 {
-		return ErrNoRecord
+	if err := writeAudit(tx, AuditDelete, EntityFavourite, favourite.ID, favourite, nil); err != nil {
+		return err
 	}
 
-	return nil
+	event := events.New(events.FavouriteRemoved, favourite.ID, int(favourite.UserID), events.Deleted{ID: favourite.ID})
+	return writeEvent(tx, event)
 }
 
 func (m *FavouriteModel) GetAll(userId int) ([]GetFavouriteInfo, error) {
 	var movieDetails []GetFavouriteInfo
 
 	result := m.DB.Model(&Favourite{}).Select("favourites.id AS fav_id", "movies.*").
-		Joins("LEFT JOIN users ON favourites.user_id = users.id").
-		Joins("LEFT JOIN movies ON favourites.movie_id = movies.id").
+		Joins("INNER JOIN movies ON favourites.movie_id = movies.id").
 		Where("favourites.user_id = ?", userId).
+		Where("movies.deleted_at IS NULL").
 		Scan(&movieDetails)
 
 	if err := result.Error; err != nil {
@@ -67,11 +93,30 @@ func (m *FavouriteModel) Insert(userId, movieId int) (int, error) {
 		MovieID: uint(movieId),
 	}
 
-	result := m.DB.Create(&favorite)
-	if err := result.Error; err != nil {
+	err := m.DB.Transaction(func(tx *gorm.DB) error {
+		// Movies in the trash cannot be added, although their rows exist
+		if err := referenced(tx, &Movie{}, movieId); err != nil {
+			return err
+		}
+
+		if err := tx.Create(&favorite).Error; err != nil {
+			return err
+		}
+
+		if err := writeAudit(tx, AuditCreate, EntityFavourite, favorite.ID, nil, favorite); err != nil {
+			return err
+		}
+
+		data := events.Favourite{ID: favorite.ID, MovieID: favorite.MovieID}
+		return writeEvent(tx, events.New(events.FavouriteAdded, favorite.ID, userId, data))
+	})
+	if err != nil {
 		if errors.Is(err, gorm.ErrDuplicatedKey) {
 			return 0, ErrDuplicatedEntry
 		}
+		if errors.Is(err, gorm.ErrForeignKeyViolated) {
+			return 0, ErrReferencedNotFound
+		}
 
 		return 0, err
 	}
@@ -0,0 +1,318 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"films-api.rdelgado.es/src/internals/events"
+	"gorm.io/gorm"
+)
+
+// Identity links a user to their account in an OpenID Connect provider
+type Identity struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+
+	UserID  uint   `gorm:"index"`
+	Issuer  string `gorm:"not null; size:255; uniqueIndex:idx_identity"`
+	Subject string `gorm:"not null; size:255; uniqueIndex:idx_identity"`
+
+	// Address given by the provider the last time the user logged in
+	Email string
+
+	// Only used for the foreign key, identities go with their user
+	User *User `json:"-" gorm:"constraint:OnDelete:CASCADE"`
+}
+
+// ExternalIdentity is a user logged in by a provider, from the claims of its ID token
+type ExternalIdentity struct {
+	Issuer        string
+	Subject       string
+	Email         string
+	EmailVerified bool
+
+	// Preferred names of the user, to make the name of provisioned users
+	Names []string
+}
+
+// LoginState is a login with a provider between the redirection to it and
+// the callback. Only the hash of the state sent through the browser is stored.
+type LoginState struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+
+	Hash     string `gorm:"not null; size:64; uniqueIndex"`
+	Nonce    string `gorm:"not null"`
+	Verifier string `gorm:"not null"`
+
+	// User linking the identity, null for logins
+	UserID *uint `gorm:"index"`
+
+	ExpiresAt time.Time `gorm:"not null"`
+
+	// Only used for the foreign key, states go with their user
+	User *User `json:"-" gorm:"constraint:OnDelete:CASCADE"`
+}
+
+type IdentityModel struct {
+	DB *gorm.DB
+}
+
+// StartLogin saves the state of a login with a provider. The expired ones are
+// deleted on the way.
+func (m *IdentityModel) StartLogin(state, nonce, verifier string, userId *uint, ttl time.Duration) error {
+	now := time.Now()
+
+	if err := m.DB.Where("expires_at <= ?", now).Delete(&LoginState{}).Error; err != nil {
+		return err
+	}
+
+	login := LoginState{
+		Hash:      hashToken(state),
+		Nonce:     nonce,
+		Verifier:  verifier,
+		UserID:    userId,
+		ExpiresAt: now.Add(ttl),
+	}
+
+	return m.DB.Create(&login).Error
+}
+
+// UseLogin returns and deletes the login with the state. It returns
+// ErrInvalidOneTimeToken if it does not exist or has expired.
+func (m *IdentityModel) UseLogin(state string, now time.Time) (LoginState, error) {
+	var login LoginState
+
+	result := m.DB.Where("hash = ? AND expires_at > ?", hashToken(state), now).Limit(1).Find(&login)
+	if err := result.Error; err != nil {
+		return LoginState{}, err
+	}
+	if result.RowsAffected == 0 {
+		return LoginState{}, ErrInvalidOneTimeToken
+	}
+
+	// Another request may have used it in the meantime
+	result = m.DB.Delete(&LoginState{}, login.ID)
+	if err := result.Error; err != nil {
+		return LoginState{}, err
+	}
+	if result.RowsAffected == 0 {
+		return LoginState{}, ErrInvalidOneTimeToken
+	}
+
+	return login, nil
+}
+
+// Login returns the user of an identity. Identities not linked yet are
+// linked to the user with the same verified address, if any, or to a new
+// user if provision is set. It returns ErrNoRecord otherwise.
+func (m *IdentityModel) Login(external ExternalIdentity, provision bool) (User, error) {
+	var user User
+
+	err := m.DB.Transaction(func(tx *gorm.DB) error {
+		var identity Identity
+		result := tx.Where("issuer = ? AND subject = ?", external.Issuer, external.Subject).Limit(1).Find(&identity)
+		if err := result.Error; err != nil {
+			return err
+		}
+
+		if result.RowsAffected > 0 {
+			if err := tx.Model(&identity).Update("email", external.Email).Error; err != nil {
+				return err
+			}
+			return tx.First(&user, identity.UserID).Error
+		}
+
+		// Both the provider and the API must have verified the address
+		if external.Email != "" && external.EmailVerified {
+			result := tx.Where("email = ? AND email_verified_at IS NOT NULL", external.Email).Limit(1).Find(&user)
+			if err := result.Error; err != nil {
+				return err
+			}
+
+			if result.RowsAffected > 0 {
+				return linkIdentity(tx, user.ID, external)
+			}
+		}
+
+		if !provision {
+			return ErrNoRecord
+		}
+
+		var err error
+		if user, err = provisionUser(tx, external); err != nil {
+			return err
+		}
+
+		return linkIdentity(tx, user.ID, external)
+	})
+	if err != nil {
+		return User{}, err
+	}
+
+	return user, nil
+}
+
+// Link links an identity to the user. It returns ErrDuplicatedEntry if it
+// is linked to another user.
+func (m *IdentityModel) Link(userId uint, external ExternalIdentity) (Identity, error) {
+	var identity Identity
+
+	err := m.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("issuer = ? AND subject = ?", external.Issuer, external.Subject).Limit(1).Find(&identity)
+		if err := result.Error; err != nil {
+			return err
+		}
+
+		if result.RowsAffected > 0 {
+			if identity.UserID != userId {
+				return ErrDuplicatedEntry
+			}
+			return nil
+		}
+
+		if err := linkIdentity(tx, userId, external); err != nil {
+			return err
+		}
+
+		return tx.Where("issuer = ? AND subject = ?", external.Issuer, external.Subject).First(&identity).Error
+	})
+	if err != nil {
+		return Identity{}, err
+	}
+
+	return identity, nil
+}
+
+func (m *IdentityModel) GetAll(userId int) ([]Identity, error) {
+	identities := []Identity{}
+	return identities, m.DB.Where("user_id = ?", userId).Order("id").Find(&identities).Error
+}
+
+// Delete unlinks an identity of the user. The last identity of a user without
+// a password cannot be unlinked, returning ErrLastIdentity.
+func (m *IdentityModel) Delete(id, userId int) error {
+	return m.DB.Transaction(func(tx *gorm.DB) error {
+		var user User
+		if err := tx.First(&user, userId).Error; err != nil {
+			return err
+		}
+
+		var count int64
+		if err := tx.Model(&Identity{}).Where("user_id = ?", userId).Count(&count).Error; err != nil {
+			return err
+		}
+
+		result := tx.Where("id = ? AND user_id = ?", id, userId).Delete(&Identity{})
+		if err := result.Error; err != nil {
+			return err
+		}
+		if result.RowsAffected == 0 {
+			return ErrNoRecord
+		}
+
+		if count == 1 && user.Password == "" {
+			return ErrLastIdentity
+		}
+
+		return nil
+	})
+}
+
+func linkIdentity(tx *gorm.DB, userId uint, external ExternalIdentity) error {
+	identity := Identity{UserID: userId, Issuer: external.Issuer, Subject: external.Subject, Email: external.Email}
+
+	if err := tx.Create(&identity).Error; err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return ErrDuplicatedEntry
+		}
+		return err
+	}
+
+	return nil
+}
+
+// provisionUser creates a user without a password for an identity. It takes
+// the verified address of the identity if no other user has it.
+func provisionUser(tx *gorm.DB, external ExternalIdentity) (User, error) {
+	name, err := availableName(tx, external.Names)
+	if err != nil {
+		return User{}, err
+	}
+
+	user := User{Name: name, Role: RoleUser}
+
+	if external.Email != "" && external.EmailVerified {
+		var taken int64
+		if err := tx.Unscoped().Model(&User{}).Where("email = ?", external.Email).Count(&taken).Error; err != nil {
+			return User{}, err
+		}
+
+		if taken == 0 {
+			now := time.Now()
+			user.Email, user.EmailVerifiedAt = &external.Email, &now
+		}
+	}
+
+	if err := tx.Create(&user).Error; err != nil {
+		return User{}, err
+	}
+
+	if err := writeAudit(tx, AuditCreate, EntityUser, user.ID, nil, user); err != nil {
+		return User{}, err
+	}
+
+	data := events.User{ID: user.ID, Name: user.Name, Role: user.Role}
+	if err := writeEvent(tx, events.New(events.UserCreated, user.ID, int(user.ID), data)); err != nil {
+		return User{}, err
+	}
+
+	return user, nil
+}
+
+// Characters left out of the names of the provisioned users
+var nameRX = regexp.MustCompile(`[^a-zA-Z0-9._-]+`)
+
+// availableName makes a name from the first usable one of the candidates,
+// with a number appended if it is taken
+func availableName(tx *gorm.DB, candidates []string) (string, error) {
+	base := "user"
+	for _, candidate := range candidates {
+		candidate, _, _ = strings.Cut(candidate, "@")
+		candidate = nameRX.ReplaceAllString(candidate, "")
+
+		if candidate != "" {
+			base = candidate
+			break
+		}
+	}
+
+	// Names must start with a letter
+	if c := base[0]; !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z') {
+		base = "user" + base
+	}
+	if len(base) > 40 {
+		base = base[:40]
+	}
+
+	for i := 1; i <= 100; i++ {
+		name := base
+		if i > 1 {
+			name = fmt.Sprintf("%s-%d", base, i)
+		}
+
+		var taken int64
+		if err := tx.Unscoped().Model(&User{}).Where("name = ?", name).Count(&taken).Error; err != nil {
+			return "", err
+		}
+
+		if taken == 0 {
+			return name, nil
+		}
+	}
+
+	return "", fmt.Errorf("no available name for %q", base)
+}
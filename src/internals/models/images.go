@@ -0,0 +1,110 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"films-api.rdelgado.es/src/internals/events"
+	"gorm.io/gorm"
+)
+
+// Kinds of movie images, which are also the columns that hold them
+const (
+	ImagePoster   = "poster"
+	ImageBackdrop = "backdrop"
+)
+
+// ImagesURLPath is the path under which the blobs of the images are served
+const ImagesURLPath = "/images/"
+
+// Image is an uploaded image of a movie: the URL of the original file and of
+// its thumbnails by size name (small, medium, large)
+type Image struct {
+	URL         string
+	ContentType string
+	Width       int
+	Height      int
+	Thumbnails  map[string]string `json:",omitempty"`
+}
+
+// ImageURL is the URL of the blob with the key
+func ImageURL(key string) string {
+	return ImagesURLPath + key
+}
+
+// Keys returns the keys of the blobs of the image and its thumbnails
+func (i *Image) Keys() []string {
+	if i == nil {
+		return nil
+	}
+
+	keys := []string{strings.TrimPrefix(i.URL, ImagesURLPath)}
+	for _, url := range i.Thumbnails {
+		keys = append(keys, strings.TrimPrefix(url, ImagesURLPath))
+	}
+
+	return keys
+}
+
+// SetImage replaces the poster or backdrop of a movie and returns the previous one
+func (m *MovieModel) SetImage(id int, kind string, image *Image) (*Image, error) {
+	if kind != ImagePoster && kind != ImageBackdrop {
+		return nil, errors.New("unknown image kind " + kind)
+	}
+
+	var previous *Image
+
+	err := m.DB.Transaction(func(tx *gorm.DB) error {
+		var movie Movie
+		if err := tx.First(&movie, id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrNoRecord
+			}
+			return err
+		}
+
+		before := movie
+
+		update := Movie{Poster: image}
+		previous = movie.Poster
+		if kind == ImageBackdrop {
+			update = Movie{Backdrop: image}
+			previous = movie.Backdrop
+		}
+
+		if err := tx.Model(&movie).Select(kind).Updates(&update).Error; err != nil {
+			return err
+		}
+
+		if err := writeAudit(tx, AuditUpdate, EntityMovie, movie.ID, before, movie); err != nil {
+			return err
+		}
+
+		if err := BumpCatalogue(tx); err != nil {
+			return err
+		}
+
+		return writeEvent(tx, events.New(events.MovieUpdated, movie.ID, int(movie.UserID), movie))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return previous, nil
+}
+
+// deleteImages removes the blobs of the images of a movie. Missing blobs are
+// ignored, so a failed deletion can be retried.
+func (m *MovieModel) deleteImages(movie Movie) error {
+	if m.Blobs == nil {
+		return nil
+	}
+
+	keys := append(movie.Poster.Keys(), movie.Backdrop.Keys()...)
+	if len(keys) == 0 {
+		return nil
+	}
+
+	return m.Blobs.Delete(context.Background(), keys...)
+}
@@ -0,0 +1,134 @@
+package models
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// How the orphaned rows of a column are fixed
+const (
+	OrphanDelete   = "delete"
+	OrphanReassign = "reassign"
+)
+
+// orphanRule is a column that references the IDs of another table. Lists go
+// before their items, so the items of deleted lists are deleted too.
+type orphanRule struct {
+	table, column, parent, fix string
+}
+
+var orphanRules = []orphanRule{
+	{"lists", "user_id", "users", OrphanDelete},
+	{"movies", "user_id", "users", OrphanReassign},
+	{"favourites", "user_id", "users", OrphanDelete},
+	{"favourites", "movie_id", "movies", OrphanDelete},
+	{"list_items", "list_id", "lists", OrphanDelete},
+	{"list_items", "movie_id", "movies", OrphanDelete},
+}
+
+// Orphans are the rows of a table whose column references a missing row of
+// another table, left by databases created before the foreign keys
+type Orphans struct {
+	Table      string `json:"table"`
+	Column     string `json:"column"`
+	References string `json:"references"`
+	Rows       int64  `json:"rows"`
+	Fix        string `json:"fix"`
+}
+
+// FindOrphans counts the orphaned rows of every foreign key. Tables that do
+// not exist yet are skipped.
+func FindOrphans(db *gorm.DB) ([]Orphans, error) {
+	var found []Orphans
+
+	for _, rule := range orphanRules {
+		if !db.Migrator().HasTable(rule.table) || !db.Migrator().HasTable(rule.parent) {
+			continue
+		}
+
+		var rows int64
+		if err := db.Table(rule.table).Where(rule.orphaned()).Count(&rows).Error; err != nil {
+			return nil, err
+		}
+
+		if rows > 0 {
+			found = append(found, Orphans{Table: rule.table, Column: rule.column, References: rule.parent, Rows: rows, Fix: rule.fix})
+		}
+	}
+
+	return found, nil
+}
+
+// RepairOrphans deletes the orphaned rows, except the movies of missing users,
+// which are given to the owner. Movies are not deleted as other users may
+// have them as favourites. It returns the rows fixed.
+func RepairOrphans(db *gorm.DB, ownerId uint) ([]Orphans, error) {
+	var fixed []Orphans
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		for _, rule := range orphanRules {
+			if !tx.Migrator().HasTable(rule.table) || !tx.Migrator().HasTable(rule.parent) {
+				continue
+			}
+
+			var result *gorm.DB
+			if rule.fix == OrphanReassign {
+				var rows int64
+				if err := tx.Table(rule.table).Where(rule.orphaned()).Count(&rows).Error; err != nil {
+					return err
+				}
+				if rows > 0 && ownerId == 0 {
+					return fmt.Errorf("%d %s reference missing %s, an owner is needed to reassign them", rows, rule.table, rule.parent)
+				}
+
+				result = tx.Table(rule.table).Where(rule.orphaned()).Update(rule.column, ownerId)
+			} else {
+				result = tx.Exec("DELETE FROM " + rule.table + " WHERE " + rule.orphaned())
+			}
+
+			if err := result.Error; err != nil {
+				return err
+			}
+
+			if result.RowsAffected > 0 {
+				fixed = append(fixed, Orphans{Table: rule.table, Column: rule.column, References: rule.parent, Rows: result.RowsAffected, Fix: rule.fix})
+			}
+
+			// Repairs run before the migrations, the catalogue may not exist yet
+			if rule.table == "movies" && result.RowsAffected > 0 && tx.Migrator().HasTable(&Catalogue{}) {
+				if err := BumpCatalogue(tx); err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return fixed, nil
+}
+
+// orphaned is the condition of the rows whose reference is missing. Deleted
+// rows (in the trash) still exist for the foreign keys.
+func (r orphanRule) orphaned() string {
+	return fmt.Sprintf("NOT EXISTS (SELECT 1 FROM %[3]s WHERE %[3]s.id = %[1]s.%[2]s)", r.table, r.column, r.parent)
+}
+
+// referenced checks that the row of the model with the ID exists and is not
+// deleted, so it can be referenced by a new row
+func referenced(tx *gorm.DB, model interface{}, id int) error {
+	var count int64
+	if err := tx.Model(model).Where("id = ?", id).Count(&count).Error; err != nil {
+		return err
+	}
+
+	if count == 0 {
+		return ErrReferencedNotFound
+	}
+
+	return nil
+}
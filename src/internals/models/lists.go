@@ -0,0 +1,364 @@
+package models
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+const (
+	ListPublic   = "public"
+	ListUnlisted = "unlisted"
+	ListPrivate  = "private"
+)
+
+type ListModel struct {
+	DB *gorm.DB
+}
+
+type List struct {
+	gorm.Model
+	Name        string `gorm:"not null"`
+	Description string
+	Visibility  string `gorm:"not null; default:private"`
+	UserID      uint   `gorm:"index"`
+
+	// Only used for the foreign key, lists go with their user
+	User *User `json:"-" gorm:"constraint:OnDelete:CASCADE"`
+}
+
+type ListItem struct {
+	gorm.Model
+	ListID   uint `gorm:"uniqueIndex:idx_listid_movieid"`
+	MovieID  uint `gorm:"uniqueIndex:idx_listid_movieid"`
+	Position int  `gorm:"not null"`
+	Note     string
+
+	// Only used for the foreign keys, items go with their list and movie
+	List  *List  `json:"-" gorm:"constraint:OnDelete:CASCADE"`
+	Movie *Movie `json:"-" gorm:"constraint:OnDelete:CASCADE"`
+}
+
+type GetListItemInfo struct {
+	ItemID   uint   `gorm:"column:item_id"`
+	Position int    `gorm:"column:position"`
+	Note     string `gorm:"column:note"`
+	Movie    Movie  `gorm:"embedded"`
+}
+
+type ListDetails struct {
+	List  `json:"list"`
+	Items []GetListItemInfo `json:"items"`
+}
+
+func (m *ListModel) Insert(userId int, name, description, visibility string) (int, error) {
+	list := &List{
+		Name:        name,
+		Description: description,
+		Visibility:  visibility,
+		UserID:      uint(userId),
+	}
+
+	result := m.DB.Create(list)
+	if err := result.Error; err != nil {
+		return 0, err
+	}
+
+	return int(list.ID), nil
+}
+
+func (m *ListModel) Get(id int) (List, error) {
+	var list List
+
+	result := m.DB.First(&list, id)
+	if err := result.Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return List{}, ErrNoRecord
+		} else {
+			return List{}, result.Error
+		}
+	}
+
+	return list, nil
+}
+
+// GetDetails returns the list and its movies sorted by position. Private lists
+// are only returned to their owner, any other caller gets ErrNoRecord so the
+// existence of the list is not leaked.
+func (m *ListModel) GetDetails(id, userId int) (ListDetails, error) {
+	list, err := m.Get(id)
+	if err != nil {
+		return ListDetails{}, err
+	}
+
+	if list.Visibility == ListPrivate && list.UserID != uint(userId) {
+		return ListDetails{}, ErrNoRecord
+	}
+
+	items := []GetListItemInfo{}
+
+	result := m.DB.Model(&ListItem{}).
+		Select("list_items.id AS item_id", "list_items.position", "list_items.note", "movies.*").
+		Joins("INNER JOIN movies ON list_items.movie_id = movies.id").
+		Where("list_items.list_id = ?", id).
+		Where("list_items.deleted_at IS NULL").
+		Where("movies.deleted_at IS NULL").
+		Order("list_items.position").
+		Scan(&items)
+
+	if err := result.Error; err != nil {
+		return ListDetails{}, err
+	}
+
+	return ListDetails{List: list, Items: items}, nil
+}
+
+// GetAllByUser returns every list created by the user, whatever its visibility
+func (m *ListModel) GetAllByUser(userId int) ([]List, error) {
+	var lists []List
+
+	result := m.DB.Where("user_id = ?", userId).Order("id").Find(&lists)
+	if err := result.Error; err != nil {
+		return nil, err
+	}
+
+	return lists, nil
+}
+
+// GetAllPublic returns the lists anyone can browse. Unlisted lists are
+// readable by ID but never listed here.
+func (m *ListModel) GetAllPublic() ([]List, error) {
+	var lists []List
+
+	result := m.DB.Where("visibility = ?", ListPublic).Order("id").Find(&lists)
+	if err := result.Error; err != nil {
+		return nil, err
+	}
+
+	return lists, nil
+}
+
+// Update changes the fields that are not nil, so the description can be
+// cleared with an empty one
+func (m *ListModel) Update(id, userId int, name, description, visibility *string) error {
+	updates := map[string]interface{}{}
+	if name != nil {
+		updates["name"] = *name
+	}
+	if description != nil {
+		updates["description"] = *description
+	}
+	if visibility != nil {
+		updates["visibility"] = *visibility
+	}
+
+	result := m.DB.Model(&List{}).
+		Where("id = ?", id).
+		Where("user_id = ?", userId).
+		Updates(updates)
+
+	if err := result.Error; err != nil {
+		return err
+	}
+
+	// return Not Found error if the list does not exist or belongs to another user
+	if result.RowsAffected == 0 && len(updates) > 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
+
+func (m *ListModel) Delete(id, userId int) error {
+	return m.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Unscoped().
+			Where("id = ?", id).
+			Where("user_id = ?", userId).
+			Delete(&List{})
+
+		if err := result.Error; err != nil {
+			return err
+		}
+
+		// return Not Found error if no record has been deleted
+		if result.RowsAffected == 0 {
+			return ErrNoRecord
+		}
+
+		return tx.Unscoped().Where("list_id = ?", id).Delete(&ListItem{}).Error
+	})
+}
+
+// AddItem appends a movie at the end of the list
+func (m *ListModel) AddItem(listId, userId, movieId int, note string) (int, error) {
+	item := ListItem{
+		ListID:  uint(listId),
+		MovieID: uint(movieId),
+		Note:    note,
+	}
+
+	err := m.DB.Transaction(func(tx *gorm.DB) error {
+		if err := ownedList(tx, listId, userId); err != nil {
+			return err
+		}
+
+		if err := referenced(tx, &Movie{}, movieId); err != nil {
+			return err
+		}
+
+		var last int
+		err := tx.Model(&ListItem{}).
+			Select("COALESCE(MAX(position), 0)").
+			Where("list_id = ?", listId).
+			Scan(&last).Error
+		if err != nil {
+			return err
+		}
+
+		item.Position = last + 1
+
+		return tx.Create(&item).Error
+	})
+
+	if err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return 0, ErrDuplicatedEntry
+		}
+		if errors.Is(err, gorm.ErrForeignKeyViolated) {
+			return 0, ErrReferencedNotFound
+		}
+
+		return 0, err
+	}
+
+	return int(item.ID), nil
+}
+
+func (m *ListModel) UpdateItemNote(listId, userId, itemId int, note string) error {
+	return m.DB.Transaction(func(tx *gorm.DB) error {
+		if err := ownedList(tx, listId, userId); err != nil {
+			return err
+		}
+
+		result := tx.Model(&ListItem{}).
+			Where("id = ?", itemId).
+			Where("list_id = ?", listId).
+			Update("note", note)
+
+		if err := result.Error; err != nil {
+			return err
+		}
+
+		if result.RowsAffected == 0 {
+			return ErrNoRecord
+		}
+
+		return nil
+	})
+}
+
+func (m *ListModel) RemoveItem(listId, userId, itemId int) error {
+	return m.DB.Transaction(func(tx *gorm.DB) error {
+		if err := ownedList(tx, listId, userId); err != nil {
+			return err
+		}
+
+		result := tx.Unscoped().
+			Where("id = ?", itemId).
+			Where("list_id = ?", listId).
+			Delete(&ListItem{})
+
+		if err := result.Error; err != nil {
+			return err
+		}
+
+		// return Not Found error if no record has been deleted
+		if result.RowsAffected == 0 {
+			return ErrNoRecord
+		}
+
+		return nil
+	})
+}
+
+// Reorder sets the position of every item in the list in a single transaction.
+// itemIds must contain each item of the list exactly once, in the new order,
+// otherwise ErrInvalidOrder is returned and nothing is changed. Items of movies
+// in the trash are not listed, so they are not in itemIds either: they keep
+// their place among the other items, to be shown again if the movie is
+// restored.
+func (m *ListModel) Reorder(listId, userId int, itemIds []int) error {
+	return m.DB.Transaction(func(tx *gorm.DB) error {
+		if err := ownedList(tx, listId, userId); err != nil {
+			return err
+		}
+
+		var all, visible []uint
+		err := tx.Model(&ListItem{}).Where("list_id = ?", listId).Order("position, id").Pluck("id", &all).Error
+		if err != nil {
+			return err
+		}
+
+		err = tx.Model(&ListItem{}).
+			Joins("INNER JOIN movies ON list_items.movie_id = movies.id").
+			Where("list_items.list_id = ?", listId).
+			Where("movies.deleted_at IS NULL").
+			Pluck("list_items.id", &visible).Error
+		if err != nil {
+			return err
+		}
+
+		if len(visible) != len(itemIds) {
+			return ErrInvalidOrder
+		}
+
+		shown := make(map[uint]bool, len(visible))
+		for _, id := range visible {
+			shown[id] = true
+		}
+
+		seen := make(map[uint]bool, len(itemIds))
+		for _, id := range itemIds {
+			if !shown[uint(id)] || seen[uint(id)] {
+				return ErrInvalidOrder
+			}
+			seen[uint(id)] = true
+		}
+
+		// The items of itemIds take the places of the visible items
+		next := 0
+		for i, id := range all {
+			if shown[id] {
+				id = uint(itemIds[next])
+				next++
+			}
+
+			err := tx.Model(&ListItem{}).Where("id = ?", id).Update("position", i+1).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// ownedList checks that the list exists and belongs to the user
+func ownedList(tx *gorm.DB, listId, userId int) error {
+	var list List
+
+	result := tx.Where("id = ?", listId).
+		Where("user_id = ?", userId).
+		Limit(1).
+		Find(&list)
+
+	if err := result.Error; err != nil {
+		return err
+	}
+
+	if result.RowsAffected == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
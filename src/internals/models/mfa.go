@@ -0,0 +1,315 @@
+package models
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"films-api.rdelgado.es/src/internals/totp"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// Recovery codes given when the second factor is enabled
+	RecoveryCodes = 10
+
+	// Failed codes in a row that lock the second factor for MFALockout
+	MaxMFAFailures = 5
+	MFALockout     = 15 * time.Minute
+)
+
+// RecoveryCode replaces a TOTP code once, for users who lost their device.
+// Only its hash is stored.
+type RecoveryCode struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+
+	UserID uint   `gorm:"index"`
+	Hash   string `gorm:"not null; size:64"`
+	UsedAt *time.Time
+
+	// Only used for the foreign key, codes go with their user
+	User *User `json:"-" gorm:"constraint:OnDelete:CASCADE"`
+}
+
+// StartTOTP begins the enrolment of the user in two-factor authentication and
+// returns the secret for their authenticator app. It is not enabled until a
+// code is confirmed with ConfirmTOTP.
+func (m *UserModel) StartTOTP(id int) (string, error) {
+	user, err := m.Get(id)
+	if err != nil {
+		return "", err
+	}
+
+	if user.TOTPEnabledAt != nil {
+		return "", ErrTOTPEnabled
+	}
+
+	secret, err := totp.NewSecret()
+	if err != nil {
+		return "", err
+	}
+
+	// The secret is not recorded in the audit log, nothing changes until it is confirmed
+	if err := m.DB.Model(&User{}).Where("id = ?", id).Update("totp_secret", secret).Error; err != nil {
+		return "", err
+	}
+
+	return secret, nil
+}
+
+// ConfirmTOTP enables two-factor authentication if the code matches the
+// secret of StartTOTP, and returns the recovery codes of the user
+func (m *UserModel) ConfirmTOTP(id int, code string, now time.Time) ([]string, error) {
+	var codes []string
+
+	err := m.DB.Transaction(func(tx *gorm.DB) error {
+		var user User
+		if err := tx.First(&user, id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrNoRecord
+			}
+			return err
+		}
+
+		if user.TOTPEnabledAt != nil {
+			return ErrTOTPEnabled
+		}
+		if user.TOTPSecret == "" {
+			return ErrNoRecord
+		}
+
+		counter, ok := totp.Validate(user.TOTPSecret, code, now, 0)
+		if !ok {
+			return ErrInvalidCredentials
+		}
+
+		updates := map[string]interface{}{"totp_enabled_at": now, "totp_counter": counter}
+		if err := updateUser(tx, updates, "id = ?", id); err != nil {
+			return err
+		}
+
+		var err error
+		codes, err = newRecoveryCodes(tx, user.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// DisableTOTP turns two-factor authentication off if the password is right
+func (m *UserModel) DisableTOTP(id int, password string) error {
+	user, err := m.Get(id)
+	if err != nil {
+		return err
+	}
+
+	if err := checkPassword(user, password); err != nil {
+		return err
+	}
+
+	if user.TOTPEnabledAt == nil {
+		return ErrNoRecord
+	}
+
+	return m.DB.Transaction(func(tx *gorm.DB) error {
+		return resetTOTP(tx, "id = ?", id)
+	})
+}
+
+// ResetTOTP turns two-factor authentication off for a user who lost their
+// device and recovery codes
+func (m *UserModel) ResetTOTP(name string) error {
+	return m.DB.Transaction(func(tx *gorm.DB) error {
+		return resetTOTP(tx, "name = ?", name)
+	})
+}
+
+func resetTOTP(tx *gorm.DB, query string, args ...interface{}) error {
+	updates := map[string]interface{}{
+		"totp_secret":      "",
+		"totp_enabled_at":  nil,
+		"totp_counter":     0,
+		"mfa_failures":     0,
+		"mfa_locked_until": nil,
+	}
+	if err := updateUser(tx, updates, query, args...); err != nil {
+		return err
+	}
+
+	users := tx.Model(&User{}).Select("id").Where(query, args...)
+	return tx.Where("user_id IN (?)", users).Delete(&RecoveryCode{}).Error
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes of the user, after
+// checking a code of their second factor
+func (m *UserModel) RegenerateRecoveryCodes(id int, code string, now time.Time) ([]string, error) {
+	if err := m.VerifySecondFactor(id, code, now); err != nil {
+		return nil, err
+	}
+
+	var codes []string
+
+	err := m.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		codes, err = newRecoveryCodes(tx, uint(id))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// VerifySecondFactor checks a TOTP or recovery code of the user. TOTP codes
+// and recovery codes can only be used once. After MaxMFAFailures wrong codes
+// in a row the second factor is locked for MFALockout, returning ErrMFALocked.
+func (m *UserModel) VerifySecondFactor(id int, code string, now time.Time) error {
+	verified := false
+
+	err := m.DB.Transaction(func(tx *gorm.DB) error {
+		var user User
+		if err := tx.First(&user, id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrNoRecord
+			}
+			return err
+		}
+
+		if user.TOTPEnabledAt == nil {
+			return ErrInvalidCredentials
+		}
+		if user.MFALockedUntil != nil && now.Before(*user.MFALockedUntil) {
+			return ErrMFALocked
+		}
+
+		updates := map[string]interface{}{"mfa_failures": 0, "mfa_locked_until": nil}
+
+		code = strings.TrimSpace(code)
+		if counter, ok := totp.Validate(user.TOTPSecret, code, now, user.TOTPCounter); ok {
+			verified = true
+			updates["totp_counter"] = counter
+		} else {
+			result := tx.Model(&RecoveryCode{}).
+				Where("user_id = ? AND hash = ? AND used_at IS NULL", user.ID, hashToken(normalizeRecoveryCode(code))).
+				Update("used_at", now)
+			if err := result.Error; err != nil {
+				return err
+			}
+			verified = result.RowsAffected > 0
+		}
+
+		if !verified {
+			updates["mfa_failures"] = user.MFAFailures + 1
+			if user.MFAFailures+1 >= MaxMFAFailures {
+				updates["mfa_failures"] = 0
+				updates["mfa_locked_until"] = now.Add(MFALockout)
+			}
+		}
+
+		// The failures are saved even though the code is wrong
+		return tx.Model(&User{}).Where("id = ?", user.ID).Updates(updates).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	if !verified {
+		return ErrInvalidCredentials
+	}
+
+	return nil
+}
+
+// newRecoveryCodes replaces the recovery codes of the user and returns them
+func newRecoveryCodes(tx *gorm.DB, userId uint) ([]string, error) {
+	if err := tx.Where("user_id = ?", userId).Delete(&RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, RecoveryCodes)
+	records := make([]RecoveryCode, 0, RecoveryCodes)
+
+	for i := 0; i < RecoveryCodes; i++ {
+		random := make([]byte, 10)
+		if _, err := rand.Read(random); err != nil {
+			return nil, err
+		}
+
+		// 16 characters in groups of 4, easy to write down
+		code := strings.ToLower(base32.StdEncoding.EncodeToString(random))
+		code = code[0:4] + "-" + code[4:8] + "-" + code[8:12] + "-" + code[12:16]
+
+		codes = append(codes, code)
+		records = append(records, RecoveryCode{UserID: userId, Hash: hashToken(normalizeRecoveryCode(code))})
+	}
+
+	if err := tx.Create(&records).Error; err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// normalizeRecoveryCode accepts the codes in any case, with or without dashes and spaces
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
+
+// Setting is a value of the settings of the API changed by the admins
+type Setting struct {
+	Key       string `gorm:"primarykey; size:64"`
+	Value     string `gorm:"type:text; not null"`
+	UpdatedAt time.Time
+}
+
+// Keys of the settings
+const settingMFARequiredRoles = "mfa_required_roles"
+
+type SettingsModel struct {
+	DB *gorm.DB
+}
+
+// MFARequiredRoles returns the roles whose users must enable two-factor authentication
+func (m *SettingsModel) MFARequiredRoles() ([]string, error) {
+	roles := []string{}
+	return roles, m.get(settingMFARequiredRoles, &roles)
+}
+
+func (m *SettingsModel) SetMFARequiredRoles(roles []string) error {
+	return m.set(settingMFARequiredRoles, roles)
+}
+
+// get decodes the JSON value of a setting. Missing settings leave value as is.
+func (m *SettingsModel) get(key string, value interface{}) error {
+	var setting Setting
+
+	result := m.DB.Where("`key` = ?", key).Limit(1).Find(&setting)
+	if err := result.Error; err != nil {
+		return err
+	}
+
+	if result.RowsAffected == 0 {
+		return nil
+	}
+
+	return json.Unmarshal([]byte(setting.Value), value)
+}
+
+func (m *SettingsModel) set(key string, value interface{}) error {
+	content, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	setting := Setting{Key: key, Value: string(content)}
+	return m.DB.Clauses(clause.OnConflict{UpdateAll: true}).Create(&setting).Error
+}
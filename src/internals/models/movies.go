@@ -1,15 +1,23 @@
 package models
 
 import (
+	"context"
 	"errors"
-	"fmt"
 	"time"
 
+	"films-api.rdelgado.es/src/internals/events"
+	"films-api.rdelgado.es/src/internals/storage"
 	"gorm.io/gorm"
 )
 
 type MovieModel struct {
 	DB *gorm.DB
+
+	// Store of the images, deleted when the movies are purged
+	Blobs storage.BlobStore
+
+	// Time the deleted movies are kept in the trash before they are purged
+	TrashRetention time.Duration
 }
 
 type Cast []string
@@ -23,6 +31,8 @@ type Movie struct {
 	Cast        Cast      `gorm:"serializer:json"`
 	Genre       string    `gorm:"not null"`
 	Synopsis    string    `gorm:"not null"`
+	Poster      *Image    `gorm:"serializer:json"`
+	Backdrop    *Image    `gorm:"serializer:json"`
 
 	UserID uint
 }
@@ -32,6 +42,12 @@ type MovieAndAuthor struct {
 	CreatedBy `json:"created_by"`
 }
 
+// TrashedMovie is a deleted movie, which can be restored until PurgeAt
+type TrashedMovie struct {
+	Movie   `json:"movie"`
+	PurgeAt time.Time `json:"purge_at"`
+}
+
 type CreatedBy struct {
 	Name   string `json:"name"`
 	UserId uint   `json:"userId"`
@@ -40,6 +56,56 @@ type CreatedBy struct {
 func (m *MovieModel) GetAll(filters map[string]interface{}) ([]Movie, error) {
 	var movies []Movie
 
+	result := m.filter(filters).Model(&Movie{}).Find(&movies)
+	if err := result.Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNoRecord
+		} else {
+			return nil, result.Error
+		}
+	}
+
+	return movies, nil
+}
+
+// GetPage returns one page of the movies matching the filters, ordered by ID,
+// and the total number of matching movies
+func (m *MovieModel) GetPage(filters map[string]interface{}, offset, limit int) ([]Movie, int64, error) {
+	var movies []Movie
+	var total int64
+
+	result := m.filter(filters).Model(&Movie{}).Count(&total)
+	if err := result.Error; err != nil {
+		return nil, 0, err
+	}
+
+	result = m.filter(filters).Model(&Movie{}).Order("id").Offset(offset).Limit(limit).Find(&movies)
+	if err := result.Error; err != nil {
+		return nil, 0, err
+	}
+
+	return movies, total, nil
+}
+
+// Each calls fn for every movie matching the filters, loading them from the
+// database in batches so the whole catalogue is never kept in memory
+func (m *MovieModel) Each(filters map[string]interface{}, batchSize int, fn func(Movie) error) error {
+	var batch []Movie
+
+	result := m.filter(filters).Model(&Movie{}).Order("id").FindInBatches(&batch, batchSize, func(tx *gorm.DB, _ int) error {
+		for _, movie := range batch {
+			if err := fn(movie); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	return result.Error
+}
+
+// filter builds the query used to search movies by title, genre and release year
+func (m *MovieModel) filter(filters map[string]interface{}) *gorm.DB {
 	query := m.DB
 	title, exists := filters["title"]
 	if exists {
@@ -49,7 +115,6 @@ func (m *MovieModel) GetAll(filters map[string]interface{}) ([]Movie, error) {
 	genre, exists := filters["genre"]
 	if exists {
 		query = query.Where("genre = ?", genre)
-		fmt.Print(genre)
 	}
 
 	year, exists := filters["year"]
@@ -59,16 +124,7 @@ func (m *MovieModel) GetAll(filters map[string]interface{}) ([]Movie, error) {
 		query = query.Where("release_date >= ? AND release_date < ?", startDate, endDate)
 	}
 
-	result := query.Model(&Movie{}).Find(&movies)
-	if err := result.Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, ErrNoRecord
-		} else {
-			return nil, result.Error
-		}
-	}
-
-	return movies, nil
+	return query
 }
 
 func (m *MovieModel) GetMovieAndAuthor(id int) (MovieAndAuthor, error) {
@@ -88,6 +144,11 @@ func (m *MovieModel) GetMovieAndAuthor(id int) (MovieAndAuthor, error) {
 		}
 	}
 
+	// Scan does not return ErrRecordNotFound when no row matches
+	if result.RowsAffected == 0 {
+		return MovieAndAuthor{}, ErrNoRecord
+	}
+
 	return movie, nil
 }
 
@@ -106,13 +167,78 @@ func (m *MovieModel) Get(id int) (Movie, error) {
 	return movie, nil
 }
 
-func (m *MovieModel) Update(movie Movie) error {
-	result := m.DB.Save(&movie)
+// GetByTitle returns the movie with the title. Titles stay taken while their
+// movies are in the trash, so ErrTitleInTrash is returned for those.
+func (m *MovieModel) GetByTitle(title string) (Movie, error) {
+	var movie Movie
+
+	// Find is used instead of First so imports do not log every new title as an error
+	result := m.DB.Unscoped().Where("title = ?", title).Limit(1).Find(&movie)
 	if err := result.Error; err != nil {
+		return Movie{}, err
+	}
+
+	if result.RowsAffected == 0 {
+		return Movie{}, ErrNoRecord
+	}
+
+	if movie.DeletedAt.Valid {
+		return Movie{}, ErrTitleInTrash
+	}
+
+	return movie, nil
+}
+
+// duplicatedTitle tells apart the titles taken by a movie of the trash, which
+// the user cannot see, from the ones taken by a movie of the catalogue
+func duplicatedTitle(tx *gorm.DB, title string) error {
+	var trashed int64
+	if err := tx.Unscoped().Model(&Movie{}).Where("title = ? AND deleted_at IS NOT NULL", title).Count(&trashed).Error; err != nil {
 		return err
 	}
 
-	return nil
+	if trashed > 0 {
+		return ErrTitleInTrash
+	}
+	return ErrDuplicatedEntry
+}
+
+// WithContext returns a copy of the model whose changes are recorded in the
+// audit log with the actor of ctx
+func (m *MovieModel) WithContext(ctx context.Context) *MovieModel {
+	return &MovieModel{DB: m.DB.WithContext(ctx), Blobs: m.Blobs, TrashRetention: m.TrashRetention}
+}
+
+// Update saves the movie. Only its creator can change it, so the event is
+// attributed to them.
+func (m *MovieModel) Update(movie Movie) error {
+	return m.DB.Transaction(func(tx *gorm.DB) error {
+		var before Movie
+		if err := tx.First(&before, movie.ID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrNoRecord
+			}
+			return err
+		}
+
+		result := tx.Save(&movie)
+		if err := result.Error; err != nil {
+			if errors.Is(err, gorm.ErrDuplicatedKey) {
+				return duplicatedTitle(tx, movie.Title)
+			}
+			return err
+		}
+
+		if err := writeAudit(tx, AuditUpdate, EntityMovie, movie.ID, before, movie); err != nil {
+			return err
+		}
+
+		if err := BumpCatalogue(tx); err != nil {
+			return err
+		}
+
+		return writeEvent(tx, events.New(events.MovieUpdated, movie.ID, int(movie.UserID), movie))
+	})
 }
 
 func (m *MovieModel) Insert(title, director, genre, synopsis string, releaseDate time.Time, cast []string, userId int) (int, error) {
@@ -126,10 +252,27 @@ func (m *MovieModel) Insert(title, director, genre, synopsis string, releaseDate
 		UserID:      uint(userId),
 	}
 
-	result := m.DB.Create(movie)
-	if err := result.Error; err != nil {
-		if errors.Is(err, gorm.ErrDuplicatedKey) {
-			return 0, ErrDuplicatedEntry
+	err := m.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(movie).Error; err != nil {
+			if errors.Is(err, gorm.ErrDuplicatedKey) {
+				return duplicatedTitle(tx, movie.Title)
+			}
+			return err
+		}
+
+		if err := writeAudit(tx, AuditCreate, EntityMovie, movie.ID, nil, movie); err != nil {
+			return err
+		}
+
+		if err := BumpCatalogue(tx); err != nil {
+			return err
+		}
+
+		return writeEvent(tx, events.New(events.MovieCreated, movie.ID, userId, movie))
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrForeignKeyViolated) {
+			return 0, ErrReferencedNotFound
 		} else {
 			return 0, err
 		}
@@ -151,10 +294,146 @@ func (m *MovieModel) Delete(id, userId int) error {
 		return ErrNotAuthorized
 	}
 
-	result := m.DB.Unscoped().Delete(&Movie{}, id)
+	// The movie is moved to the trash. Its images, favourites and list items
+	// are kept (but hidden) until it is restored or purged.
+	return m.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Delete(&Movie{}, id)
+		if err := result.Error; err != nil {
+			return err
+		}
+
+		if err := writeAudit(tx, AuditDelete, EntityMovie, movie.ID, movie, nil); err != nil {
+			return err
+		}
+
+		if err := BumpCatalogue(tx); err != nil {
+			return err
+		}
+
+		return writeEvent(tx, events.New(events.MovieDeleted, movie.ID, userId, events.Deleted{ID: movie.ID}))
+	})
+}
+
+// GetTrash returns the deleted movies of the user, most recently deleted first
+func (m *MovieModel) GetTrash(userId int) ([]TrashedMovie, error) {
+	var movies []Movie
+
+	result := m.DB.Unscoped().
+		Where("user_id = ?", userId).
+		Where("deleted_at IS NOT NULL").
+		Order("deleted_at DESC").
+		Find(&movies)
 	if err := result.Error; err != nil {
-		return err
-	} else {
-		return nil
+		return nil, err
+	}
+
+	trash := make([]TrashedMovie, 0, len(movies))
+	for _, movie := range movies {
+		trash = append(trash, TrashedMovie{Movie: movie, PurgeAt: movie.DeletedAt.Time.Add(m.TrashRetention)})
+	}
+
+	return trash, nil
+}
+
+// Restore takes a movie of the user out of the trash, with its favourites and
+// list items
+func (m *MovieModel) Restore(id, userId int) (Movie, error) {
+	var movie Movie
+
+	err := m.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Unscoped().Where("deleted_at IS NOT NULL").Limit(1).Find(&movie, id)
+		if err := result.Error; err != nil {
+			return err
+		}
+
+		if result.RowsAffected == 0 {
+			return ErrNoRecord
+		}
+
+		// Only the user who deleted the movie (its creator) can restore it
+		if movie.UserID != uint(userId) {
+			return ErrNotAuthorized
+		}
+
+		before := movie
+
+		if err := tx.Unscoped().Model(&movie).Update("deleted_at", nil).Error; err != nil {
+			return err
+		}
+		movie.DeletedAt = gorm.DeletedAt{}
+
+		if err := writeAudit(tx, AuditRestore, EntityMovie, movie.ID, before, movie); err != nil {
+			return err
+		}
+
+		if err := BumpCatalogue(tx); err != nil {
+			return err
+		}
+
+		return writeEvent(tx, events.New(events.MovieRestored, movie.ID, userId, movie))
+	})
+	if err != nil {
+		return Movie{}, err
+	}
+
+	return movie, nil
+}
+
+// PurgeExpired deletes for good up to limit movies that have been in the trash
+// longer than the retention, and returns how many it deleted
+func (m *MovieModel) PurgeExpired(now time.Time, limit int) (int, error) {
+	var movies []Movie
+
+	result := m.DB.Unscoped().
+		Where("deleted_at < ?", now.Add(-m.TrashRetention)).
+		Order("deleted_at").
+		Limit(limit).
+		Find(&movies)
+	if err := result.Error; err != nil {
+		return 0, err
+	}
+
+	for i, movie := range movies {
+		if err := m.purge(movie); err != nil {
+			return i, err
+		}
 	}
+
+	return len(movies), nil
+}
+
+// purge deletes a movie of the trash with the favourites and list items that
+// reference it. The rows are only deleted if its images are, so no blob is
+// left behind.
+func (m *MovieModel) purge(movie Movie) error {
+	return m.DB.Transaction(func(tx *gorm.DB) error {
+		var favourites []Favourite
+		if err := tx.Unscoped().Where("movie_id = ?", movie.ID).Find(&favourites).Error; err != nil {
+			return err
+		}
+
+		for _, favourite := range favourites {
+			if err := deleteFavourite(tx, favourite); err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Unscoped().Where("movie_id = ?", movie.ID).Delete(&ListItem{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Unscoped().Delete(&Movie{}, movie.ID).Error; err != nil {
+			return err
+		}
+
+		if err := BumpCatalogue(tx); err != nil {
+			return err
+		}
+
+		if err := writeAudit(tx, AuditPurge, EntityMovie, movie.ID, movie, nil); err != nil {
+			return err
+		}
+
+		return m.deleteImages(movie)
+	})
 }
@@ -0,0 +1,102 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Purposes of the one-time tokens
+const (
+	TokenVerifyEmail   = "verify_email"
+	TokenResetPassword = "reset_password"
+)
+
+// OneTimeToken is a secret sent to a user by email to verify their address or
+// reset their password. Only its hash is stored, and it can be used once
+// before it expires.
+type OneTimeToken struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+
+	UserID  uint   `gorm:"index"`
+	Purpose string `gorm:"not null; size:32"`
+	Hash    string `gorm:"not null; size:64; uniqueIndex"`
+
+	// Address the token was sent to
+	Email string `gorm:"not null"`
+
+	ExpiresAt time.Time `gorm:"not null"`
+	UsedAt    *time.Time
+
+	// Only used for the foreign key, tokens go with their user
+	User *User `json:"-" gorm:"constraint:OnDelete:CASCADE"`
+}
+
+// newOneTimeToken saves a token of the user for the purpose and returns it.
+// The previous tokens of the purpose are deleted, so only the last one sent
+// can be used.
+func newOneTimeToken(tx *gorm.DB, userId uint, purpose, email string, ttl time.Duration) (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(secret)
+
+	if err := tx.Where("user_id = ? AND purpose = ?", userId, purpose).Delete(&OneTimeToken{}).Error; err != nil {
+		return "", err
+	}
+
+	record := OneTimeToken{
+		UserID:    userId,
+		Purpose:   purpose,
+		Hash:      hashToken(token),
+		Email:     email,
+		ExpiresAt: time.Now().Add(ttl),
+	}
+	if err := tx.Create(&record).Error; err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// useOneTimeToken marks a token of the purpose as used and returns it. It
+// returns ErrInvalidOneTimeToken if the token does not exist, has expired or
+// was already used.
+func useOneTimeToken(tx *gorm.DB, token, purpose string, now time.Time) (OneTimeToken, error) {
+	var record OneTimeToken
+
+	result := tx.Where("hash = ? AND purpose = ?", hashToken(token), purpose).
+		Where("used_at IS NULL AND expires_at > ?", now).
+		Limit(1).
+		Find(&record)
+	if err := result.Error; err != nil {
+		return OneTimeToken{}, err
+	}
+
+	if result.RowsAffected == 0 {
+		return OneTimeToken{}, ErrInvalidOneTimeToken
+	}
+
+	// Another request may have used it in the meantime
+	result = tx.Model(&OneTimeToken{}).Where("id = ? AND used_at IS NULL", record.ID).Update("used_at", now)
+	if err := result.Error; err != nil {
+		return OneTimeToken{}, err
+	}
+
+	if result.RowsAffected == 0 {
+		return OneTimeToken{}, ErrInvalidOneTimeToken
+	}
+
+	return record, nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,99 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"films-api.rdelgado.es/src/internals/events"
+	"gorm.io/gorm"
+)
+
+type OutboxModel struct {
+	DB *gorm.DB
+}
+
+// OutboxEvent is an event saved in the transaction of the change that causes
+// it, until it is published
+type OutboxEvent struct {
+	ID          uint   `gorm:"primarykey"`
+	EventID     string `gorm:"not null; size:32; uniqueIndex"`
+	Type        string `gorm:"not null"`
+	Aggregate   string `gorm:"not null; size:32; index:idx_outbox_aggregate"`
+	AggregateID uint   `gorm:"not null; index:idx_outbox_aggregate"`
+	Payload     string `gorm:"type:text; not null"`
+	CreatedAt   time.Time
+	PublishedAt *time.Time `gorm:"index"`
+
+	// Failed attempts to publish the event and the error of the last one
+	Attempts      int `gorm:"not null; default:0"`
+	NextAttemptAt *time.Time
+	LastError     string
+}
+
+// Event decodes the payload of the row
+func (e OutboxEvent) Event() (events.Event, error) {
+	var event events.Event
+	err := json.Unmarshal([]byte(e.Payload), &event)
+
+	return event, err
+}
+
+// writeEvent saves an event in the outbox. It must be called with the
+// transaction of the change, so both are saved or none is.
+func writeEvent(tx *gorm.DB, event events.Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	return tx.Create(&OutboxEvent{
+		EventID:     event.ID,
+		Type:        event.Type,
+		Aggregate:   event.Aggregate,
+		AggregateID: event.AggregateID,
+		Payload:     string(payload),
+		CreatedAt:   event.CreatedAt,
+	}).Error
+}
+
+// Pending returns the oldest unpublished event of each aggregate, if it is
+// due at now. Later events of an aggregate wait for the earlier ones, so
+// they are published in order.
+func (m *OutboxModel) Pending(now time.Time, limit int) ([]OutboxEvent, error) {
+	var pending []OutboxEvent
+
+	result := m.DB.Table("outbox_events AS o").
+		Where("o.published_at IS NULL").
+		Where("o.next_attempt_at IS NULL OR o.next_attempt_at <= ?", now).
+		Where(`NOT EXISTS (SELECT 1 FROM outbox_events AS e WHERE e.published_at IS NULL
+			AND e.aggregate = o.aggregate AND e.aggregate_id = o.aggregate_id AND e.id < o.id)`).
+		Order("o.id").Limit(limit).Find(&pending)
+	if err := result.Error; err != nil {
+		return nil, err
+	}
+
+	return pending, nil
+}
+
+func (m *OutboxModel) MarkPublished(id uint, publishedAt time.Time) error {
+	return m.DB.Model(&OutboxEvent{ID: id}).Updates(map[string]interface{}{
+		"published_at":    publishedAt,
+		"next_attempt_at": nil,
+		"last_error":      "",
+	}).Error
+}
+
+// MarkFailed counts a failed attempt and sets when the event is tried again
+func (m *OutboxModel) MarkFailed(id uint, nextAttemptAt time.Time, reason string) error {
+	return m.DB.Model(&OutboxEvent{ID: id}).Updates(map[string]interface{}{
+		"attempts":        gorm.Expr("attempts + 1"),
+		"next_attempt_at": nextAttemptAt,
+		"last_error":      reason,
+	}).Error
+}
+
+// Purge deletes the events published before a time and returns how many
+func (m *OutboxModel) Purge(before time.Time) (int64, error) {
+	result := m.DB.Where("published_at < ?", before).Delete(&OutboxEvent{})
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,156 @@
+package models
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Session is a login of a user on a device. The access tokens carry the key
+// of their session, so deleting it logs the device out.
+type Session struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+
+	UserID uint   `gorm:"index"`
+	Key    string `json:"-" gorm:"column:session_key; not null; size:64; uniqueIndex"`
+
+	// Device of the login, as told by the client
+	UserAgent string `gorm:"size:512"`
+	IP        string `gorm:"size:45"`
+
+	LastSeenAt time.Time `gorm:"not null"`
+	ExpiresAt  time.Time `gorm:"not null"`
+
+	// Only used for the foreign key, sessions go with their user
+	User *User `json:"-" gorm:"constraint:OnDelete:CASCADE"`
+}
+
+type SessionModel struct {
+	DB *gorm.DB
+}
+
+// Create starts a session of the user, valid for the lifetime of its token.
+// The expired sessions are deleted on the way.
+func (m *SessionModel) Create(userId int, userAgent, ip string, ttl time.Duration) (Session, error) {
+	now := time.Now()
+
+	if err := m.DB.Where("expires_at <= ?", now).Delete(&Session{}).Error; err != nil {
+		return Session{}, err
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return Session{}, err
+	}
+
+	if len(userAgent) > 512 {
+		userAgent = userAgent[:512]
+	}
+
+	session := Session{
+		UserID:     uint(userId),
+		Key:        base64.RawURLEncoding.EncodeToString(secret),
+		UserAgent:  userAgent,
+		IP:         ip,
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(ttl),
+	}
+
+	return session, m.DB.Create(&session).Error
+}
+
+// Touch reports if the session of the user is active, and records that it
+// was seen now
+func (m *SessionModel) Touch(key string, userId int, now time.Time) (bool, error) {
+	result := m.DB.Model(&Session{}).
+		Where("session_key = ? AND user_id = ? AND expires_at > ?", key, userId, now).
+		Update("last_seen_at", now)
+	if err := result.Error; err != nil {
+		return false, err
+	}
+
+	return result.RowsAffected > 0, nil
+}
+
+// Refresh extends an active session of the user, whose token is renewed. It
+// returns ErrNoRecord if it does not exist or has expired.
+func (m *SessionModel) Refresh(key string, userId int, ttl time.Duration) error {
+	now := time.Now()
+
+	result := m.DB.Model(&Session{}).
+		Where("session_key = ? AND user_id = ? AND expires_at > ?", key, userId, now).
+		Updates(map[string]interface{}{"last_seen_at": now, "expires_at": now.Add(ttl)})
+	if err := result.Error; err != nil {
+		return err
+	}
+	if result.RowsAffected == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
+
+// GetAll returns the active sessions of the user, the last seen first
+func (m *SessionModel) GetAll(userId int) ([]Session, error) {
+	sessions := []Session{}
+
+	err := m.DB.Where("user_id = ? AND expires_at > ?", userId, time.Now()).
+		Order("last_seen_at DESC").
+		Order("id DESC").
+		Find(&sessions).Error
+
+	return sessions, err
+}
+
+// Delete ends a session of the user and returns it, so its key can be
+// forgotten. It returns ErrNoRecord if it does not exist.
+func (m *SessionModel) Delete(id, userId int) (Session, error) {
+	var session Session
+
+	err := m.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("id = ? AND user_id = ?", id, userId).Limit(1).Find(&session)
+		if err := result.Error; err != nil {
+			return err
+		}
+		if result.RowsAffected == 0 {
+			return ErrNoRecord
+		}
+
+		return tx.Delete(&session).Error
+	})
+	if err != nil {
+		return Session{}, err
+	}
+
+	return session, nil
+}
+
+// WithContext returns a copy of the model whose changes are recorded in the
+// audit log with the actor of ctx
+func (m *SessionModel) WithContext(ctx context.Context) *SessionModel {
+	return &SessionModel{DB: m.DB.WithContext(ctx)}
+}
+
+// DeleteAll ends every session of the user and returns their keys. The token
+// version is increased too, revoking the tokens issued before the sessions,
+// as any other revocation of the tokens of the user.
+func (m *SessionModel) DeleteAll(userId int) ([]string, error) {
+	var keys []string
+
+	err := m.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&Session{}).Where("user_id = ?", userId).Pluck("session_key", &keys).Error; err != nil {
+			return err
+		}
+
+		return updateUser(tx, map[string]interface{}{"token_version": gorm.Expr("token_version + 1")}, "id = ?", userId)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
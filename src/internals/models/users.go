@@ -1,22 +1,83 @@
 package models
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"time"
 
+	"films-api.rdelgado.es/src/internals/events"
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
 
+const (
+	RoleUser   = "user"
+	RoleEditor = "editor"
+	RoleAdmin  = "admin"
+)
+
+var Roles = []string{RoleUser, RoleEditor, RoleAdmin}
+
 type UserModel struct {
 	DB *gorm.DB
 }
 
 type User struct {
 	gorm.Model
-	Name      string `gorm:"unique; not null"`
-	Password  string `gorm:"not null"`
-	Favorites []Favourite
-	Movie     []Movie
+	Name      string      `gorm:"unique; not null"`
+	Password  string      `gorm:"not null"`
+	Role      string      `gorm:"not null; default:user"`
+	Disabled  bool        `gorm:"not null; default:false"`
+	Favorites []Favourite `gorm:"constraint:OnDelete:CASCADE"`
+
+	// Version of the valid access tokens, increased to revoke them
+	TokenVersion int `gorm:"not null; default:0"`
+
+	// Optional address to reset the password, which must be verified first
+	Email           *string `gorm:"size:255; uniqueIndex"`
+	EmailVerifiedAt *time.Time
+
+	// Second factor: the secret is set when the enrolment starts and enabled
+	// once a code is confirmed. TOTPCounter is the last period used, so codes
+	// cannot be used twice.
+	TOTPSecret     string `json:"-"`
+	TOTPEnabledAt  *time.Time
+	TOTPCounter    int64      `json:"-" gorm:"not null; default:0"`
+	MFAFailures    int        `json:"-" gorm:"not null; default:0"`
+	MFALockedUntil *time.Time `json:"-"`
+
+	// Movies must be deleted or given to another user before their creator
+	Movie []Movie `gorm:"constraint:OnDelete:RESTRICT"`
+}
+
+// Profile is what users see of their own account
+type Profile struct {
+	ID            uint
+	CreatedAt     time.Time
+	Name          string
+	Role          string
+	Email         *string
+	EmailVerified bool
+	MFAEnabled    bool
+}
+
+func (u User) Profile() Profile {
+	return Profile{
+		ID:            u.ID,
+		CreatedAt:     u.CreatedAt,
+		Name:          u.Name,
+		Role:          u.Role,
+		Email:         u.Email,
+		EmailVerified: u.EmailVerifiedAt != nil,
+		MFAEnabled:    u.TOTPEnabledAt != nil,
+	}
+}
+
+// WithContext returns a copy of the model whose changes are recorded in the
+// audit log with the actor of ctx
+func (m *UserModel) WithContext(ctx context.Context) *UserModel {
+	return &UserModel{DB: m.DB.WithContext(ctx)}
 }
 
 func (m *UserModel) Authenticate(name, password string) (int, error) {
@@ -32,24 +93,66 @@ func (m *UserModel) Authenticate(name, password string) (int, error) {
 		}
 	}
 
+	// Disabled users cannot log in
+	if user.Disabled {
+		return 0, ErrInvalidCredentials
+	}
+
 	// Check whether if password submitted hash is equal to saved password hash in DB
-	err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password))
-	if err != nil {
-		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
-			return 0, ErrInvalidCredentials
-		} else {
-			return 0, nil
-		}
+	if err := checkPassword(user, password); err != nil {
+		return 0, err
 	}
 
 	return int(user.ID), nil
 }
 
-func (m *UserModel) Exists(id int) (bool, error) {
+// UserStatus is what the API needs to know of a user to accept their tokens,
+// and to check the routes that depend on their role
+type UserStatus struct {
+	Exists       bool
+	Disabled     bool
+	TokenVersion int
+	Role         string
+
+	// Two-factor authentication is enabled
+	MFAEnabled bool
+}
+
+// Accepts reports if the user can use a token of the version
+func (s UserStatus) Accepts(tokenVersion int) bool {
+	return s.Exists && !s.Disabled && s.TokenVersion == tokenVersion
+}
+
+// Status returns the status of the user, which does not exist if it was deleted
+func (m *UserModel) Status(id int) (UserStatus, error) {
+	var user User
+
+	r := m.DB.Select("id", "disabled", "token_version", "role", "totp_enabled_at").Where("`id` = ?", id).Limit(1).Find(&user)
+	if err := r.Error; err != nil {
+		return UserStatus{}, err
+	}
+	if r.RowsAffected == 0 {
+		return UserStatus{}, nil
+	}
+
+	return UserStatus{
+		Exists:       true,
+		Disabled:     user.Disabled,
+		TokenVersion: user.TokenVersion,
+		Role:         user.Role,
+		MFAEnabled:   user.TOTPEnabledAt != nil,
+	}, nil
+}
+
+// Exists reports if the user can use a token of the version: it is enabled
+// and the token has not been revoked
+func (m *UserModel) Exists(id, tokenVersion int) (bool, error) {
 	var user User
 
 	r := m.DB.
 		Where("`id` = ?", id).
+		Where("disabled = ?", false).
+		Where("token_version = ?", tokenVersion).
 		Limit(1).
 		Find(&user)
 
@@ -62,6 +165,12 @@ func (m *UserModel) Exists(id int) (bool, error) {
 }
 
 func (m *UserModel) Insert(name, password string) error {
+	return m.InsertWithRole(name, password, RoleUser)
+}
+
+// InsertWithRole creates a user with the role in a single transaction, so no
+// user is left behind if any part fails
+func (m *UserModel) InsertWithRole(name, password, role string) error {
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), 12)
 	if err != nil {
 		return err
@@ -70,10 +179,22 @@ func (m *UserModel) Insert(name, password string) error {
 	user := &User{
 		Name:     name,
 		Password: string(hashedPassword),
+		Role:     role,
 	}
 
-	result := m.DB.Create(user)
-	if err := result.Error; err != nil {
+	err = m.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(user).Error; err != nil {
+			return err
+		}
+
+		if err := writeAudit(tx, AuditCreate, EntityUser, user.ID, nil, user); err != nil {
+			return err
+		}
+
+		data := events.User{ID: user.ID, Name: user.Name, Role: user.Role}
+		return writeEvent(tx, events.New(events.UserCreated, user.ID, int(user.ID), data))
+	})
+	if err != nil {
 		if errors.Is(err, gorm.ErrDuplicatedKey) {
 			return ErrDuplicatedEntry
 		} else {
@@ -83,3 +204,362 @@ func (m *UserModel) Insert(name, password string) error {
 
 	return nil
 }
+
+func (m *UserModel) Get(id int) (User, error) {
+	var user User
+
+	result := m.DB.First(&user, id)
+	if err := result.Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return User{}, ErrNoRecord
+		} else {
+			return User{}, result.Error
+		}
+	}
+
+	return user, nil
+}
+
+func (m *UserModel) GetByName(name string) (User, error) {
+	var user User
+
+	result := m.DB.Where("name = ?", name).First(&user)
+	if err := result.Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return User{}, ErrNoRecord
+		} else {
+			return User{}, result.Error
+		}
+	}
+
+	return user, nil
+}
+
+func (m *UserModel) SetDisabled(name string, disabled bool) error {
+	return m.updateByName(name, map[string]interface{}{"disabled": disabled})
+}
+
+func (m *UserModel) SetRole(name, role string) error {
+	return m.updateByName(name, map[string]interface{}{"role": role})
+}
+
+// SetPassword changes the password of the user and revokes their tokens
+func (m *UserModel) SetPassword(name, password string) error {
+	updates, err := passwordUpdates(password)
+	if err != nil {
+		return err
+	}
+
+	return m.updateByName(name, updates)
+}
+
+// Rename changes the name of the user
+func (m *UserModel) Rename(id int, name string) error {
+	err := m.update(id, map[string]interface{}{"name": name})
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return ErrDuplicatedEntry
+	}
+
+	return err
+}
+
+// ChangePassword sets a new password if the current one is right, and revokes
+// the tokens of the user
+func (m *UserModel) ChangePassword(id int, current, password string) error {
+	user, err := m.Get(id)
+	if err != nil {
+		return err
+	}
+
+	if err := checkPassword(user, current); err != nil {
+		return err
+	}
+
+	updates, err := passwordUpdates(password)
+	if err != nil {
+		return err
+	}
+
+	return m.update(id, updates)
+}
+
+// SetEmail changes the address of the user, which is not verified until the
+// token returned is sent back with VerifyEmail
+func (m *UserModel) SetEmail(id int, email string, ttl time.Duration) (string, error) {
+	var token string
+
+	err := m.DB.Transaction(func(tx *gorm.DB) error {
+		updates := map[string]interface{}{"email": email, "email_verified_at": nil}
+		if err := updateUser(tx, updates, "id = ?", id); err != nil {
+			return err
+		}
+
+		var err error
+		token, err = newOneTimeToken(tx, uint(id), TokenVerifyEmail, email, ttl)
+		return err
+	})
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return "", ErrDuplicatedEntry
+	}
+
+	return token, err
+}
+
+// VerifyEmail marks the address a token was sent to as verified. Tokens sent
+// to an address the user has since changed are not valid.
+func (m *UserModel) VerifyEmail(token string) error {
+	return m.DB.Transaction(func(tx *gorm.DB) error {
+		record, err := useOneTimeToken(tx, token, TokenVerifyEmail, time.Now())
+		if err != nil {
+			return err
+		}
+
+		err = updateUser(tx, map[string]interface{}{"email_verified_at": time.Now()}, "id = ? AND email = ?", record.UserID, record.Email)
+		if errors.Is(err, ErrNoRecord) {
+			return ErrInvalidOneTimeToken
+		}
+
+		return err
+	})
+}
+
+// RequestPasswordReset returns the enabled user with the verified address and
+// a token to reset their password. It returns ErrNoRecord if there is none.
+func (m *UserModel) RequestPasswordReset(email string, ttl time.Duration) (User, string, error) {
+	var user User
+	var token string
+
+	err := m.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("email = ? AND email_verified_at IS NOT NULL", email).
+			Where("disabled = ?", false).
+			Limit(1).
+			Find(&user)
+		if err := result.Error; err != nil {
+			return err
+		}
+
+		if result.RowsAffected == 0 {
+			return ErrNoRecord
+		}
+
+		var err error
+		token, err = newOneTimeToken(tx, user.ID, TokenResetPassword, email, ttl)
+		return err
+	})
+	if err != nil {
+		return User{}, "", err
+	}
+
+	return user, token, nil
+}
+
+// ResetPassword sets a new password with a reset token, revoking the tokens
+// of the user, and returns the ID of the user
+func (m *UserModel) ResetPassword(token, password string) (int, error) {
+	updates, err := passwordUpdates(password)
+	if err != nil {
+		return 0, err
+	}
+
+	var userId uint
+	err = m.DB.Transaction(func(tx *gorm.DB) error {
+		record, err := useOneTimeToken(tx, token, TokenResetPassword, time.Now())
+		if err != nil {
+			return err
+		}
+		userId = record.UserID
+
+		// Disabled users cannot log in, so they cannot reset their password either
+		err = updateUser(tx, updates, "id = ? AND disabled = ?", record.UserID, false)
+		if errors.Is(err, ErrNoRecord) {
+			return ErrInvalidOneTimeToken
+		}
+
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return int(userId), nil
+}
+
+// Delete removes the account of the user. Their movies stay in the catalogue,
+// as other users may have them as favourites or in their lists, so the user
+// is anonymized instead of deleted: the name is replaced, the password and
+// tokens are revoked, the email is removed and the row is soft deleted. Their
+// favourites, lists and webhooks are deleted, and their exports expire.
+func (m *UserModel) Delete(id int) error {
+	return m.DB.Transaction(func(tx *gorm.DB) error {
+		var user User
+		if err := tx.First(&user, id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrNoRecord
+			}
+			return err
+		}
+
+		var favourites []Favourite
+		if err := tx.Where("user_id = ?", id).Find(&favourites).Error; err != nil {
+			return err
+		}
+
+		for _, favourite := range favourites {
+			if err := deleteFavourite(tx, favourite); err != nil {
+				return err
+			}
+		}
+
+		lists := tx.Unscoped().Model(&List{}).Select("id").Where("user_id = ?", id)
+		if err := tx.Unscoped().Where("list_id IN (?)", lists).Delete(&ListItem{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("user_id = ?", id).Delete(&List{}).Error; err != nil {
+			return err
+		}
+
+		webhooks := tx.Unscoped().Model(&Webhook{}).Select("id").Where("user_id = ?", id)
+		if err := tx.Unscoped().Where("webhook_id IN (?)", webhooks).Delete(&WebhookDelivery{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("user_id = ?", id).Delete(&Webhook{}).Error; err != nil {
+			return err
+		}
+
+		if err := expireExports(tx, id, time.Now()); err != nil {
+			return err
+		}
+
+		if err := tx.Where("user_id = ?", id).Delete(&OneTimeToken{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", id).Delete(&RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", id).Delete(&Identity{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", id).Delete(&LoginState{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", id).Delete(&Session{}).Error; err != nil {
+			return err
+		}
+
+		// The audit log does not keep the data erased with the account
+		before, err := withoutPersonalData(user)
+		if err != nil {
+			return err
+		}
+
+		// Names of users cannot start with #, so the new one is never taken
+		anonymized := map[string]interface{}{
+			"name":              fmt.Sprintf("#deleted-%d", id),
+			"password":          "",
+			"role":              RoleUser,
+			"disabled":          true,
+			"token_version":     gorm.Expr("token_version + 1"),
+			"email":             nil,
+			"email_verified_at": nil,
+			"totp_secret":       "",
+			"totp_enabled_at":   nil,
+		}
+		if err := tx.Model(&user).Updates(anonymized).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&user).Error; err != nil {
+			return err
+		}
+
+		if err := writeAudit(tx, AuditDelete, EntityUser, user.ID, before, nil); err != nil {
+			return err
+		}
+
+		return writeEvent(tx, events.New(events.UserDeleted, user.ID, id, events.Deleted{ID: user.ID}))
+	})
+}
+
+// checkPassword returns ErrInvalidCredentials if the password is not the one
+// of the user. Users provisioned by an identity provider have no password
+// until they reset it.
+func checkPassword(user User, password string) error {
+	if user.Password == "" {
+		return ErrInvalidCredentials
+	}
+
+	err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return ErrInvalidCredentials
+	}
+
+	return err
+}
+
+// passwordUpdates returns the columns changed with the password: its hash
+// and the token version, so the tokens issued with the old one are revoked
+func passwordUpdates(password string) (map[string]interface{}, error) {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), 12)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"password":      string(hashedPassword),
+		"token_version": gorm.Expr("token_version + 1"),
+	}, nil
+}
+
+func (m *UserModel) updateByName(name string, updates map[string]interface{}) error {
+	return m.updateWhere(updates, "name = ?", name)
+}
+
+func (m *UserModel) update(id int, updates map[string]interface{}) error {
+	return m.updateWhere(updates, "id = ?", id)
+}
+
+// updateWhere changes the columns of the user matching the query, recording
+// the values before and after in the audit log
+func (m *UserModel) updateWhere(updates map[string]interface{}, query string, args ...interface{}) error {
+	return m.DB.Transaction(func(tx *gorm.DB) error {
+		return updateUser(tx, updates, query, args...)
+	})
+}
+
+// updateUser is updateWhere in a transaction
+func updateUser(tx *gorm.DB, updates map[string]interface{}, query string, args ...interface{}) error {
+	var before User
+
+	result := tx.Where(query, args...).Limit(1).Find(&before)
+	if err := result.Error; err != nil {
+		return err
+	}
+
+	// return Not Found error if there is no user to update
+	if result.RowsAffected == 0 {
+		return ErrNoRecord
+	}
+
+	if err := tx.Model(&User{}).Where("id = ?", before.ID).Updates(updates).Error; err != nil {
+		return err
+	}
+
+	// The sessions of the revoked tokens are over too
+	if _, revoked := updates["token_version"]; revoked {
+		if err := tx.Where("user_id = ?", before.ID).Delete(&Session{}).Error; err != nil {
+			return err
+		}
+	}
+
+	// The updates may be expressions, the new values are read back
+	var after User
+	if err := tx.First(&after, before.ID).Error; err != nil {
+		return err
+	}
+
+	if err := writeAudit(tx, AuditUpdate, EntityUser, before.ID, before, after); err != nil {
+		return err
+	}
+
+	data := events.User{ID: after.ID, Name: after.Name, Role: after.Role}
+	return writeEvent(tx, events.New(events.UserUpdated, after.ID, int(after.ID), data))
+}
@@ -0,0 +1,261 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed"
+)
+
+type WebhookModel struct {
+	DB *gorm.DB
+}
+
+// Webhook is an endpoint of a user that receives the events it subscribes to
+type Webhook struct {
+	gorm.Model
+	UserID      uint   `gorm:"index"`
+	URL         string `gorm:"not null"`
+	Description string
+	Secret      string   `gorm:"not null" json:"-"`
+	Events      []string `gorm:"serializer:json"`
+	Active      bool     `gorm:"not null"`
+
+	// Consecutive failed attempts, reset by a successful delivery
+	Failures   int `gorm:"not null; default:0"`
+	DisabledAt *time.Time
+}
+
+// WebhookDelivery is an event sent (or to be sent) to a webhook, with the
+// result of the last attempt
+type WebhookDelivery struct {
+	gorm.Model
+	WebhookID      uint   `gorm:"index"`
+	EventID        string `gorm:"not null; index"`
+	EventType      string `gorm:"not null"`
+	Payload        string `gorm:"type:text; not null"`
+	Status         string `gorm:"not null; index"`
+	Attempts       int    `gorm:"not null; default:0"`
+	NextAttemptAt  *time.Time
+	ResponseStatus int
+	Error          string
+	DeliveredAt    *time.Time
+
+	// Delivery sent again by this one
+	RedeliveryOf *uint
+}
+
+func (m *WebhookModel) Insert(webhook *Webhook) error {
+	webhook.Active = true
+
+	return m.DB.Create(webhook).Error
+}
+
+// Get returns a webhook of the user. Webhooks of other users are not found.
+func (m *WebhookModel) Get(id, userId int) (Webhook, error) {
+	var webhook Webhook
+
+	result := m.DB.Where("user_id = ?", userId).First(&webhook, id)
+	if err := result.Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return Webhook{}, ErrNoRecord
+		}
+		return Webhook{}, err
+	}
+
+	return webhook, nil
+}
+
+func (m *WebhookModel) GetAll(userId int) ([]Webhook, error) {
+	webhooks := []Webhook{}
+
+	result := m.DB.Where("user_id = ?", userId).Order("id").Find(&webhooks)
+	if err := result.Error; err != nil {
+		return nil, err
+	}
+
+	return webhooks, nil
+}
+
+// Update saves the settings of a webhook. Enabling it again resets its failures.
+func (m *WebhookModel) Update(webhook Webhook) error {
+	if webhook.Active {
+		webhook.Failures = 0
+		webhook.DisabledAt = nil
+	}
+
+	result := m.DB.Model(&webhook).Select("URL", "Description", "Events", "Active", "Failures", "DisabledAt").Updates(&webhook)
+	return result.Error
+}
+
+// Delete removes a webhook of the user and its delivery log
+func (m *WebhookModel) Delete(id, userId int) error {
+	return m.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Unscoped().Where("user_id = ?", userId).Delete(&Webhook{}, id)
+		if err := result.Error; err != nil {
+			return err
+		}
+
+		if result.RowsAffected == 0 {
+			return ErrNoRecord
+		}
+
+		return tx.Unscoped().Where("webhook_id = ?", id).Delete(&WebhookDelivery{}).Error
+	})
+}
+
+// Subscribers returns the active webhooks subscribed to an event type. Private
+// events are only sent to the webhooks of the user who caused them and of the admins.
+func (m *WebhookModel) Subscribers(eventType string, userId uint, private bool) ([]Webhook, error) {
+	var candidates []Webhook
+
+	query := m.DB.Model(&Webhook{}).Where("webhooks.active = ?", true)
+	if private {
+		query = query.Joins("INNER JOIN users ON users.id = webhooks.user_id").
+			Where("webhooks.user_id = ? OR users.role = ?", userId, RoleAdmin)
+	}
+
+	if err := query.Find(&candidates).Error; err != nil {
+		return nil, err
+	}
+
+	// Events are kept as JSON, so the subscription is checked here
+	var webhooks []Webhook
+	for _, webhook := range candidates {
+		for _, subscribed := range webhook.Events {
+			if subscribed == eventType {
+				webhooks = append(webhooks, webhook)
+				break
+			}
+		}
+	}
+
+	return webhooks, nil
+}
+
+func (m *WebhookModel) InsertDeliveries(deliveries []WebhookDelivery) error {
+	if len(deliveries) == 0 {
+		return nil
+	}
+
+	return m.DB.Create(&deliveries).Error
+}
+
+// EventWebhooks returns the IDs of the webhooks with a delivery of an event
+func (m *WebhookModel) EventWebhooks(eventId string) ([]uint, error) {
+	var ids []uint
+
+	result := m.DB.Model(&WebhookDelivery{}).Where("event_id = ? AND redelivery_of IS NULL", eventId).Pluck("webhook_id", &ids)
+	if err := result.Error; err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
+
+// Deliveries returns the latest deliveries of a webhook, newest first
+func (m *WebhookModel) Deliveries(webhookId, limit int) ([]WebhookDelivery, error) {
+	deliveries := []WebhookDelivery{}
+
+	result := m.DB.Where("webhook_id = ?", webhookId).Order("id DESC").Limit(limit).Find(&deliveries)
+	if err := result.Error; err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+func (m *WebhookModel) GetDelivery(webhookId, deliveryId int) (WebhookDelivery, error) {
+	var delivery WebhookDelivery
+
+	result := m.DB.Where("webhook_id = ?", webhookId).First(&delivery, deliveryId)
+	if err := result.Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return WebhookDelivery{}, ErrNoRecord
+		}
+		return WebhookDelivery{}, err
+	}
+
+	return delivery, nil
+}
+
+// Due returns the pending deliveries whose next attempt is before now, oldest first
+func (m *WebhookModel) Due(now time.Time, limit int) ([]WebhookDelivery, error) {
+	var deliveries []WebhookDelivery
+
+	result := m.DB.Where("status = ? AND next_attempt_at <= ?", DeliveryPending, now).
+		Order("next_attempt_at, id").Limit(limit).Find(&deliveries)
+	if err := result.Error; err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+// GetWebhook returns a webhook by ID, whoever its owner is
+func (m *WebhookModel) GetWebhook(id uint) (Webhook, error) {
+	var webhook Webhook
+
+	result := m.DB.First(&webhook, id)
+	if err := result.Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return Webhook{}, ErrNoRecord
+		}
+		return Webhook{}, err
+	}
+
+	return webhook, nil
+}
+
+func (m *WebhookModel) SaveDelivery(delivery WebhookDelivery) error {
+	return m.DB.Save(&delivery).Error
+}
+
+// SaveAttempt saves the result of an attempt and counts the consecutive
+// failures of the webhook. When they reach maxFailures the webhook is
+// disabled and its pending deliveries fail.
+func (m *WebhookModel) SaveAttempt(delivery WebhookDelivery, succeeded bool, maxFailures int) (disabled bool, err error) {
+	err = m.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&delivery).Error; err != nil {
+			return err
+		}
+
+		if succeeded {
+			return tx.Model(&Webhook{}).Where("id = ?", delivery.WebhookID).Update("failures", 0).Error
+		}
+
+		result := tx.Model(&Webhook{}).Where("id = ?", delivery.WebhookID).Update("failures", gorm.Expr("failures + 1"))
+		if err := result.Error; err != nil {
+			return err
+		}
+
+		var webhook Webhook
+		if err := tx.First(&webhook, delivery.WebhookID).Error; err != nil {
+			return err
+		}
+
+		if !webhook.Active || webhook.Failures < maxFailures {
+			return nil
+		}
+
+		now := time.Now()
+		disabled = true
+
+		result = tx.Model(&webhook).Select("Active", "DisabledAt").Updates(&Webhook{Active: false, DisabledAt: &now})
+		if err := result.Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&WebhookDelivery{}).
+			Where("webhook_id = ? AND status = ?", webhook.ID, DeliveryPending).
+			Updates(map[string]interface{}{"status": DeliveryFailed, "next_attempt_at": nil, "error": "webhook disabled after repeated failures"}).Error
+	})
+
+	return disabled, err
+}
@@ -0,0 +1,314 @@
+// Package oidc is a relying party of OpenID Connect: it logs users in with an
+// identity provider using the authorization code flow with PKCE (RFC 7636),
+// and verifies the ID tokens with the keys of the provider. The endpoints of
+// the provider are discovered from its .well-known/openid-configuration.
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var ErrInvalidIDToken = errors.New("oidc: invalid ID token")
+
+// Time the discovery document and the keys of the provider are cached
+const cacheTTL = time.Hour
+
+// Config is the registration of the API as a client of the provider
+type Config struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+
+	// Scopes requested besides openid (email and profile by default)
+	Scopes []string
+
+	// Client of the requests to the provider (http.DefaultClient if nil)
+	HTTPClient *http.Client
+}
+
+// Metadata is the part of the discovery document used by the API
+type Metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Claims are the claims of an ID token used to link or provision users. The
+// issuer and subject are in the registered claims.
+type Claims struct {
+	Nonce             string `json:"nonce"`
+	Email             string `json:"email"`
+	EmailVerified     bool   `json:"email_verified"`
+	Name              string `json:"name"`
+	PreferredUsername string `json:"preferred_username"`
+	jwt.RegisteredClaims
+}
+
+// Provider discovers the provider on first use, so the API can start while it is down
+type Provider struct {
+	config Config
+
+	mu        sync.Mutex
+	metadata  *Metadata
+	keys      map[string]*rsa.PublicKey
+	fetchedAt time.Time
+}
+
+func New(config Config) *Provider {
+	if config.HTTPClient == nil {
+		config.HTTPClient = http.DefaultClient
+	}
+	if len(config.Scopes) == 0 {
+		config.Scopes = []string{"email", "profile"}
+	}
+
+	return &Provider{config: config}
+}
+
+// Issuer is the identifier of the provider, stored with the identities
+func (p *Provider) Issuer() string {
+	return p.config.Issuer
+}
+
+// NewVerifier returns a random PKCE code verifier. The state and nonce of the
+// logins are made the same way.
+func NewVerifier() (string, error) {
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(random), nil
+}
+
+// Challenge is the S256 PKCE code challenge of a verifier
+func Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// AuthCodeURL returns the URL of the provider where the user logs in
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	metadata, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.config.ClientID},
+		"redirect_uri":          {p.config.RedirectURL},
+		"scope":                 {strings.Join(append([]string{"openid"}, p.config.Scopes...), " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {Challenge(verifier)},
+		"code_challenge_method": {"S256"},
+	}
+
+	separator := "?"
+	if strings.Contains(metadata.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+
+	return metadata.AuthorizationEndpoint + separator + query.Encode(), nil
+}
+
+// Exchange redeems the code of the callback and returns the verified claims
+// of the ID token
+func (p *Provider) Exchange(ctx context.Context, code, verifier, nonce string) (*Claims, error) {
+	metadata, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.config.RedirectURL},
+		"client_id":     {p.config.ClientID},
+		"code_verifier": {verifier},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, metadata.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.config.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.config.ClientID), url.QueryEscape(p.config.ClientSecret))
+	}
+
+	var tokens struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := p.fetch(req, &tokens); err != nil {
+		return nil, fmt.Errorf("oidc: exchanging the code: %w", err)
+	}
+
+	if tokens.IDToken == "" {
+		return nil, fmt.Errorf("%w: missing in the token response", ErrInvalidIDToken)
+	}
+
+	return p.Verify(ctx, tokens.IDToken, nonce)
+}
+
+// Verify checks the signature, issuer, audience, expiry and nonce of an ID token
+func (p *Provider) Verify(ctx context.Context, raw, nonce string) (*Claims, error) {
+	var claims Claims
+
+	_, err := jwt.ParseWithClaims(raw, &claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.key(ctx, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256"}),
+		jwt.WithIssuer(p.config.Issuer),
+		jwt.WithAudience(p.config.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+
+	if claims.Subject == "" || claims.Nonce != nonce {
+		return nil, fmt.Errorf("%w: wrong subject or nonce", ErrInvalidIDToken)
+	}
+
+	return &claims, nil
+}
+
+// discover returns the cached metadata of the provider
+func (p *Provider) discover(ctx context.Context) (*Metadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.metadata != nil && time.Since(p.fetchedAt) < cacheTTL {
+		return p.metadata, nil
+	}
+
+	endpoint := strings.TrimSuffix(p.config.Issuer, "/") + "/.well-known/openid-configuration"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var metadata Metadata
+	if err := p.fetch(req, &metadata); err != nil {
+		return nil, fmt.Errorf("oidc: discovering %s: %w", p.config.Issuer, err)
+	}
+
+	// The document must belong to the configured issuer (OpenID Connect Discovery, section 4.3)
+	if metadata.Issuer != p.config.Issuer {
+		return nil, fmt.Errorf("oidc: discovered issuer %q does not match %q", metadata.Issuer, p.config.Issuer)
+	}
+
+	p.metadata, p.keys, p.fetchedAt = &metadata, nil, time.Now()
+	return p.metadata, nil
+}
+
+// key returns the public key with the ID. The keys are fetched again when
+// the ID is unknown, as the provider may have rotated them.
+func (p *Provider) key(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	metadata, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key, exists := p.keys[kid]; exists {
+		return key, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, metadata.JWKSURI, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := p.fetch(req, &set); err != nil {
+		return nil, fmt.Errorf("oidc: fetching the keys: %w", err)
+	}
+
+	p.keys = make(map[string]*rsa.PublicKey)
+	for _, jwk := range set.Keys {
+		if key, err := jwk.rsaKey(); err == nil {
+			p.keys[jwk.Kid] = key
+		}
+	}
+
+	key, exists := p.keys[kid]
+	if !exists {
+		return nil, fmt.Errorf("unknown key %q", kid)
+	}
+
+	return key, nil
+}
+
+// fetch decodes the JSON response of a request to the provider
+func (p *Provider) fetch(req *http.Request, out interface{}) error {
+	res, err := p.config.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("status %d: %s", res.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	return json.Unmarshal(body, out)
+}
+
+// jsonWebKey is an RSA key of a JWK set (RFC 7517)
+type jsonWebKey struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+func (k jsonWebKey) rsaKey() (*rsa.PublicKey, error) {
+	if k.Kty != "RSA" || (k.Use != "" && k.Use != "sig") {
+		return nil, errors.New("not an RSA signing key")
+	}
+
+	n, err := base64.RawURLEncoding.DecodeString(k.N)
+	if err != nil {
+		return nil, err
+	}
+	e, err := base64.RawURLEncoding.DecodeString(k.E)
+	if err != nil {
+		return nil, err
+	}
+
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+}
@@ -0,0 +1,89 @@
+package oidc_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"films-api.rdelgado.es/src/internals/oidc"
+	"films-api.rdelgado.es/src/internals/oidc/oidctest"
+)
+
+// authorize follows the authorization URL and returns the code of the redirection
+func authorize(t *testing.T, authURL string) (code, state string) {
+	t.Helper()
+
+	noRedirect := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+
+	res, err := noRedirect.Get(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	location, err := url.Parse(res.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return location.Query().Get("code"), location.Query().Get("state")
+}
+
+func TestExchange(t *testing.T) {
+	idp := oidctest.NewProvider("films-api", "secret")
+	defer idp.Close()
+
+	idp.Login(oidctest.User{Subject: "1234", Email: "ana@example.com", EmailVerified: true, PreferredUsername: "ana"})
+
+	provider := oidc.New(oidc.Config{
+		Issuer:       idp.Issuer(),
+		ClientID:     "films-api",
+		ClientSecret: "secret",
+		RedirectURL:  "http://localhost/user/oidc/callback",
+	})
+	ctx := context.Background()
+
+	verifier, _ := oidc.NewVerifier()
+	authURL, err := provider.AuthCodeURL(ctx, "state", "nonce", verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, state := authorize(t, authURL)
+	if state != "state" {
+		t.Errorf("state: got %q", state)
+	}
+
+	claims, err := provider.Exchange(ctx, code, verifier, "nonce")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Issuer != idp.Issuer() || claims.Subject != "1234" || claims.Email != "ana@example.com" || !claims.EmailVerified || claims.PreferredUsername != "ana" {
+		t.Errorf("claims: got %+v", claims)
+	}
+
+	// Codes can be used once
+	if _, err := provider.Exchange(ctx, code, verifier, "nonce"); err == nil {
+		t.Errorf("exchanging a code twice succeeded")
+	}
+
+	code, _ = authorize(t, authURL)
+	other, _ := oidc.NewVerifier()
+	if _, err := provider.Exchange(ctx, code, other, "nonce"); err == nil {
+		t.Errorf("exchanging a code with another verifier succeeded")
+	}
+
+	code, _ = authorize(t, authURL)
+	if _, err := provider.Exchange(ctx, code, verifier, "other"); !errors.Is(err, oidc.ErrInvalidIDToken) {
+		t.Errorf("exchanging a code with another nonce: got %v, want %v", err, oidc.ErrInvalidIDToken)
+	}
+
+	// The discovery document must be of the configured issuer
+	if _, err := oidc.New(oidc.Config{Issuer: idp.Issuer() + "/other"}).AuthCodeURL(ctx, "state", "nonce", verifier); err == nil {
+		t.Errorf("discovering a provider with another issuer succeeded")
+	}
+}
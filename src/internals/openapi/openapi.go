@@ -0,0 +1,302 @@
+// Package openapi builds OpenAPI 3 documents from route and Go type definitions.
+package openapi
+
+import (
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const Version = "3.0.3"
+
+// Security of an operation
+type Security int
+
+const (
+	// AuthRequired operations need a bearer token (default)
+	AuthRequired Security = iota
+	// AuthOptional operations can be called with or without a bearer token
+	AuthOptional
+	// AuthNone operations do not use the bearer token
+	AuthNone
+)
+
+// Operation documents a route. Request and response bodies are described with
+// a value of the type sent or returned by the handler (nil if there is none).
+type Operation struct {
+	Summary     string
+	Description string
+	Tags        []string
+	Security    Security
+
+	// Query parameters (path parameters are taken from the route path)
+	Query []Parameter
+
+	// Request is a value of the JSON body type. Use RequestBody for other content types.
+	Request     interface{}
+	RequestBody *RequestBody
+
+	Responses map[int]Response
+}
+
+type Response struct {
+	Description string
+
+	// Body is a value of the JSON response type. Use Content for other content types.
+	Body    interface{}
+	Content map[string]*MediaType
+	Headers map[string]*Header
+}
+
+// Route is an operation served at a method and httprouter path (/movie/:id)
+type Route struct {
+	Method string
+	Path   string
+	Operation
+}
+
+type Document struct {
+	OpenAPI    string               `json:"openapi"`
+	Info       Info                 `json:"info"`
+	Servers    []Server             `json:"servers,omitempty"`
+	Tags       []Tag                `json:"tags,omitempty"`
+	Paths      map[string]*PathItem `json:"paths"`
+	Components Components           `json:"components"`
+}
+
+type Info struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+type Server struct {
+	URL string `json:"url"`
+}
+
+type Tag struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+type PathItem map[string]*OperationObject
+
+type OperationObject struct {
+	Tags        []string                   `json:"tags,omitempty"`
+	Summary     string                     `json:"summary,omitempty"`
+	Description string                     `json:"description,omitempty"`
+	OperationID string                     `json:"operationId"`
+	Parameters  []Parameter                `json:"parameters,omitempty"`
+	RequestBody *RequestBody               `json:"requestBody,omitempty"`
+	Responses   map[string]*ResponseObject `json:"responses"`
+	Security    []map[string][]string      `json:"security"`
+}
+
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Description string                `json:"description,omitempty"`
+	Required    bool                  `json:"required,omitempty"`
+	Content     map[string]*MediaType `json:"content"`
+}
+
+type ResponseObject struct {
+	Description string                `json:"description"`
+	Headers     map[string]*Header    `json:"headers,omitempty"`
+	Content     map[string]*MediaType `json:"content,omitempty"`
+}
+
+type Header struct {
+	Description string  `json:"description,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+type Components struct {
+	Schemas         map[string]*Schema         `json:"schemas"`
+	SecuritySchemes map[string]*SecurityScheme `json:"securitySchemes"`
+}
+
+type SecurityScheme struct {
+	Type         string `json:"type"`
+	Scheme       string `json:"scheme"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+}
+
+const bearerAuth = "BearerAuth"
+
+// Generator builds a document, registering the schemas of the Go types used
+// in the operations as components
+type Generator struct {
+	doc *Document
+
+	// Go type of each component schema
+	types map[string]reflect.Type
+}
+
+func NewGenerator(info Info, tags ...Tag) *Generator {
+	return &Generator{
+		types: map[string]reflect.Type{},
+		doc: &Document{
+			OpenAPI: Version,
+			Info:    info,
+			Tags:    tags,
+			Paths:   map[string]*PathItem{},
+			Components: Components{
+				Schemas: map[string]*Schema{},
+				SecuritySchemes: map[string]*SecurityScheme{
+					bearerAuth: {Type: "http", Scheme: "bearer", BearerFormat: "JWT"},
+				},
+			},
+		},
+	}
+}
+
+// Add documents a route
+func (g *Generator) Add(route Route) {
+	path, params := convertPath(route.Path)
+
+	op := &OperationObject{
+		Tags:        route.Tags,
+		Summary:     route.Summary,
+		Description: route.Description,
+		OperationID: operationID(route.Method, route.Path),
+		Parameters:  params,
+		Responses:   map[string]*ResponseObject{},
+	}
+
+	for _, param := range route.Query {
+		param.In = "query"
+		if param.Schema == nil {
+			param.Schema = &Schema{Type: "string"}
+		}
+		op.Parameters = append(op.Parameters, param)
+	}
+
+	switch route.Security {
+	case AuthRequired:
+		op.Security = []map[string][]string{{bearerAuth: {}}}
+	case AuthOptional:
+		op.Security = []map[string][]string{{}, {bearerAuth: {}}}
+	case AuthNone:
+		op.Security = []map[string][]string{}
+	}
+
+	if route.RequestBody != nil {
+		op.RequestBody = route.RequestBody
+	} else if route.Request != nil {
+		op.RequestBody = &RequestBody{
+			Required: true,
+			Content:  map[string]*MediaType{"application/json": {Schema: g.Schema(route.Request)}},
+		}
+	}
+
+	for status, res := range route.Responses {
+		object := &ResponseObject{
+			Description: res.Description,
+			Headers:     res.Headers,
+			Content:     res.Content,
+		}
+		if object.Description == "" {
+			object.Description = http.StatusText(status)
+		}
+		if res.Body != nil {
+			object.Content = map[string]*MediaType{"application/json": {Schema: g.Schema(res.Body)}}
+		}
+
+		op.Responses[strconv.Itoa(status)] = object
+	}
+
+	item, exists := g.doc.Paths[path]
+	if !exists {
+		item = &PathItem{}
+		g.doc.Paths[path] = item
+	}
+	(*item)[strings.ToLower(route.Method)] = op
+}
+
+// Schema returns the schema of the type of v, registering named struct types as components
+func (g *Generator) Schema(v interface{}) *Schema {
+	return g.schemaOf(reflect.TypeOf(v))
+}
+
+func (g *Generator) Document() *Document {
+	return g.doc
+}
+
+// Operation returns the operation of the document served at method and
+// httprouter path, or nil if it is not documented
+func (d *Document) Operation(method, path string) *OperationObject {
+	converted, _ := convertPath(path)
+
+	item, exists := d.Paths[converted]
+	if !exists {
+		return nil
+	}
+
+	return (*item)[strings.ToLower(method)]
+}
+
+// Routes returns the method and path (OpenAPI format) of every operation, sorted
+func (d *Document) Routes() []string {
+	var routes []string
+	for path, item := range d.Paths {
+		for method := range *item {
+			routes = append(routes, strings.ToUpper(method)+" "+path)
+		}
+	}
+
+	sort.Strings(routes)
+	return routes
+}
+
+// convertPath turns an httprouter path into an OpenAPI path (/movie/:id into
+// /movie/{id}) and returns its path parameters
+func convertPath(path string) (string, []Parameter) {
+	var params []Parameter
+
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") || strings.HasPrefix(segment, "*") {
+			name := segment[1:]
+			segments[i] = "{" + name + "}"
+			params = append(params, Parameter{Name: name, In: "path", Required: true, Schema: &Schema{Type: "string"}})
+		}
+	}
+
+	return strings.Join(segments, "/"), params
+}
+
+// operationID builds an ID like getMovieById from the method and path
+func operationID(method, path string) string {
+	var id strings.Builder
+	id.WriteString(strings.ToLower(method))
+
+	for _, segment := range strings.Split(path, "/") {
+		if segment == "" {
+			continue
+		}
+
+		if strings.HasPrefix(segment, ":") || strings.HasPrefix(segment, "*") {
+			id.WriteString("By")
+			segment = segment[1:]
+		}
+
+		for _, word := range strings.FieldsFunc(segment, func(r rune) bool { return r == '-' || r == '_' || r == '.' }) {
+			id.WriteString(strings.ToUpper(word[:1]) + word[1:])
+		}
+	}
+
+	return id.String()
+}
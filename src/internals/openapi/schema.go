@@ -0,0 +1,253 @@
+package openapi
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AllOf                []*Schema          `json:"allOf,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	MinItems             *int               `json:"minItems,omitempty"`
+	MaxItems             *int               `json:"maxItems,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	Example              interface{}        `json:"example,omitempty"`
+}
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	rawMessageType    = reflect.TypeOf(json.RawMessage{})
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+)
+
+// schemaOf returns the schema of t as encoding/json would marshal it. Named
+// struct types are registered as components and referenced.
+func (g *Generator) schemaOf(t reflect.Type) *Schema {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case t == rawMessageType:
+		return &Schema{}
+	case t.Kind() == reflect.Struct && t.Implements(jsonMarshalerType):
+		// Types with custom marshalling (gorm.DeletedAt) are documented as nullable values
+		return &Schema{Nullable: true}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: g.schemaOf(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: g.schemaOf(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.structSchema(t)
+		}
+
+		name := g.componentName(t)
+		if _, exists := g.types[name]; !exists {
+			// Reserve the name before building the schema so recursive types end
+			g.types[name] = t
+			g.doc.Components.Schemas[name] = &Schema{}
+			*g.doc.Components.Schemas[name] = *g.structSchema(t)
+		}
+
+		return &Schema{Ref: "#/components/schemas/" + name}
+	}
+
+	return &Schema{}
+}
+
+// structSchema builds an object schema with the fields encoding/json marshals
+func (g *Generator) structSchema(t reflect.Type) *Schema {
+	schema := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	g.addFields(schema, t)
+
+	return schema
+}
+
+func (g *Generator) addFields(schema *Schema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+
+		name, options, _ := strings.Cut(tag, ",")
+
+		// Fields of embedded structs without a name are promoted
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Pointer {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				g.addFields(schema, embedded)
+				continue
+			}
+		}
+
+		if !field.IsExported() {
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+
+		property := g.schemaOf(field.Type)
+		if strings.Contains(options, "string") {
+			property = &Schema{Type: "string"}
+		}
+		if doc := field.Tag.Get("doc"); doc != "" {
+			property = withDescription(property, doc)
+		}
+
+		if required := applyRules(property, field.Tag.Get("validate")); required {
+			schema.Required = append(schema.Required, name)
+		}
+
+		schema.Properties[name] = property
+	}
+}
+
+// applyRules adds the constraints of a validate tag (see the validator
+// package) to the schema of a field, and reports if the field is required.
+// Rules after dive apply to the items of arrays.
+func applyRules(schema *Schema, tag string) (required bool) {
+	if tag == "" {
+		return false
+	}
+
+	target := schema
+	for _, part := range strings.Split(tag, ",") {
+		name, param, _ := strings.Cut(strings.TrimSpace(part), "=")
+
+		// Referenced schemas can not be changed
+		if target == nil || target.Ref != "" {
+			return required
+		}
+
+		switch name {
+		case "required":
+			if target == schema {
+				required = true
+			} else if target.Type == "string" {
+				target.MinLength = intPtr(1)
+			}
+		case "dive":
+			target = schema.Items
+		case "min", "max":
+			n, err := strconv.Atoi(param)
+			if err != nil {
+				continue
+			}
+
+			switch target.Type {
+			case "string":
+				if name == "min" {
+					target.MinLength = intPtr(n)
+				} else {
+					target.MaxLength = intPtr(n)
+				}
+			case "array":
+				if name == "min" {
+					target.MinItems = intPtr(n)
+				} else {
+					target.MaxItems = intPtr(n)
+				}
+			case "integer", "number":
+				limit := float64(n)
+				if name == "min" {
+					target.Minimum = &limit
+				} else {
+					target.Maximum = &limit
+				}
+			}
+		case "oneof":
+			target.Enum = strings.Fields(param)
+		case "url":
+			target.Format = "uri"
+		case "email":
+			target.Format = "email"
+		case "date":
+			if param == time.DateOnly {
+				target.Format = "date"
+			} else if param == time.RFC3339 {
+				target.Format = "date-time"
+			} else {
+				target.Description = strings.TrimSpace(target.Description + " Go time layout " + param)
+			}
+		}
+	}
+
+	return required
+}
+
+func intPtr(n int) *int {
+	return &n
+}
+
+// withDescription sets the description of a schema. References can not have
+// siblings, so they are wrapped.
+func withDescription(schema *Schema, description string) *Schema {
+	if schema.Ref != "" {
+		return &Schema{Description: description, AllOf: []*Schema{schema}}
+	}
+
+	schema.Description = description
+	return schema
+}
+
+// componentName is the name of the type (Movie). If another package has a
+// type with the same name, it is prefixed with the package (models.Movie).
+func (g *Generator) componentName(t reflect.Type) string {
+	name := t.Name()
+	// Generic types have the parameters in the name
+	if i := strings.Index(name, "["); i >= 0 {
+		name = name[:i]
+	}
+
+	if other, exists := g.types[name]; !exists || other == t {
+		return name
+	}
+
+	pkg := t.PkgPath()
+	if i := strings.LastIndex(pkg, "/"); i >= 0 {
+		pkg = pkg[i+1:]
+	}
+
+	return pkg + "." + name
+}
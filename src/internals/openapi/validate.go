@@ -0,0 +1,261 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"films-api.rdelgado.es/src/internals/i18n"
+)
+
+// ValidateRequest checks the query parameters and JSON body of a request
+// against the operation documented at method and httprouter path. It returns
+// the translatable errors of each field (empty if the request is valid). The body is
+// restored so handlers can read it again.
+func (d *Document) ValidateRequest(method, path string, r *http.Request) (map[string]i18n.Message, error) {
+	errs := map[string]i18n.Message{}
+
+	op := d.Operation(method, path)
+	if op == nil {
+		return errs, nil
+	}
+
+	query := r.URL.Query()
+	for _, param := range op.Parameters {
+		if param.In != "query" {
+			continue
+		}
+
+		value := query.Get(param.Name)
+		if value == "" {
+			if param.Required {
+				errs[param.Name] = i18n.NewMessage("validation.required", nil)
+			}
+			continue
+		}
+
+		if msg := d.checkString(param.Schema, value); msg != nil {
+			errs[param.Name] = *msg
+		}
+	}
+
+	if op.RequestBody == nil || r.Body == nil {
+		return errs, nil
+	}
+
+	media, isJSON := op.RequestBody.Content["application/json"]
+	if !isJSON || len(op.RequestBody.Content) > 1 && !strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		return errs, nil
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	var value interface{}
+	if err := json.Unmarshal(body, &value); err != nil {
+		// Malformed bodies are reported by the handlers
+		return errs, nil
+	}
+
+	d.checkValue(media.Schema, value, "", errs)
+
+	return errs, nil
+}
+
+// resolve follows the reference of a schema to its component
+func (d *Document) resolve(schema *Schema) *Schema {
+	for schema != nil && schema.Ref != "" {
+		schema = d.Components.Schemas[strings.TrimPrefix(schema.Ref, "#/components/schemas/")]
+	}
+
+	for schema != nil && schema.Type == "" && len(schema.AllOf) == 1 {
+		schema = d.resolve(schema.AllOf[0])
+	}
+
+	return schema
+}
+
+// checkValue validates a decoded JSON value, adding an error for each invalid
+// field at its path (cast[2])
+func (d *Document) checkValue(schema *Schema, value interface{}, path string, errs map[string]i18n.Message) {
+	schema = d.resolve(schema)
+	if schema == nil || value == nil {
+		return
+	}
+
+	field := path
+	if field == "" {
+		field = "body"
+	}
+
+	switch schema.Type {
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			errs[field] = i18n.NewMessage("validation.type.object", nil)
+			return
+		}
+
+		// Keys are matched case-insensitively like encoding/json does
+		for _, name := range schema.Required {
+			if _, ok := lookup(object, name); !ok {
+				errs[join(path, name)] = i18n.NewMessage("validation.required", nil)
+			}
+		}
+
+		for name, property := range schema.Properties {
+			if v, ok := lookup(object, name); ok {
+				d.checkValue(property, v, join(path, name), errs)
+			}
+		}
+
+		if schema.AdditionalProperties != nil {
+			for name, v := range object {
+				d.checkValue(schema.AdditionalProperties, v, join(path, name), errs)
+			}
+		}
+
+	case "array":
+		array, ok := value.([]interface{})
+		if !ok {
+			errs[field] = i18n.NewMessage("validation.type.array", nil)
+			return
+		}
+
+		if schema.MinItems != nil && len(array) < *schema.MinItems {
+			errs[field] = i18n.NewMessage("validation.min.items", i18n.Params{"min": strconv.Itoa(*schema.MinItems)})
+		} else if schema.MaxItems != nil && len(array) > *schema.MaxItems {
+			errs[field] = i18n.NewMessage("validation.max.items", i18n.Params{"max": strconv.Itoa(*schema.MaxItems)})
+		}
+
+		for i, v := range array {
+			d.checkValue(schema.Items, v, fmt.Sprintf("%s[%d]", path, i), errs)
+		}
+
+	case "integer", "number":
+		number, ok := value.(float64)
+		if !ok {
+			errs[field] = i18n.NewMessage("validation.type.number", nil)
+			return
+		}
+
+		if schema.Type == "integer" && number != float64(int64(number)) {
+			errs[field] = i18n.NewMessage("validation.type.integer", nil)
+		} else if schema.Minimum != nil && number < *schema.Minimum {
+			errs[field] = i18n.NewMessage("validation.min.number", i18n.Params{"min": fmt.Sprint(*schema.Minimum)})
+		} else if schema.Maximum != nil && number > *schema.Maximum {
+			errs[field] = i18n.NewMessage("validation.max.number", i18n.Params{"max": fmt.Sprint(*schema.Maximum)})
+		}
+
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			errs[field] = i18n.NewMessage("validation.type.boolean", nil)
+		}
+
+	case "string":
+		s, ok := value.(string)
+		if !ok {
+			errs[field] = i18n.NewMessage("validation.type.string", nil)
+			return
+		}
+
+		if schema.MinLength != nil && len([]rune(strings.TrimSpace(s))) < *schema.MinLength {
+			errs[field] = i18n.NewMessage("validation.min.string", i18n.Params{"min": strconv.Itoa(*schema.MinLength)})
+		} else if msg := d.checkString(schema, s); msg != nil {
+			errs[field] = *msg
+		}
+	}
+}
+
+// checkString validates a string value or query parameter against a schema,
+// returning nil if it is valid
+func (d *Document) checkString(schema *Schema, value string) *i18n.Message {
+	schema = d.resolve(schema)
+
+	// Blank values are handled as missing
+	if schema == nil || value == "" {
+		return nil
+	}
+
+	switch schema.Type {
+	case "integer":
+		if _, err := strconv.ParseInt(value, 10, 64); err != nil {
+			return ptr(i18n.NewMessage("validation.type.integer", nil))
+		}
+	case "number":
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			return ptr(i18n.NewMessage("validation.type.number", nil))
+		}
+	case "boolean":
+		if _, err := strconv.ParseBool(value); err != nil {
+			return ptr(i18n.NewMessage("validation.type.boolean", nil))
+		}
+	}
+
+	if len(schema.Enum) > 0 && !contains(schema.Enum, value) {
+		return ptr(i18n.NewMessage("validation.oneof", i18n.Params{"values": strings.Join(schema.Enum, ", ")}))
+	}
+
+	if schema.MaxLength != nil && len([]rune(value)) > *schema.MaxLength {
+		return ptr(i18n.NewMessage("validation.max.string", i18n.Params{"max": strconv.Itoa(*schema.MaxLength)}))
+	}
+
+	switch schema.Format {
+	case "date":
+		if _, err := time.Parse(time.DateOnly, value); err != nil {
+			return ptr(i18n.NewMessage("validation.date", i18n.Params{"format": "YYYY-MM-DD"}))
+		}
+	case "date-time":
+		if _, err := time.Parse(time.RFC3339, value); err != nil {
+			return ptr(i18n.NewMessage("validation.datetime", nil))
+		}
+	}
+
+	return nil
+}
+
+// lookup returns the value of a key, preferring an exact match over a
+// case-insensitive one
+func lookup(object map[string]interface{}, name string) (interface{}, bool) {
+	if v, ok := object[name]; ok {
+		return v, true
+	}
+
+	for key, v := range object {
+		if strings.EqualFold(key, name) {
+			return v, true
+		}
+	}
+
+	return nil, false
+}
+
+func join(path, name string) string {
+	if path == "" {
+		return name
+	}
+
+	return path + "." + name
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+func ptr(message i18n.Message) *i18n.Message {
+	return &message
+}
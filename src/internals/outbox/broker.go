@@ -0,0 +1,38 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+
+	"films-api.rdelgado.es/src/internals/events"
+)
+
+// Broker is a message broker such as NATS or Kafka. Implementations wrap the
+// client of the broker; the API does not depend on any.
+type Broker interface {
+	// Send publishes a message to a topic (a NATS subject or a Kafka topic).
+	// Messages with the same key must keep their order, as they do in a
+	// Kafka partition.
+	Send(ctx context.Context, topic, key string, value []byte, headers map[string]string) error
+}
+
+// BrokerSink sends the events to a broker as JSON. Each type goes to the
+// topic Prefix + type (movies.movie.created) and the key is the aggregate, so
+// the events of a movie keep their order.
+type BrokerSink struct {
+	Broker Broker
+	Prefix string
+}
+
+func (s BrokerSink) Publish(ctx context.Context, event events.Event) error {
+	value, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	key := event.Aggregate + ":" + strconv.FormatUint(uint64(event.AggregateID), 10)
+	headers := map[string]string{"Event-Id": event.ID, "Event-Type": event.Type}
+
+	return s.Broker.Send(ctx, s.Prefix+event.Type, key, value, headers)
+}
@@ -0,0 +1,167 @@
+// Package outbox publishes the events saved in the outbox table by the models.
+// Events are written in the same transaction as the change that causes them,
+// so none is lost if the server stops before sending it. The Dispatcher sends
+// them to a Sink at least once: an event is sent again if it could not be
+// marked as published, so sinks must tolerate duplicates (events keep their ID).
+// The events of each aggregate (a movie, a favourite, a user) are sent in the
+// order they were saved.
+package outbox
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"films-api.rdelgado.es/src/internals/events"
+	"films-api.rdelgado.es/src/internals/models"
+	"films-api.rdelgado.es/src/internals/retry"
+)
+
+// Sink receives the events of the outbox. An event is sent again while
+// Publish returns an error.
+type Sink interface {
+	Publish(ctx context.Context, event events.Event) error
+}
+
+// Dispatcher sends the pending events of the outbox to the sink. It must be
+// created with New, which sets the default settings.
+type Dispatcher struct {
+	Outbox *models.OutboxModel
+	Sink   Sink
+	Logger *slog.Logger
+
+	// Events loaded on each round
+	BatchSize int
+
+	// How often the outbox is checked for new events
+	PollInterval time.Duration
+
+	// Delay before the first retry, doubled on each attempt up to MaxBackoff
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+
+	// How long the published events are kept. Zero keeps them forever.
+	Retention time.Duration
+}
+
+func New(outbox *models.OutboxModel, sink Sink, logger *slog.Logger) *Dispatcher {
+	return &Dispatcher{
+		Outbox:       outbox,
+		Sink:         sink,
+		Logger:       logger,
+		BatchSize:    100,
+		PollInterval: time.Second,
+		Backoff:      time.Second,
+		MaxBackoff:   10 * time.Minute,
+		Retention:    7 * 24 * time.Hour,
+	}
+}
+
+// Run publishes the pending events until the context is canceled
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.PollInterval)
+	defer ticker.Stop()
+
+	lastPurge := time.Time{}
+
+	for {
+		d.publishPending(ctx)
+
+		if d.Retention > 0 && time.Since(lastPurge) > time.Hour {
+			lastPurge = time.Now()
+			if _, err := d.Outbox.Purge(lastPurge.Add(-d.Retention)); err != nil {
+				d.Logger.Error("purging the outbox", "error", err.Error())
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// publishPending sends the due events until none is left. Each round has at
+// most one event per aggregate, so the next ones are loaded after it.
+func (d *Dispatcher) publishPending(ctx context.Context) {
+	for ctx.Err() == nil {
+		pending, err := d.Outbox.Pending(time.Now(), d.BatchSize)
+		if err != nil {
+			d.Logger.Error("loading the outbox", "error", err.Error())
+			return
+		}
+		if len(pending) == 0 {
+			return
+		}
+
+		published := 0
+		for _, row := range pending {
+			if d.publish(ctx, row) {
+				published++
+			}
+		}
+
+		// The failed events wait for their next attempt
+		if published == 0 {
+			return
+		}
+	}
+}
+
+// publish sends an event and records the result. It reports if it was published.
+func (d *Dispatcher) publish(ctx context.Context, row models.OutboxEvent) bool {
+	event, err := row.Event()
+	if err == nil {
+		err = d.Sink.Publish(ctx, event)
+	}
+
+	if err != nil {
+		if ctx.Err() != nil {
+			return false
+		}
+
+		// MarkFailed counts this attempt, as the deliveries of the webhooks do
+		attempts := row.Attempts + 1
+		d.Logger.Warn("publishing event", "event", row.EventID, "type", row.Type, "attempts", attempts, "error", err.Error())
+
+		next := time.Now().Add(retry.Backoff(d.Backoff, d.MaxBackoff, attempts))
+		if err := d.Outbox.MarkFailed(row.ID, next, err.Error()); err != nil {
+			d.Logger.Error("saving outbox event", "event", row.EventID, "error", err.Error())
+		}
+		return false
+	}
+
+	if err := d.Outbox.MarkPublished(row.ID, time.Now()); err != nil {
+		d.Logger.Error("saving outbox event", "event", row.EventID, "error", err.Error())
+		return false
+	}
+
+	return true
+}
+
+// Sinks sends the events to several sinks. An event that fails in one of
+// them is sent again to all of them.
+type Sinks []Sink
+
+func (s Sinks) Publish(ctx context.Context, event events.Event) error {
+	var errs []error
+	for _, sink := range s {
+		if err := sink.Publish(ctx, event); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// LogSink writes the events to a logger
+type LogSink struct {
+	Logger *slog.Logger
+}
+
+func (s LogSink) Publish(ctx context.Context, event events.Event) error {
+	s.Logger.InfoContext(ctx, "event", "id", event.ID, "type", event.Type, "aggregate", event.Aggregate, "aggregate_id", event.AggregateID, "user", event.UserID)
+	return nil
+}
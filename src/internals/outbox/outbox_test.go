@@ -0,0 +1,162 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"reflect"
+	"testing"
+	"time"
+
+	"films-api.rdelgado.es/src/internals/events"
+	"films-api.rdelgado.es/src/internals/models"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// testSink records the events it receives and fails while fail returns true
+type testSink struct {
+	published []events.Event
+	fail      func(events.Event) bool
+}
+
+func (s *testSink) Publish(ctx context.Context, event events.Event) error {
+	if s.fail != nil && s.fail(event) {
+		return errors.New("sink unavailable")
+	}
+
+	s.published = append(s.published, event)
+	return nil
+}
+
+func (s *testSink) types() []string {
+	types := []string{}
+	for _, event := range s.published {
+		types = append(types, event.Type)
+	}
+
+	return types
+}
+
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{
+		TranslateError: true,
+		Logger:         logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.AutoMigrate(&models.User{}, &models.Movie{}, &models.Favourite{}, &models.OutboxEvent{}, &models.AuditEntry{}, &models.Catalogue{}); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	return db
+}
+
+func TestDispatcher(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+
+	users := &models.UserModel{DB: db}
+	movies := &models.MovieModel{DB: db}
+	favs := &models.FavouriteModel{DB: db}
+
+	if err := users.Insert("outbox", "Test.1234"); err != nil {
+		t.Fatal(err)
+	}
+
+	heat, err := movies.Insert("Heat", "Michael Mann", "Crime", "Bank robbers.", time.Now(), []string{"Al Pacino"}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	alien, err := movies.Insert("Alien", "Ridley Scott", "Horror", "A crew meets an alien.", time.Now(), []string{"Sigourney Weaver"}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	movie, _ := movies.Get(heat)
+	movie.Genre = "Thriller"
+	if err := movies.Update(movie); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := favs.Insert(1, alien); err != nil {
+		t.Fatal(err)
+	}
+
+	// Failed changes do not save their events
+	if _, err := favs.Insert(1, alien); !errors.Is(err, models.ErrDuplicatedEntry) {
+		t.Fatalf("duplicated favourite: got %v", err)
+	}
+	if err := movies.Delete(heat, 2); !errors.Is(err, models.ErrNotAuthorized) {
+		t.Fatalf("movie of another user: got %v", err)
+	}
+
+	// The first movie can not be published for now
+	failing := true
+	sink := &testSink{fail: func(event events.Event) bool {
+		return failing && event.Aggregate == "movie" && event.AggregateID == uint(heat)
+	}}
+
+	dispatcher := New(&models.OutboxModel{DB: db}, sink, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	dispatcher.Backoff = time.Hour
+
+	dispatcher.publishPending(ctx)
+
+	// The update of the first movie waits for its creation, the other aggregates go on
+	want := []string{events.UserCreated, events.MovieCreated, events.FavouriteAdded}
+	if got := sink.types(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("published with a failing aggregate: got %v, want %v", got, want)
+	}
+	if sink.published[1].AggregateID != uint(alien) {
+		t.Errorf("published the movie %d, want %d", sink.published[1].AggregateID, alien)
+	}
+
+	var failed models.OutboxEvent
+	if err := db.Where("aggregate = ? AND aggregate_id = ?", "movie", heat).First(&failed).Error; err != nil {
+		t.Fatal(err)
+	}
+	if failed.Attempts != 1 || failed.LastError != "sink unavailable" || failed.PublishedAt != nil {
+		t.Errorf("failed event: got %+v", failed)
+	}
+
+	// Retry it now
+	if err := db.Model(&failed).Update("next_attempt_at", time.Now()).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	failing = false
+	sink.published = nil
+	dispatcher.publishPending(ctx)
+
+	want = []string{events.MovieCreated, events.MovieUpdated}
+	if got := sink.types(); !reflect.DeepEqual(got, want) {
+		t.Errorf("published after recovering: got %v, want %v", got, want)
+	}
+	if data, ok := sink.published[1].Data.(map[string]interface{}); !ok || data["Genre"] != "Thriller" {
+		t.Errorf("data of the update: got %+v", sink.published[1].Data)
+	}
+
+	// Published events are kept until they are purged
+	sink.published = nil
+	dispatcher.publishPending(ctx)
+	if len(sink.published) != 0 {
+		t.Errorf("published again: %v", sink.types())
+	}
+
+	purged, err := dispatcher.Outbox.Purge(time.Now().Add(time.Second))
+	if err != nil || purged != 5 {
+		t.Errorf("purge: got %d %v, want 5", purged, err)
+	}
+}
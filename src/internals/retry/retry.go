@@ -0,0 +1,21 @@
+// Package retry has the schedule of the jobs that retry failed work, such as
+// the deliveries of the webhooks and the events of the outbox.
+package retry
+
+import "time"
+
+// Backoff is the delay after a failed attempt: base, doubled for each
+// previous attempt, up to max. attempts counts every attempt made so far,
+// including the one that just failed, so the first retry waits base.
+func Backoff(base, max time.Duration, attempts int) time.Duration {
+	delay := base
+	for i := 1; i < attempts && delay < max; i++ {
+		delay *= 2
+	}
+
+	if delay > max {
+		delay = max
+	}
+
+	return delay
+}
@@ -0,0 +1,14 @@
+package retry
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	for attempts, want := range map[int]time.Duration{0: time.Second, 1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 4: 5 * time.Second, 20: 5 * time.Second} {
+		if got := Backoff(time.Second, 5*time.Second, attempts); got != want {
+			t.Errorf("backoff after %d attempts: got %v, want %v", attempts, got, want)
+		}
+	}
+}
@@ -0,0 +1,261 @@
+package seed
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"films-api.rdelgado.es/src/internals/models"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+type userFixture struct {
+	Key      string `json:"key"`
+	Name     string `json:"name"`
+	Password string `json:"password"`
+	Role     string `json:"role"`
+}
+
+type movieFixture struct {
+	Key         string   `json:"key"`
+	Title       string   `json:"title"`
+	Director    string   `json:"director"`
+	ReleaseDate string   `json:"release_date"`
+	Cast        []string `json:"cast"`
+	Genre       string   `json:"genre"`
+	Synopsis    string   `json:"synopsis"`
+	CreatedBy   string   `json:"created_by"`
+}
+
+type favouriteFixture struct {
+	User  string `json:"user"`
+	Movie string `json:"movie"`
+}
+
+type listFixture struct {
+	Key         string `json:"key"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Visibility  string `json:"visibility"`
+	Owner       string `json:"owner"`
+	Items       []struct {
+		Movie string `json:"movie"`
+		Note  string `json:"note"`
+	} `json:"items"`
+}
+
+func init() {
+	Register(Entity{Name: "users", Seed: seedUser})
+	Register(Entity{Name: "movies", Seed: seedMovie})
+	Register(Entity{Name: "favourites", Seed: seedFavourite})
+	Register(Entity{Name: "lists", Seed: seedList})
+}
+
+// seedUser creates the user if no user has the same name. Fixtures are
+// referenced by key, or by name if the key is not set.
+//
+// In production users are never created from fixtures, as they would come with
+// well known passwords. Production fixtures can still reference users created
+// with the admin commands by leaving the password empty.
+func seedUser(tx *gorm.DB, s *State, raw json.RawMessage) (string, uint, bool, error) {
+	var fixture userFixture
+	if err := json.Unmarshal(raw, &fixture); err != nil {
+		return "", 0, false, err
+	}
+
+	key := fixture.Key
+	if key == "" {
+		key = fixture.Name
+	}
+
+	if s.Production && fixture.Password != "" {
+		return "", 0, false, ErrDefaultCredentials
+	}
+
+	id, err := find(tx, &models.User{}, "name = ?", fixture.Name)
+	if err != nil || id > 0 {
+		return key, id, false, err
+	}
+
+	if fixture.Password == "" {
+		return "", 0, false, fmt.Errorf("user %q does not exist and has no password", fixture.Name)
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(fixture.Password), 12)
+	if err != nil {
+		return "", 0, false, err
+	}
+
+	user := models.User{
+		Name:     fixture.Name,
+		Password: string(hashedPassword),
+		Role:     fixture.Role,
+	}
+	if user.Role == "" {
+		user.Role = models.RoleUser
+	}
+
+	if err := tx.Create(&user).Error; err != nil {
+		return "", 0, false, err
+	}
+
+	return key, user.ID, true, nil
+}
+
+// seedMovie creates the movie if no movie has the same title. Fixtures are
+// referenced by key, or by title if the key is not set.
+func seedMovie(tx *gorm.DB, s *State, raw json.RawMessage) (string, uint, bool, error) {
+	var fixture movieFixture
+	if err := json.Unmarshal(raw, &fixture); err != nil {
+		return "", 0, false, err
+	}
+
+	key := fixture.Key
+	if key == "" {
+		key = fixture.Title
+	}
+
+	userId, err := s.Ref("users", fixture.CreatedBy)
+	if err != nil {
+		return "", 0, false, err
+	}
+
+	id, err := find(tx, &models.Movie{}, "title = ?", fixture.Title)
+	if err != nil || id > 0 {
+		return key, id, false, err
+	}
+
+	releaseDate, err := time.Parse("2006-01-02", fixture.ReleaseDate)
+	if err != nil {
+		return "", 0, false, err
+	}
+
+	movie := models.Movie{
+		Title:       fixture.Title,
+		Director:    fixture.Director,
+		ReleaseDate: releaseDate,
+		Cast:        fixture.Cast,
+		Genre:       fixture.Genre,
+		Synopsis:    fixture.Synopsis,
+		UserID:      userId,
+	}
+
+	if err := tx.Create(&movie).Error; err != nil {
+		return "", 0, false, err
+	}
+
+	if err := models.BumpCatalogue(tx); err != nil {
+		return "", 0, false, err
+	}
+
+	return key, movie.ID, true, nil
+}
+
+// seedFavourite adds the movie to the user's favourites if it is not there yet
+func seedFavourite(tx *gorm.DB, s *State, raw json.RawMessage) (string, uint, bool, error) {
+	var fixture favouriteFixture
+	if err := json.Unmarshal(raw, &fixture); err != nil {
+		return "", 0, false, err
+	}
+
+	key := fixture.User + "/" + fixture.Movie
+
+	userId, err := s.Ref("users", fixture.User)
+	if err != nil {
+		return "", 0, false, err
+	}
+
+	movieId, err := s.Ref("movies", fixture.Movie)
+	if err != nil {
+		return "", 0, false, err
+	}
+
+	id, err := find(tx, &models.Favourite{}, "user_id = ? AND movie_id = ?", userId, movieId)
+	if err != nil || id > 0 {
+		return key, id, false, err
+	}
+
+	favourite := models.Favourite{UserID: userId, MovieID: movieId}
+
+	if err := tx.Create(&favourite).Error; err != nil {
+		return "", 0, false, err
+	}
+
+	return key, favourite.ID, true, nil
+}
+
+// seedList creates the list with its items, in the given order, if the owner
+// has no list with the same name
+func seedList(tx *gorm.DB, s *State, raw json.RawMessage) (string, uint, bool, error) {
+	var fixture listFixture
+	if err := json.Unmarshal(raw, &fixture); err != nil {
+		return "", 0, false, err
+	}
+
+	key := fixture.Key
+	if key == "" {
+		key = fixture.Owner + "/" + fixture.Name
+	}
+
+	userId, err := s.Ref("users", fixture.Owner)
+	if err != nil {
+		return "", 0, false, err
+	}
+
+	id, err := find(tx, &models.List{}, "user_id = ? AND name = ?", userId, fixture.Name)
+	if err != nil || id > 0 {
+		return key, id, false, err
+	}
+
+	list := models.List{
+		Name:        fixture.Name,
+		Description: fixture.Description,
+		Visibility:  fixture.Visibility,
+		UserID:      userId,
+	}
+	if list.Visibility == "" {
+		list.Visibility = models.ListPrivate
+	}
+
+	if err := tx.Create(&list).Error; err != nil {
+		return "", 0, false, err
+	}
+
+	for i, item := range fixture.Items {
+		movieId, err := s.Ref("movies", item.Movie)
+		if err != nil {
+			return "", 0, false, err
+		}
+
+		listItem := models.ListItem{
+			ListID:   list.ID,
+			MovieID:  movieId,
+			Position: i + 1,
+			Note:     item.Note,
+		}
+
+		if err := tx.Create(&listItem).Error; err != nil {
+			return "", 0, false, err
+		}
+	}
+
+	return key, list.ID, true, nil
+}
+
+// find looks for an existing record and returns its ID, or 0 if there is none.
+// Deleted records are found too, as they keep their unique keys until purged.
+func find(tx *gorm.DB, dest interface{}, query string, args ...interface{}) (uint, error) {
+	var ids []uint
+
+	err := tx.Unscoped().Model(dest).Where(query, args...).Limit(1).Pluck("id", &ids).Error
+	if err != nil {
+		return 0, err
+	}
+
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	return ids[0], nil
+}
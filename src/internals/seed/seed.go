@@ -0,0 +1,200 @@
+package seed
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+	"gorm.io/gorm"
+)
+
+const EnvProduction = "production"
+
+// Fixtures of every environment are loaded from this subdirectory before the
+// fixtures of the selected one
+const baseDir = "base"
+
+var ErrDefaultCredentials = errors.New("fixtures with passwords cannot be seeded in production")
+var ErrUnknownEntity = errors.New("fixture entity is not registered")
+var ErrUnknownReference = errors.New("fixture references an unknown key")
+
+// Entity describes how to seed one kind of fixture. Entities are seeded in
+// registration order, so an entity can only reference the ones registered
+// before it.
+type Entity struct {
+	// Name used as top level key in fixture files (users, movies...)
+	Name string
+
+	// Seed creates the record described by raw if it does not exist yet, and
+	// returns the key other fixtures use to reference it and its database ID.
+	// Records that already exist must be left untouched so seeding is idempotent.
+	Seed func(tx *gorm.DB, s *State, raw json.RawMessage) (key string, id uint, created bool, err error)
+}
+
+var registry []Entity
+
+// Register adds an entity to the seeding subsystem
+func Register(entity Entity) {
+	registry = append(registry, entity)
+}
+
+// State is shared by every fixture of a seeding run
+type State struct {
+	Production bool
+	refs       map[string]map[string]uint
+}
+
+// Ref returns the database ID of the fixture of entity with the given key
+func (s *State) Ref(entity, key string) (uint, error) {
+	id, exists := s.refs[entity][key]
+	if !exists {
+		return 0, fmt.Errorf("%w: %s %q", ErrUnknownReference, entity, key)
+	}
+
+	return id, nil
+}
+
+func (s *State) setRef(entity, key string, id uint) {
+	if s.refs[entity] == nil {
+		s.refs[entity] = map[string]uint{}
+	}
+
+	s.refs[entity][key] = id
+}
+
+// Set holds the raw fixtures of each entity, in the order they were loaded
+type Set map[string][]json.RawMessage
+
+// Report counts the records created and already present for each entity
+type Report map[string]struct {
+	Created  int
+	Existing int
+}
+
+// LoadDir reads the fixtures of dir/base and dir/env. Files are read in name
+// order and can be YAML (.yaml, .yml) or JSON (.json).
+func LoadDir(dir, env string) (Set, error) {
+	set := Set{}
+
+	for _, sub := range []string{baseDir, env} {
+		files, err := filepath.Glob(filepath.Join(dir, sub, "*"))
+		if err != nil {
+			return nil, err
+		}
+
+		sort.Strings(files)
+
+		for _, file := range files {
+			switch strings.ToLower(filepath.Ext(file)) {
+			case ".yaml", ".yml", ".json":
+				if err := set.loadFile(file); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	return set, nil
+}
+
+// LoadFile reads the fixtures of a single YAML or JSON file
+func LoadFile(file string) (Set, error) {
+	set := Set{}
+
+	if err := set.loadFile(file); err != nil {
+		return nil, err
+	}
+
+	return set, nil
+}
+
+func (set Set) loadFile(file string) error {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	// JSON is valid YAML, so every file goes through the YAML decoder and is
+	// converted back to JSON for the entities
+	var entities map[string][]interface{}
+	if err := yaml.Unmarshal(content, &entities); err != nil {
+		return fmt.Errorf("%s: %w", file, err)
+	}
+
+	for name, fixtures := range entities {
+		for i, fixture := range fixtures {
+			raw, err := json.Marshal(fixture)
+			if err != nil {
+				return fmt.Errorf("%s: %s[%d]: %w", file, name, i, err)
+			}
+
+			set[name] = append(set[name], raw)
+		}
+	}
+
+	return nil
+}
+
+// Run seeds every fixture of the set in a single transaction, a broken fixture
+// leaves the database untouched
+func Run(db *gorm.DB, set Set, env string) (Report, error) {
+	for name := range set {
+		if !registered(name) {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownEntity, name)
+		}
+	}
+
+	state := &State{
+		Production: env == EnvProduction,
+		refs:       map[string]map[string]uint{},
+	}
+	report := Report{}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		for _, entity := range registry {
+			counts := report[entity.Name]
+
+			for i, raw := range set[entity.Name] {
+				key, id, created, err := entity.Seed(tx, state, raw)
+				if err != nil {
+					return fmt.Errorf("%s[%d]: %w", entity.Name, i, err)
+				}
+
+				state.setRef(entity.Name, key, id)
+
+				if created {
+					counts.Created++
+				} else {
+					counts.Existing++
+				}
+			}
+
+			if len(set[entity.Name]) > 0 {
+				report[entity.Name] = counts
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+func registered(name string) bool {
+	for _, entity := range registry {
+		if entity.Name == name {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,286 @@
+package seed
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"films-api.rdelgado.es/src/internals/models"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+const usersFixture = `
+users:
+  - key: alice
+    name: alice
+    password: Secret.pass1
+`
+
+const moviesFixture = `
+movies:
+  - key: heat
+    title: Heat
+    director: Michael Mann
+    release_date: "1995-12-15"
+    cast: [Al Pacino, Robert De Niro]
+    genre: Crime
+    synopsis: A group of professional bank robbers.
+    created_by: alice
+favourites:
+  - user: alice
+    movie: heat
+lists:
+  - name: Heists
+    owner: alice
+    items:
+      - movie: heat
+        note: The bank robbery
+`
+
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{
+		TranslateError: true,
+		Logger:         logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.AutoMigrate(&models.User{}, &models.Movie{}, &models.Favourite{}, &models.List{}, &models.ListItem{}, &models.Catalogue{}); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	return db
+}
+
+// writeFiles creates the files of a fixtures directory
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return dir
+}
+
+func TestLoadDir(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"base/01_users.yaml":             usersFixture,
+		"base/README.md":                 "Not a fixture",
+		"development/02_movies.json":     `{"movies": [{"title": "Thief", "created_by": "alice"}]}`,
+		"development/01_movies.yml":      "movies:\n  - title: Heat\n    created_by: alice\n",
+		"production/01_users.yaml":       "users:\n  - name: admin\n",
+		"production/nested/01_users.yml": "users:\n  - name: nested\n",
+	})
+
+	tests := []struct {
+		env    string
+		users  int
+		movies []string
+	}{
+		{env: "development", users: 1, movies: []string{"Heat", "Thief"}},
+		{env: EnvProduction, users: 2},
+		{env: "staging", users: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.env, func(t *testing.T) {
+			set, err := LoadDir(dir, tt.env)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(set["users"]) != tt.users {
+				t.Errorf("users: got %d, want %d", len(set["users"]), tt.users)
+			}
+
+			// Files are loaded in name order
+			if len(set["movies"]) != len(tt.movies) {
+				t.Fatalf("movies: got %d, want %d", len(set["movies"]), len(tt.movies))
+			}
+			for i, title := range tt.movies {
+				var movie movieFixture
+				if err := json.Unmarshal(set["movies"][i], &movie); err != nil || movie.Title != title {
+					t.Errorf("movie %d: got %q (%v), want %q", i, movie.Title, err, title)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadInvalidFiles(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"syntax.yaml":    "users:\n  - name: alice\n   password: [",
+		"not-a-list.yml": "users:\n  name: alice\n",
+		"syntax.json":    `{"users": [{"name": "alice"}`,
+		"empty.yaml":     "",
+	})
+
+	tests := []struct {
+		file    string
+		wantErr bool
+	}{
+		{file: "syntax.yaml", wantErr: true},
+		{file: "not-a-list.yml", wantErr: true},
+		{file: "syntax.json", wantErr: true},
+		{file: "missing.yaml", wantErr: true},
+		{file: "empty.yaml"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			set, err := LoadFile(filepath.Join(dir, tt.file))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("got %v (%v), want error: %v", set, err, tt.wantErr)
+			}
+		})
+	}
+
+	// A broken file stops the whole directory
+	broken := writeFiles(t, map[string]string{
+		"base/01_users.yaml":  usersFixture,
+		"development/02.yaml": "movies: {",
+		"development/01.yaml": moviesFixture,
+	})
+	if _, err := LoadDir(broken, "development"); err == nil {
+		t.Error("loading a directory with a broken file: got no error")
+	}
+}
+
+func TestRun(t *testing.T) {
+	db := newTestDB(t)
+
+	dir := writeFiles(t, map[string]string{
+		"base/01_users.yaml":        usersFixture,
+		"development/02_movies.yml": moviesFixture,
+	})
+	set, err := LoadDir(dir, "development")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := Run(db, set, "development")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entity := range []string{"users", "movies", "favourites", "lists"} {
+		if report[entity].Created != 1 || report[entity].Existing != 0 {
+			t.Errorf("%s of the first run: got %+v", entity, report[entity])
+		}
+	}
+
+	// Seeding again only references what already exists
+	report, err = Run(db, set, "development")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entity := range []string{"users", "movies", "favourites", "lists"} {
+		if report[entity].Created != 0 || report[entity].Existing != 1 {
+			t.Errorf("%s of the second run: got %+v", entity, report[entity])
+		}
+	}
+
+	var items int64
+	db.Model(&models.ListItem{}).Count(&items)
+	if items != 1 {
+		t.Errorf("list items after seeding twice: got %d", items)
+	}
+}
+
+func TestRunProduction(t *testing.T) {
+	db := newTestDB(t)
+
+	set := Set{}
+	if err := set.loadFile(writeFiles(t, map[string]string{"users.yaml": usersFixture}) + "/users.yaml"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Run(db, set, EnvProduction); !errors.Is(err, ErrDefaultCredentials) {
+		t.Fatalf("seeding passwords in production: got %v, want %v", err, ErrDefaultCredentials)
+	}
+
+	// Users created by other means can still be referenced
+	if _, err := Run(db, set, "development"); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := writeFiles(t, map[string]string{
+		"production/01_users.yaml": "users:\n  - key: alice\n    name: alice\n",
+		"production/02_movies.yml": moviesFixture,
+	})
+	production, err := LoadDir(dir, EnvProduction)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := Run(db, production, EnvProduction)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report["users"].Existing != 1 || report["movies"].Created != 1 {
+		t.Errorf("production report: got %+v", report)
+	}
+
+	// Users without password are not created
+	missing := Set{}
+	missing.loadFile(writeFiles(t, map[string]string{"users.yaml": "users:\n  - name: bob\n"}) + "/users.yaml")
+	if _, err := Run(db, missing, EnvProduction); err == nil {
+		t.Error("referencing a missing user: got no error")
+	}
+}
+
+func TestRunInvalidFixtures(t *testing.T) {
+	db := newTestDB(t)
+
+	tests := []struct {
+		name    string
+		fixture string
+		want    error
+	}{
+		{name: "unknown entity", fixture: "actors:\n  - name: Al Pacino\n", want: ErrUnknownEntity},
+		{name: "unknown reference", fixture: usersFixture + "favourites:\n  - user: alice\n    movie: heat\n", want: ErrUnknownReference},
+		{name: "invalid date", fixture: usersFixture + "movies:\n  - title: Heat\n    release_date: 15/12/1995\n    created_by: alice\n"},
+		{name: "invalid field", fixture: usersFixture + "movies:\n  - title: Heat\n    cast: Al Pacino\n    created_by: alice\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			set := Set{}
+			if err := set.loadFile(writeFiles(t, map[string]string{"fixtures.yaml": tt.fixture}) + "/fixtures.yaml"); err != nil {
+				t.Fatal(err)
+			}
+
+			_, err := Run(db, set, "development")
+			if err == nil || (tt.want != nil && !errors.Is(err, tt.want)) {
+				t.Fatalf("got %v, want %v", err, tt.want)
+			}
+
+			// A broken fixture leaves the database untouched
+			var users int64
+			db.Model(&models.User{}).Count(&users)
+			if users != 0 {
+				t.Errorf("users after a failed run: got %d", users)
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+// Package storage keeps binary files (blobs) such as the movie images. Blobs
+// are identified by slash-separated keys like movies/12/poster-3f9a.jpg and
+// stored through the BlobStore interface, so the local filesystem can be
+// replaced by an S3-compatible store.
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"mime"
+	"path"
+	"strings"
+	"time"
+)
+
+var ErrNotFound = errors.New("blob not found")
+var ErrInvalidKey = errors.New("blob key is not valid")
+
+// BlobStore stores blobs by key. Putting an existing key replaces the blob and
+// deleting a missing key is not an error.
+type BlobStore interface {
+	Put(ctx context.Context, key string, src io.Reader) error
+	Get(ctx context.Context, key string) (*Blob, error)
+	Delete(ctx context.Context, keys ...string) error
+}
+
+// Blob is the content of a stored blob. The caller must close it.
+type Blob struct {
+	io.ReadCloser
+
+	Size        int64
+	ContentType string
+	ModTime     time.Time
+}
+
+// ValidKey reports if a key can be stored: relative, without empty, . or ..
+// segments and without backslashes
+func ValidKey(key string) bool {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, `\`) {
+		return false
+	}
+
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return false
+		}
+	}
+
+	return true
+}
+
+// ContentType is the media type of a key, taken from its extension
+func ContentType(key string) string {
+	if contentType := mime.TypeByExtension(path.Ext(key)); contentType != "" {
+		return contentType
+	}
+
+	return "application/octet-stream"
+}
@@ -0,0 +1,132 @@
+// Package stream fans out the events of the outbox to the clients of the
+// Server-Sent Events endpoint. The Broker keeps the latest events in memory,
+// so clients that reconnect get the events they missed.
+package stream
+
+import (
+	"context"
+	"sync"
+
+	"films-api.rdelgado.es/src/internals/events"
+)
+
+// Broker is a sink of the outbox that sends the events to the subscriptions.
+// Publishing never blocks: subscriptions whose buffer is full are closed, and
+// their clients resume from the log when they reconnect.
+type Broker struct {
+	mu            sync.Mutex
+	log           []events.Event
+	ids           map[string]struct{}
+	logSize       int
+	bufferSize    int
+	subscriptions map[*Subscription]struct{}
+}
+
+// New returns a broker that keeps the last logSize events and buffers up to
+// bufferSize events for each subscription
+func New(logSize, bufferSize int) *Broker {
+	return &Broker{
+		ids:           make(map[string]struct{}, logSize),
+		logSize:       logSize,
+		bufferSize:    bufferSize,
+		subscriptions: make(map[*Subscription]struct{}),
+	}
+}
+
+// Subscription receives the events that pass its filter. C is closed when the
+// subscription ends because the client did not keep up.
+type Subscription struct {
+	C <-chan events.Event
+
+	c      chan events.Event
+	filter func(events.Event) bool
+}
+
+// Publish adds the event to the log and sends it to the subscriptions. The
+// outbox publishes at least once, so events already in the log are ignored.
+func (b *Broker) Publish(ctx context.Context, event events.Event) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, exists := b.ids[event.ID]; exists {
+		return nil
+	}
+
+	if len(b.log) == b.logSize {
+		delete(b.ids, b.log[0].ID)
+		b.log = b.log[1:]
+	}
+	b.log = append(b.log, event)
+	b.ids[event.ID] = struct{}{}
+
+	for sub := range b.subscriptions {
+		if !sub.filter(event) {
+			continue
+		}
+
+		select {
+		case sub.c <- event:
+		default:
+			b.remove(sub)
+		}
+	}
+
+	return nil
+}
+
+// Subscribe starts a subscription with the events that pass filter. If
+// lastEventId is set, the events of the log after it are returned to be sent
+// first. found is false if the event is not in the log anymore, so the client
+// may have missed events.
+func (b *Broker) Subscribe(lastEventId string, filter func(events.Event) bool) (sub *Subscription, missed []events.Event, found bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	found = lastEventId == ""
+	if !found {
+		for i, event := range b.log {
+			if event.ID != lastEventId {
+				continue
+			}
+
+			found = true
+			for _, event := range b.log[i+1:] {
+				if filter(event) {
+					missed = append(missed, event)
+				}
+			}
+			break
+		}
+	}
+
+	c := make(chan events.Event, b.bufferSize)
+	sub = &Subscription{C: c, c: c, filter: filter}
+	b.subscriptions[sub] = struct{}{}
+
+	return sub, missed, found
+}
+
+// Unsubscribe ends a subscription. It can be called after the broker closed it.
+func (b *Broker) Unsubscribe(sub *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.remove(sub)
+}
+
+func (b *Broker) remove(sub *Subscription) {
+	if _, exists := b.subscriptions[sub]; !exists {
+		return
+	}
+
+	delete(b.subscriptions, sub)
+	close(sub.c)
+}
+
+// Subscribers returns the number of active subscriptions
+func (b *Broker) Subscribers() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return len(b.subscriptions)
+}
@@ -0,0 +1,77 @@
+package stream
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"films-api.rdelgado.es/src/internals/events"
+)
+
+func all(events.Event) bool { return true }
+
+func TestBroker(t *testing.T) {
+	ctx := context.Background()
+	broker := New(3, 2)
+
+	published := make([]events.Event, 5)
+	for i := range published {
+		published[i] = events.New(events.MovieCreated, uint(i+1), 1, nil)
+	}
+
+	slow, _, _ := broker.Subscribe("", all)
+	movie2, _, _ := broker.Subscribe("", func(event events.Event) bool { return event.AggregateID == 2 })
+
+	// Publishing does not wait for the slow subscription, which is closed
+	for _, event := range published {
+		if err := broker.Publish(ctx, event); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	received := 0
+	for range slow.C {
+		received++
+	}
+	if received != 2 {
+		t.Errorf("slow subscription: got %d events before closing, want 2", received)
+	}
+
+	if event := <-movie2.C; event.ID != published[1].ID {
+		t.Errorf("filtered subscription: got %+v", event)
+	}
+	if broker.Subscribers() != 1 {
+		t.Errorf("subscribers: got %d, want 1", broker.Subscribers())
+	}
+
+	// Duplicates of the outbox are ignored
+	broker.Publish(ctx, published[4])
+
+	// The log keeps the last 3 events
+	_, missed, found := broker.Subscribe(published[2].ID, all)
+	if !found || len(missed) != 2 || missed[0].ID != published[3].ID || missed[1].ID != published[4].ID {
+		t.Errorf("resuming after %s: got %v %v", published[2].ID, missed, found)
+	}
+
+	if _, missed, found := broker.Subscribe(published[1].ID, all); found || len(missed) != 0 {
+		t.Errorf("resuming after an event out of the log: got %v %v", missed, found)
+	}
+
+	broker.Unsubscribe(movie2)
+	broker.Unsubscribe(slow)
+	if _, ok := <-movie2.C; ok {
+		t.Error("the subscription was not closed")
+	}
+}
+
+func TestBrokerLog(t *testing.T) {
+	broker := New(10, 1)
+
+	for i := 0; i < 100; i++ {
+		broker.Publish(context.Background(), events.Event{ID: strconv.Itoa(i)})
+	}
+
+	if len(broker.log) != 10 || len(broker.ids) != 10 || broker.log[0].ID != "90" {
+		t.Errorf("log: got %d events (%d ids) from %s", len(broker.log), len(broker.ids), broker.log[0].ID)
+	}
+}
@@ -0,0 +1,76 @@
+package totp
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Test vectors of RFC 6238, appendix B (SHA-1), truncated to 6 digits
+func TestCode(t *testing.T) {
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+	tests := map[int64]string{
+		59:          "287082",
+		1111111109:  "081804",
+		1111111111:  "050471",
+		1234567890:  "005924",
+		2000000000:  "279037",
+		20000000000: "353130",
+	}
+
+	for unix, want := range tests {
+		got, err := Code(secret, Counter(time.Unix(unix, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("code at %d: got %s, want %s", unix, got, want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret, err := NewSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Unix(1700000000, 0)
+	code, _ := Code(secret, Counter(now))
+	previous, _ := Code(secret, Counter(now)-1)
+	old, _ := Code(secret, Counter(now)-2)
+
+	counter, ok := Validate(secret, code, now, 0)
+	if !ok || counter != Counter(now) {
+		t.Errorf("current code: got %d %v", counter, ok)
+	}
+	if _, ok := Validate(secret, previous, now, 0); !ok {
+		t.Error("code of the previous period rejected")
+	}
+	if _, ok := Validate(secret, old, now, 0); ok {
+		t.Error("code of two periods ago accepted")
+	}
+
+	// Codes cannot be used again
+	if _, ok := Validate(secret, code, now, counter); ok {
+		t.Error("code of a used period accepted")
+	}
+	if _, ok := Validate(secret, previous, now, counter); ok {
+		t.Error("code of a period before the used one accepted")
+	}
+}
+
+func TestURI(t *testing.T) {
+	uri := URI("JBSWY3DPEHPK3PXP", "Films API", "test 1")
+
+	if !strings.HasPrefix(uri, "otpauth://totp/Films%20API:test%201?") {
+		t.Errorf("label of %s", uri)
+	}
+	for _, want := range []string{"secret=JBSWY3DPEHPK3PXP", "issuer=Films+API", "digits=6", "period=30"} {
+		if !strings.Contains(uri, want) {
+			t.Errorf("%s does not contain %s", uri, want)
+		}
+	}
+}
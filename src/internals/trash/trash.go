@@ -0,0 +1,81 @@
+// Package trash purges the deleted movies. Deleted movies are kept in the
+// trash, where their creators can restore them, until the retention of the
+// MovieModel is over; then the Purger deletes them for good with their
+// favourites, list items and images.
+package trash
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// Trash deletes the movies whose retention is over, at most limit at a time,
+// and returns how many it deleted
+type Trash interface {
+	PurgeExpired(now time.Time, limit int) (int, error)
+}
+
+// Purger empties the trash in the background. It must be created with New,
+// which sets the default settings.
+type Purger struct {
+	Trash  Trash
+	Logger *slog.Logger
+
+	// Movies purged on each round
+	BatchSize int
+
+	// How often the trash is checked
+	Interval time.Duration
+}
+
+func New(trash Trash, logger *slog.Logger) *Purger {
+	return &Purger{
+		Trash:     trash,
+		Logger:    logger,
+		BatchSize: 100,
+		Interval:  time.Hour,
+	}
+}
+
+// Run purges the trash until the context is canceled
+func (p *Purger) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.Interval)
+	defer ticker.Stop()
+
+	for {
+		purged, err := p.Purge(ctx, time.Now())
+		if err != nil {
+			p.Logger.Error("purging the trash", "error", err.Error())
+		}
+		if purged > 0 {
+			p.Logger.Info("trash purged", "movies", purged)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Purge deletes the expired movies in batches until none is left, and
+// returns how many it deleted
+func (p *Purger) Purge(ctx context.Context, now time.Time) (int, error) {
+	total := 0
+
+	for ctx.Err() == nil {
+		purged, err := p.Trash.PurgeExpired(now, p.BatchSize)
+		total += purged
+		if err != nil {
+			return total, err
+		}
+
+		if purged < p.BatchSize {
+			break
+		}
+	}
+
+	return total, nil
+}
@@ -0,0 +1,434 @@
+package validator
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"films-api.rdelgado.es/src/internals/i18n"
+)
+
+// RuleFunc checks the value of a field. param is the text after the "=" of the
+// rule in the tag (max=200 has param "200"), empty if there is none.
+type RuleFunc func(value reflect.Value, param string) bool
+
+type rule struct {
+	check   RuleFunc
+	message func(value reflect.Value, param string) i18n.Message
+}
+
+var (
+	rulesMu sync.RWMutex
+	rules   = map[string]rule{}
+
+	// Validation plan of each struct type
+	plans sync.Map
+)
+
+func init() {
+	registerRule("required", isSet, fixedMessage("validation.required"))
+	registerRule("min", checkMin, limitMessage("min"))
+	registerRule("max", checkMax, limitMessage("max"))
+	registerRule("oneof", checkOneOf, func(_ reflect.Value, param string) i18n.Message {
+		return i18n.NewMessage("validation.oneof", i18n.Params{"values": strings.Join(strings.Fields(param), ", ")})
+	})
+	registerRule("date", checkDate, func(_ reflect.Value, param string) i18n.Message {
+		return i18n.NewMessage("validation.date", i18n.Params{"format": dateFormat(param)})
+	})
+	registerRule("username", func(v reflect.Value, _ string) bool {
+		return Matches(v.String(), UsernameRX)
+	}, fixedMessage("validation.username"))
+	registerRule("password", func(v reflect.Value, _ string) bool {
+		return IsStrongPassword(v.String())
+	}, fixedMessage("validation.password"))
+	registerRule("url", func(v reflect.Value, _ string) bool {
+		return IsWebURL(v.String())
+	}, fixedMessage("validation.url"))
+	registerRule("email", func(v reflect.Value, _ string) bool {
+		return IsEmail(v.String())
+	}, fixedMessage("validation.email"))
+}
+
+// RegisterRule adds a rule that can be used in validate tags. The message is
+// a key of the i18n catalogues or a plain text, where {param} is replaced by
+// the parameter of the rule. Rules must be registered before the first struct
+// using them is validated.
+func RegisterRule(name string, check RuleFunc, message string) {
+	registerRule(name, check, func(_ reflect.Value, param string) i18n.Message {
+		return i18n.NewMessage(message, i18n.Params{"param": param})
+	})
+}
+
+func registerRule(name string, check RuleFunc, message func(reflect.Value, string) i18n.Message) {
+	rulesMu.Lock()
+	defer rulesMu.Unlock()
+
+	rules[name] = rule{check: check, message: message}
+}
+
+// CheckStruct validates the fields of a struct (or pointer to struct) with the
+// rules of their validate tags, adding an error for each invalid field
+func (v *Validator) CheckStruct(s any) {
+	for key, message := range StructMessages(s) {
+		v.AddFieldMessage(key, message)
+	}
+}
+
+// Struct validates the fields of a struct with the rules of their validate
+// tags and returns a message for each invalid field. Rules are separated by
+// commas and checked in order until one fails:
+//
+//	Title string   `validate:"required,max=200"`
+//	Cast  []string `validate:"required,dive,required,max=100"`
+//
+// omitempty skips the rest of the rules if the field is empty, and dive
+// applies the rules after it to each element of a slice. Fields of nested
+// structs are always validated. Errors are keyed by the JSON name of the field
+// (or the field tag) with the path of nested fields: cast[2], list.name.
+// Messages are in the fallback locale of the i18n package.
+func Struct(s any) map[string]string {
+	errs := map[string]string{}
+	for key, message := range StructMessages(s) {
+		errs[key] = message.String()
+	}
+
+	return errs
+}
+
+// StructMessages is like Struct but returns translatable messages
+func StructMessages(s any) map[string]i18n.Message {
+	errs := map[string]i18n.Message{}
+
+	value := reflect.ValueOf(s)
+	for value.Kind() == reflect.Pointer {
+		if value.IsNil() {
+			return errs
+		}
+		value = value.Elem()
+	}
+
+	if value.Kind() == reflect.Struct {
+		validateStruct(value, "", errs)
+	}
+
+	return errs
+}
+
+// plan holds the parsed rules of the fields of a struct type
+type plan struct {
+	fields []fieldPlan
+}
+
+type fieldPlan struct {
+	index     []int
+	key       string
+	omitEmpty bool
+	rules     []boundRule
+
+	// Rules of the elements of slices
+	dive      bool
+	elemRules []boundRule
+}
+
+type boundRule struct {
+	name  string
+	param string
+	rule
+}
+
+func planFor(t reflect.Type) *plan {
+	if cached, ok := plans.Load(t); ok {
+		return cached.(*plan)
+	}
+
+	p := buildPlan(t, nil)
+
+	cached, _ := plans.LoadOrStore(t, p)
+	return cached.(*plan)
+}
+
+func buildPlan(t reflect.Type, index []int) *plan {
+	p := &plan{}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		fieldIndex := append(append([]int{}, index...), i)
+
+		jsonName, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		tag := field.Tag.Get("validate")
+
+		// Fields of embedded structs are validated as fields of the parent
+		if field.Anonymous && jsonName == "" && tag == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Struct {
+				p.fields = append(p.fields, buildPlan(embedded, fieldIndex).fields...)
+			}
+			continue
+		}
+
+		if !field.IsExported() || tag == "-" || (jsonName == "-" && tag == "") {
+			continue
+		}
+
+		f := fieldPlan{index: fieldIndex, key: fieldKey(field, jsonName)}
+
+		if tag != "" {
+			for _, part := range strings.Split(tag, ",") {
+				name, param, _ := strings.Cut(strings.TrimSpace(part), "=")
+
+				switch name {
+				case "omitempty":
+					if !f.dive {
+						f.omitEmpty = true
+					}
+					continue
+				case "dive":
+					f.dive = true
+					continue
+				}
+
+				rulesMu.RLock()
+				r, exists := rules[name]
+				rulesMu.RUnlock()
+				if !exists {
+					panic(fmt.Sprintf("validator: unknown rule %q in field %s.%s", name, t.Name(), field.Name))
+				}
+
+				bound := boundRule{name: name, param: param, rule: r}
+				if f.dive {
+					f.elemRules = append(f.elemRules, bound)
+				} else {
+					f.rules = append(f.rules, bound)
+				}
+			}
+		}
+
+		p.fields = append(p.fields, f)
+	}
+
+	return p
+}
+
+func validateStruct(value reflect.Value, path string, errs map[string]i18n.Message) {
+	for _, field := range planFor(value.Type()).fields {
+		fieldValue, ok := fieldByIndex(value, field.index)
+		if !ok {
+			continue
+		}
+
+		key := join(path, field.key)
+
+		if field.omitEmpty && !isSet(fieldValue, "") {
+			continue
+		}
+
+		if !checkRules(fieldValue, field.rules, key, errs) {
+			continue
+		}
+
+		element := fieldValue
+		for element.Kind() == reflect.Pointer && !element.IsNil() {
+			element = element.Elem()
+		}
+
+		switch element.Kind() {
+		case reflect.Struct:
+			if element.Type() != timeType {
+				validateStruct(element, key, errs)
+			}
+		case reflect.Slice, reflect.Array:
+			for i := 0; i < element.Len(); i++ {
+				item := element.Index(i)
+				itemKey := fmt.Sprintf("%s[%d]", key, i)
+
+				if field.dive && !checkRules(item, field.elemRules, itemKey, errs) {
+					continue
+				}
+
+				for item.Kind() == reflect.Pointer && !item.IsNil() {
+					item = item.Elem()
+				}
+				if item.Kind() == reflect.Struct && item.Type() != timeType {
+					validateStruct(item, itemKey, errs)
+				}
+			}
+		}
+	}
+}
+
+// checkRules adds the message of the first failed rule and reports if all passed
+func checkRules(value reflect.Value, fieldRules []boundRule, key string, errs map[string]i18n.Message) bool {
+	for _, r := range fieldRules {
+		// Rules other than required are not checked on missing values
+		if r.name != "required" && value.Kind() == reflect.Pointer && value.IsNil() {
+			continue
+		}
+
+		v := reflect.Indirect(value)
+		if !r.check(v, r.param) {
+			if _, exists := errs[key]; !exists {
+				errs[key] = r.message(v, r.param)
+			}
+			return false
+		}
+	}
+
+	return true
+}
+
+// fieldByIndex is reflect.Value.FieldByIndex stopping at nil embedded pointers
+func fieldByIndex(value reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && value.Kind() == reflect.Pointer {
+			if value.IsNil() {
+				return reflect.Value{}, false
+			}
+			value = value.Elem()
+		}
+		value = value.Field(x)
+	}
+
+	return value, true
+}
+
+// fieldKey is the name of the field in the errors: the field tag, the JSON
+// name or the Go name in snake case
+func fieldKey(field reflect.StructField, jsonName string) string {
+	if name := field.Tag.Get("field"); name != "" {
+		return name
+	}
+	if jsonName != "" && jsonName != "-" {
+		return jsonName
+	}
+
+	return snakeCase(field.Name)
+}
+
+// snakeCase converts a Go name to snake case (ReleaseDate to release_date, MovieID to movie_id)
+func snakeCase(name string) string {
+	runes := []rune(name)
+
+	var b strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			// A new word starts after a lower case letter or before one (the D in IDs is not a new word)
+			if i > 0 && (unicode.IsLower(runes[i-1]) || i+1 < len(runes) && unicode.IsLower(runes[i+1]) && runes[i+1] != 's') {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+
+	return b.String()
+}
+
+func join(path, key string) string {
+	if path == "" {
+		return key
+	}
+
+	return path + "." + key
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func fixedMessage(key string) func(reflect.Value, string) i18n.Message {
+	return func(reflect.Value, string) i18n.Message {
+		return i18n.NewMessage(key, nil)
+	}
+}
+
+// isSet reports if a value is not empty. Strings with only spaces are empty.
+func isSet(value reflect.Value, _ string) bool {
+	switch value.Kind() {
+	case reflect.Invalid:
+		return false
+	case reflect.String:
+		return NoBlank(value.String())
+	case reflect.Slice, reflect.Map, reflect.Array:
+		return value.Len() > 0
+	case reflect.Pointer, reflect.Interface:
+		return !value.IsNil()
+	}
+
+	return !value.IsZero()
+}
+
+// size is the number of characters of strings, elements of collections and
+// the value of numbers
+func size(value reflect.Value) (float64, bool) {
+	switch value.Kind() {
+	case reflect.String:
+		return float64(utf8.RuneCountInString(value.String())), true
+	case reflect.Slice, reflect.Map, reflect.Array:
+		return float64(value.Len()), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(value.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(value.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return value.Float(), true
+	}
+
+	return 0, false
+}
+
+func checkMin(value reflect.Value, param string) bool {
+	limit, err := strconv.ParseFloat(param, 64)
+	n, ok := size(value)
+
+	return err == nil && ok && n >= limit
+}
+
+func checkMax(value reflect.Value, param string) bool {
+	limit, err := strconv.ParseFloat(param, 64)
+	n, ok := size(value)
+
+	return err == nil && ok && n <= limit
+}
+
+// limitMessage returns the message of the min or max rule, which depends on
+// the kind of value (characters, items or number)
+func limitMessage(name string) func(reflect.Value, string) i18n.Message {
+	return func(value reflect.Value, param string) i18n.Message {
+		kind := "number"
+		switch value.Kind() {
+		case reflect.String:
+			kind = "string"
+		case reflect.Slice, reflect.Map, reflect.Array:
+			kind = "items"
+		}
+
+		return i18n.NewMessage("validation."+name+"."+kind, i18n.Params{name: param})
+	}
+}
+
+// checkOneOf checks that the value is one of the values separated by spaces (oneof=public private)
+func checkOneOf(value reflect.Value, param string) bool {
+	return PermittedValue(fmt.Sprint(value.Interface()), strings.Fields(param)...)
+}
+
+// checkDate checks that a string is a date in the time layout of the param
+// (date=2006-01-02). Empty strings are left to the required rule.
+func checkDate(value reflect.Value, param string) bool {
+	if value.Kind() != reflect.String {
+		return false
+	}
+	if value.String() == "" {
+		return true
+	}
+
+	_, err := time.Parse(param, value.String())
+	return err == nil
+}
+
+// dateFormat describes a time layout to users (2006-01-02 is YYYY-MM-DD)
+func dateFormat(layout string) string {
+	return strings.NewReplacer("2006", "YYYY", "01", "MM", "02", "DD", "15", "hh", "04", "mm", "05", "ss").Replace(layout)
+}
@@ -0,0 +1,114 @@
+package validator
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"films-api.rdelgado.es/src/internals/i18n"
+)
+
+type testActor struct {
+	Name string `json:"name" validate:"required"`
+}
+
+type testMovie struct {
+	Title       string      `validate:"required,max=10"`
+	ReleaseDate string      `validate:"omitempty,date=2006-01-02"`
+	Cast        []string    `json:"stringArray" field:"cast" validate:"required,dive,required,max=5"`
+	Rating      int         `json:"rating" validate:"omitempty,min=1,max=5"`
+	Visibility  string      `json:"visibility" validate:"omitempty,oneof=public private"`
+	Director    *testActor  `json:"director"`
+	Crew        []testActor `json:"crew"`
+	Code        string      `json:"code" validate:"omitempty,upper"`
+	Validator   `json:"-"`
+}
+
+func init() {
+	RegisterRule("upper", func(value reflect.Value, _ string) bool {
+		return strings.ToUpper(value.String()) == value.String()
+	}, "This field must be in upper case")
+}
+
+func TestStruct(t *testing.T) {
+	valid := testMovie{Title: "Heat", Cast: []string{"Al"}}
+
+	tests := []struct {
+		name  string
+		movie func(m *testMovie)
+		want  map[string]string
+	}{
+		{"valid", func(m *testMovie) {}, map[string]string{}},
+		{"required", func(m *testMovie) { m.Title = "  " }, map[string]string{"title": "This field cannot be blank"}},
+		{"max characters", func(m *testMovie) { m.Title = "Once Upon a Time" }, map[string]string{"title": "This field must be less than 10 characters long"}},
+		{"date", func(m *testMovie) { m.ReleaseDate = "15/12/1995" }, map[string]string{"release_date": "This field must be a date with format YYYY-MM-DD"}},
+		{"empty slice", func(m *testMovie) { m.Cast = nil }, map[string]string{"cast": "This field cannot be blank"}},
+		{"slice elements", func(m *testMovie) { m.Cast = []string{"Al", "", "Robert"} }, map[string]string{"cast[1]": "This field cannot be blank", "cast[2]": "This field must be less than 5 characters long"}},
+		{"numbers", func(m *testMovie) { m.Rating = 6 }, map[string]string{"rating": "This field must be at most 5"}},
+		{"oneof", func(m *testMovie) { m.Visibility = "friends" }, map[string]string{"visibility": "This field must be one of: public, private"}},
+		{"nested struct", func(m *testMovie) { m.Director = &testActor{} }, map[string]string{"director.name": "This field cannot be blank"}},
+		{"slice of structs", func(m *testMovie) { m.Crew = []testActor{{"Dante"}, {}} }, map[string]string{"crew[1].name": "This field cannot be blank"}},
+		{"custom rule", func(m *testMovie) { m.Code = "abc" }, map[string]string{"code": "This field must be in upper case"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			movie := valid
+			tt.movie(&movie)
+
+			if got := Struct(&movie); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckStructKeepsFirstError(t *testing.T) {
+	movie := testMovie{Cast: []string{"Al"}}
+	movie.AddFieldError("title", "Title already exists")
+	movie.CheckStruct(movie)
+
+	if movie.IsValid() || movie.FieldErrors["title"] != "Title already exists" {
+		t.Errorf("got %v, want the first error of title", movie.FieldErrors)
+	}
+}
+
+func TestUnknownRule(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("unknown rule did not panic")
+		}
+	}()
+
+	Struct(struct {
+		Name string `validate:"nonsense"`
+	}{})
+}
+
+func TestSnakeCase(t *testing.T) {
+	for name, want := range map[string]string{"Title": "title", "ReleaseDate": "release_date", "MovieID": "movie_id", "ItemIDs": "item_ids", "HTTPCode": "http_code"} {
+		if got := snakeCase(name); got != want {
+			t.Errorf("snakeCase(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestRuleMessagesAreTranslated(t *testing.T) {
+	movie := testMovie{Title: "Once Upon a Time", ReleaseDate: "1995", Cast: []string{""}, Rating: 9, Visibility: "friends"}
+
+	messages := StructMessages(movie)
+	if len(messages) == 0 {
+		t.Fatal("no errors")
+	}
+
+	for field, message := range messages {
+		if !i18n.Has(message.Key) {
+			t.Errorf("%s: message key %q is not in the catalogue", field, message.Key)
+		}
+	}
+
+	movie.CheckStruct(movie)
+	if got := movie.LocalizedFieldErrors("es")["title"]; got != "Este campo debe tener menos de 10 caracteres" {
+		t.Errorf("spanish title error: got %q", got)
+	}
+}
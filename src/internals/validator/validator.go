@@ -1,16 +1,23 @@
 package validator
 
 import (
+	"net/mail"
+	"net/url"
 	"regexp"
 	"slices"
 	"strings"
 	"unicode"
 	"unicode/utf8"
+
+	"films-api.rdelgado.es/src/internals/i18n"
 )
 
 type Validator struct {
 	NonFieldErrors []string
 	FieldErrors    map[string]string
+
+	// Translatable messages of the field errors
+	fieldMessages map[string]i18n.Message
 }
 
 var UsernameRX = regexp.MustCompile("^[a-zA-Z]")
@@ -31,6 +38,35 @@ func (v *Validator) AddFieldError(key, message string) {
 	}
 }
 
+// AddFieldMessage adds a translatable field error. FieldErrors has the
+// message in the fallback locale.
+func (v *Validator) AddFieldMessage(key string, message i18n.Message) {
+	if _, exists := v.FieldErrors[key]; exists {
+		return
+	}
+
+	v.AddFieldError(key, message.String())
+
+	if v.fieldMessages == nil {
+		v.fieldMessages = map[string]i18n.Message{}
+	}
+	v.fieldMessages[key] = message
+}
+
+// LocalizedFieldErrors returns the field errors translated to a locale.
+// Errors added with AddFieldError are returned as they are.
+func (v *Validator) LocalizedFieldErrors(locale string) map[string]string {
+	errs := make(map[string]string, len(v.FieldErrors))
+	for key, message := range v.FieldErrors {
+		if translatable, exists := v.fieldMessages[key]; exists {
+			message = translatable.In(locale)
+		}
+		errs[key] = message
+	}
+
+	return errs
+}
+
 func (v *Validator) AddNonFieldError(message string) {
 	v.NonFieldErrors = append(v.NonFieldErrors, message)
 }
@@ -41,6 +77,12 @@ func (v *Validator) CheckField(ok bool, key, message string) {
 	}
 }
 
+func (v *Validator) CheckFieldMessage(ok bool, key string, message i18n.Message) {
+	if !ok {
+		v.AddFieldMessage(key, message)
+	}
+}
+
 func NoBlank(value string) bool {
 	return strings.TrimSpace(value) != ""
 }
@@ -58,16 +100,11 @@ func Matches(value string, rx *regexp.Regexp) bool {
 }
 
 func NoEmptyTextSlice(value []string) bool {
-	if value == nil {
-		return false
-	} else {
-		return len(value) <= 0
-	}
+	return len(value) > 0
 }
 
 func IsPositiveNumber(value int) bool {
-	rx := regexp.MustCompile(`^\d+$`)
-	return rx.MatchString(string(value))
+	return value > 0
 }
 
 func IsStrongPassword(value string) bool {
@@ -94,6 +131,18 @@ func IsStrongPassword(value string) bool {
 	return hasUpper && hasLower && hasDigit && hasSpecial
 }
 
+// IsEmail reports if the value is a bare email address, without a display name
+func IsEmail(value string) bool {
+	address, err := mail.ParseAddress(value)
+	return err == nil && address.Address == value
+}
+
+// IsWebURL reports if a value is an absolute http or https URL
+func IsWebURL(value string) bool {
+	u, err := url.Parse(value)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
 func PermittedValue[T comparable](value T, permittedValues ...T) bool {
 	return slices.Contains(permittedValues, value)
 }
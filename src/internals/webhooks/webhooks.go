@@ -0,0 +1,394 @@
+// Package webhooks sends the events to the endpoints registered by the users.
+// Each event is saved as a delivery for every subscribed webhook and sent by
+// the Dispatcher, which retries failed attempts with exponential backoff and
+// disables the webhooks that keep failing.
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"films-api.rdelgado.es/src/internals/events"
+	"films-api.rdelgado.es/src/internals/models"
+	"films-api.rdelgado.es/src/internals/retry"
+)
+
+// Headers of the deliveries
+const (
+	HeaderEvent     = "Webhook-Event"
+	HeaderID        = "Webhook-Id"
+	HeaderSignature = "Webhook-Signature"
+)
+
+var ErrInvalidSignature = errors.New("webhook signature is not valid")
+var ErrPrivateAddress = errors.New("webhook address is not public")
+
+// Dispatcher sends the deliveries of the webhooks. It must be created with
+// New, which sets the default settings.
+type Dispatcher struct {
+	Webhooks *models.WebhookModel
+	Client   *http.Client
+	Logger   *slog.Logger
+
+	// Attempts of a delivery before it fails
+	MaxAttempts int
+
+	// Delay before the first retry, doubled on each attempt up to MaxBackoff
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+
+	// Consecutive failed attempts that disable a webhook
+	MaxFailures int
+
+	// How often the due deliveries are checked, besides when an event is published
+	PollInterval time.Duration
+
+	wake chan struct{}
+}
+
+func New(webhooks *models.WebhookModel, logger *slog.Logger) *Dispatcher {
+	return &Dispatcher{
+		Webhooks:     webhooks,
+		Client:       NewClient(false),
+		Logger:       logger,
+		MaxAttempts:  8,
+		Backoff:      30 * time.Second,
+		MaxBackoff:   6 * time.Hour,
+		MaxFailures:  20,
+		PollInterval: 5 * time.Second,
+		wake:         make(chan struct{}, 1),
+	}
+}
+
+// NewClient returns the client of the deliveries. Redirects are not followed,
+// and unless allowPrivate is set, connections to loopback, private, link-local
+// and unspecified addresses are refused once the host is resolved, so the
+// webhooks cannot reach the internal network.
+func NewClient(allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+	if !allowPrivate {
+		dialer.Control = func(network, address string, c syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+
+			ip, err := netip.ParseAddr(host)
+			if err != nil || !Public(ip) {
+				return fmt.Errorf("%w: %s", ErrPrivateAddress, host)
+			}
+
+			return nil
+		}
+	}
+
+	return &http.Client{
+		Timeout: 10 * time.Second,
+
+		// No proxy, the dialer has to see the address of the endpoint
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			ForceAttemptHTTP2:   true,
+			MaxIdleConns:        100,
+			IdleConnTimeout:     90 * time.Second,
+			TLSHandshakeTimeout: 5 * time.Second,
+		},
+
+		// A redirect is the response of the endpoint, it is not followed
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// Public reports if the deliveries can be sent to an address: it must not be
+// a loopback, private, link-local, multicast or unspecified address
+func Public(ip netip.Addr) bool {
+	ip = ip.Unmap()
+
+	return ip.IsValid() && !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsUnspecified() &&
+		!ip.IsLinkLocalUnicast() && !ip.IsLinkLocalMulticast() && !ip.IsInterfaceLocalMulticast() && !ip.IsMulticast()
+}
+
+// NewSecret returns a random secret to sign the deliveries of a webhook
+func NewSecret() string {
+	secret := make([]byte, 24)
+	if _, err := rand.Read(secret); err != nil {
+		panic(err)
+	}
+
+	return "whsec_" + hex.EncodeToString(secret)
+}
+
+// Sign returns the Webhook-Signature header of a delivery: the timestamp and
+// the HMAC-SHA256 of "timestamp.body" with the secret of the webhook
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	t := strconv.FormatInt(timestamp.Unix(), 10)
+	return "t=" + t + ",v1=" + signature(secret, t, body)
+}
+
+// Verify checks the Webhook-Signature header of a delivery received at now.
+// Signatures older than tolerance are rejected to prevent replays.
+func Verify(secret, header string, body []byte, now time.Time, tolerance time.Duration) error {
+	var t, v1 string
+	for _, part := range strings.Split(header, ",") {
+		name, value, _ := strings.Cut(part, "=")
+		switch name {
+		case "t":
+			t = value
+		case "v1":
+			v1 = value
+		}
+	}
+
+	timestamp, err := strconv.ParseInt(t, 10, 64)
+	if err != nil || v1 == "" {
+		return ErrInvalidSignature
+	}
+
+	if age := now.Sub(time.Unix(timestamp, 0)); age > tolerance || age < -tolerance {
+		return ErrInvalidSignature
+	}
+
+	if !hmac.Equal([]byte(v1), []byte(signature(secret, t, body))) {
+		return ErrInvalidSignature
+	}
+
+	return nil
+}
+
+func signature(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Publish saves a delivery of the event for each subscribed webhook. They are
+// sent by Run. It is the sink of the outbox, so an event can be published more
+// than once: webhooks that already have a delivery of the event are skipped.
+func (d *Dispatcher) Publish(ctx context.Context, event events.Event) error {
+	subscribers, err := d.Webhooks.Subscribers(event.Type, event.UserID, events.Private(event.Type))
+	if err != nil {
+		return err
+	}
+	if len(subscribers) == 0 {
+		return nil
+	}
+
+	delivered, err := d.Webhooks.EventWebhooks(event.ID)
+	if err != nil {
+		return err
+	}
+
+	var webhooks []models.Webhook
+	for _, webhook := range subscribers {
+		if !slices.Contains(delivered, webhook.ID) {
+			webhooks = append(webhooks, webhook)
+		}
+	}
+	if len(webhooks) == 0 {
+		return nil
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	deliveries := make([]models.WebhookDelivery, len(webhooks))
+	for i, webhook := range webhooks {
+		deliveries[i] = models.WebhookDelivery{
+			WebhookID:     webhook.ID,
+			EventID:       event.ID,
+			EventType:     event.Type,
+			Payload:       string(payload),
+			Status:        models.DeliveryPending,
+			NextAttemptAt: &now,
+		}
+	}
+
+	if err := d.Webhooks.InsertDeliveries(deliveries); err != nil {
+		return err
+	}
+
+	d.notify()
+	return nil
+}
+
+// Redeliver sends the event of a delivery again, as a new delivery
+func (d *Dispatcher) Redeliver(delivery models.WebhookDelivery) (models.WebhookDelivery, error) {
+	now := time.Now()
+	redelivery := models.WebhookDelivery{
+		WebhookID:     delivery.WebhookID,
+		EventID:       delivery.EventID,
+		EventType:     delivery.EventType,
+		Payload:       delivery.Payload,
+		Status:        models.DeliveryPending,
+		NextAttemptAt: &now,
+		RedeliveryOf:  &delivery.ID,
+	}
+
+	// The ID is set in the element of the slice
+	batch := []models.WebhookDelivery{redelivery}
+	if err := d.Webhooks.InsertDeliveries(batch); err != nil {
+		return models.WebhookDelivery{}, err
+	}
+
+	d.notify()
+	return batch[0], nil
+}
+
+// notify wakes up Run without blocking
+func (d *Dispatcher) notify() {
+	if d.wake == nil {
+		return
+	}
+
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run sends the due deliveries until the context is canceled
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		d.sendDue(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-d.wake:
+		}
+	}
+}
+
+func (d *Dispatcher) sendDue(ctx context.Context) {
+	for ctx.Err() == nil {
+		deliveries, err := d.Webhooks.Due(time.Now(), 50)
+		if err != nil {
+			d.Logger.Error("loading due webhook deliveries", "error", err.Error())
+			return
+		}
+
+		for _, delivery := range deliveries {
+			d.send(ctx, delivery)
+		}
+
+		if len(deliveries) < 50 {
+			return
+		}
+	}
+}
+
+// send makes an attempt of a delivery and saves its result
+func (d *Dispatcher) send(ctx context.Context, delivery models.WebhookDelivery) {
+	webhook, err := d.Webhooks.GetWebhook(delivery.WebhookID)
+	if err != nil && !errors.Is(err, models.ErrNoRecord) {
+		d.Logger.Error("loading webhook", "webhook", delivery.WebhookID, "error", err.Error())
+		return
+	}
+
+	delivery.Attempts++
+
+	if err != nil || !webhook.Active {
+		delivery.Status = models.DeliveryFailed
+		delivery.NextAttemptAt = nil
+		delivery.Error = "webhook is disabled"
+
+		if err := d.Webhooks.SaveDelivery(delivery); err != nil {
+			d.Logger.Error("saving webhook delivery", "delivery", delivery.ID, "error", err.Error())
+		}
+		return
+	}
+
+	status, err := d.post(ctx, webhook, delivery)
+	succeeded := err == nil && status >= 200 && status < 300
+
+	now := time.Now()
+	delivery.ResponseStatus = status
+	delivery.Error = ""
+	if err != nil {
+		delivery.Error = err.Error()
+	}
+
+	switch {
+	case succeeded:
+		delivery.Status = models.DeliverySucceeded
+		delivery.DeliveredAt = &now
+		delivery.NextAttemptAt = nil
+	case delivery.Attempts >= d.MaxAttempts:
+		delivery.Status = models.DeliveryFailed
+		delivery.NextAttemptAt = nil
+	default:
+		next := now.Add(retry.Backoff(d.Backoff, d.MaxBackoff, delivery.Attempts))
+		delivery.NextAttemptAt = &next
+	}
+
+	disabled, err := d.Webhooks.SaveAttempt(delivery, succeeded, d.MaxFailures)
+	if err != nil {
+		d.Logger.Error("saving webhook delivery", "delivery", delivery.ID, "error", err.Error())
+		return
+	}
+
+	if disabled {
+		d.Logger.Warn("webhook disabled after repeated failures", "webhook", webhook.ID, "url", webhook.URL)
+	}
+}
+
+// post sends the payload of a delivery and returns the status of the
+// response. The body is not kept, so the endpoints cannot be used to read
+// other servers.
+func (d *Dispatcher) post(ctx context.Context, webhook models.Webhook, delivery models.WebhookDelivery) (int, error) {
+	payload := []byte(delivery.Payload)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(payload))
+	if err != nil {
+		return 0, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "movies-api-webhooks")
+	req.Header.Set(HeaderEvent, delivery.EventType)
+	req.Header.Set(HeaderID, delivery.EventID)
+	req.Header.Set(HeaderSignature, Sign(webhook.Secret, time.Now(), payload))
+
+	res, err := d.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	// Read a bit of the body so the connection can be reused
+	io.Copy(io.Discard, io.LimitReader(res.Body, 4096))
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return res.StatusCode, fmt.Errorf("endpoint responded %s", res.Status)
+	}
+
+	return res.StatusCode, nil
+}